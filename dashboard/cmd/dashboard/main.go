@@ -17,6 +17,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -37,8 +39,20 @@ func main() {
 	}
 	promAPI := v1.NewAPI(client)
 
+	// Label the dashboard's own metrics with its environment and cluster
+	if len(cfg.MetricLabels) > 0 {
+		prometheus.DefaultRegisterer = prometheus.WrapRegistererWith(cfg.MetricLabels, prometheus.DefaultRegisterer)
+	}
+
 	// Create metrics collector
-	metricsCollector := metrics.NewCollector(promAPI, cfg.OllamaURL)
+	metricsCollector := metrics.NewCollector(promAPI, cfg.OllamaURL, cfg.ProxyHealthURL, metrics.QueryOptions{
+		InstantTimeout: cfg.PrometheusQueryTimeout,
+		RangeTimeout:   cfg.PrometheusRangeQueryTimeout,
+		SlowThreshold:  cfg.PrometheusSlowQueryThreshold,
+	}, metrics.StatusOptions{
+		Model:    cfg.StatusModel,
+		Interval: cfg.StatusInterval,
+	}, cfg.RequestRateWindow)
 
 	// Create WebSocket hub
 	wsHub := websocket.NewHub()
@@ -49,6 +63,9 @@ func main() {
 
 	// Create router
 	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
 
 	// Load HTML templates
 	router.LoadHTMLGlob("web/templates/*")
@@ -64,6 +81,7 @@ func main() {
 	// Routes
 	router.GET("/", dashboardHandler.Index)
 	router.GET("/ws", wsHandler.HandleWebSocket)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	// API endpoints
 	api := router.Group("/api")
@@ -72,6 +90,8 @@ func main() {
 		api.GET("/metrics/summary", apiHandler.GetMetricsSummary)
 		api.GET("/metrics/timeseries", apiHandler.GetTimeSeriesData)
 		api.GET("/status", apiHandler.GetAIStatus)
+		api.GET("/cost", apiHandler.GetCost)
+		api.GET("/models", apiHandler.GetModels)
 		api.GET("/health", apiHandler.Health)
 	}
 
@@ -107,7 +127,9 @@ func main() {
 	log.Println("Server exited")
 }
 
-// startMetricsBroadcaster broadcasts metrics updates to all connected clients
+// startMetricsBroadcaster broadcasts metrics updates to all connected
+// clients. Ticks with nobody connected are skipped, so an unwatched dashboard
+// neither queries Prometheus nor spends LLM time on status summaries.
 func startMetricsBroadcaster(collector *metrics.Collector, hub *websocket.Hub) {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
@@ -115,33 +137,42 @@ func startMetricsBroadcaster(collector *metrics.Collector, hub *websocket.Hub) {
 	for {
 		select {
 		case <-ticker.C:
+			if hub.ClientCount() == 0 {
+				continue
+			}
+
 			// Get latest metrics
-			summary, err := collector.GetSummaryMetrics()
+			summary, err := collector.GetSummaryMetrics("")
 			if err != nil {
 				log.Printf("Error getting summary metrics: %v", err)
 				continue
 			}
 
-			percentiles, err := collector.GetLatencyPercentiles()
+			percentiles, err := collector.GetLatencyPercentiles("")
 			if err != nil {
 				log.Printf("Error getting latency percentiles: %v", err)
 			}
 
-			highPriorityPercentiles, err := collector.GetHighPriorityLatencyPercentiles()
+			highPriorityPercentiles, err := collector.GetHighPriorityLatencyPercentiles("")
 			if err != nil {
 				log.Printf("Error getting high priority percentiles: %v", err)
 			}
 
+			normalPriorityPercentiles, err := collector.GetNormalPriorityLatencyPercentiles("")
+			if err != nil {
+				log.Printf("Error getting normal priority percentiles: %v", err)
+			}
+
 			aiStatus, isAIGenerated := collector.GenerateAIStatus(summary, percentiles)
 
-			hub.Broadcast(gin.H{
-				"summary":             summary,
-				"latency_percentiles": percentiles,
-				"high_priority_percentiles": highPriorityPercentiles,
-				"ai_status":          aiStatus,
-				"ai_generated":       isAIGenerated,
-				"timestamp":          time.Now().Format(time.RFC3339),
-			})
+			hub.Broadcast(websocket.NewMessage(websocket.TypeMetrics, websocket.MetricsVersion, websocket.MetricsPayload{
+				Summary:                   summary,
+				LatencyPercentiles:        percentiles,
+				HighPriorityPercentiles:   highPriorityPercentiles,
+				NormalPriorityPercentiles: normalPriorityPercentiles,
+				AIStatus:                  aiStatus,
+				IsAIGenerated:             isAIGenerated,
+			}))
 		}
 	}
 }
\ No newline at end of file
@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/atyronesmith/llamastack-prometheus/dashboard/internal/metrics"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/common/model"
 )
 
 // APIHandler handles API endpoints
@@ -21,9 +23,11 @@ func NewAPIHandler(collector *metrics.Collector) *APIHandler {
 	}
 }
 
-// GetMetrics returns all metrics
+// GetMetrics returns all metrics, for ?model= or, by default, all models
 func (h *APIHandler) GetMetrics(c *gin.Context) {
-	summary, err := h.collector.GetSummaryMetrics()
+	modelName := c.Query("model")
+
+	summary, err := h.collector.GetSummaryMetrics(modelName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -31,7 +35,7 @@ func (h *APIHandler) GetMetrics(c *gin.Context) {
 		return
 	}
 
-	percentiles, err := h.collector.GetLatencyPercentiles()
+	percentiles, err := h.collector.GetLatencyPercentiles(modelName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -46,9 +50,12 @@ func (h *APIHandler) GetMetrics(c *gin.Context) {
 	})
 }
 
-// GetMetricsSummary returns summary metrics
+// GetMetricsSummary returns summary metrics, for ?model= or, by default,
+// all models
 func (h *APIHandler) GetMetricsSummary(c *gin.Context) {
-	summary, err := h.collector.GetSummaryMetrics()
+	modelName := c.Query("model")
+
+	summary, err := h.collector.GetSummaryMetrics(modelName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -56,7 +63,7 @@ func (h *APIHandler) GetMetricsSummary(c *gin.Context) {
 		return
 	}
 
-	percentiles, err := h.collector.GetLatencyPercentiles()
+	percentiles, err := h.collector.GetLatencyPercentiles(modelName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -64,25 +71,33 @@ func (h *APIHandler) GetMetricsSummary(c *gin.Context) {
 		return
 	}
 
-	highPriorityPercentiles, err := h.collector.GetHighPriorityLatencyPercentiles()
+	highPriorityPercentiles, err := h.collector.GetHighPriorityLatencyPercentiles(modelName)
 	if err != nil {
 		log.Printf("Error getting high priority percentiles: %v", err)
 		highPriorityPercentiles = nil
 	}
 
+	normalPriorityPercentiles, err := h.collector.GetNormalPriorityLatencyPercentiles(modelName)
+	if err != nil {
+		log.Printf("Error getting normal priority percentiles: %v", err)
+		normalPriorityPercentiles = nil
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"summary":             summary,
 		"latency_percentiles": percentiles,
 		"high_priority_percentiles": highPriorityPercentiles,
+		"normal_priority_percentiles": normalPriorityPercentiles,
 		"timestamp":          time.Now().Format(time.RFC3339),
 	})
 }
 
-// GetTimeSeriesData returns time series data for graphs
+// GetTimeSeriesData returns time series data for graphs, for ?model= or, by
+// default, all models
 func (h *APIHandler) GetTimeSeriesData(c *gin.Context) {
 	hours := 1 // Default to 1 hour
 
-	data, err := h.collector.GetTimeSeriesData(hours)
+	data, err := h.collector.GetTimeSeriesData(hours, c.Query("model"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -98,7 +113,7 @@ func (h *APIHandler) GetTimeSeriesData(c *gin.Context) {
 
 // GetAIStatus returns the AI-generated status
 func (h *APIHandler) GetAIStatus(c *gin.Context) {
-	summary, err := h.collector.GetSummaryMetrics()
+	summary, err := h.collector.GetSummaryMetrics("")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -106,7 +121,7 @@ func (h *APIHandler) GetAIStatus(c *gin.Context) {
 		return
 	}
 
-	percentiles, err := h.collector.GetLatencyPercentiles()
+	percentiles, err := h.collector.GetLatencyPercentiles("")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -123,6 +138,57 @@ func (h *APIHandler) GetAIStatus(c *gin.Context) {
 	})
 }
 
+// GetCost returns token spend and request counts over ?range= (a Prometheus
+// duration such as 24h or 7d, default 24h), grouped by ?by=user or model
+// (default model), with a time series per group for charting
+func (h *APIHandler) GetCost(c *gin.Context) {
+	window := 24 * time.Hour
+	if r := c.Query("range"); r != "" {
+		d, err := model.ParseDuration(r)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "range must be a positive duration such as 24h or 7d",
+			})
+			return
+		}
+		window = time.Duration(d)
+	}
+
+	report, err := h.collector.GetCost(window, c.DefaultQuery("by", "model"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, metrics.ErrInvalidGrouping) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cost":      report,
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// GetModels returns the models seen in the proxy's metrics, for choosing
+// the ?model= of the metrics endpoints
+func (h *APIHandler) GetModels(c *gin.Context) {
+	models, err := h.collector.GetModels()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"models":    models,
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
 // Health returns the health status of the dashboard
 func (h *APIHandler) Health(c *gin.Context) {
 	// Simple health check for now
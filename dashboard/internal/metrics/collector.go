@@ -9,22 +9,51 @@ import (
 	"log"
 	"math"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
+	"github.com/atyronesmith/llamastack-prometheus/dashboard/pkg/ratelog"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
 )
 
+// QueryOptions bounds the Prometheus queries the collector runs
+type QueryOptions struct {
+	// InstantTimeout bounds each instant query
+	InstantTimeout time.Duration
+	// RangeTimeout bounds each range query
+	RangeTimeout time.Duration
+	// SlowThreshold is the duration above which a query is logged and
+	// counted as slow; zero disables the check
+	SlowThreshold time.Duration
+}
+
+// StatusOptions controls the AI-generated status summary
+type StatusOptions struct {
+	// Model is the Ollama model asked to write the summary
+	Model string
+	// Interval is the least time between two generations; in between, the
+	// last summary is reused
+	Interval time.Duration
+}
+
 // Collector handles metrics collection from Prometheus and AI status generation
 type Collector struct {
 	promAPI    v1.API
 	ollamaURL  string
 	httpClient *http.Client
+	queryOpts  QueryOptions
+	statusOpts StatusOptions
 
-	// Request history for local rate calculation
+	// proxyHealthURL is the proxy's /health on its metrics port
+	proxyHealthURL string
+
+	// Request history for local rate calculation; points older than
+	// historyWindow are dropped so a rate never spans an idle gap
 	requestHistory []requestDataPoint
+	historyWindow  time.Duration
 	historyMutex   sync.RWMutex
 
 	// AI status generation state
@@ -33,6 +62,15 @@ type Collector struct {
 	requestInProgress   bool
 	consecutiveTimeouts int
 	statusMutex         sync.RWMutex
+
+	// errLog keeps repeated query failures from flooding the log while
+	// Prometheus is unreachable
+	errLog *ratelog.Logger
+	// slowLog does the same for queries that are persistently slow
+	slowLog *ratelog.Logger
+	// slowQueries counts Prometheus queries that exceeded the slow query
+	// threshold, including those that timed out
+	slowQueries *prometheus.CounterVec
 }
 
 type requestDataPoint struct {
@@ -41,12 +79,27 @@ type requestDataPoint struct {
 }
 
 // NewCollector creates a new metrics collector
-func NewCollector(promAPI v1.API, ollamaURL string) *Collector {
+func NewCollector(promAPI v1.API, ollamaURL, proxyHealthURL string, queryOpts QueryOptions, statusOpts StatusOptions, historyWindow time.Duration) *Collector {
 	return &Collector{
-		promAPI:    promAPI,
-		ollamaURL:  ollamaURL,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+		promAPI:       promAPI,
+		ollamaURL:     ollamaURL,
+		proxyHealthURL: proxyHealthURL,
+		httpClient:    &http.Client{Timeout: 30 * time.Second},
+		queryOpts:     queryOpts,
+		statusOpts:    statusOpts,
+		historyWindow: historyWindow,
 		lastStatus: "System operational",
+		errLog:     ratelog.New(5 * time.Minute),
+		slowLog:    ratelog.New(5 * time.Minute),
+		// Registered here rather than at package init so it picks up
+		// the constant labels main sets on the default registerer
+		slowQueries: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llama_dashboard_prometheus_slow_queries_total",
+				Help: "Prometheus queries that took longer than the slow query threshold",
+			},
+			[]string{"type"},
+		),
 	}
 }
 
@@ -58,155 +111,177 @@ func toMetricValue(val float64) interface{} {
 	return val
 }
 
-// GetSummaryMetrics retrieves summary metrics from Prometheus
-func (c *Collector) GetSummaryMetrics() (map[string]interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	metrics := make(map[string]interface{})
-
-	// Request rate
-	requestRate, err := c.calculateRequestRate(ctx)
-	if err != nil {
-		log.Printf("Error calculating request rate: %v", err)
-	}
-	metrics["request_rate"] = toMetricValue(requestRate)
-
-	// Average latency
-	avgLatency, err := c.queryScalar(ctx, `sum(rate(ollama_proxy_request_duration_seconds_sum{endpoint="/api/generate"}[5m])) / sum(rate(ollama_proxy_request_duration_seconds_count{endpoint="/api/generate"}[5m]))`)
-	if err != nil {
-		log.Printf("Error querying average latency: %v", err)
-	}
-	metrics["avg_latency"] = toMetricValue(avgLatency)
-
-	// Success rate
-	successRate, err := c.calculateSuccessRate(ctx)
-	if err != nil {
-		log.Printf("Error calculating success rate: %v", err)
-	}
-	metrics["success_rate"] = toMetricValue(successRate)
-
-	// Token generation rate
-	tokenRate, err := c.queryScalar(ctx, `rate(ollama_proxy_generated_tokens_total[5m])`)
-	if err != nil {
-		log.Printf("Error querying token rate: %v", err)
-	}
-	metrics["tokens_per_second"] = toMetricValue(tokenRate)
-
-	// GPU utilization
-	gpuUtil, err := c.queryScalar(ctx, `ollama_proxy_gpu_active_residency_percent`)
-	if err != nil {
-		log.Printf("Error querying GPU utilization: %v", err)
-	}
-	metrics["gpu_utilization"] = toMetricValue(gpuUtil)
+// summaryConcurrency bounds how many summary queries run against Prometheus
+// at once
+const summaryConcurrency = 4
+
+// summaryQuery is one metric of the dashboard summary
+type summaryQuery struct {
+	metric string
+	// action describes the query in error logs
+	action string
+	// query is evaluated with queryScalar unless value is set
+	query string
+	value func(ctx context.Context) (float64, error)
+	// convert shapes the result for JSON; nil uses toMetricValue
+	convert func(float64) interface{}
+}
 
-	// Power consumption (convert from milliwatts to watts)
-	powerMilliwatts, err := c.queryScalar(ctx, `ollama_proxy_cpu_power_milliwatts`)
-	if err != nil {
-		log.Printf("Error querying power consumption: %v", err)
-	}
-	metrics["power_consumption"] = toMetricValue(powerMilliwatts / 1000.0)
+func asInt(val float64) interface{} {
+	return int(val)
+}
 
-	// Memory usage - track just the main Ollama serve process, not all runners
-	memoryBytes, err := c.queryScalar(ctx, `ollama_proxy_ollama_serve_memory_bytes`)
-	if err != nil {
-		log.Printf("Error querying memory: %v", err)
-		memoryBytes = 0.0
+// summaryQueries lists the Prometheus-backed metrics of the summary. Request
+// and token metrics are narrowed to modelName when it is set; system metrics
+// have no model label and always cover the whole host.
+func (c *Collector) summaryQueries(modelName string) []summaryQuery {
+	generateSel := modelSelector(modelName, `endpoint="/api/generate"`)
+	return []summaryQuery{
+		{metric: "request_rate", action: "calculating request rate",
+			value: func(ctx context.Context) (float64, error) { return c.calculateRequestRate(ctx, modelName) }},
+		{metric: "avg_latency", action: "querying average latency",
+			query: fmt.Sprintf(`sum(rate(ollama_proxy_request_duration_seconds_sum%s[5m])) / sum(rate(ollama_proxy_request_duration_seconds_count%s[5m]))`, generateSel, generateSel)},
+		{metric: "success_rate", action: "calculating success rate",
+			value: func(ctx context.Context) (float64, error) { return c.calculateSuccessRate(ctx, modelName) }},
+		{metric: "tokens_per_second", action: "querying token rate", query: fmt.Sprintf(`sum(rate(ollama_proxy_generated_tokens_total%s[5m]))`, modelSelector(modelName))},
+		// Highest per-model throughput of the most recent request
+		{metric: "last_tokens_per_second", action: "querying last token rate", query: fmt.Sprintf(`max(ollama_proxy_last_tokens_per_second%s)`, modelSelector(modelName))},
+		{metric: "gpu_utilization", action: "querying GPU utilization", query: `ollama_proxy_gpu_active_residency_percent`},
+		// Power consumption in watts
+		{metric: "power_consumption", action: "querying power consumption", query: `ollama_proxy_cpu_power_watts`},
+		// Thermal pressure, 0 (nominal) to 1 (critical)
+		{metric: "thermal_pressure", action: "querying thermal pressure", query: `ollama_proxy_thermal_pressure`},
+		// Memory usage - track just the main Ollama serve process, not all
+		// runners, converted to MB
+		{metric: "memory_usage", action: "querying memory", query: `ollama_proxy_ollama_serve_memory_bytes`,
+			convert: func(val float64) interface{} { return toMetricValue(val / (1024 * 1024)) }},
+		{metric: "active_requests", action: "querying active requests", query: fmt.Sprintf(`sum(ollama_proxy_active_requests%s)`, modelSelector(modelName)), convert: asInt},
+		{metric: "queue_size", action: "querying queue size", query: `ollama_proxy_queue_size`, convert: asInt},
+		{metric: "queue_processing_rate", action: "querying queue processing rate", query: `ollama_proxy_queue_processing_rate`},
+		{metric: "max_queue_size", action: "querying peak queue size", query: `ollama_proxy_queue_peak_size`, convert: asInt},
+		{metric: "direct_requests", action: "querying total requests", query: fmt.Sprintf(`sum(ollama_proxy_requests_total%s)`, modelSelector(modelName)), convert: asInt},
 	}
-	metrics["memory_usage"] = toMetricValue(memoryBytes / (1024 * 1024)) // Convert to MB
+}
 
-	// Active requests
-	activeReqs, err := c.queryScalar(ctx, `sum(ollama_proxy_active_requests)`)
-	if err != nil {
-		log.Printf("Error querying active requests: %v", err)
+// GetSummaryMetrics retrieves summary metrics from Prometheus. The queries
+// run concurrently, so a refresh takes about as long as the slowest one. A
+// metric whose query fails is left nil and its error is reported under
+// "errors", keyed by metric name, so clients can tell a failed query from a
+// real zero. An empty modelName aggregates over all models.
+func (c *Collector) GetSummaryMetrics(modelName string) (map[string]interface{}, error) {
+	ctx := context.Background()
+
+	queries := c.summaryQueries(modelName)
+	values := make([]float64, len(queries))
+	queryErrs := make([]error, len(queries))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, summaryConcurrency)
+
+	for i, q := range queries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, q summaryQuery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if q.value != nil {
+				values[i], queryErrs[i] = q.value(ctx)
+			} else {
+				values[i], queryErrs[i] = c.queryScalar(ctx, q.query)
+			}
+		}(i, q)
 	}
-	metrics["active_requests"] = int(activeReqs)
 
-	// Queue metrics
-	queueSize, err := c.queryScalar(ctx, `ollama_proxy_queue_size`)
-	if err == nil {
-		metrics["queue_size"] = int(queueSize)
-	}
+	// The health checks hit Ollama and the proxy rather than Prometheus, so
+	// they don't take a query slot
+	var ollamaStatus, proxyStatus map[string]interface{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		ollamaStatus = c.checkOllamaHealth()
+	}()
+	go func() {
+		defer wg.Done()
+		proxyStatus = c.checkProxyHealth()
+	}()
 
-	queueRate, err := c.queryScalar(ctx, `ollama_proxy_queue_processing_rate`)
-	if err == nil {
-		metrics["queue_processing_rate"] = queueRate
-	}
+	wg.Wait()
 
-	maxQueueSize, err := c.queryScalar(ctx, `ollama_proxy_queue_peak_size`)
-	if err == nil {
-		metrics["max_queue_size"] = int(maxQueueSize)
+	metrics := make(map[string]interface{})
+	errs := make(map[string]string)
+
+	for i, q := range queries {
+		c.errLog.Report(q.action, queryErrs[i])
+		if queryErrs[i] != nil {
+			errs[q.metric] = queryErrs[i].Error()
+			metrics[q.metric] = nil
+			continue
+		}
+		convert := q.convert
+		if convert == nil {
+			convert = toMetricValue
+		}
+		metrics[q.metric] = convert(values[i])
 	}
 
-	// Check Ollama health
-	metrics["ollama_status"] = c.checkOllamaHealth()
-
-	// Check Proxy health
-	metrics["proxy_status"] = c.checkProxyHealth()
-
-	// Direct requests count
-	totalRequests, err := c.queryScalar(ctx, `ollama_proxy_requests_total`)
-	if err != nil {
-		log.Printf("Error querying total requests: %v", err)
-	}
-	metrics["direct_requests"] = int(totalRequests)
+	metrics["ollama_status"] = ollamaStatus
+	metrics["proxy_status"] = proxyStatus
 	metrics["routing_ratio"] = 0 // No routing in this setup
+	metrics["errors"] = errs
 
 	return metrics, nil
 }
 
-// GetLatencyPercentiles retrieves latency percentiles from Prometheus
-func (c *Collector) GetLatencyPercentiles() (map[string]interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	percentiles := make(map[string]interface{})
-	quantiles := []int{50, 75, 95, 99}
-
-	for _, p := range quantiles {
-		quantile := float64(p) / 100.0
-		query := fmt.Sprintf(`histogram_quantile(%f, rate(ollama_proxy_request_duration_seconds_bucket[5m]))`, quantile)
+// GetLatencyPercentiles retrieves latency percentiles from Prometheus, for
+// modelName or, when empty, all models
+func (c *Collector) GetLatencyPercentiles(modelName string) (map[string]interface{}, error) {
+	return c.latencyPercentiles("ollama_proxy_request_duration_seconds", "", modelName), nil
+}
 
-		value, err := c.queryScalar(ctx, query)
-		if err != nil {
-			log.Printf("Error querying p%d: %v", p, err)
-			percentiles[fmt.Sprintf("p%d", p)] = nil
-		} else {
-			percentiles[fmt.Sprintf("p%d", p)] = toMetricValue(value)
-		}
-	}
+// GetHighPriorityLatencyPercentiles retrieves latency percentiles for high
+// priority requests, for modelName or, when empty, all models
+func (c *Collector) GetHighPriorityLatencyPercentiles(modelName string) (map[string]interface{}, error) {
+	return c.latencyPercentiles("ollama_proxy_high_priority_request_duration_seconds", "high priority ", modelName), nil
+}
 
-	return percentiles, nil
+// GetNormalPriorityLatencyPercentiles retrieves latency percentiles for
+// normal priority requests, for modelName or, when empty, all models
+func (c *Collector) GetNormalPriorityLatencyPercentiles(modelName string) (map[string]interface{}, error) {
+	return c.latencyPercentiles("ollama_proxy_normal_priority_request_duration_seconds", "normal priority ", modelName), nil
 }
 
-// GetHighPriorityLatencyPercentiles retrieves latency percentiles for high priority requests
-func (c *Collector) GetHighPriorityLatencyPercentiles() (map[string]interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// latencyPercentiles returns p50, p75, p95 and p99 of a duration histogram,
+// leaving a percentile nil when its query fails. tier prefixes the query
+// names in error logs.
+func (c *Collector) latencyPercentiles(histogram, tier, modelName string) map[string]interface{} {
+	ctx := context.Background()
 
 	percentiles := make(map[string]interface{})
 	quantiles := []int{50, 75, 95, 99}
 
 	for _, p := range quantiles {
 		quantile := float64(p) / 100.0
-		query := fmt.Sprintf(`histogram_quantile(%f, rate(ollama_proxy_high_priority_request_duration_seconds_bucket[5m]))`, quantile)
+		// Buckets are summed across the other labels so the percentile
+		// covers every matching series, not one of them
+		query := fmt.Sprintf(`histogram_quantile(%f, sum by (le) (rate(%s_bucket%s[5m])))`, quantile, histogram, modelSelector(modelName))
 
 		value, err := c.queryScalar(ctx, query)
+		c.errLog.Report(fmt.Sprintf("querying %sp%d", tier, p), err)
 		if err != nil {
-			log.Printf("Error querying high priority p%d: %v", p, err)
 			percentiles[fmt.Sprintf("p%d", p)] = nil
 		} else {
 			percentiles[fmt.Sprintf("p%d", p)] = toMetricValue(value)
 		}
 	}
 
-	return percentiles, nil
+	return percentiles
 }
 
-// GetTimeSeriesData retrieves time series data for charts
-func (c *Collector) GetTimeSeriesData(hours int) (map[string]interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// GetTimeSeriesData retrieves time series data for charts. The token rate is
+// narrowed to modelName when it is set; the system charts cover the host.
+func (c *Collector) GetTimeSeriesData(hours int, modelName string) (map[string]interface{}, error) {
+	ctx := context.Background()
 
 	endTime := time.Now()
 	startTime := endTime.Add(-time.Duration(hours) * time.Hour)
@@ -214,34 +289,30 @@ func (c *Collector) GetTimeSeriesData(hours int) (map[string]interface{}, error)
 	data := make(map[string]interface{})
 
 	// Token generation rate
-	tokensData, err := c.queryRange(ctx, `rate(ollama_proxy_generated_tokens_total[1m])`, startTime, endTime)
-	if err != nil {
-		log.Printf("Error querying tokens time series: %v", err)
-	} else {
+	tokensData, err := c.queryRange(ctx, fmt.Sprintf(`sum(rate(ollama_proxy_generated_tokens_total%s[1m]))`, modelSelector(modelName)), startTime, endTime)
+	c.errLog.Report("querying tokens time series", err)
+	if err == nil {
 		data["tokens_per_second"] = tokensData
 	}
 
 	// Memory usage
 	memoryData, err := c.queryRange(ctx, `ollama_proxy_memory_usage_bytes / 1024 / 1024`, startTime, endTime)
-	if err != nil {
-		log.Printf("Error querying memory time series: %v", err)
-	} else {
+	c.errLog.Report("querying memory time series", err)
+	if err == nil {
 		data["memory_usage"] = memoryData
 	}
 
 	// GPU utilization
 	gpuData, err := c.queryRange(ctx, `ollama_proxy_gpu_active_residency_percent`, startTime, endTime)
-	if err != nil {
-		log.Printf("Error querying GPU time series: %v", err)
-	} else {
+	c.errLog.Report("querying GPU time series", err)
+	if err == nil {
 		data["gpu_utilization"] = gpuData
 	}
 
-	// Power consumption (convert from milliwatts to watts)
-	powerData, err := c.queryRange(ctx, `ollama_proxy_cpu_power_milliwatts / 1000`, startTime, endTime)
-	if err != nil {
-		log.Printf("Error querying power time series: %v", err)
-	} else {
+	// Power consumption in watts
+	powerData, err := c.queryRange(ctx, `ollama_proxy_cpu_power_watts`, startTime, endTime)
+	c.errLog.Report("querying power time series", err)
+	if err == nil {
 		data["power_consumption"] = powerData
 	}
 
@@ -282,8 +353,8 @@ func (c *Collector) GenerateAIStatus(summary map[string]interface{}, percentiles
 		return c.lastStatus, true
 	}
 
-	// Only generate every 15 seconds
-	if time.Since(c.lastGenerationTime) < 15*time.Second {
+	// Only generate once per status interval
+	if time.Since(c.lastGenerationTime) < c.statusOpts.Interval {
 		return c.lastStatus, true
 	}
 
@@ -325,9 +396,15 @@ func (c *Collector) GenerateAIStatus(summary map[string]interface{}, percentiles
 
 // Helper functions
 
-func (c *Collector) calculateRequestRate(ctx context.Context) (float64, error) {
+func (c *Collector) calculateRequestRate(ctx context.Context, modelName string) (float64, error) {
+	// The local history tracks all models, so a single model's rate comes
+	// straight from Prometheus
+	if modelName != "" {
+		return c.queryScalar(ctx, fmt.Sprintf(`sum(rate(ollama_proxy_requests_total%s[2m]))`, modelSelector(modelName)))
+	}
+
 	// Get current total requests
-	totalRequests, err := c.queryScalar(ctx, `ollama_proxy_requests_total`)
+	totalRequests, err := c.queryScalar(ctx, `sum(ollama_proxy_requests_total)`)
 	if err != nil {
 		return 0.0, err
 	}
@@ -342,7 +419,7 @@ func (c *Collector) calculateRequestRate(ctx context.Context) (float64, error) {
 	}
 
 	// Try Prometheus rate
-	rate, err := c.queryScalar(ctx, `rate(ollama_proxy_requests_total[2m])`)
+	rate, err := c.queryScalar(ctx, `sum(rate(ollama_proxy_requests_total[2m]))`)
 	if err != nil {
 		return 0.0, err
 	}
@@ -354,11 +431,21 @@ func (c *Collector) updateRequestHistory(totalRequests float64) {
 	c.historyMutex.Lock()
 	defer c.historyMutex.Unlock()
 
+	now := time.Now()
 	c.requestHistory = append(c.requestHistory, requestDataPoint{
-		timestamp:    time.Now(),
+		timestamp:    now,
 		totalRequests: totalRequests,
 	})
 
+	// Drop points from before the window, e.g. left over from before an
+	// idle period when nobody had the dashboard open
+	cutoff := now.Add(-c.historyWindow)
+	stale := 0
+	for stale < len(c.requestHistory) && c.requestHistory[stale].timestamp.Before(cutoff) {
+		stale++
+	}
+	c.requestHistory = c.requestHistory[stale:]
+
 	// Keep only last 20 data points
 	if len(c.requestHistory) > 20 {
 		c.requestHistory = c.requestHistory[len(c.requestHistory)-20:]
@@ -385,13 +472,13 @@ func (c *Collector) calculateLocalRequestRate() float64 {
 	return requestDiff / timeDiff
 }
 
-func (c *Collector) calculateSuccessRate(ctx context.Context) (float64, error) {
-	successRate, err := c.queryScalar(ctx, `rate(ollama_proxy_requests_total{status="200"}[5m])`)
+func (c *Collector) calculateSuccessRate(ctx context.Context, modelName string) (float64, error) {
+	successRate, err := c.queryScalar(ctx, fmt.Sprintf(`sum(rate(ollama_proxy_requests_total%s[5m]))`, modelSelector(modelName, `status="200"`)))
 	if err != nil {
 		return 0.0, err
 	}
 
-	totalRate, err := c.queryScalar(ctx, `rate(ollama_proxy_requests_total[5m])`)
+	totalRate, err := c.queryScalar(ctx, fmt.Sprintf(`sum(rate(ollama_proxy_requests_total%s[5m]))`, modelSelector(modelName)))
 	if err != nil {
 		return 0.0, err
 	}
@@ -404,7 +491,12 @@ func (c *Collector) calculateSuccessRate(ctx context.Context) (float64, error) {
 }
 
 func (c *Collector) queryScalar(ctx context.Context, query string) (float64, error) {
-	result, _, err := c.promAPI.Query(ctx, query, time.Now())
+	ctx, cancel := context.WithTimeout(ctx, c.queryOpts.InstantTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result, _, err := c.promAPI.Query(ctx, query, start)
+	c.checkQueryDuration("instant", query, time.Since(start))
 	if err != nil {
 		return 0.0, err
 	}
@@ -428,7 +520,12 @@ func (c *Collector) queryRange(ctx context.Context, query string, start, end tim
 		Step:  30 * time.Second,
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, c.queryOpts.RangeTimeout)
+	defer cancel()
+
+	queryStart := time.Now()
 	result, _, err := c.promAPI.QueryRange(ctx, query, r)
+	c.checkQueryDuration("range", query, time.Since(queryStart))
 	if err != nil {
 		return nil, err
 	}
@@ -450,6 +547,25 @@ func (c *Collector) queryRange(ctx context.Context, query string, start, end tim
 	return data, nil
 }
 
+// checkQueryDuration logs and counts a query that took longer than the slow
+// query threshold. Queries that hit their timeout count as slow too, which is
+// usually why a chart goes blank.
+func (c *Collector) checkQueryDuration(queryType, query string, elapsed time.Duration) {
+	threshold := c.queryOpts.SlowThreshold
+	if threshold <= 0 {
+		return
+	}
+
+	key := fmt.Sprintf("running %s Prometheus query %s", queryType, query)
+	if elapsed < threshold {
+		c.slowLog.Report(key, nil)
+		return
+	}
+
+	c.slowQueries.WithLabelValues(queryType).Inc()
+	c.slowLog.Report(key, fmt.Errorf("slow query took %v (threshold %v)", elapsed.Round(time.Millisecond), threshold))
+}
+
 func (c *Collector) checkOllamaHealth() map[string]interface{} {
 	status := map[string]interface{}{
 		"status":        "unknown",
@@ -492,9 +608,8 @@ func (c *Collector) checkProxyHealth() map[string]interface{} {
 		"last_check":    time.Now().Unix(),
 	}
 
-	// Proxy health endpoint is on metrics port 8001
 	start := time.Now()
-	resp, err := c.httpClient.Get("http://localhost:8001/health")
+	resp, err := c.httpClient.Get(c.proxyHealthURL)
 	if err != nil {
 		status["status"] = "offline"
 		return status
@@ -599,7 +714,7 @@ Write a status summary:`,
 
 func (c *Collector) queryLLM(prompt string) (string, error) {
 	payload := map[string]interface{}{
-		"model":  "phi3:mini",
+		"model":  c.statusOpts.Model,
 		"prompt": prompt,
 		"stream": false,
 	}
@@ -627,7 +742,7 @@ func (c *Collector) queryLLM(prompt string) (string, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("LLM returned status %d", resp.StatusCode)
+		return "", fmt.Errorf("LLM %s returned status %d", c.statusOpts.Model, resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -645,27 +760,7 @@ func (c *Collector) queryLLM(prompt string) (string, error) {
 		return "", fmt.Errorf("invalid response format")
 	}
 
-	// Validate response
-	response = strings.TrimSpace(response)
-	if response == "" {
-		return "", fmt.Errorf("empty response")
-	}
-
-	// Check for error indicators
-	errorIndicators := []string{"sorry", "I need", "dictionary", "python", "document", "instruction"}
-	lowerResponse := strings.ToLower(response)
-	for _, indicator := range errorIndicators {
-		if strings.Contains(lowerResponse, indicator) {
-			return "", fmt.Errorf("invalid LLM response")
-		}
-	}
-
-	// Limit length
-	if len(response) > 500 {
-		response = response[:497] + "..."
-	}
-
-	return response, nil
+	return validateStatus(response)
 }
 
 func (c *Collector) generateFallbackStatus(summary map[string]interface{}) string {
@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atyronesmith/llamastack-prometheus/dashboard/pkg/ratelog"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// stubAPI answers instant queries with values from a map, after an optional
+// latency. The collector uses no other v1.API methods in these tests.
+type stubAPI struct {
+	v1.API
+
+	latency time.Duration
+	mu      sync.Mutex
+	values  map[string]float64
+	queries []string
+}
+
+func (s *stubAPI) set(query string, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[query] = value
+}
+
+func (s *stubAPI) Query(ctx context.Context, query string, ts time.Time, opts ...v1.Option) (model.Value, v1.Warnings, error) {
+	if s.latency > 0 {
+		select {
+		case <-time.After(s.latency):
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = append(s.queries, query)
+	value, ok := s.values[query]
+	if !ok {
+		return model.Vector{}, nil, nil
+	}
+	return model.Vector{&model.Sample{Value: model.SampleValue(value), Timestamp: model.TimeFromUnixNano(ts.UnixNano())}}, nil, nil
+}
+
+// newTestCollector builds a collector around api. NewCollector registers
+// its slow query counter with the default registry, so tests build the
+// struct directly to get a fresh one each time.
+func newTestCollector(api v1.API, ollamaURL, proxyHealthURL string, historyWindow time.Duration) *Collector {
+	return &Collector{
+		promAPI:        api,
+		ollamaURL:      ollamaURL,
+		proxyHealthURL: proxyHealthURL,
+		httpClient:     &http.Client{Timeout: time.Second},
+		queryOpts:      QueryOptions{InstantTimeout: time.Second, RangeTimeout: time.Second},
+		historyWindow:  historyWindow,
+		lastStatus:     "System operational",
+		errLog:         ratelog.New(time.Minute),
+		slowLog:        ratelog.New(time.Minute),
+		slowQueries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "llama_dashboard_prometheus_slow_queries_total",
+		}, []string{"type"}),
+	}
+}
+
+const (
+	totalQuery    = `sum(ollama_proxy_requests_total)`
+	fallbackQuery = `sum(rate(ollama_proxy_requests_total[2m]))`
+)
+
+func TestRequestRateDropsSamplesOlderThanWindow(t *testing.T) {
+	const window = 100 * time.Millisecond
+	const prometheusRate = 0.25
+
+	api := &stubAPI{values: map[string]float64{totalQuery: 100, fallbackQuery: prometheusRate}}
+	c := newTestCollector(api, "", "", window)
+	ctx := context.Background()
+
+	// One sample gives no local rate, so Prometheus' rate is used
+	if rate, err := c.calculateRequestRate(ctx, ""); err != nil || rate != prometheusRate {
+		t.Fatalf("first rate = %v, %v; want the Prometheus rate %v", rate, err, prometheusRate)
+	}
+
+	// Two samples inside the window give a local rate
+	time.Sleep(window / 4)
+	api.set(totalQuery, 110)
+	rate, err := c.calculateRequestRate(ctx, "")
+	if err != nil || rate <= prometheusRate {
+		t.Fatalf("second rate = %v, %v; want a local rate of about %v/s", rate, err, 10/(window/4).Seconds())
+	}
+
+	// After an idle gap longer than the window the earlier samples are
+	// dropped rather than averaged over the gap, and the rate falls back to
+	// Prometheus again
+	time.Sleep(2 * window)
+	rate, err = c.calculateRequestRate(ctx, "")
+	if err != nil || rate != prometheusRate {
+		t.Errorf("rate after the gap = %v, %v; want the Prometheus rate %v", rate, err, prometheusRate)
+	}
+	c.historyMutex.RLock()
+	kept := len(c.requestHistory)
+	c.historyMutex.RUnlock()
+	if kept != 1 {
+		t.Errorf("%d samples kept after the gap, want only the newest", kept)
+	}
+}
+
+func TestCalculateLocalRequestRate(t *testing.T) {
+	c := newTestCollector(nil, "", "", time.Minute)
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name    string
+		history []requestDataPoint
+		want    float64
+	}{
+		{"empty", nil, 0},
+		{"one sample", []requestDataPoint{{now, 5}}, 0},
+		{"oldest to newest", []requestDataPoint{{now.Add(-10 * time.Second), 100}, {now.Add(-5 * time.Second), 120}, {now, 150}}, 5},
+		{"same timestamp", []requestDataPoint{{now, 100}, {now, 150}}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c.requestHistory = tc.history
+			if got := c.calculateLocalRequestRate(); got != tc.want {
+				t.Errorf("calculateLocalRequestRate() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestModelRequestRateSkipsLocalHistory(t *testing.T) {
+	query := `sum(rate(ollama_proxy_requests_total{model="llama2:7b"}[2m]))`
+	api := &stubAPI{values: map[string]float64{query: 1.5}}
+	c := newTestCollector(api, "", "", time.Minute)
+
+	if rate, err := c.calculateRequestRate(context.Background(), "llama2:7b"); err != nil || rate != 1.5 {
+		t.Errorf("rate = %v, %v; want 1.5 from Prometheus", rate, err)
+	}
+	if len(c.requestHistory) != 0 {
+		t.Errorf("%d samples in the local history, want none for a model's rate", len(c.requestHistory))
+	}
+}
+
+// BenchmarkGetSummaryMetrics measures a summary refresh against a
+// Prometheus whose queries each take latency, so the benefit of running
+// them concurrently shows up as a refresh taking a few latencies rather than
+// one per query
+func BenchmarkGetSummaryMetrics(b *testing.B) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"healthy","models":[{"name":"llama2:7b"}]}`))
+	}))
+	defer ok.Close()
+
+	for _, latency := range []time.Duration{0, 5 * time.Millisecond, 20 * time.Millisecond} {
+		b.Run(latency.String(), func(b *testing.B) {
+			api := &stubAPI{latency: latency, values: map[string]float64{totalQuery: 100, fallbackQuery: 0.5}}
+			c := newTestCollector(api, ok.URL, ok.URL+"/health", time.Minute)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.GetSummaryMetrics(""); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestLabelledQueriesAggregate checks that queries over metrics with
+// per-request labels sum the series, since only the first series of a
+// result is read
+func TestLabelledQueriesAggregate(t *testing.T) {
+	labelled := []string{"ollama_proxy_requests_total", "ollama_proxy_generated_tokens_total", "ollama_proxy_active_requests", "_bucket"}
+
+	for _, model := range []string{"", "llama2:7b"} {
+		api := &stubAPI{values: map[string]float64{}}
+		c := newTestCollector(api, "", "", time.Minute)
+		c.GetSummaryMetrics(model)
+		c.GetLatencyPercentiles(model)
+
+		for _, query := range api.queries {
+			for _, name := range labelled {
+				if !strings.Contains(query, name) {
+					continue
+				}
+				aggregated := strings.HasPrefix(query, "sum(") || strings.HasPrefix(query, "sum by (")
+				if name == "_bucket" {
+					aggregated = strings.HasPrefix(query, "histogram_quantile(") && strings.Contains(query, "sum by (le) (rate(")
+				}
+				if !aggregated {
+					t.Errorf("model %q: query %s isn't aggregated across series", model, query)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// ErrInvalidGrouping is returned by GetCost for a grouping other than user
+// or model
+var ErrInvalidGrouping = errors.New(`cost can only be grouped by "user" or "model"`)
+
+// costSeriesPoints is roughly how many points the cost time series has,
+// whatever the range
+const costSeriesPoints = 60
+
+// CostGroup is the spend and request count of one user or model
+type CostGroup struct {
+	Name     string  `json:"name"`
+	Cost     float64 `json:"cost"`
+	Requests float64 `json:"requests"`
+}
+
+// CostReport is the token spend over a range, broken down by user or model
+type CostReport struct {
+	Range         string      `json:"range"`
+	By            string      `json:"by"`
+	Unit          string      `json:"unit"`
+	TotalCost     float64     `json:"total_cost"`
+	TotalRequests float64     `json:"total_requests"`
+	Groups        []CostGroup `json:"groups"`
+	// TimeSeries maps each group to its spend per step, as chart points
+	TimeSeries map[string][]map[string]interface{} `json:"timeseries"`
+	Step       string                              `json:"step"`
+	// Prices maps each model, and "default" for unlisted ones, to its
+	// prompt and completion price in cents per 1,000 tokens
+	Prices map[string]map[string]float64 `json:"prices"`
+}
+
+// GetCost totals ollama_proxy_token_cost_total and
+// ollama_proxy_user_requests_total over the last window, grouped by the
+// user or model label. increase() is used throughout so proxy restarts,
+// which reset the counters, don't show up as negative or lost spend.
+func (c *Collector) GetCost(window time.Duration, by string) (*CostReport, error) {
+	if by != "user" && by != "model" {
+		return nil, ErrInvalidGrouping
+	}
+	ctx := context.Background()
+	rng := model.Duration(window).String()
+
+	costs, err := c.queryByLabel(ctx, fmt.Sprintf(`sum by (%s) (increase(ollama_proxy_token_cost_total[%s]))`, by, rng), by)
+	if err != nil {
+		return nil, fmt.Errorf("querying cost: %w", err)
+	}
+	requests, err := c.queryByLabel(ctx, fmt.Sprintf(`sum by (%s) (increase(ollama_proxy_user_requests_total[%s]))`, by, rng), by)
+	if err != nil {
+		return nil, fmt.Errorf("querying requests: %w", err)
+	}
+
+	// Each point is the spend during the step that ends at it
+	step := window / costSeriesPoints
+	if step < time.Minute {
+		step = time.Minute
+	}
+	end := time.Now()
+	series, err := c.queryRangeByLabel(ctx,
+		fmt.Sprintf(`sum by (%s) (increase(ollama_proxy_token_cost_total[%s]))`, by, model.Duration(step)),
+		by, v1.Range{Start: end.Add(-window), End: end, Step: step})
+	if err != nil {
+		return nil, fmt.Errorf("querying cost time series: %w", err)
+	}
+
+	prices, err := c.queryPrices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("querying prices: %w", err)
+	}
+
+	report := &CostReport{
+		Range:      rng,
+		By:         by,
+		Unit:       "cents",
+		Groups:     []CostGroup{},
+		TimeSeries: series,
+		Step:       model.Duration(step).String(),
+		Prices:     prices,
+	}
+
+	names := make(map[string]bool)
+	for name := range costs {
+		names[name] = true
+	}
+	for name := range requests {
+		names[name] = true
+	}
+	for name := range names {
+		group := CostGroup{Name: name, Cost: costs[name], Requests: requests[name]}
+		report.Groups = append(report.Groups, group)
+		report.TotalCost += group.Cost
+		report.TotalRequests += group.Requests
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if report.Groups[i].Cost != report.Groups[j].Cost {
+			return report.Groups[i].Cost > report.Groups[j].Cost
+		}
+		return report.Groups[i].Name < report.Groups[j].Name
+	})
+
+	return report, nil
+}
+
+// queryPrices returns the token prices the proxy publishes in
+// ollama_proxy_token_price_cents, keyed by model and then token type
+func (c *Collector) queryPrices(ctx context.Context) (map[string]map[string]float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.queryOpts.InstantTimeout)
+	defer cancel()
+
+	query := `max by (model, type) (ollama_proxy_token_price_cents)`
+	start := time.Now()
+	result, _, err := c.promAPI.Query(ctx, query, start)
+	c.checkQueryDuration("instant", query, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]map[string]float64)
+	if vector, ok := result.(model.Vector); ok {
+		for _, sample := range vector {
+			name := groupName(sample.Metric, "model")
+			if prices[name] == nil {
+				prices[name] = make(map[string]float64)
+			}
+			prices[name][groupName(sample.Metric, "type")] = float64(sample.Value)
+		}
+	}
+	return prices, nil
+}
+
+// groupName returns a series' value for label, naming series without it
+// "unknown"
+func groupName(metric model.Metric, label string) string {
+	if name := string(metric[model.LabelName(label)]); name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// queryByLabel runs an instant query and returns each series' value keyed
+// by its label
+func (c *Collector) queryByLabel(ctx context.Context, query, label string) (map[string]float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.queryOpts.InstantTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result, _, err := c.promAPI.Query(ctx, query, start)
+	c.checkQueryDuration("instant", query, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]float64)
+	if vector, ok := result.(model.Vector); ok {
+		for _, sample := range vector {
+			values[groupName(sample.Metric, label)] += float64(sample.Value)
+		}
+	}
+	return values, nil
+}
+
+// queryRangeByLabel runs a range query and returns each series as chart
+// points keyed by its label
+func (c *Collector) queryRangeByLabel(ctx context.Context, query, label string, r v1.Range) (map[string][]map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.queryOpts.RangeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result, _, err := c.promAPI.QueryRange(ctx, query, r)
+	c.checkQueryDuration("range", query, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+
+	series := make(map[string][]map[string]interface{})
+	if matrix, ok := result.(model.Matrix); ok {
+		for _, stream := range matrix {
+			name := groupName(stream.Metric, label)
+			for _, pair := range stream.Values {
+				series[name] = append(series[name], map[string]interface{}{
+					"x": pair.Timestamp.Unix() * 1000, // Convert to milliseconds
+					"y": float64(pair.Value),
+				})
+			}
+		}
+	}
+	return series, nil
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// modelsLookback is how far back GetModels looks for models with requests
+const modelsLookback = 24 * time.Hour
+
+// modelSelector returns a PromQL label selector of matchers, plus a model
+// matcher when modelName is set, e.g. {endpoint="/api/generate",model="llama3"}.
+// It returns "" when there is nothing to match, leaving the query across all
+// series.
+func modelSelector(modelName string, matchers ...string) string {
+	if modelName != "" {
+		// PromQL string literals use Go's escaping rules
+		matchers = append(matchers, fmt.Sprintf("model=%q", modelName))
+	}
+	if len(matchers) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(matchers, ",") + "}"
+}
+
+// GetModels returns the models the proxy has served requests for in the last
+// modelsLookback, sorted by name
+func (c *Collector) GetModels() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.queryOpts.InstantTimeout)
+	defer cancel()
+
+	match := "ollama_proxy_requests_total"
+	end := time.Now()
+	values, _, err := c.promAPI.LabelValues(ctx, "model", []string{match}, end.Add(-modelsLookback), end)
+	c.checkQueryDuration("labels", match, time.Since(end))
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(values))
+	for _, value := range values {
+		models = append(models, string(value))
+	}
+	sort.Strings(models)
+	return models, nil
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxStatusLength is the longest status summary shown; longer ones are
+// truncated
+const maxStatusLength = 500
+
+// refusalPrefixes start LLM replies that decline or ask for more input
+// instead of summarizing. They are only matched at the start, so a summary
+// that merely mentions "sorry" or "instructions" is kept.
+var refusalPrefixes = []string{
+	"i'm sorry", "i am sorry", "sorry,", "sorry.",
+	"i cannot", "i can't", "i can not", "i'm unable", "i am unable",
+	"as an ai", "i need more", "i need the", "please provide",
+}
+
+// codePrefixes start replies that are code or data rather than a sentence
+var codePrefixes = []string{"```", "{", "[", "<", "import ", "def ", "def\t", "print("}
+
+// validateStatus checks that an LLM reply reads as a status summary and
+// trims it for display
+func validateStatus(response string) (string, error) {
+	response = strings.TrimSpace(response)
+	if response == "" {
+		return "", fmt.Errorf("empty response")
+	}
+
+	// Models often wrap the answer in quotes
+	lower := strings.ToLower(strings.TrimLeft(response, "\"'“ "))
+	for _, prefix := range refusalPrefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return "", fmt.Errorf("LLM declined to write a status: %q", truncateStatus(response, 80))
+		}
+	}
+	for _, prefix := range codePrefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return "", fmt.Errorf("LLM returned code instead of a status: %q", truncateStatus(response, 80))
+		}
+	}
+	if strings.Contains(response, "```") {
+		return "", fmt.Errorf("LLM returned code instead of a status: %q", truncateStatus(response, 80))
+	}
+
+	// A status is prose, so it needs at least a few words
+	if len(strings.Fields(response)) < 3 {
+		return "", fmt.Errorf("LLM response too short for a status: %q", response)
+	}
+
+	return truncateStatus(response, maxStatusLength), nil
+}
+
+// truncateStatus shortens s to at most limit bytes, ending in "..." when cut,
+// without splitting a UTF-8 character
+func truncateStatus(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	cut := limit - 3
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestValidateStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		response string
+		want     string // "" when the reply must be rejected
+		wantErr  string
+	}{
+		{"summary", "System healthy: 2.1 req/s, 340ms average latency, GPU at 58%.",
+			"System healthy: 2.1 req/s, 340ms average latency, GPU at 58%.", ""},
+		{"surrounding whitespace", "\n  Queue is empty and latency is steady.  \n",
+			"Queue is empty and latency is steady.", ""},
+		{"no instruction needed", "All metrics nominal, no instruction needed from operators.",
+			"All metrics nominal, no instruction needed from operators.", ""},
+		{"mentions sorry later", "Latency spiked; sorry state of the GPU at 95% utilization.",
+			"Latency spiked; sorry state of the GPU at 95% utilization.", ""},
+		{"quoted summary", `"Throughput steady at 40 tokens/s."`, `"Throughput steady at 40 tokens/s."`, ""},
+
+		{"empty", "   ", "", "empty response"},
+		{"refusal", "I'm sorry, but I can't summarize these metrics.", "", "declined"},
+		{"refusal in double quotes", `"I cannot provide a status without more data."`, "", "declined"},
+		{"refusal in single quotes", `'Sorry, I need more context.'`, "", "declined"},
+		{"refusal in curly quotes", "“As an AI, I don't have access to your metrics.”", "", "declined"},
+		{"asks for input", "Please provide the metrics you'd like summarized.", "", "declined"},
+		{"json", `{"status": "healthy"}`, "", "code instead"},
+		{"code fence", "```\nstatus = healthy\n```", "", "code instead"},
+		{"inline code fence", "Status is fine: ```ok``` overall.", "", "code instead"},
+		{"python", "print('System healthy')", "", "code instead"},
+		{"too short", "Healthy.", "", "too short"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := validateStatus(tc.response)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("validateStatus(%q) = %q, %v; want an error containing %q", tc.response, got, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("validateStatus(%q) = %q, %v; want %q", tc.response, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateStatusTruncatesLongSummaries(t *testing.T) {
+	// The cut at maxStatusLength-3 bytes falls inside an "é"
+	long := "Summary: " + strings.Repeat("GPU steady é ", 60)
+	got, err := validateStatus(long)
+	if err != nil {
+		t.Fatalf("validateStatus() error = %v", err)
+	}
+	if len(got) > maxStatusLength || !strings.HasSuffix(got, "...") {
+		t.Errorf("got %d bytes ending %q, want at most %d ending in ...", len(got), got[len(got)-5:], maxStatusLength)
+	}
+	if !utf8.ValidString(got) {
+		t.Errorf("truncated status is not valid UTF-8: %q", got)
+	}
+}
@@ -1,7 +1,9 @@
 package websocket
 
 import (
+	"errors"
 	"log"
+	"net"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -32,7 +34,9 @@ type Client struct {
 	Send chan []byte
 }
 
-// ReadPump pumps messages from the websocket connection to the hub
+// ReadPump pumps messages from the websocket connection to the hub. A peer
+// that stops answering pings hits the read deadline, which ends the pump and
+// unregisters the client, so dead tabs don't hold a goroutine or a hub slot.
 func (c *Client) ReadPump() {
 	defer func() {
 		c.Hub.Unregister <- c
@@ -44,7 +48,10 @@ func (c *Client) ReadPump() {
 	for {
 		_, _, err := c.Conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				log.Printf("WebSocket client %s missed its pong, disconnecting", c.Conn.RemoteAddr())
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("error: %v", err)
 			}
 			break
@@ -53,7 +60,9 @@ func (c *Client) ReadPump() {
 	}
 }
 
-// WritePump pumps messages from the hub to the websocket connection
+// WritePump pumps messages from the hub to the websocket connection. Closing
+// the connection on a failed or timed out write also ends ReadPump, which
+// unregisters the client.
 func (c *Client) WritePump() {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
@@ -74,7 +83,9 @@ func (c *Client) WritePump() {
 			if err != nil {
 				return
 			}
-			w.Write(message)
+			if _, err := w.Write(message); err != nil {
+				return
+			}
 
 			if err := w.Close(); err != nil {
 				return
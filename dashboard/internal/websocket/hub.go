@@ -3,12 +3,17 @@ package websocket
 import (
 	"encoding/json"
 	"log"
+	"sync"
 )
 
-// Hub maintains the set of active clients and broadcasts messages to the clients
+// Hub maintains the set of active clients and broadcasts messages to the
+// clients. Only Run touches the clients map's contents; Register, Unregister,
+// Broadcast and ClientCount are safe to use from any goroutine.
 type Hub struct {
-	// Registered clients
+	// Registered clients; Run holds mu while it changes the map, and
+	// reads it from other goroutines take the read lock
 	clients map[*Client]bool
+	mu      sync.RWMutex
 
 	// Inbound messages from the clients
 	broadcast chan []byte
@@ -35,32 +40,48 @@ func (h *Hub) Run() {
 	for {
 		select {
 		case client := <-h.Register:
+			h.mu.Lock()
 			h.clients[client] = true
+			h.mu.Unlock()
 			log.Printf("Client connected. Total clients: %d", len(h.clients))
 
 		case client := <-h.Unregister:
+			h.mu.Lock()
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
 				close(client.Send)
 				log.Printf("Client disconnected. Total clients: %d", len(h.clients))
 			}
+			h.mu.Unlock()
 
 		case message := <-h.broadcast:
+			h.mu.Lock()
 			for client := range h.clients {
+				// Never wait on a client: one that can't keep up is
+				// dropped so the broadcast loop doesn't block
 				select {
 				case client.Send <- message:
 				default:
 					close(client.Send)
 					delete(h.clients, client)
+					log.Printf("Dropped a client that fell behind. Total clients: %d", len(h.clients))
 				}
 			}
+			h.mu.Unlock()
 		}
 	}
 }
 
-// Broadcast sends data to all connected clients
-func (h *Hub) Broadcast(data interface{}) {
-	message, err := json.Marshal(data)
+// ClientCount returns the number of connected clients
+func (h *Hub) ClientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// Broadcast sends a message to all connected clients
+func (h *Hub) Broadcast(msg Message) {
+	message, err := json.Marshal(msg)
 	if err != nil {
 		log.Printf("Error marshaling broadcast data: %v", err)
 		return
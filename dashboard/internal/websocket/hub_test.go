@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestHubConcurrentRegistration registers and unregisters clients from many
+// goroutines while others poll ClientCount and broadcast; run it with -race.
+func TestHubConcurrentRegistration(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	hub := NewHub()
+	go hub.Run()
+
+	const goroutines = 20
+	const perGoroutine = 50
+
+	done := make(chan struct{})
+	var pollers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		pollers.Add(1)
+		go func() {
+			defer pollers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					if n := hub.ClientCount(); n < 0 || n > goroutines {
+						t.Errorf("ClientCount() = %d, want 0..%d", n, goroutines)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	pollers.Add(1)
+	go func() {
+		defer pollers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				hub.Broadcast(NewMessage(TypeMetrics, MetricsVersion, nil))
+			}
+		}
+	}()
+
+	var clients sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		clients.Add(1)
+		go func() {
+			defer clients.Done()
+			for j := 0; j < perGoroutine; j++ {
+				client := &Client{Hub: hub, Send: make(chan []byte, 256)}
+				hub.Register <- client
+				hub.Unregister <- client
+			}
+		}()
+	}
+	clients.Wait()
+	close(done)
+	pollers.Wait()
+
+	// Run handles each unregister before taking the next message, so the
+	// count is settled once every send has been received
+	deadline := time.Now().Add(time.Second)
+	for hub.ClientCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("ClientCount() = %d after every client unregistered, want 0", hub.ClientCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,43 @@
+package websocket
+
+import "time"
+
+// Message types sent to dashboard clients
+const (
+	// TypeMetrics carries a MetricsPayload on every refresh
+	TypeMetrics = "metrics"
+)
+
+// MetricsVersion is the schema version of MetricsPayload. Bump it when a
+// field is removed or changes meaning; adding fields doesn't need a bump.
+const MetricsVersion = 1
+
+// Message is the envelope of everything the hub broadcasts. Clients switch
+// on Type and check Version before reading Payload, and ignore types they
+// don't know.
+type Message struct {
+	Type      string      `json:"type"`
+	Version   int         `json:"version"`
+	Timestamp time.Time   `json:"timestamp"`
+	Payload   interface{} `json:"payload"`
+}
+
+// NewMessage wraps payload in an envelope stamped with the current time
+func NewMessage(msgType string, version int, payload interface{}) Message {
+	return Message{
+		Type:      msgType,
+		Version:   version,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	}
+}
+
+// MetricsPayload is the periodic dashboard update
+type MetricsPayload struct {
+	Summary                   map[string]interface{} `json:"summary"`
+	LatencyPercentiles        map[string]interface{} `json:"latency_percentiles"`
+	HighPriorityPercentiles   map[string]interface{} `json:"high_priority_percentiles"`
+	NormalPriorityPercentiles map[string]interface{} `json:"normal_priority_percentiles"`
+	AIStatus                  string                 `json:"ai_status"`
+	IsAIGenerated             bool                   `json:"is_ai_generated"`
+}
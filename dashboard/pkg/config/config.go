@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds the configuration for the dashboard
@@ -11,6 +13,28 @@ type Config struct {
 	Environment   string
 	PrometheusURL string
 	OllamaURL     string
+	// ProxyHealthURL is the proxy's health endpoint, on its metrics port
+	ProxyHealthURL string
+	// TrustedProxies lists the IPs or CIDRs whose X-Forwarded-For is
+	// believed when resolving client IPs; empty trusts none
+	TrustedProxies []string
+	// PrometheusQueryTimeout bounds each instant query
+	PrometheusQueryTimeout time.Duration
+	// PrometheusRangeQueryTimeout bounds each range query behind the charts
+	PrometheusRangeQueryTimeout time.Duration
+	// PrometheusSlowQueryThreshold is the duration above which a query is
+	// logged and counted as slow; zero disables the check
+	PrometheusSlowQueryThreshold time.Duration
+	// RequestRateWindow is how far back the locally computed request rate
+	// looks; older samples are dropped
+	RequestRateWindow time.Duration
+	// StatusModel is the Ollama model that writes the AI status summary
+	StatusModel string
+	// StatusInterval is the least time between two AI status generations
+	StatusInterval time.Duration
+	// MetricLabels are added to every metric the dashboard exports: env
+	// from ENVIRONMENT and cluster from CLUSTER, each only when set
+	MetricLabels map[string]string
 }
 
 // LoadConfig loads configuration from environment variables with defaults
@@ -20,6 +44,16 @@ func LoadConfig() *Config {
 		Environment:   "development",
 		PrometheusURL: "http://localhost:9090",
 		OllamaURL:     "http://localhost:11434",
+
+		ProxyHealthURL: "http://localhost:8001/health",
+
+		PrometheusQueryTimeout:       10 * time.Second,
+		PrometheusRangeQueryTimeout:  15 * time.Second,
+		PrometheusSlowQueryThreshold: 2 * time.Second,
+		RequestRateWindow:            2 * time.Minute,
+
+		StatusModel:    "phi3:mini",
+		StatusInterval: 15 * time.Second,
 	}
 
 	// Override with environment variables if set
@@ -37,9 +71,63 @@ func LoadConfig() *Config {
 		cfg.PrometheusURL = promURL
 	}
 
+	if timeout := os.Getenv("PROMETHEUS_QUERY_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil && d > 0 {
+			cfg.PrometheusQueryTimeout = d
+		}
+	}
+
+	if timeout := os.Getenv("PROMETHEUS_RANGE_QUERY_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil && d > 0 {
+			cfg.PrometheusRangeQueryTimeout = d
+		}
+	}
+
+	if threshold := os.Getenv("PROMETHEUS_SLOW_QUERY_THRESHOLD"); threshold != "" {
+		if d, err := time.ParseDuration(threshold); err == nil && d >= 0 {
+			cfg.PrometheusSlowQueryThreshold = d
+		}
+	}
+
+	if window := os.Getenv("REQUEST_RATE_WINDOW"); window != "" {
+		if d, err := time.ParseDuration(window); err == nil && d > 0 {
+			cfg.RequestRateWindow = d
+		}
+	}
+
 	if ollamaURL := os.Getenv("OLLAMA_URL"); ollamaURL != "" {
 		cfg.OllamaURL = ollamaURL
 	}
 
+	if healthURL := os.Getenv("PROXY_HEALTH_URL"); healthURL != "" {
+		cfg.ProxyHealthURL = healthURL
+	}
+
+	if statusModel := os.Getenv("STATUS_MODEL"); statusModel != "" {
+		cfg.StatusModel = statusModel
+	}
+
+	if interval := os.Getenv("STATUS_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil && d > 0 {
+			cfg.StatusInterval = d
+		}
+	}
+
+	cfg.MetricLabels = make(map[string]string)
+	if env := os.Getenv("ENVIRONMENT"); env != "" {
+		cfg.MetricLabels["env"] = env
+	}
+	if cluster := os.Getenv("CLUSTER"); cluster != "" {
+		cfg.MetricLabels["cluster"] = cluster
+	}
+
+	if trusted := os.Getenv("TRUSTED_PROXIES"); trusted != "" {
+		for _, entry := range strings.Split(trusted, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				cfg.TrustedProxies = append(cfg.TrustedProxies, entry)
+			}
+		}
+	}
+
 	return cfg
 }
\ No newline at end of file
@@ -0,0 +1,64 @@
+// Package ratelog suppresses repetitive error logging from periodic tasks.
+package ratelog
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Logger logs the first failure of a task immediately, repeats of it at most
+// once per interval, and a single line when the task recovers
+type Logger struct {
+	interval time.Duration
+	mu       sync.Mutex
+	failing  map[string]*failure
+}
+
+type failure struct {
+	count      int
+	suppressed int
+	lastLogged time.Time
+}
+
+// New creates a Logger that repeats an ongoing failure at most once per interval
+func New(interval time.Duration) *Logger {
+	return &Logger{
+		interval: interval,
+		failing:  make(map[string]*failure),
+	}
+}
+
+// Report records the outcome of the task identified by key, e.g.
+// "collecting disk I/O". A nil err marks the task healthy.
+func (l *Logger) Report(key string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, wasFailing := l.failing[key]
+
+	if err == nil {
+		if wasFailing {
+			log.Printf("Recovered %s after %d failures", key, f.count)
+			delete(l.failing, key)
+		}
+		return
+	}
+
+	now := time.Now()
+	if !wasFailing {
+		l.failing[key] = &failure{count: 1, lastLogged: now}
+		log.Printf("Error %s: %v", key, err)
+		return
+	}
+
+	f.count++
+	if now.Sub(f.lastLogged) < l.interval {
+		f.suppressed++
+		return
+	}
+
+	log.Printf("Error %s: %v (still failing, %d similar errors suppressed)", key, err, f.suppressed)
+	f.suppressed = 0
+	f.lastLogged = now
+}
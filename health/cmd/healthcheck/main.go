@@ -15,9 +15,12 @@ import (
 	"encoding/json"
 
 	"github.com/atyronesmith/llama-metrics/health/internal/checker"
+	"github.com/atyronesmith/llama-metrics/health/internal/metrics"
 	"github.com/atyronesmith/llama-metrics/health/internal/models"
+	"github.com/atyronesmith/llama-metrics/health/internal/openapi"
 	"github.com/atyronesmith/llama-metrics/health/pkg/config"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var (
@@ -42,7 +45,10 @@ func main() {
 	}
 
 	// Create health checker
-	healthChecker := checker.NewHealthChecker(cfg)
+	healthChecker, err := checker.NewHealthChecker(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure health checks: %v", err)
+	}
 
 	if *mode == "cli" {
 		// CLI mode - run check and exit
@@ -51,7 +57,7 @@ func main() {
 	}
 
 	// Server mode - start HTTP server
-	runServer(healthChecker, *port)
+	runServer(healthChecker, *port, time.Duration(cfg.HealthCheck.CheckInterval)*time.Second)
 }
 
 func runCLICheck(hc *checker.HealthChecker, checkType string) {
@@ -153,15 +159,22 @@ func printAnalyzedHealth(analyzed models.AnalyzedHealth) {
 		}
 	}
 
-	// Print system metrics summary
+	// Print system metrics summary, colored by the configured thresholds
 	fmt.Printf("\n%s💻 System Resources:%s\n", colorBlue, colorReset)
 
-	cpuColor := colorGreen
-	if analyzed.SystemMetrics.CPU.Percent > 80 {
-		cpuColor = colorRed
-	} else if analyzed.SystemMetrics.CPU.Percent > 60 {
-		cpuColor = colorYellow
+	breaches := checker.ThresholdBreaches(analyzed.SystemHealth)
+	resourceColor := func(resource string) string {
+		breach, ok := breaches[resource]
+		if !ok {
+			return colorGreen
+		}
+		if breach.Level == checker.LevelCritical {
+			return colorRed
+		}
+		return colorYellow
 	}
+
+	cpuColor := resourceColor("cpu")
 	fmt.Printf("  CPU:    %s%.1f%%%s", cpuColor, analyzed.SystemMetrics.CPU.Percent, colorReset)
 	if len(analyzed.SystemMetrics.CPU.LoadAvg) >= 3 {
 		fmt.Printf(" (Load: %.2f, %.2f, %.2f)",
@@ -171,12 +184,7 @@ func printAnalyzedHealth(analyzed models.AnalyzedHealth) {
 	}
 	fmt.Println()
 
-	memColor := colorGreen
-	if analyzed.SystemMetrics.Memory.Percent > 85 {
-		memColor = colorRed
-	} else if analyzed.SystemMetrics.Memory.Percent > 70 {
-		memColor = colorYellow
-	}
+	memColor := resourceColor("memory")
 	fmt.Printf("  Memory: %s%.1f%%%s (%.1f/%.1f GB)\n",
 		memColor,
 		analyzed.SystemMetrics.Memory.Percent,
@@ -184,12 +192,7 @@ func printAnalyzedHealth(analyzed models.AnalyzedHealth) {
 		analyzed.SystemMetrics.Memory.UsedGB,
 		analyzed.SystemMetrics.Memory.TotalGB)
 
-	diskColor := colorGreen
-	if analyzed.SystemMetrics.Disk.Percent > 80 {
-		diskColor = colorRed
-	} else if analyzed.SystemMetrics.Disk.Percent > 60 {
-		diskColor = colorYellow
-	}
+	diskColor := resourceColor("disk")
 	fmt.Printf("  Disk:   %s%.1f%%%s (%.1f/%.1f GB)\n",
 		diskColor,
 		analyzed.SystemMetrics.Disk.Percent,
@@ -248,15 +251,35 @@ func wrapAndPrint(text string, width int) {
 	}
 }
 
-func runServer(hc *checker.HealthChecker, port int) {
+// serveCachedHealth answers with the cached comprehensive health, or a fresh
+// one when the cache is stale or the request sets force=true
+func serveCachedHealth(c *gin.Context, hc *checker.HealthChecker) {
+	force := c.Query("force") == "true"
+	health, cached := hc.GetCachedHealth(c.Request.Context(), force)
+	if cached {
+		c.Header("X-Health-Cache", "hit")
+	} else {
+		c.Header("X-Health-Cache", "miss")
+	}
+	c.JSON(http.StatusOK, health)
+}
+
+func runServer(hc *checker.HealthChecker, port int, checkInterval time.Duration) {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
 
-	// Health check endpoints
+	// Export check results to Prometheus, checking in the background so a
+	// scrape only reads the last results
+	hc.SetMetrics(metrics.NewCollector())
+	checkCtx, stopChecks := context.WithCancel(context.Background())
+	defer stopChecks()
+	if checkInterval > 0 {
+		go hc.RunChecks(checkCtx, checkInterval)
+	}
+
+	// Health check endpoints; ?force=true skips the cache
 	router.GET("/health", func(c *gin.Context) {
-		ctx := c.Request.Context()
-		health := hc.GetComprehensiveHealth(ctx)
-		c.JSON(http.StatusOK, health)
+		serveCachedHealth(c, hc)
 	})
 
 	router.GET("/health/simple", func(c *gin.Context) {
@@ -291,9 +314,16 @@ func runServer(hc *checker.HealthChecker, port int) {
 
 	// Legacy endpoints for compatibility
 	router.GET("/api/health", func(c *gin.Context) {
-		ctx := c.Request.Context()
-		health := hc.GetComprehensiveHealth(ctx)
-		c.JSON(http.StatusOK, health)
+		serveCachedHealth(c, hc)
+	})
+
+	// Prometheus exporter, serving the gauges from the last check
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// Machine-readable contract of the endpoints above
+	spec := openapi.Spec(os.Getenv("VERSION"))
+	router.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, spec)
 	})
 
 	// Start server
@@ -309,6 +339,7 @@ func runServer(hc *checker.HealthChecker, port int) {
 		<-sigint
 
 		log.Println("Shutting down server...")
+		stopChecks()
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
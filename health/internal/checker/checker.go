@@ -5,14 +5,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/atyronesmith/llama-metrics/health/internal/metrics"
 	"github.com/atyronesmith/llama-metrics/health/internal/models"
 	"github.com/atyronesmith/llama-metrics/health/pkg/config"
 	"github.com/shirou/gopsutil/v3/cpu"
@@ -21,12 +24,34 @@ import (
 	"github.com/shirou/gopsutil/v3/net"
 )
 
+// maxExpectBodySize caps how much of a response body is read to check expectations
+const maxExpectBodySize = 1 << 20
+
+// defaultRetryDelay separates retries of services that set retries but no
+// retry delay
+const defaultRetryDelay = time.Second
+
+// Service check types
+const (
+	CheckHTTP = "http"
+	CheckTCP  = "tcp"
+)
+
 // ServiceEndpoint represents a service to check
 type ServiceEndpoint struct {
-	Name     string
+	Name string
+	// Type is CheckHTTP, a GET of URL, or CheckTCP, a connect to URL given
+	// as host:port; empty means CheckHTTP
+	Type     string
 	URL      string
 	Critical bool
 	Timeout  time.Duration
+	Headers  map[string]string
+	Expect   config.ServiceExpectation
+	// Retries is how many more attempts a failed check gets, RetryDelay
+	// apart, before the service is reported unhealthy
+	Retries    int
+	RetryDelay time.Duration
 }
 
 // HealthChecker implements comprehensive health checking
@@ -36,16 +61,41 @@ type HealthChecker struct {
 	httpClient      *http.Client
 	serviceEndpoints []ServiceEndpoint
 	mu              sync.RWMutex
+
+	// consecutiveFailures counts the failed checks in a row per service,
+	// guarded by mu
+	consecutiveFailures map[string]int
+
+	// The last successful LLM analysis, the health state it was made for
+	// and when, guarded by mu
+	analysis      *models.LLMAnalysis
+	analysisState string
+	analysisAt    time.Time
+
+	// cacheMu guards the last comprehensive result and is held while a
+	// fresh check runs, so concurrent polls share one check
+	cacheMu  sync.Mutex
+	cached   *models.SystemHealth
+	cachedAt time.Time
+
+	// metrics, when set, exports each comprehensive check to Prometheus
+	metrics *metrics.Collector
 }
 
-// NewHealthChecker creates a new health checker instance
-func NewHealthChecker(cfg *config.Config) *HealthChecker {
+// defaultServiceTimeout bounds checks of configured services that don't set
+// their own timeout
+const defaultServiceTimeout = 3 * time.Second
+
+// NewHealthChecker creates a new health checker instance. It fails when a
+// configured service is neither built in nor given a URL.
+func NewHealthChecker(cfg *config.Config) (*HealthChecker, error) {
 	hc := &HealthChecker{
 		config:    cfg,
 		startTime: time.Now(),
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		consecutiveFailures: make(map[string]int),
 	}
 
 	// Initialize service endpoints
@@ -54,7 +104,8 @@ func NewHealthChecker(cfg *config.Config) *HealthChecker {
 			Name:     "ollama",
 			URL:      fmt.Sprintf("%s/api/tags", cfg.Server.OllamaURL),
 			Critical: true,
-			Timeout:  5 * time.Second,
+			// Covers listing the models and a one-token test generation
+			Timeout: 20 * time.Second,
 		},
 		{
 			Name:     "proxy",
@@ -76,15 +127,66 @@ func NewHealthChecker(cfg *config.Config) *HealthChecker {
 		},
 	}
 
-	return hc
+	if err := hc.applyServiceConfig(cfg.HealthCheck.Services); err != nil {
+		return nil, err
+	}
+
+	for i := range hc.serviceEndpoints {
+		name := hc.serviceEndpoints[i].Name
+		hc.serviceEndpoints[i].Headers = cfg.HealthCheck.Headers[name]
+		hc.serviceEndpoints[i].Expect = cfg.HealthCheck.Expect[name]
+	}
+
+	return hc, nil
+}
+
+// applyServiceConfig overrides built-in service endpoints by name and
+// appends the configured services that aren't built in
+func (hc *HealthChecker) applyServiceConfig(services []config.ServiceConfig) error {
+	for _, service := range services {
+		i := slices.IndexFunc(hc.serviceEndpoints, func(e ServiceEndpoint) bool { return e.Name == service.Name })
+		if i < 0 {
+			if service.URL == "" {
+				return fmt.Errorf("health_check.services: service %q needs a url", service.Name)
+			}
+			hc.serviceEndpoints = append(hc.serviceEndpoints, ServiceEndpoint{
+				Name:    service.Name,
+				Timeout: defaultServiceTimeout,
+			})
+			i = len(hc.serviceEndpoints) - 1
+		}
+
+		endpoint := &hc.serviceEndpoints[i]
+		if service.Type != "" {
+			endpoint.Type = service.Type
+		}
+		if service.URL != "" {
+			endpoint.URL = service.URL
+		}
+		if service.Critical != nil {
+			endpoint.Critical = *service.Critical
+		}
+		if service.Timeout > 0 {
+			endpoint.Timeout = time.Duration(service.Timeout) * time.Second
+		}
+		if service.Retries > 0 {
+			endpoint.Retries = service.Retries
+			endpoint.RetryDelay = defaultRetryDelay
+		}
+		if service.RetryDelayMs > 0 {
+			endpoint.RetryDelay = time.Duration(service.RetryDelayMs) * time.Millisecond
+		}
+	}
+	return nil
 }
 
-// CheckOllamaGeneration performs comprehensive Ollama health check including generation
+// CheckOllamaGeneration performs comprehensive Ollama health check including
+// generation, giving up when ctx is done
 func (hc *HealthChecker) CheckOllamaGeneration(ctx context.Context) models.ServiceHealth {
 	startTime := time.Now()
 
 	// First, check if Ollama is listening
-	resp, err := hc.httpClient.Get(fmt.Sprintf("%s/api/tags", hc.config.Server.OllamaURL))
+	resp, err := hc.ollamaRequest(ctx, "GET", "/api/tags", nil)
 	if err != nil {
 		errStr := err.Error()
 		return models.ServiceHealth{
@@ -128,11 +230,7 @@ func (hc *HealthChecker) CheckOllamaGeneration(ctx context.Context) models.Servi
 	}
 
 	reqBody, _ := json.Marshal(genReq)
-	genResp, err := hc.httpClient.Post(
-		fmt.Sprintf("%s/api/generate", hc.config.Server.OllamaURL),
-		"application/json",
-		bytes.NewReader(reqBody),
-	)
+	genResp, err := hc.ollamaRequest(ctx, "POST", "/api/generate", reqBody)
 
 	generationTime := time.Since(genStart).Milliseconds()
 	totalTime := time.Since(startTime).Milliseconds()
@@ -213,16 +311,91 @@ func (hc *HealthChecker) CheckOllamaGeneration(ctx context.Context) models.Servi
 	}
 }
 
-// CheckServiceHealth checks health of a single service
+// ollamaRequest sends a request to the Ollama API, with body as JSON when
+// it isn't nil
+func (hc *HealthChecker) ollamaRequest(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, hc.config.Server.OllamaURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return hc.httpClient.Do(req)
+}
+
+// CheckServiceHealth checks health of a single service, retrying a failed
+// check up to service.Retries times so a transient blip doesn't report the
+// service unhealthy. The details of an unhealthy result include how many
+// checks in a row have failed.
 func (hc *HealthChecker) CheckServiceHealth(ctx context.Context, service ServiceEndpoint) models.ServiceHealth {
+	result := hc.checkServiceOnce(ctx, service)
+	attempts := 1
+	for result.Status.Status != "healthy" && attempts <= service.Retries {
+		select {
+		case <-ctx.Done():
+			return hc.recordServiceResult(result, attempts)
+		case <-time.After(service.RetryDelay):
+		}
+		result = hc.checkServiceOnce(ctx, service)
+		attempts++
+	}
+	return hc.recordServiceResult(result, attempts)
+}
+
+// recordServiceResult updates the service's consecutive failure count and
+// adds it, and the attempts made when there was more than one, to the
+// result's details
+func (hc *HealthChecker) recordServiceResult(result models.ServiceHealth, attempts int) models.ServiceHealth {
+	hc.mu.Lock()
+	if result.Status.Status == "healthy" {
+		delete(hc.consecutiveFailures, result.Name)
+	} else {
+		hc.consecutiveFailures[result.Name]++
+	}
+	failures := hc.consecutiveFailures[result.Name]
+	hc.mu.Unlock()
+
+	if failures == 0 && attempts == 1 {
+		return result
+	}
+	if result.Status.Details == nil {
+		result.Status.Details = make(map[string]any)
+	}
+	if failures > 0 {
+		result.Status.Details["consecutive_failures"] = failures
+	}
+	if attempts > 1 {
+		result.Status.Details["attempts"] = attempts
+	}
+	return result
+}
+
+// checkServiceOnce makes a single health check of a service
+func (hc *HealthChecker) checkServiceOnce(ctx context.Context, service ServiceEndpoint) models.ServiceHealth {
 	// Special handling for Ollama
 	if service.Name == "ollama" {
-		return hc.CheckOllamaGeneration(ctx)
+		if service.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, service.Timeout)
+			defer cancel()
+		}
+		result := hc.CheckOllamaGeneration(ctx)
+		result.Critical = service.Critical
+		return result
+	}
+	if service.Type == CheckTCP {
+		return hc.checkTCP(ctx, service)
 	}
 
 	startTime := time.Now()
 
 	// Create request with timeout
+	if service.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, service.Timeout)
+		defer cancel()
+	}
 	req, err := http.NewRequestWithContext(ctx, "GET", service.URL, nil)
 	if err != nil {
 		errStr := err.Error()
@@ -237,7 +410,10 @@ func (hc *HealthChecker) CheckServiceHealth(ctx context.Context, service Service
 			Critical: service.Critical,
 		}
 	}
-	req.Header.Set("User-Agent", "HealthChecker/1.0")
+	req.Header.Set("User-Agent", hc.config.HealthCheck.UserAgent)
+	for name, value := range service.Headers {
+		req.Header.Set(name, value)
+	}
 
 	resp, err := hc.httpClient.Do(req)
 	responseTime := time.Since(startTime).Milliseconds()
@@ -264,42 +440,120 @@ func (hc *HealthChecker) CheckServiceHealth(ctx context.Context, service Service
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
+	if err := checkExpectations(service.Expect, resp); err != nil {
+		errStr := err.Error()
 		return models.ServiceHealth{
 			Name: service.Name,
 			URL:  service.URL,
 			Status: models.HealthStatus{
-				Status:         "healthy",
+				Status:         "unhealthy",
 				Timestamp:      time.Now().UTC().Format(time.RFC3339),
 				ResponseTimeMs: &responseTimeMs,
+				Error:          &errStr,
+				Details:        requestDetails(service),
 			},
 			Critical: service.Critical,
 		}
 	}
 
-	errStr := fmt.Sprintf("HTTP %d", resp.StatusCode)
 	return models.ServiceHealth{
 		Name: service.Name,
 		URL:  service.URL,
 		Status: models.HealthStatus{
-			Status:         "unhealthy",
+			Status:         "healthy",
 			Timestamp:      time.Now().UTC().Format(time.RFC3339),
 			ResponseTimeMs: &responseTimeMs,
-			Error:          &errStr,
+			Details:        requestDetails(service),
 		},
 		Critical: service.Critical,
 	}
 }
 
-// GetSystemMetrics collects system metrics
-func (hc *HealthChecker) GetSystemMetrics() models.SystemMetrics {
-	metrics := models.SystemMetrics{}
+// checkExpectations verifies a service response against its configured
+// expectations, returning a descriptive error for the first one unmet
+func checkExpectations(expect config.ServiceExpectation, resp *http.Response) error {
+	if len(expect.StatusCodes) == 0 {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+	} else if !slices.Contains(expect.StatusCodes, resp.StatusCode) {
+		return fmt.Errorf("HTTP %d, expected one of %v", resp.StatusCode, expect.StatusCodes)
+	}
 
-	// CPU metrics
-	cpuPercent, _ := cpu.Percent(100*time.Millisecond, false)
-	if len(cpuPercent) > 0 {
-		metrics.CPU.Percent = cpuPercent[0]
+	if expect.BodyContains == "" && expect.JSONField == "" {
+		return nil
 	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxExpectBodySize))
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if expect.BodyContains != "" && !strings.Contains(string(body), expect.BodyContains) {
+		return fmt.Errorf("response body does not contain %q", expect.BodyContains)
+	}
+
+	if expect.JSONField != "" {
+		var data any
+		if err := json.Unmarshal(body, &data); err != nil {
+			return fmt.Errorf("response body is not valid JSON: %w", err)
+		}
+
+		value, ok := lookupJSONField(data, expect.JSONField)
+		if !ok {
+			return fmt.Errorf("response field %q is missing", expect.JSONField)
+		}
+		if got := fmt.Sprint(value); got != expect.JSONValue {
+			return fmt.Errorf("response field %q is %q, expected %q", expect.JSONField, got, expect.JSONValue)
+		}
+	}
+
+	return nil
+}
+
+// lookupJSONField walks a dot-separated path through decoded JSON objects
+func lookupJSONField(data any, path string) (any, bool) {
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := data.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if data, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// requestDetails reports the custom headers sent to a service, with secret
+// values masked
+func requestDetails(service ServiceEndpoint) map[string]any {
+	if len(service.Headers) == 0 {
+		return nil
+	}
+
+	headers := make(map[string]string, len(service.Headers))
+	for name, value := range service.Headers {
+		if isSecretHeader(name) {
+			value = "****"
+		}
+		headers[name] = value
+	}
+	return map[string]any{"headers": headers}
+}
+
+// isSecretHeader reports whether a header likely carries a credential
+func isSecretHeader(name string) bool {
+	name = strings.ToLower(name)
+	if name == "authorization" || name == "proxy-authorization" || name == "cookie" {
+		return true
+	}
+	return strings.Contains(name, "token") || strings.Contains(name, "key") || strings.Contains(name, "secret")
+}
+
+// GetSystemMetrics collects system metrics
+func (hc *HealthChecker) GetSystemMetrics() models.SystemMetrics {
+	metrics := resourceMetrics(100 * time.Millisecond)
 	metrics.CPU.Count, _ = cpu.Counts(true)
 
 	// Load average (Unix systems)
@@ -312,22 +566,6 @@ func (hc *HealthChecker) GetSystemMetrics() models.SystemMetrics {
 		}
 	}
 
-	// Memory metrics
-	if vm, err := mem.VirtualMemory(); err == nil {
-		metrics.Memory.Percent = vm.UsedPercent
-		metrics.Memory.TotalGB = float64(vm.Total) / (1024 * 1024 * 1024)
-		metrics.Memory.AvailableGB = float64(vm.Available) / (1024 * 1024 * 1024)
-		metrics.Memory.UsedGB = float64(vm.Used) / (1024 * 1024 * 1024)
-	}
-
-	// Disk metrics
-	if d, err := disk.Usage("/"); err == nil {
-		metrics.Disk.Percent = d.UsedPercent
-		metrics.Disk.TotalGB = float64(d.Total) / (1024 * 1024 * 1024)
-		metrics.Disk.FreeGB = float64(d.Free) / (1024 * 1024 * 1024)
-		metrics.Disk.UsedGB = float64(d.Used) / (1024 * 1024 * 1024)
-	}
-
 	// Network metrics
 	if n, err := net.IOCounters(false); err == nil && len(n) > 0 {
 		metrics.Network.BytesSent = n[0].BytesSent
@@ -363,6 +601,36 @@ func (hc *HealthChecker) GetSystemMetrics() models.SystemMetrics {
 	return metrics
 }
 
+// resourceMetrics collects only the CPU, memory and disk usage that the
+// resource thresholds are checked against. CPU usage is sampled over
+// cpuInterval, or since the previous call when it is zero.
+func resourceMetrics(cpuInterval time.Duration) models.SystemMetrics {
+	metrics := models.SystemMetrics{}
+
+	// CPU metrics
+	if cpuPercent, _ := cpu.Percent(cpuInterval, false); len(cpuPercent) > 0 {
+		metrics.CPU.Percent = cpuPercent[0]
+	}
+
+	// Memory metrics
+	if vm, err := mem.VirtualMemory(); err == nil {
+		metrics.Memory.Percent = vm.UsedPercent
+		metrics.Memory.TotalGB = float64(vm.Total) / (1024 * 1024 * 1024)
+		metrics.Memory.AvailableGB = float64(vm.Available) / (1024 * 1024 * 1024)
+		metrics.Memory.UsedGB = float64(vm.Used) / (1024 * 1024 * 1024)
+	}
+
+	// Disk metrics
+	if d, err := disk.Usage("/"); err == nil {
+		metrics.Disk.Percent = d.UsedPercent
+		metrics.Disk.TotalGB = float64(d.Total) / (1024 * 1024 * 1024)
+		metrics.Disk.FreeGB = float64(d.Free) / (1024 * 1024 * 1024)
+		metrics.Disk.UsedGB = float64(d.Used) / (1024 * 1024 * 1024)
+	}
+
+	return metrics
+}
+
 // getLoadAverage returns the system load average
 func getLoadAverage() ([]float64, error) {
 	// Try sysctl on macOS
@@ -403,7 +671,12 @@ func (hc *HealthChecker) GetComprehensiveHealth(ctx context.Context) models.Syst
 		wg.Add(1)
 		go func(svc ServiceEndpoint) {
 			defer wg.Done()
-			serviceChan <- hc.CheckServiceHealth(ctx, svc)
+			start := time.Now()
+			result := hc.CheckServiceHealth(ctx, svc)
+			if hc.metrics != nil {
+				hc.metrics.RecordServiceCheck(result, time.Since(start))
+			}
+			serviceChan <- result
 		}(service)
 	}
 
@@ -438,18 +711,24 @@ func (hc *HealthChecker) GetComprehensiveHealth(ctx context.Context) models.Syst
 	// Get system metrics
 	systemMetrics := hc.GetSystemMetrics()
 
+	// Resource pressure counts against the overall status like a failing
+	// service does
+	breaches := hc.thresholdBreaches(systemMetrics)
+	overallStatus = worseStatus(overallStatus, resourceStatus(breaches))
+
 	// Create summary
 	healthyServices := len(services) - totalFailures
 	summary := map[string]interface{}{
-		"overall_status":    overallStatus,
-		"services_healthy":  healthyServices,
-		"services_total":    len(services),
-		"critical_failures": criticalFailures,
-		"uptime_seconds":    uptime,
-		"version":           os.Getenv("VERSION"),
+		"overall_status":     overallStatus,
+		"services_healthy":   healthyServices,
+		"services_total":     len(services),
+		"critical_failures":  criticalFailures,
+		"resource_warnings":  breaches,
+		"uptime_seconds":     uptime,
+		"version":            os.Getenv("VERSION"),
 	}
 
-	return models.SystemHealth{
+	health := models.SystemHealth{
 		Status:        overallStatus,
 		Timestamp:     timestamp,
 		Version:       os.Getenv("VERSION"),
@@ -458,6 +737,56 @@ func (hc *HealthChecker) GetComprehensiveHealth(ctx context.Context) models.Syst
 		SystemMetrics: systemMetrics,
 		Summary:       summary,
 	}
+	if hc.metrics != nil {
+		hc.metrics.RecordHealth(health)
+	}
+
+	return health
+}
+
+// SetMetrics makes every comprehensive check update the given Prometheus
+// metrics; call it before serving requests
+func (hc *HealthChecker) SetMetrics(m *metrics.Collector) {
+	hc.metrics = m
+}
+
+// GetCachedHealth returns the last comprehensive health result while it is
+// younger than the configured cache TTL, and runs the checks again once it
+// is stale or when force is set. cached reports whether the result came
+// from the cache.
+func (hc *HealthChecker) GetCachedHealth(ctx context.Context, force bool) (health models.SystemHealth, cached bool) {
+	ttl := time.Duration(hc.config.HealthCheck.CacheTTL) * time.Second
+
+	hc.cacheMu.Lock()
+	defer hc.cacheMu.Unlock()
+
+	if !force && hc.cached != nil && time.Since(hc.cachedAt) < ttl {
+		return *hc.cached, true
+	}
+
+	health = hc.GetComprehensiveHealth(ctx)
+	// Checks cut short by the client going away aren't worth keeping
+	if ctx.Err() == nil {
+		hc.cached = &health
+		hc.cachedAt = time.Now()
+	}
+	return health, false
+}
+
+// RunChecks runs the comprehensive checks every interval until ctx is done,
+// so the exported metrics stay current without anyone polling /health. A
+// round is skipped while the cached result is still fresh.
+func (hc *HealthChecker) RunChecks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		hc.GetCachedHealth(ctx, false)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
 // GetSimpleHealth returns simple health status
@@ -508,6 +837,22 @@ func (hc *HealthChecker) GetReadinessStatus() models.ReadinessStatus {
 		components["metrics_collection"] = "ready"
 	}
 
+	// Check resource pressure; a machine over several critical thresholds
+	// shouldn't take more work. Probes run often, so this reads only the
+	// resources with thresholds and doesn't wait on a CPU sample.
+	if hc.config != nil {
+		breaches := hc.thresholdBreaches(resourceMetrics(0))
+		switch resourceStatus(breaches) {
+		case "unhealthy":
+			components["resources"] = "failed: " + describeCriticalBreaches(breaches)
+			ready = false
+		case "degraded":
+			components["resources"] = "degraded: " + describeCriticalBreaches(breaches)
+		default:
+			components["resources"] = "ready"
+		}
+	}
+
 	return models.ReadinessStatus{
 		Ready:      ready,
 		Timestamp:  timestamp,
@@ -537,9 +882,61 @@ func (hc *HealthChecker) GetAnalyzedHealth(ctx context.Context) models.AnalyzedH
 		SystemHealth: health,
 	}
 
+	// Reuse a recent analysis of the same health state rather than asking
+	// Ollama again on every poll
+	state := healthState(health)
+	if analysis, ok := hc.cachedAnalysis(state); ok {
+		analyzed.Analysis = &analysis
+		return analyzed
+	}
+
 	// Get LLM analysis if available
 	analysis := hc.AnalyzeHealthWithLLM(ctx, health)
-	analyzed.Analysis = &analysis
+	if analysis.Available {
+		hc.mu.Lock()
+		hc.analysis = &analysis
+		hc.analysisState = state
+		hc.analysisAt = time.Now()
+		hc.mu.Unlock()
+	}
+	analyzed.Analysis = withCachedFlag(analysis, false)
 
 	return analyzed
+}
+
+// cachedAnalysis returns the last LLM analysis if it was made for state
+// within the analysis cache TTL
+func (hc *HealthChecker) cachedAnalysis(state string) (models.LLMAnalysis, bool) {
+	ttl := time.Duration(hc.config.HealthCheck.AnalysisCacheTTL) * time.Second
+
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	if hc.analysis == nil || hc.analysisState != state || time.Since(hc.analysisAt) >= ttl {
+		return models.LLMAnalysis{}, false
+	}
+	return *withCachedFlag(*hc.analysis, true), true
+}
+
+// withCachedFlag returns a copy of analysis whose details say whether it
+// came from the cache
+func withCachedFlag(analysis models.LLMAnalysis, cached bool) *models.LLMAnalysis {
+	details := make(map[string]interface{}, len(analysis.Details)+1)
+	for key, value := range analysis.Details {
+		details[key] = value
+	}
+	details["cached"] = cached
+	analysis.Details = details
+	return &analysis
+}
+
+// healthState summarizes the overall and per-service status, so a cached
+// analysis is dropped as soon as any of them changes
+func healthState(health models.SystemHealth) string {
+	states := make([]string, 0, len(health.Services)+1)
+	for _, service := range health.Services {
+		states = append(states, service.Name+"="+service.Status.Status)
+	}
+	slices.Sort(states)
+	return health.Status + ";" + strings.Join(states, ",")
 }
\ No newline at end of file
@@ -0,0 +1,165 @@
+package checker
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/health/pkg/config"
+)
+
+// newTestChecker returns a checker with the built-in services and the given
+// configuration changes
+func newTestChecker(t *testing.T, configure func(*config.Config)) *HealthChecker {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Server.OllamaURL = "http://localhost:11434"
+	cfg.HealthCheck.UserAgent = "HealthChecker/test"
+	if configure != nil {
+		configure(cfg)
+	}
+	hc, err := NewHealthChecker(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hc
+}
+
+// flakyService answers 503 to its first failures requests and 200 after
+type flakyService struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func newFlakyService(t *testing.T, failures int) *flakyService {
+	s := &flakyService{failures: failures}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.calls++
+		if s.calls <= s.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestCheckServiceHealthRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		failures     int
+		retries      int
+		wantStatus   string
+		wantCalls    int
+		wantAttempts any
+		wantFailures any
+	}{
+		{"healthy first time", 0, 2, "healthy", 1, nil, nil},
+		{"recovers on a retry", 2, 2, "healthy", 3, 3, nil},
+		{"fails every attempt", 5, 2, "unhealthy", 3, 3, 1},
+		{"no retries", 1, 0, "unhealthy", 1, nil, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			service := newFlakyService(t, tc.failures)
+			hc := newTestChecker(t, nil)
+
+			result := hc.CheckServiceHealth(context.Background(), ServiceEndpoint{
+				Name:       "vector-db",
+				URL:        service.URL,
+				Timeout:    time.Second,
+				Retries:    tc.retries,
+				RetryDelay: time.Millisecond,
+			})
+
+			if result.Status.Status != tc.wantStatus {
+				t.Errorf("status = %q, want %q", result.Status.Status, tc.wantStatus)
+			}
+			if service.calls != tc.wantCalls {
+				t.Errorf("%d requests, want %d", service.calls, tc.wantCalls)
+			}
+			if got := result.Status.Details["attempts"]; got != tc.wantAttempts {
+				t.Errorf("attempts = %v, want %v", got, tc.wantAttempts)
+			}
+			if got := result.Status.Details["consecutive_failures"]; got != tc.wantFailures {
+				t.Errorf("consecutive_failures = %v, want %v", got, tc.wantFailures)
+			}
+		})
+	}
+}
+
+func TestConsecutiveFailuresResetOnSuccess(t *testing.T) {
+	service := newFlakyService(t, 3)
+	hc := newTestChecker(t, nil)
+	endpoint := ServiceEndpoint{Name: "vector-db", URL: service.URL, Timeout: time.Second}
+
+	for i, want := range []any{1, 2, 3, nil, nil} {
+		result := hc.CheckServiceHealth(context.Background(), endpoint)
+		if got := result.Status.Details["consecutive_failures"]; got != want {
+			t.Errorf("check %d: consecutive_failures = %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestCheckExpectations(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		expect  config.ServiceExpectation
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"default accepts 200", config.ServiceExpectation{}, http.StatusOK, "", ""},
+		{"default rejects 204", config.ServiceExpectation{}, http.StatusNoContent, "", "HTTP 204"},
+		{"listed status", config.ServiceExpectation{StatusCodes: []int{200, 204}}, http.StatusNoContent, "", ""},
+		{"unlisted status", config.ServiceExpectation{StatusCodes: []int{204}}, http.StatusOK, "", "expected one of [204]"},
+		{"body contains", config.ServiceExpectation{BodyContains: "ok"}, http.StatusOK, "all ok", ""},
+		{"body lacks", config.ServiceExpectation{BodyContains: "ok"}, http.StatusOK, "failing", `does not contain "ok"`},
+		{"json field", config.ServiceExpectation{JSONField: "status", JSONValue: "healthy"}, http.StatusOK, `{"status":"healthy"}`, ""},
+		{"nested json field", config.ServiceExpectation{JSONField: "db.up", JSONValue: "true"}, http.StatusOK, `{"db":{"up":true}}`, ""},
+		{"json number", config.ServiceExpectation{JSONField: "replicas", JSONValue: "3"}, http.StatusOK, `{"replicas":3}`, ""},
+		{"json value differs", config.ServiceExpectation{JSONField: "status", JSONValue: "healthy"}, http.StatusOK, `{"status":"degraded"}`, `is "degraded", expected "healthy"`},
+		{"json field missing", config.ServiceExpectation{JSONField: "db.up", JSONValue: "true"}, http.StatusOK, `{"db":"up"}`, `"db.up" is missing`},
+		{"body not json", config.ServiceExpectation{JSONField: "status", JSONValue: "healthy"}, http.StatusOK, "healthy", "not valid JSON"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tc.status, Body: io.NopCloser(strings.NewReader(tc.body))}
+			err := checkExpectations(tc.expect, resp)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("checkExpectations() error = %v, want none", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Errorf("checkExpectations() error = %v, want one containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpectationsApplyToServiceChecks(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"status":"degraded"}`)
+	}))
+	defer service.Close()
+	hc := newTestChecker(t, nil)
+
+	result := hc.CheckServiceHealth(context.Background(), ServiceEndpoint{
+		Name:    "vector-db",
+		URL:     service.URL,
+		Timeout: time.Second,
+		Expect:  config.ServiceExpectation{JSONField: "status", JSONValue: "healthy"},
+	})
+	if result.Status.Status != "unhealthy" || result.Status.Error == nil {
+		t.Fatalf("result = %+v, want unhealthy with an error", result.Status)
+	}
+	if !strings.Contains(*result.Status.Error, `expected "healthy"`) {
+		t.Errorf("error = %q, want the unmet expectation", *result.Status.Error)
+	}
+}
@@ -64,12 +64,19 @@ func (hc *HealthChecker) buildAnalysisPrompt(health models.SystemHealth) string
 	sb.WriteString(fmt.Sprintf("OVERALL STATUS: %s\n", strings.ToUpper(health.Status)))
 	sb.WriteString(fmt.Sprintf("Uptime: %.1f hours\n\n", health.UptimeSeconds/3600))
 
-	// Service status
+	// Service status; with many services, healthy ones are only counted so
+	// the prompt stays focused on problems and within the model's context
+	summarize := len(health.Services) > hc.config.HealthCheck.AnalysisDetailThreshold
+	healthyCount := 0
+
 	sb.WriteString("SERVICE STATUS:\n")
 	for _, service := range health.Services {
 		status := "✅"
 		if service.Status.Status != "healthy" {
 			status = "❌"
+		} else if summarize {
+			healthyCount++
+			continue
 		}
 		sb.WriteString(fmt.Sprintf("%s %s: %s", status, service.Name, service.Status.Status))
 		if service.Status.Error != nil {
@@ -80,6 +87,9 @@ func (hc *HealthChecker) buildAnalysisPrompt(health models.SystemHealth) string
 		}
 		sb.WriteString("\n")
 	}
+	if summarize {
+		sb.WriteString(fmt.Sprintf("✅ %d healthy services (not listed individually)\n", healthyCount))
+	}
 
 	// System metrics
 	sb.WriteString(fmt.Sprintf("\nSYSTEM METRICS:\n"))
@@ -101,12 +111,13 @@ func (hc *HealthChecker) buildAnalysisPrompt(health models.SystemHealth) string
 		health.SystemMetrics.Disk.UsedGB,
 		health.SystemMetrics.Disk.TotalGB))
 
-	// Special notes
-	if health.SystemMetrics.CPU.Percent > 80 {
-		sb.WriteString("\n⚠️ HIGH CPU USAGE DETECTED\n")
-	}
-	if health.SystemMetrics.Memory.Percent > 85 {
-		sb.WriteString("\n⚠️ HIGH MEMORY USAGE DETECTED\n")
+	// Special notes for resources above their critical threshold
+	breaches := ThresholdBreaches(health)
+	for _, resource := range []string{"cpu", "memory", "disk"} {
+		if breach, ok := breaches[resource]; ok && breach.Level == LevelCritical {
+			sb.WriteString(fmt.Sprintf("\n⚠️ HIGH %s USAGE DETECTED (%.1f%% > %.0f%%)\n",
+				strings.ToUpper(resource), breach.Percent, breach.Threshold))
+		}
 	}
 
 	sb.WriteString("\nProvide a brief analysis including:\n")
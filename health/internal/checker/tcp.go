@@ -0,0 +1,54 @@
+package checker
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/health/internal/models"
+)
+
+// checkTCP reports a service healthy when a TCP connection to its host:port
+// URL opens within the service timeout, recording the connect latency
+func (hc *HealthChecker) checkTCP(ctx context.Context, service ServiceEndpoint) models.ServiceHealth {
+	dialer := net.Dialer{Timeout: service.Timeout}
+	if dialer.Timeout <= 0 {
+		dialer.Timeout = hc.httpClient.Timeout
+	}
+
+	startTime := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", service.URL)
+	responseTimeMs := float64(time.Since(startTime).Milliseconds())
+
+	if err != nil {
+		errStr := err.Error()
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			errStr = "Connection timeout"
+		} else if strings.Contains(errStr, "refused") {
+			errStr = "Connection refused"
+		}
+		return models.ServiceHealth{
+			Name: service.Name,
+			URL:  service.URL,
+			Status: models.HealthStatus{
+				Status:    "unhealthy",
+				Timestamp: time.Now().UTC().Format(time.RFC3339),
+				Error:     &errStr,
+			},
+			Critical: service.Critical,
+		}
+	}
+	conn.Close()
+
+	return models.ServiceHealth{
+		Name: service.Name,
+		URL:  service.URL,
+		Status: models.HealthStatus{
+			Status:         "healthy",
+			Timestamp:      time.Now().UTC().Format(time.RFC3339),
+			ResponseTimeMs: &responseTimeMs,
+		},
+		Critical: service.Critical,
+	}
+}
@@ -0,0 +1,92 @@
+package checker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atyronesmith/llama-metrics/health/internal/models"
+)
+
+// Threshold levels reported in a models.ThresholdBreach
+const (
+	LevelWarning  = "warning"
+	LevelCritical = "critical"
+)
+
+// thresholdBreaches lists the resources whose usage is above their
+// configured warning or critical threshold
+func (hc *HealthChecker) thresholdBreaches(metrics models.SystemMetrics) []models.ThresholdBreach {
+	thresholds := hc.config.HealthCheck.Thresholds
+	breaches := []models.ThresholdBreach{}
+
+	for _, r := range []struct {
+		resource   string
+		percent    float64
+		warn, crit float64
+	}{
+		{"cpu", metrics.CPU.Percent, thresholds.CPUWarn, thresholds.CPUCrit},
+		{"memory", metrics.Memory.Percent, thresholds.MemWarn, thresholds.MemCrit},
+		{"disk", metrics.Disk.Percent, thresholds.DiskWarn, thresholds.DiskCrit},
+	} {
+		switch {
+		case r.percent > r.crit:
+			breaches = append(breaches, models.ThresholdBreach{Resource: r.resource, Level: LevelCritical, Percent: r.percent, Threshold: r.crit})
+		case r.percent > r.warn:
+			breaches = append(breaches, models.ThresholdBreach{Resource: r.resource, Level: LevelWarning, Percent: r.percent, Threshold: r.warn})
+		}
+	}
+
+	return breaches
+}
+
+// resourceStatus is the health implied by resource pressure: degraded with
+// one resource above its critical threshold, unhealthy with more than one
+func resourceStatus(breaches []models.ThresholdBreach) string {
+	critical := 0
+	for _, breach := range breaches {
+		if breach.Level == LevelCritical {
+			critical++
+		}
+	}
+
+	switch {
+	case critical > 1:
+		return "unhealthy"
+	case critical == 1:
+		return "degraded"
+	default:
+		return "healthy"
+	}
+}
+
+// worseStatus returns the more severe of two health statuses
+func worseStatus(a, b string) string {
+	severity := map[string]int{"healthy": 0, "degraded": 1, "unhealthy": 2}
+	if severity[b] > severity[a] {
+		return b
+	}
+	return a
+}
+
+// describeCriticalBreaches lists the resources above their critical
+// threshold, e.g. "cpu 92.0% > 80%"
+func describeCriticalBreaches(breaches []models.ThresholdBreach) string {
+	var parts []string
+	for _, breach := range breaches {
+		if breach.Level == LevelCritical {
+			parts = append(parts, fmt.Sprintf("%s %.1f%% > %.0f%%", breach.Resource, breach.Percent, breach.Threshold))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ThresholdBreaches returns the resource warnings recorded in a health
+// summary, keyed by resource
+func ThresholdBreaches(health models.SystemHealth) map[string]models.ThresholdBreach {
+	byResource := make(map[string]models.ThresholdBreach)
+	breaches, _ := health.Summary["resource_warnings"].([]models.ThresholdBreach)
+	for _, breach := range breaches {
+		byResource[breach.Resource] = breach
+	}
+	return byResource
+}
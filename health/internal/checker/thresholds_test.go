@@ -0,0 +1,58 @@
+package checker
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/atyronesmith/llama-metrics/health/internal/models"
+	"github.com/atyronesmith/llama-metrics/health/pkg/config"
+)
+
+func TestThresholdBreaches(t *testing.T) {
+	hc := newTestChecker(t, func(cfg *config.Config) {
+		cfg.HealthCheck.Thresholds = config.ResourceThresholds{
+			CPUWarn: 60, CPUCrit: 80,
+			MemWarn: 70, MemCrit: 85,
+			DiskWarn: 60, DiskCrit: 80,
+		}
+	})
+
+	for _, tc := range []struct {
+		name           string
+		cpu, mem, disk float64
+		want           []models.ThresholdBreach
+		wantStatus     string
+	}{
+		{"all below", 10, 20, 30, []models.ThresholdBreach{}, "healthy"},
+		{"at the threshold", 60, 85, 80, []models.ThresholdBreach{
+			{Resource: "memory", Level: LevelWarning, Percent: 85, Threshold: 70},
+			{Resource: "disk", Level: LevelWarning, Percent: 80, Threshold: 60},
+		}, "healthy"},
+		{"warning only", 70, 20, 30, []models.ThresholdBreach{
+			{Resource: "cpu", Level: LevelWarning, Percent: 70, Threshold: 60},
+		}, "healthy"},
+		{"one critical", 90, 75, 30, []models.ThresholdBreach{
+			{Resource: "cpu", Level: LevelCritical, Percent: 90, Threshold: 80},
+			{Resource: "memory", Level: LevelWarning, Percent: 75, Threshold: 70},
+		}, "degraded"},
+		{"two critical", 90, 95, 30, []models.ThresholdBreach{
+			{Resource: "cpu", Level: LevelCritical, Percent: 90, Threshold: 80},
+			{Resource: "memory", Level: LevelCritical, Percent: 95, Threshold: 85},
+		}, "unhealthy"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var metrics models.SystemMetrics
+			metrics.CPU.Percent = tc.cpu
+			metrics.Memory.Percent = tc.mem
+			metrics.Disk.Percent = tc.disk
+
+			breaches := hc.thresholdBreaches(metrics)
+			if !reflect.DeepEqual(breaches, tc.want) {
+				t.Errorf("thresholdBreaches() = %+v, want %+v", breaches, tc.want)
+			}
+			if got := resourceStatus(breaches); got != tc.wantStatus {
+				t.Errorf("resourceStatus() = %q, want %q", got, tc.wantStatus)
+			}
+		})
+	}
+}
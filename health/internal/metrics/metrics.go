@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/health/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// overallStates are the values of the overall health status
+var overallStates = []string{"healthy", "degraded", "unhealthy"}
+
+// Collector holds the Prometheus metrics exported by the health checker
+type Collector struct {
+	// Service check results
+	ServiceUp           *prometheus.GaugeVec
+	CheckDuration       *prometheus.GaugeVec
+	ConsecutiveFailures *prometheus.GaugeVec
+
+	// OverallStatus is 1 for the current overall status only
+	OverallStatus *prometheus.GaugeVec
+	LastCheck     prometheus.Gauge
+
+	// System resources
+	CPUPercent    prometheus.Gauge
+	MemoryPercent prometheus.Gauge
+	DiskPercent   prometheus.Gauge
+}
+
+// NewCollector creates and registers the health checker's metrics
+func NewCollector() *Collector {
+	return &Collector{
+		ServiceUp: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "llama_health_service_up",
+				Help: "Whether the service passed its last health check (1) or not (0)",
+			},
+			[]string{"service"},
+		),
+		CheckDuration: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "llama_health_check_duration_seconds",
+				Help: "How long the service's last health check took, including retries",
+			},
+			[]string{"service"},
+		),
+		ConsecutiveFailures: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "llama_health_service_consecutive_failures",
+				Help: "Number of health checks in a row the service has failed",
+			},
+			[]string{"service"},
+		),
+		OverallStatus: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "llama_health_overall_status",
+				Help: "Overall health status; 1 for the current status, 0 for the others",
+			},
+			[]string{"status"},
+		),
+		LastCheck: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "llama_health_last_check_timestamp_seconds",
+				Help: "Unix time of the last comprehensive health check",
+			},
+		),
+		CPUPercent: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "llama_health_cpu_percent",
+				Help: "CPU usage percentage at the last comprehensive health check",
+			},
+		),
+		MemoryPercent: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "llama_health_memory_percent",
+				Help: "Memory usage percentage at the last comprehensive health check",
+			},
+		),
+		DiskPercent: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "llama_health_disk_percent",
+				Help: "Disk usage percentage at the last comprehensive health check",
+			},
+		),
+	}
+}
+
+// RecordServiceCheck records the result of one service's health check
+func (c *Collector) RecordServiceCheck(service models.ServiceHealth, duration time.Duration) {
+	up := 0.0
+	if service.Status.Status == "healthy" {
+		up = 1
+	}
+	c.ServiceUp.WithLabelValues(service.Name).Set(up)
+	c.CheckDuration.WithLabelValues(service.Name).Set(duration.Seconds())
+
+	failures, _ := service.Status.Details["consecutive_failures"].(int)
+	c.ConsecutiveFailures.WithLabelValues(service.Name).Set(float64(failures))
+}
+
+// RecordHealth records the overall status and system resources of a
+// comprehensive health check
+func (c *Collector) RecordHealth(health models.SystemHealth) {
+	for _, state := range overallStates {
+		current := 0.0
+		if state == health.Status {
+			current = 1
+		}
+		c.OverallStatus.WithLabelValues(state).Set(current)
+	}
+	c.LastCheck.SetToCurrentTime()
+
+	c.CPUPercent.Set(health.SystemMetrics.CPU.Percent)
+	c.MemoryPercent.Set(health.SystemMetrics.Memory.Percent)
+	c.DiskPercent.Set(health.SystemMetrics.Disk.Percent)
+}
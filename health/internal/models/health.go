@@ -70,6 +70,15 @@ type PowerMetrics struct {
 	BatteryInfo string `json:"battery_info,omitempty"`
 }
 
+// ThresholdBreach describes a resource whose usage is above one of its
+// configured thresholds
+type ThresholdBreach struct {
+	Resource  string  `json:"resource"` // cpu, memory, disk
+	Level     string  `json:"level"`    // warning, critical
+	Percent   float64 `json:"percent"`
+	Threshold float64 `json:"threshold"`
+}
+
 // SystemHealth represents overall system health status
 type SystemHealth struct {
 	Status        string                 `json:"status"`
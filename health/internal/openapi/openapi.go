@@ -0,0 +1,209 @@
+// Package openapi describes the health server's endpoints as an OpenAPI 3
+// document, with response schemas generated from the models' JSON tags so
+// the contract can't drift from what the handlers return.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/atyronesmith/llama-metrics/health/internal/models"
+)
+
+// endpoint describes one GET route of the health server
+type endpoint struct {
+	path        string
+	summary     string
+	response    interface{}
+	statusCodes []int
+	parameters  []map[string]interface{}
+	headers     map[string]interface{}
+	deprecated  bool
+}
+
+// cacheHeaders documents the header set by the cached /health endpoints
+var cacheHeaders = map[string]interface{}{
+	"X-Health-Cache": map[string]interface{}{
+		"description": "Whether the result came from the cache",
+		"schema":      map[string]interface{}{"type": "string", "enum": []string{"hit", "miss"}},
+	},
+}
+
+// forceParameter documents the query parameter that bypasses the cache
+var forceParameter = map[string]interface{}{
+	"name":        "force",
+	"in":          "query",
+	"description": "Run the checks now instead of serving the cached result",
+	"schema":      map[string]interface{}{"type": "boolean"},
+}
+
+var endpoints = []endpoint{
+	{
+		path:        "/health",
+		summary:     "Comprehensive health of all services and system resources",
+		response:    models.SystemHealth{},
+		statusCodes: []int{http.StatusOK},
+		parameters:  []map[string]interface{}{forceParameter},
+		headers:     cacheHeaders,
+	},
+	{
+		path:        "/health/simple",
+		summary:     "Basic CPU and memory usage without service checks",
+		response:    models.SimpleHealth{},
+		statusCodes: []int{http.StatusOK},
+	},
+	{
+		path:        "/health/analyzed",
+		summary:     "Comprehensive health with an LLM analysis",
+		response:    models.AnalyzedHealth{},
+		statusCodes: []int{http.StatusOK},
+	},
+	{
+		path:        "/readiness",
+		summary:     "Readiness probe; 503 when not ready",
+		response:    models.ReadinessStatus{},
+		statusCodes: []int{http.StatusOK, http.StatusServiceUnavailable},
+	},
+	{
+		path:        "/liveness",
+		summary:     "Liveness probe; 503 when not alive",
+		response:    models.LivenessStatus{},
+		statusCodes: []int{http.StatusOK, http.StatusServiceUnavailable},
+	},
+	{
+		path:        "/api/health",
+		summary:     "Legacy alias of /health",
+		response:    models.SystemHealth{},
+		statusCodes: []int{http.StatusOK},
+		parameters:  []map[string]interface{}{forceParameter},
+		headers:     cacheHeaders,
+		deprecated:  true,
+	},
+}
+
+// Spec returns the OpenAPI 3 document for the health server
+func Spec(version string) map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]interface{})
+
+	for _, ep := range endpoints {
+		schema := schemaFor(reflect.TypeOf(ep.response), schemas)
+
+		responses := make(map[string]interface{})
+		for _, code := range ep.statusCodes {
+			response := map[string]interface{}{
+				"description": http.StatusText(code),
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schema},
+				},
+			}
+			if ep.headers != nil {
+				response["headers"] = ep.headers
+			}
+			responses[strconv.Itoa(code)] = response
+		}
+
+		operation := map[string]interface{}{
+			"summary":   ep.summary,
+			"responses": responses,
+		}
+		if ep.parameters != nil {
+			operation["parameters"] = ep.parameters
+		}
+		if ep.deprecated {
+			operation["deprecated"] = true
+		}
+		paths[ep.path] = map[string]interface{}{"get": operation}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Llama Metrics Health Checker",
+			"version": version,
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+// schemaFor returns the JSON schema of t. Named structs are added to schemas
+// once and referenced by name.
+func schemaFor(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := schemaFor(t.Elem(), schemas)
+		if _, ok := schema["$ref"]; ok {
+			// Siblings of $ref are ignored, so wrap it
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case reflect.Struct:
+		if _, ok := schemas[t.Name()]; !ok {
+			// Reserve the name first so self-references terminate
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		// interface{} holds any JSON value
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema returns the object schema of a struct's JSON fields, with
+// embedded structs flattened as encoding/json does
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" || !field.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				addFields(field.Type)
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			properties[name] = schemaFor(field.Type, schemas)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if required != nil {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -10,9 +10,10 @@ import (
 
 // Config represents the complete configuration
 type Config struct {
-	Server     ServerConfig     `yaml:"server"`
-	Models     ModelConfig      `yaml:"models"`
-	Monitoring MonitoringConfig `yaml:"monitoring"`
+	Server      ServerConfig      `yaml:"server"`
+	Models      ModelConfig       `yaml:"models"`
+	Monitoring  MonitoringConfig  `yaml:"monitoring"`
+	HealthCheck HealthCheckConfig `yaml:"health_check"`
 }
 
 // ServerConfig represents server configuration
@@ -42,6 +43,76 @@ type MonitoringConfig struct {
 	MaxQueueSize          int `yaml:"max_queue_size"`
 }
 
+// HealthCheckConfig represents health checker request configuration
+type HealthCheckConfig struct {
+	UserAgent string `yaml:"user_agent"`
+	// Headers maps a service name to extra request headers. Values are
+	// expanded from the environment, e.g. "Bearer ${METRICS_TOKEN}".
+	Headers map[string]map[string]string `yaml:"headers"`
+	// Expect maps a service name to what a healthy response looks like
+	Expect map[string]ServiceExpectation `yaml:"expect"`
+	// AnalysisDetailThreshold is the service count above which the LLM
+	// analysis prompt lists only unhealthy services and counts the rest
+	AnalysisDetailThreshold int `yaml:"analysis_detail_threshold"`
+	// CacheTTL is how many seconds GET /health serves the last comprehensive
+	// result before running the checks again; negative disables the cache
+	CacheTTL int `yaml:"cache_ttl"`
+	// CheckInterval is how many seconds apart the server runs the checks in
+	// the background, keeping /metrics current; negative disables it
+	CheckInterval int `yaml:"check_interval"`
+	// AnalysisCacheTTL is how many seconds /health/analyzed reuses the last
+	// LLM analysis while no service changes status; negative disables it
+	AnalysisCacheTTL int `yaml:"analysis_cache_ttl"`
+	// Services adds services to check, or overrides the URL, criticality or
+	// timeout of a built-in one (ollama, proxy, metrics, dashboard) by name.
+	// The ollama check always uses Server.OllamaURL, so its URL and type
+	// can't be overridden.
+	Services []ServiceConfig `yaml:"services"`
+	// Thresholds are the resource usage percentages reported as warning and
+	// critical; a critical one degrades the overall status
+	Thresholds ResourceThresholds `yaml:"thresholds"`
+}
+
+// ResourceThresholds holds warning and critical usage percentages for CPU,
+// memory and disk
+type ResourceThresholds struct {
+	CPUWarn  float64 `yaml:"cpu_warn"`
+	CPUCrit  float64 `yaml:"cpu_crit"`
+	MemWarn  float64 `yaml:"mem_warn"`
+	MemCrit  float64 `yaml:"mem_crit"`
+	DiskWarn float64 `yaml:"disk_warn"`
+	DiskCrit float64 `yaml:"disk_crit"`
+}
+
+// ServiceConfig defines a service to check. Fields left unset keep the
+// built-in service's value; a new service needs a URL.
+type ServiceConfig struct {
+	Name string `yaml:"name"`
+	// Type is "http" (default), a GET of URL, or "tcp", a connect to URL
+	// given as host:port, for backends such as databases that don't speak HTTP
+	Type     string `yaml:"type"`
+	URL      string `yaml:"url"`
+	Critical *bool  `yaml:"critical"`
+	// Timeout is in seconds
+	Timeout int `yaml:"timeout"`
+	// Retries is how many times a failed check is retried, RetryDelayMs
+	// apart, before the service is reported unhealthy
+	Retries      int `yaml:"retries"`
+	RetryDelayMs int `yaml:"retry_delay_ms"`
+}
+
+// ServiceExpectation describes a healthy response beyond plain reachability
+type ServiceExpectation struct {
+	// StatusCodes lists acceptable status codes (default: 200)
+	StatusCodes []int `yaml:"status_codes"`
+	// BodyContains is a substring the response body must contain
+	BodyContains string `yaml:"body_contains"`
+	// JSONField is a dot-separated path into the JSON body whose value must
+	// equal JSONValue, e.g. json_field: "status", json_value: "ok"
+	JSONField string `yaml:"json_field"`
+	JSONValue string `yaml:"json_value"`
+}
+
 // LoadConfig loads configuration from file
 func LoadConfig(configPath string) (*Config, error) {
 	// If no path provided, look for config.yml in current directory
@@ -90,6 +161,66 @@ func LoadConfig(configPath string) (*Config, error) {
 	if config.Models.DefaultModel == "" {
 		config.Models.DefaultModel = "phi3:mini"
 	}
+	if config.HealthCheck.UserAgent == "" {
+		config.HealthCheck.UserAgent = "HealthChecker/1.0"
+	}
+	if config.HealthCheck.AnalysisDetailThreshold <= 0 {
+		config.HealthCheck.AnalysisDetailThreshold = 10
+	}
+	if config.HealthCheck.CacheTTL == 0 {
+		config.HealthCheck.CacheTTL = 10
+	}
+	if config.HealthCheck.CheckInterval == 0 {
+		config.HealthCheck.CheckInterval = 15
+	}
+	if config.HealthCheck.AnalysisCacheTTL == 0 {
+		config.HealthCheck.AnalysisCacheTTL = 60
+	}
+	thresholds := &config.HealthCheck.Thresholds
+	for _, t := range []struct {
+		name       string
+		warn, crit *float64
+		defWarn    float64
+		defCrit    float64
+	}{
+		{"cpu", &thresholds.CPUWarn, &thresholds.CPUCrit, 60, 80},
+		{"mem", &thresholds.MemWarn, &thresholds.MemCrit, 70, 85},
+		{"disk", &thresholds.DiskWarn, &thresholds.DiskCrit, 60, 80},
+	} {
+		if *t.warn == 0 {
+			*t.warn = t.defWarn
+		}
+		if *t.crit == 0 {
+			*t.crit = t.defCrit
+		}
+		if *t.warn < 0 || *t.crit > 100 || *t.warn > *t.crit {
+			return nil, fmt.Errorf("health_check.thresholds: need 0 <= %s_warn (%g) <= %s_crit (%g) <= 100", t.name, *t.warn, t.name, *t.crit)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, service := range config.HealthCheck.Services {
+		if service.Name == "" {
+			return nil, fmt.Errorf("health_check.services: every service needs a name")
+		}
+		if seen[service.Name] {
+			return nil, fmt.Errorf("health_check.services: service %q is listed twice", service.Name)
+		}
+		seen[service.Name] = true
+		if service.Name == "ollama" && (service.URL != "" || service.Type != "") {
+			return nil, fmt.Errorf("health_check.services: the ollama check runs a test generation against server.ollama_url; set that rather than its url or type")
+		}
+		if service.Type != "" && service.Type != "http" && service.Type != "tcp" {
+			return nil, fmt.Errorf("health_check.services: service %q has unknown type %q (use http or tcp)", service.Name, service.Type)
+		}
+		if service.Timeout < 0 || service.Retries < 0 || service.RetryDelayMs < 0 {
+			return nil, fmt.Errorf("health_check.services: service %q has a negative timeout, retries or retry_delay_ms", service.Name)
+		}
+	}
+	for _, headers := range config.HealthCheck.Headers {
+		for name, value := range headers {
+			headers[name] = os.ExpandEnv(value)
+		}
+	}
 
 	return &config, nil
 }
\ No newline at end of file
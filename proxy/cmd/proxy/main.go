@@ -8,11 +8,20 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/atyronesmith/llama-metrics/proxy/internal/apikeys"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/backend"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/circuit"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/contentfilter"
 	"github.com/atyronesmith/llama-metrics/proxy/internal/handlers"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/inflight"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/logging"
 	"github.com/atyronesmith/llama-metrics/proxy/internal/metrics"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/modelload"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/requestlog"
 	"github.com/atyronesmith/llama-metrics/proxy/pkg/config"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -20,9 +29,19 @@ import (
 
 func main() {
 	// Load configuration
-	cfg := config.DefaultConfig()
-	cfg.LoadFromEnv()
-	cfg.LoadFromFlags()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Log as JSON lines from here on
+	logger := logging.New(cfg.LogLevel)
+	for _, warning := range cfg.Warnings() {
+		log.Printf("⚠️  Config: %s", warning)
+	}
+	for _, setting := range cfg.Effective() {
+		log.Printf("⚙️  %s=%s (%s)", setting.Name, setting.Value, setting.Source)
+	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
@@ -37,30 +56,106 @@ func main() {
 	}
 
 	// Initialize metrics
-	metricsCollector := metrics.NewCollector()
+	metrics.SetConstLabels(cfg.MetricLabels())
+	metricsCollector := metrics.NewCollector(cfg.MinRateTokens)
+	if cfg.SharedQueueMetrics {
+		metricsCollector.EnableSharedQueueMetrics()
+	}
+	if cfg.PricingFile != "" {
+		pricing, err := metrics.LoadPricing(cfg.PricingFile)
+		if err != nil {
+			log.Fatalf("Failed to load pricing: %v", err)
+		}
+		metricsCollector.SetPricing(pricing)
+		log.Printf("💰 Loaded prices for %d models from %s", len(pricing.Models), cfg.PricingFile)
+	}
 
 	// Start system metrics collector
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Use standard system collector for all platforms
-	systemCollector := metrics.NewSystemCollector(metricsCollector, 10*time.Second)
+	systemCollector := metrics.NewSystemCollector(metricsCollector, cfg.SystemMetricsInterval, cfg.RunnerMemoryTopN)
 	systemCollector.Start(ctx)
 
 	// On macOS, also start Mac-specific collector
 	if runtime.GOOS == "darwin" {
-		macCollector := metrics.NewMacSystemCollector(metricsCollector, 10*time.Second)
+		macCollector := metrics.NewMacSystemCollector(metricsCollector, cfg.SystemMetricsInterval, metrics.MacCollectorOptions{
+			Helper:         cfg.MacCollectHelper,
+			GPU:            cfg.MacCollectGPU,
+			Temperature:    cfg.MacCollectTemp,
+			MemoryPressure: cfg.MacCollectMemoryPressure,
+			DiskIO:         cfg.MacCollectDiskIO,
+			DiskDevice:     cfg.MacDiskDevice,
+			Debug:          cfg.LogLevel == "debug",
+		})
 		macCollector.Start(ctx)
 		log.Println("📱 Mac system metrics collector started")
 	}
 
+	// Load the optional content filter
+	var contentFilter contentfilter.Filter
+	if cfg.ContentFilterFile != "" {
+		patternFilter, err := contentfilter.LoadPatternFile(cfg.ContentFilterFile, cfg.ContentFilterResponse)
+		if err != nil {
+			log.Fatalf("Failed to load content filter: %v", err)
+		}
+		contentFilter = patternFilter
+		log.Printf("🛡️  Content filter loaded from %s (responses: %s)", cfg.ContentFilterFile, cfg.ContentFilterResponse)
+	}
+
+	// Serialize loads of non-resident models, shared by all handlers
+	var modelLoads *modelload.Guard
+	if cfg.MaxModelLoads > 0 {
+		modelLoads = modelload.New(cfg.MaxModelLoads, metricsCollector)
+	}
+
+	// Spread requests across the Ollama backends, shared by all handlers.
+	// With a circuit breaker, each backend fails fast on its own.
+	var breaker *circuit.Options
+	if cfg.CircuitErrorThreshold > 0 {
+		breaker = &circuit.Options{
+			ErrorThreshold: cfg.CircuitErrorThreshold,
+			MinRequests:    cfg.CircuitMinRequests,
+			Window:         cfg.CircuitWindow,
+			Cooldown:       cfg.CircuitCooldown,
+		}
+	}
+	backends := backend.New(cfg.OllamaURLs(), cfg.LoadBalanceStrategy, breaker, metricsCollector)
+
 	// Create handlers
-	proxyHandler := handlers.NewProxyHandler(cfg, metricsCollector)
-	openAIHandler := handlers.NewOpenAIHandler(cfg, metricsCollector)
-	healthHandler := handlers.NewHealthHandler(cfg)
+	proxyHandler := handlers.NewProxyHandler(cfg, metricsCollector, contentFilter, modelLoads, backends)
+	openAIHandler := handlers.NewOpenAIHandler(cfg, metricsCollector, contentFilter, modelLoads, backends)
+
+	// Count in-flight requests independently of the Prometheus gauges
+	inFlight := inflight.New()
+	healthHandler := handlers.NewHealthHandler(cfg, inFlight)
+
+	// Keep a bounded log of recent requests for quick triage
+	requestLog := requestlog.New(cfg.RequestLogSize)
+	adminHandler := handlers.NewAdminHandler(cfg, requestLog)
 
 		// Setup proxy router
-	proxyRouter := gin.Default()
+	proxyRouter := gin.New()
+	proxyRouter.Use(gin.Recovery(), logging.Middleware(logger))
+	if err := proxyRouter.SetTrustedProxies(cfg.ParsedTrustedProxies()); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+	proxyRouter.Use(inFlight.Middleware())
+	proxyRouter.Use(requestLog.Middleware())
+
+	// Require API keys and apply their per-key policies
+	if cfg.APIKeysFile != "" {
+		keyStore, err := apikeys.Load(cfg.APIKeysFile, metricsCollector)
+		if err != nil {
+			log.Fatalf("Failed to load API keys: %v", err)
+		}
+		proxyRouter.Use(keyStore.Middleware())
+		log.Printf("🔑 Loaded %d API keys from %s", keyStore.Len(), cfg.APIKeysFile)
+	}
+	if breaker != nil {
+		proxyRouter.Use(backends.Middleware())
+	}
 
 	// Ollama native API routes
 	proxyRouter.POST("/api/generate", proxyHandler.HandleGenerate)
@@ -69,18 +164,32 @@ func main() {
 	// OpenAI-compatible API routes
 	proxyRouter.POST("/v1/chat/completions", openAIHandler.HandleChatCompletions)
 	proxyRouter.POST("/v1/completions", openAIHandler.HandleCompletions)
-	proxyRouter.GET("/v1/models", func(c *gin.Context) {
-		// Proxy to Ollama's models endpoint and transform response
-		proxyHandler.HandleDefault(c)
-	})
+	proxyRouter.POST("/v1/embeddings", openAIHandler.HandleEmbeddings)
+	proxyRouter.GET("/v1/models", openAIHandler.HandleModels)
 
 	// Default handler for all unmatched routes - this will handle all other paths
 	proxyRouter.NoRoute(proxyHandler.HandleDefault)
 
 	// Setup metrics router
 	metricsRouter := gin.New()
+	if err := metricsRouter.SetTrustedProxies(cfg.ParsedTrustedProxies()); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
 	metricsRouter.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	metricsRouter.GET("/health", healthHandler.Handle)
+	metricsRouter.GET("/ready", healthHandler.HandleReady)
+	metricsRouter.GET("/queue/stats", proxyHandler.HandleQueueStats)
+
+	// Debug endpoints for test environments
+	if cfg.DebugEndpointsEnabled() {
+		debugHandler := handlers.NewDebugHandler(metricsCollector)
+		metricsRouter.POST("/metrics/reset", debugHandler.HandleMetricsReset)
+		log.Println("🧪 Debug endpoints enabled: POST /metrics/reset")
+	}
+
+	// Admin endpoints (require ADMIN_TOKEN)
+	adminRouter := metricsRouter.Group("/admin", adminHandler.RequireAuth)
+	adminRouter.GET("/requests/recent", adminHandler.HandleRecentRequests)
 
 	// Create servers
 	proxySrv := &http.Server{
@@ -98,7 +207,11 @@ func main() {
 		log.Printf("🚀 Ollama Monitoring Proxy Started")
 		log.Printf("🔄 Proxy listening on http://localhost:%d", cfg.ProxyPort)
 		log.Printf("📊 Metrics available at http://localhost:%d/metrics", cfg.MetricsPort)
-		log.Printf("🎯 Forwarding requests to %s", cfg.OllamaURL())
+		if urls := backends.URLs(); len(urls) > 1 {
+			log.Printf("🎯 Forwarding requests to %s (%s)", strings.Join(urls, ", "), cfg.LoadBalanceStrategy)
+		} else {
+			log.Printf("🎯 Forwarding requests to %s", urls[0])
+		}
 		log.Printf("🖥️  Running on %s/%s", runtime.GOOS, runtime.GOARCH)
 		log.Printf("Use proxy URL in your applications for monitoring")
 
@@ -120,6 +233,16 @@ func main() {
 
 	log.Println("Shutting down servers...")
 
+	// Let queued requests finish, rejecting new ones, before closing the
+	// servers
+	requestQueue := proxyHandler.Queue()
+	queued, running := requestQueue.Pending()
+	log.Printf("Draining request queue: %d queued, %d running", queued, running)
+	drainErr := requestQueue.Shutdown(cfg.ShutdownTimeout)
+	if drainErr != nil {
+		log.Printf("⚠️  %v", drainErr)
+	}
+
 	// Shutdown servers with timeout
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer shutdownCancel()
@@ -133,4 +256,9 @@ func main() {
 	}
 
 	log.Println("✅ Servers stopped")
+
+	if drainErr != nil {
+		shutdownCancel()
+		os.Exit(1)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,274 @@
+package apikeys
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/metrics"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/requestlog"
+	"github.com/gin-gonic/gin"
+)
+
+// ContextKey is the gin context key holding the caller's *Key
+const ContextKey = "apikeys.key"
+
+// Policy is the QoS class assigned to one API key
+type Policy struct {
+	// ID identifies the key in metrics and logs; the secret is never exported
+	ID string `json:"id"`
+	// Key is the secret clients send; ${VAR} references are expanded from
+	// the environment so secrets can stay out of the file
+	Key string `json:"key"`
+	// Priority is the queue priority for the key's requests: "normal",
+	// "high" or "critical"
+	Priority string `json:"priority"`
+	// RateLimit is the maximum requests per minute (0 means unlimited)
+	RateLimit int `json:"rate_limit"`
+	// TokenBudget is the maximum prompt plus generated tokens per UTC day
+	// (0 means unlimited)
+	TokenBudget int `json:"token_budget"`
+	// AllowedModels restricts the Ollama models the key may use (empty
+	// means all models). Names without a tag match ":latest", as they do
+	// in Ollama.
+	AllowedModels []string `json:"allowed_models"`
+}
+
+// file is the layout of the API keys file
+type file struct {
+	Keys []Policy `json:"keys"`
+}
+
+// Key is a loaded policy together with its usage state
+type Key struct {
+	Policy
+
+	metrics *metrics.Collector
+
+	mu         sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+	budgetDay  string
+	tokensUsed int
+}
+
+// Store holds the configured API keys, indexed by a hash of the secret
+type Store struct {
+	keys    map[[sha256.Size]byte]*Key
+	metrics *metrics.Collector
+}
+
+// Load reads API key policies from a JSON file:
+//
+//	{"keys": [{"id": "team-a", "key": "${TEAM_A_KEY}", "priority": "high",
+//	  "rate_limit": 60, "token_budget": 200000, "allowed_models": ["llama2"]}]}
+func Load(path string, m *metrics.Collector) (*Store, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file: %w", err)
+	}
+
+	s := &Store{
+		keys:    make(map[[sha256.Size]byte]*Key),
+		metrics: m,
+	}
+	ids := make(map[string]bool)
+	for i, p := range f.Keys {
+		p.Key = os.ExpandEnv(p.Key)
+		switch {
+		case p.ID == "":
+			return nil, fmt.Errorf("API key %d: id is required", i+1)
+		case ids[p.ID]:
+			return nil, fmt.Errorf("API key %s: duplicate id", p.ID)
+		case p.Key == "":
+			return nil, fmt.Errorf("API key %s: key is empty", p.ID)
+		case p.Priority != "" && p.Priority != "normal" && p.Priority != "high" && p.Priority != "critical":
+			return nil, fmt.Errorf("API key %s: priority must be normal, high or critical, got %q", p.ID, p.Priority)
+		case p.RateLimit < 0 || p.TokenBudget < 0:
+			return nil, fmt.Errorf("API key %s: rate_limit and token_budget must be non-negative", p.ID)
+		}
+
+		hash := sha256.Sum256([]byte(p.Key))
+		if _, exists := s.keys[hash]; exists {
+			return nil, fmt.Errorf("API key %s: same secret as another key", p.ID)
+		}
+		ids[p.ID] = true
+		s.keys[hash] = &Key{
+			Policy:     p,
+			metrics:    m,
+			tokens:     float64(p.RateLimit),
+			lastRefill: time.Now(),
+		}
+	}
+
+	return s, nil
+}
+
+// Len returns the number of configured keys
+func (s *Store) Len() int {
+	return len(s.keys)
+}
+
+// Lookup finds the key for a secret
+func (s *Store) Lookup(secret string) (*Key, bool) {
+	key, ok := s.keys[sha256.Sum256([]byte(secret))]
+	return key, ok
+}
+
+// Middleware authenticates requests by API key and applies the key's
+// policy. The key is read from "Authorization: Bearer" or X-API-Key. The
+// key's priority and ID replace any client-supplied X-Priority and X-User
+// headers, so queue priority and per-user limits are server-enforced.
+func (s *Store) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret := c.GetHeader("X-API-Key")
+		if auth := c.GetHeader("Authorization"); secret == "" && strings.HasPrefix(auth, "Bearer ") {
+			secret = strings.TrimPrefix(auth, "Bearer ")
+		}
+
+		key, ok := s.Lookup(secret)
+		if !ok {
+			s.metrics.RecordAPIKeyRejected("unknown", "unauthorized")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or missing API key"})
+			return
+		}
+
+		if !key.allowRequest() {
+			key.reject(c, "rate_limit", "60", "API key rate limit exceeded")
+			return
+		}
+		if !key.withinBudget() {
+			key.reject(c, "token_budget", strconv.Itoa(secondsUntilNextDay()), "API key daily token budget exhausted")
+			return
+		}
+
+		// Keep the proxy's secret from reaching Ollama
+		c.Request.Header.Del("Authorization")
+		c.Request.Header.Del("X-API-Key")
+
+		priority := key.Priority
+		if priority == "" {
+			priority = "normal"
+		}
+		c.Request.Header.Set("X-Priority", priority)
+		c.Request.Header.Set("X-User", key.ID)
+		c.Set(requestlog.UserKey, key.ID)
+		c.Set(ContextKey, key)
+
+		c.Next()
+
+		tokens := c.GetInt(requestlog.TokensKey)
+		key.addTokens(tokens)
+		s.metrics.RecordAPIKeyUsage(key.ID, c.Writer.Status(), tokens)
+	}
+}
+
+// ModelAllowed reports whether the request's API key may use model. Requests
+// without a key, and keys without a model list, may use any model.
+func ModelAllowed(c *gin.Context, model string) bool {
+	value, ok := c.Get(ContextKey)
+	if !ok {
+		return true
+	}
+	key := value.(*Key)
+	if len(key.AllowedModels) == 0 {
+		return true
+	}
+	model = normalizeModel(model)
+	for _, allowed := range key.AllowedModels {
+		if normalizeModel(allowed) == model {
+			return true
+		}
+	}
+	key.metrics.RecordAPIKeyRejected(key.ID, "model_not_allowed")
+	return false
+}
+
+// normalizeModel adds the implicit ":latest" tag so "llama2" matches
+// "llama2:latest"
+func normalizeModel(model string) string {
+	if !strings.Contains(model, ":") {
+		return model + ":latest"
+	}
+	return model
+}
+
+func (k *Key) reject(c *gin.Context, reason, retryAfter, message string) {
+	k.metrics.RecordAPIKeyRejected(k.ID, reason)
+	c.Header("Retry-After", retryAfter)
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": message})
+}
+
+// allowRequest takes one request from the key's token bucket, which refills
+// at RateLimit requests per minute
+func (k *Key) allowRequest() bool {
+	if k.RateLimit == 0 {
+		return true
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	rate := float64(k.RateLimit) / 60
+	k.tokens = math.Min(float64(k.RateLimit), k.tokens+now.Sub(k.lastRefill).Seconds()*rate)
+	k.lastRefill = now
+
+	if k.tokens < 1 {
+		return false
+	}
+	k.tokens--
+	return true
+}
+
+// withinBudget reports whether the key has tokens left for today
+func (k *Key) withinBudget() bool {
+	if k.TokenBudget == 0 {
+		return true
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.resetBudgetIfNewDay()
+	return k.tokensUsed < k.TokenBudget
+}
+
+func (k *Key) addTokens(tokens int) {
+	if k.TokenBudget == 0 || tokens == 0 {
+		return
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.resetBudgetIfNewDay()
+	k.tokensUsed += tokens
+}
+
+// resetBudgetIfNewDay clears the token count at UTC midnight; k.mu must be held
+func (k *Key) resetBudgetIfNewDay() {
+	today := time.Now().UTC().Format("2006-01-02")
+	if k.budgetDay != today {
+		k.budgetDay = today
+		k.tokensUsed = 0
+	}
+}
+
+func secondsUntilNextDay() int {
+	now := time.Now().UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return int(next.Sub(now).Seconds()) + 1
+}
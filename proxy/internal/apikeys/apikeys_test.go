@@ -0,0 +1,225 @@
+package apikeys
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/metrics"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/requestlog"
+	"github.com/gin-gonic/gin"
+)
+
+// The collector registers with the default Prometheus registry, so the
+// tests share one
+var (
+	sharedMetrics     *metrics.Collector
+	sharedMetricsOnce sync.Once
+)
+
+func testMetrics() *metrics.Collector {
+	sharedMetricsOnce.Do(func() {
+		gin.SetMode(gin.TestMode)
+		sharedMetrics = metrics.NewCollector(5)
+	})
+	return sharedMetrics
+}
+
+const testKeys = `{"keys": [
+	{"id": "team-a", "key": "secret-a", "priority": "high", "rate_limit": 2, "allowed_models": ["llama2:7b"]},
+	{"id": "team-b", "key": "secret-b", "token_budget": 150},
+	{"id": "team-c", "key": "secret-c", "allowed_models": ["llama2", "mistral:latest"]},
+	{"id": "ops", "key": "${OPS_KEY}", "priority": "critical"}
+]}`
+
+func loadKeys(t *testing.T, contents string) (*Store, error) {
+	t.Helper()
+	t.Setenv("OPS_KEY", "secret-ops")
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path, testMetrics())
+}
+
+// seen is what the handler behind the middleware observed
+type seen struct {
+	priority, user string
+	modelOK        bool
+	authHeader     string
+}
+
+// newRouter serves /generate behind the store's middleware. The handler
+// reports 100 tokens used and whether the key may use the model named in
+// the ?model= query.
+func newRouter(s *Store, got *seen) *gin.Engine {
+	router := gin.New()
+	router.Use(s.Middleware())
+	router.POST("/generate", func(c *gin.Context) {
+		got.priority = c.GetHeader("X-Priority")
+		got.user = c.GetHeader("X-User")
+		got.authHeader = c.GetHeader("Authorization") + c.GetHeader("X-API-Key")
+		got.modelOK = ModelAllowed(c, c.Query("model"))
+		c.Set(requestlog.TokensKey, 100)
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func send(router *gin.Engine, secret, model string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/generate?model="+model, nil)
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddlewareRejectsUnknownKeys(t *testing.T) {
+	s, err := loadKeys(t, testKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newRouter(s, &seen{})
+
+	for _, secret := range []string{"", "wrong"} {
+		if rec := send(router, secret, "llama2:7b", nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("key %q: status = %d, want 401", secret, rec.Code)
+		}
+	}
+}
+
+func TestMiddlewareAppliesKeyPriorityAndIdentity(t *testing.T) {
+	s, err := loadKeys(t, testKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		secret       string
+		wantPriority string
+		wantUser     string
+	}{
+		{"secret-a", "high", "team-a"},
+		{"secret-b", "normal", "team-b"},
+		{"secret-ops", "critical", "ops"},
+	} {
+		var got seen
+		// Client-supplied headers must not override the key's policy
+		rec := send(newRouter(s, &got), tc.secret, "llama2:7b", map[string]string{"X-Priority": "critical", "X-User": "someone-else"})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", tc.wantUser, rec.Code)
+		}
+		if got.priority != tc.wantPriority || got.user != tc.wantUser {
+			t.Errorf("%s: X-Priority %q, X-User %q; want %q, %q", tc.wantUser, got.priority, got.user, tc.wantPriority, tc.wantUser)
+		}
+		if got.authHeader != "" {
+			t.Errorf("%s: the API key was forwarded upstream", tc.wantUser)
+		}
+	}
+}
+
+func TestModelAllowList(t *testing.T) {
+	s, err := loadKeys(t, testKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		secret, model string
+		want          bool
+	}{
+		{"secret-a", "llama2:7b", true},
+		{"secret-a", "mistral:7b", false},
+		{"secret-b", "mistral:7b", true}, // no list allows every model
+		// Names without a tag match ":latest" on either side
+		{"secret-c", "llama2", true},
+		{"secret-c", "llama2:latest", true},
+		{"secret-c", "mistral", true},
+		{"secret-c", "mistral:latest", true},
+		{"secret-c", "llama2:7b", false},
+	} {
+		var got seen
+		send(newRouter(s, &got), tc.secret, tc.model, nil)
+		if got.modelOK != tc.want {
+			t.Errorf("%s using %s: ModelAllowed = %v, want %v", tc.secret, tc.model, got.modelOK, tc.want)
+		}
+	}
+
+	// Requests without a key, when keys aren't required, may use any model
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	if !ModelAllowed(c, "mistral:7b") {
+		t.Error("ModelAllowed without a key = false, want true")
+	}
+}
+
+func TestRateLimitIsPerKey(t *testing.T) {
+	s, err := loadKeys(t, testKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newRouter(s, &seen{})
+
+	// team-a may make 2 requests a minute
+	for i := 0; i < 2; i++ {
+		if rec := send(router, "secret-a", "llama2:7b", nil); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, rec.Code)
+		}
+	}
+	rec := send(router, "secret-a", "llama2:7b", nil)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("third request: status %d, Retry-After %q; want 429, 60", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// team-b has no rate limit and isn't affected by team-a's
+	if rec := send(router, "secret-b", "llama2:7b", nil); rec.Code != http.StatusOK {
+		t.Errorf("other key: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestTokenBudget(t *testing.T) {
+	s, err := loadKeys(t, testKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newRouter(s, &seen{})
+
+	// Each request uses 100 tokens of team-b's 150; the second starts
+	// under budget, the third doesn't
+	for i := 0; i < 2; i++ {
+		if rec := send(router, "secret-b", "llama2:7b", nil); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, rec.Code)
+		}
+	}
+	if rec := send(router, "secret-b", "llama2:7b", nil); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("over budget: status = %d, want 429", rec.Code)
+	}
+}
+
+func TestLoadRejectsInvalidPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		name, keys, wantErr string
+	}{
+		{"missing id", `{"keys": [{"key": "k"}]}`, "id is required"},
+		{"duplicate id", `{"keys": [{"id": "a", "key": "k1"}, {"id": "a", "key": "k2"}]}`, "duplicate id"},
+		{"empty key", `{"keys": [{"id": "a", "key": "${UNSET_TEST_KEY}"}]}`, "key is empty"},
+		{"bad priority", `{"keys": [{"id": "a", "key": "k", "priority": "urgent"}]}`, "priority must be"},
+		{"negative limit", `{"keys": [{"id": "a", "key": "k", "rate_limit": -1}]}`, "non-negative"},
+		{"shared secret", `{"keys": [{"id": "a", "key": "k"}, {"id": "b", "key": "k"}]}`, "same secret"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadKeys(t, tc.keys)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Load() error = %v, want one containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
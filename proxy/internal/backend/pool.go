@@ -0,0 +1,193 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/circuit"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Load balancing strategies
+const (
+	RoundRobin  = "round-robin"
+	LeastActive = "least-active"
+)
+
+// ErrUnavailable is returned by Pick when every backend's circuit breaker
+// is open
+var ErrUnavailable = errors.New("all Ollama backends are failing")
+
+// Backend is one Ollama instance
+type Backend struct {
+	// URL is the base URL requests are sent to, e.g. http://host:11434
+	URL string
+	// Name labels the backend's metrics; it is the URL's host:port
+	Name string
+
+	breaker *circuit.Breaker
+	active  atomic.Int64
+}
+
+// Pool spreads upstream requests across one or more Ollama backends. With a
+// circuit breaker configured, each backend gets its own breaker and backends
+// whose breaker is open are skipped.
+type Pool struct {
+	backends []*Backend
+	byHost   map[string]*Backend
+	strategy string
+	metrics  *metrics.Collector
+	next     atomic.Uint64
+}
+
+// New creates a pool over urls. A nil breaker disables circuit breaking.
+func New(urls []string, strategy string, breaker *circuit.Options, m *metrics.Collector) *Pool {
+	p := &Pool{
+		byHost:   make(map[string]*Backend),
+		strategy: strategy,
+		metrics:  m,
+	}
+
+	for _, raw := range urls {
+		b := &Backend{URL: raw, Name: raw}
+		if u, err := url.Parse(raw); err == nil && u.Host != "" {
+			b.Name = u.Host
+		}
+		if breaker != nil {
+			b.breaker = circuit.New(b.Name, *breaker, m)
+		}
+		p.backends = append(p.backends, b)
+		p.byHost[b.Name] = b
+	}
+
+	return p
+}
+
+// URLs returns every backend's URL
+func (p *Pool) URLs() []string {
+	urls := make([]string, len(p.backends))
+	for i, b := range p.backends {
+		urls[i] = b.URL
+	}
+	return urls
+}
+
+// Pick chooses the backend for one upstream request. The returned release
+// must be called once the request finishes.
+func (p *Pool) Pick() (*Backend, func(), error) {
+	// Rotate the starting point so equally good backends share the load
+	start := int(p.next.Add(1) - 1)
+	candidates := make([]*Backend, len(p.backends))
+	for i := range p.backends {
+		candidates[i] = p.backends[(start+i)%len(p.backends)]
+	}
+	if p.strategy == LeastActive {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].active.Load() < candidates[j].active.Load()
+		})
+	}
+
+	for _, b := range candidates {
+		probe := false
+		if b.breaker != nil {
+			var ok bool
+			if ok, probe = b.breaker.Allow(); !ok {
+				continue
+			}
+		}
+
+		b.active.Add(1)
+		p.metrics.RecordBackendRequest(b.Name)
+		p.metrics.BackendActiveRequests.WithLabelValues(b.Name).Inc()
+
+		return b, func() {
+			b.active.Add(-1)
+			p.metrics.BackendActiveRequests.WithLabelValues(b.Name).Dec()
+			// A probe that was rejected before reaching Ollama leaves the
+			// breaker half-open for the next one
+			if probe {
+				b.breaker.CancelProbe()
+			}
+		}, nil
+	}
+
+	return nil, nil, ErrUnavailable
+}
+
+// RetryAfter returns the seconds until the first backend's circuit breaker
+// half-opens, or 0 while any backend takes requests
+func (p *Pool) RetryAfter() int {
+	_, retryAfter := p.available()
+	return retryAfter
+}
+
+// available reports whether any backend would take a request, and if not,
+// the seconds until the first one half-opens
+func (p *Pool) available() (bool, int) {
+	retryAfter := 0
+	for _, b := range p.backends {
+		if b.breaker == nil || b.breaker.Ready() {
+			return true, 0
+		}
+		if wait := b.breaker.RetryAfter(); retryAfter == 0 || wait < retryAfter {
+			retryAfter = wait
+		}
+	}
+	return false, retryAfter
+}
+
+// Middleware fails requests fast with 503 while every backend's circuit
+// breaker is open
+func (p *Pool) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ok, retryAfter := p.available()
+		if !ok {
+			p.metrics.RecordError("unknown", "circuit_open")
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": gin.H{
+					"message": "Ollama is failing; requests are paused while it recovers",
+					"type":    "server_error",
+					"code":    "circuit_open",
+				},
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Transport wraps next so every upstream response is recorded by the
+// breaker of the backend it went to: connection errors and 5xx responses
+// are failures. Requests cancelled by the client are not counted.
+func (p *Pool) Transport(next http.RoundTripper) http.RoundTripper {
+	return &transport{next: next, pool: p}
+}
+
+type transport struct {
+	next http.RoundTripper
+	pool *Pool
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+
+	b := t.pool.byHost[req.URL.Host]
+	if b == nil || b.breaker == nil {
+		return resp, err
+	}
+	switch {
+	case err != nil:
+		if req.Context().Err() == nil {
+			b.breaker.Record(false)
+		}
+	default:
+		b.breaker.Record(resp.StatusCode < http.StatusInternalServerError)
+	}
+	return resp, err
+}
@@ -0,0 +1,205 @@
+package circuit
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/metrics"
+)
+
+// State is the breaker state, exported as ollama_proxy_circuit_state
+type State int
+
+const (
+	Closed   State = 0
+	Open     State = 1
+	HalfOpen State = 2
+)
+
+// Options configures a Breaker
+type Options struct {
+	// ErrorThreshold is the failure ratio within Window that opens the breaker
+	ErrorThreshold float64
+	// MinRequests is the fewest upstream requests in Window before the
+	// error ratio is trusted
+	MinRequests int
+	// Window is the span the error ratio is measured over
+	Window time.Duration
+	// Cooldown is how long the breaker stays open before allowing a probe
+	Cooldown time.Duration
+}
+
+// bucket counts upstream outcomes during one second
+type bucket struct {
+	second   int64
+	total    int
+	failures int
+}
+
+// Breaker stops requests from reaching a failing backend. It opens when the
+// rolling error ratio exceeds the threshold, fails requests fast for the
+// cooldown, then half-opens and lets a single probe request through; the
+// probe's outcome closes or re-opens it.
+type Breaker struct {
+	name    string
+	opts    Options
+	metrics *metrics.Collector
+
+	mu       sync.Mutex
+	state    State
+	buckets  []bucket
+	openedAt time.Time
+	probing  bool
+}
+
+// New creates a closed breaker for the backend called name
+func New(name string, opts Options, m *metrics.Collector) *Breaker {
+	seconds := int(opts.Window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	b := &Breaker{
+		name:    name,
+		opts:    opts,
+		metrics: m,
+		buckets: make([]bucket, seconds),
+	}
+	m.CircuitState.WithLabelValues(name).Set(float64(Closed))
+	return b
+}
+
+// State returns the current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Ready reports whether Allow would admit a request, without claiming the
+// half-open probe
+func (b *Breaker) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		return time.Since(b.openedAt) >= b.opts.Cooldown
+	case HalfOpen:
+		return !b.probing
+	default:
+		return true
+	}
+}
+
+// Allow reports whether a request may proceed and whether it is the
+// half-open probe. A probe that never reaches the backend must be handed
+// back with CancelProbe.
+func (b *Breaker) Allow() (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.opts.Cooldown {
+			return false, false
+		}
+		b.setStateLocked(HalfOpen)
+		fallthrough
+	case HalfOpen:
+		if b.probing {
+			return false, false
+		}
+		b.probing = true
+		return true, true
+	default:
+		return true, false
+	}
+}
+
+// RetryAfter returns the seconds left until the breaker half-opens
+func (b *Breaker) RetryAfter() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	remaining := b.opts.Cooldown - time.Since(b.openedAt)
+	if remaining < time.Second {
+		return 1
+	}
+	return int(remaining.Seconds() + 0.5)
+}
+
+// CancelProbe frees the probe slot when the probe request never reached the
+// backend, so another request can probe
+func (b *Breaker) CancelProbe() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Record counts the outcome of one upstream request
+func (b *Breaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		// Requests admitted before the breaker opened don't change anything
+		return
+	case HalfOpen:
+		if !b.probing {
+			return
+		}
+		b.probing = false
+		if success {
+			b.resetLocked()
+			b.setStateLocked(Closed)
+		} else {
+			b.openedAt = time.Now()
+			b.setStateLocked(Open)
+		}
+		return
+	}
+
+	now := time.Now().Unix()
+	bk := &b.buckets[now%int64(len(b.buckets))]
+	if bk.second != now {
+		*bk = bucket{second: now}
+	}
+	bk.total++
+	if !success {
+		bk.failures++
+	}
+
+	total, failures := 0, 0
+	oldest := now - int64(len(b.buckets))
+	for _, bk := range b.buckets {
+		if bk.second > oldest {
+			total += bk.total
+			failures += bk.failures
+		}
+	}
+	if total >= b.opts.MinRequests && float64(failures)/float64(total) >= b.opts.ErrorThreshold {
+		log.Printf("⚠️  Circuit breaker for %s opened: %d of %d upstream requests failed in the last %v", b.name, failures, total, b.opts.Window)
+		b.openedAt = time.Now()
+		b.setStateLocked(Open)
+	}
+}
+
+func (b *Breaker) resetLocked() {
+	for i := range b.buckets {
+		b.buckets[i] = bucket{}
+	}
+}
+
+func (b *Breaker) setStateLocked(state State) {
+	if b.state == state {
+		return
+	}
+	if state == Closed {
+		log.Printf("Circuit breaker for %s closed after a successful probe", b.name)
+	}
+	b.state = state
+	b.metrics.CircuitState.WithLabelValues(b.name).Set(float64(state))
+}
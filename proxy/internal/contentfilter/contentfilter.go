@@ -0,0 +1,153 @@
+package contentfilter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Action is the outcome of filtering a piece of text
+type Action string
+
+const (
+	ActionAllow  Action = "allow"
+	ActionBlock  Action = "block"
+	ActionRedact Action = "redact"
+)
+
+// Response modes for PatternFilter
+const (
+	ResponseOff    = "off"
+	ResponseRedact = "redact"
+	ResponseBlock  = "block"
+)
+
+// redactedText replaces matched content in redacted responses
+const redactedText = "[REDACTED]"
+
+// Result describes what a filter decided
+type Result struct {
+	Action Action
+	// Text is the text to pass on, redacted when Action is ActionRedact
+	Text string
+	// Reason explains a block or redaction for logs and metrics
+	Reason string
+}
+
+// Filter inspects prompts and responses passing through the proxy.
+// Implementations must be safe for concurrent use; an implementation backed
+// by an external moderation service can return an error when it is
+// unavailable.
+type Filter interface {
+	// CheckPrompt decides whether a prompt may be sent upstream; only
+	// ActionAllow and ActionBlock are meaningful for prompts
+	CheckPrompt(ctx context.Context, prompt string) (Result, error)
+	// FilterResponse decides whether generated text may be returned, and
+	// may redact it
+	FilterResponse(ctx context.Context, response string) (Result, error)
+}
+
+// PatternFilter matches text against banned terms and regular expressions
+type PatternFilter struct {
+	patterns     []*regexp.Regexp
+	responseMode string
+}
+
+// NewPatternFilter creates a filter from a list of entries. Entries prefixed
+// with "re:" are regular expressions; all others are matched as
+// case-insensitive literal terms. responseMode is one of ResponseOff,
+// ResponseRedact or ResponseBlock.
+func NewPatternFilter(entries []string, responseMode string) (*PatternFilter, error) {
+	switch responseMode {
+	case ResponseOff, ResponseRedact, ResponseBlock:
+	default:
+		return nil, fmt.Errorf("invalid response mode %q", responseMode)
+	}
+
+	f := &PatternFilter{responseMode: responseMode}
+	for _, entry := range entries {
+		var expr string
+		if pattern, ok := strings.CutPrefix(entry, "re:"); ok {
+			expr = pattern
+		} else {
+			expr = "(?i)" + regexp.QuoteMeta(entry)
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", entry, err)
+		}
+		f.patterns = append(f.patterns, re)
+	}
+
+	return f, nil
+}
+
+// LoadPatternFile creates a PatternFilter from a file with one entry per
+// line. Blank lines and lines starting with # are ignored.
+func LoadPatternFile(path, responseMode string) (*PatternFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewPatternFilter(entries, responseMode)
+}
+
+// CheckPrompt blocks prompts matching any pattern
+func (f *PatternFilter) CheckPrompt(ctx context.Context, prompt string) (Result, error) {
+	if re := f.match(prompt); re != nil {
+		return Result{Action: ActionBlock, Text: prompt, Reason: "matched " + re.String()}, nil
+	}
+	return Result{Action: ActionAllow, Text: prompt}, nil
+}
+
+// FilterResponse blocks or redacts matching responses according to the
+// configured response mode
+func (f *PatternFilter) FilterResponse(ctx context.Context, response string) (Result, error) {
+	if f.responseMode == ResponseOff {
+		return Result{Action: ActionAllow, Text: response}, nil
+	}
+
+	re := f.match(response)
+	if re == nil {
+		return Result{Action: ActionAllow, Text: response}, nil
+	}
+
+	if f.responseMode == ResponseBlock {
+		return Result{Action: ActionBlock, Text: response, Reason: "matched " + re.String()}, nil
+	}
+
+	redacted := response
+	for _, p := range f.patterns {
+		redacted = p.ReplaceAllString(redacted, redactedText)
+	}
+	return Result{Action: ActionRedact, Text: redacted, Reason: "matched " + re.String()}, nil
+}
+
+// match returns the first pattern found in text, or nil
+func (f *PatternFilter) match(text string) *regexp.Regexp {
+	for _, re := range f.patterns {
+		if re.MatchString(text) {
+			return re
+		}
+	}
+	return nil
+}
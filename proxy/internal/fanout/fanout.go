@@ -0,0 +1,117 @@
+package fanout
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// Key identifies a generation by endpoint path and exact request body
+func Key(path string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return path + ":" + hex.EncodeToString(sum[:])
+}
+
+// Broadcast buffers the chunks of one upstream stream so any number of
+// subscribers can replay it from the start while it is still being produced
+type Broadcast struct {
+	mu          sync.Mutex
+	chunks      [][]byte
+	done        bool
+	notify      chan struct{}
+	subscribers int
+}
+
+func newBroadcast() *Broadcast {
+	return &Broadcast{notify: make(chan struct{})}
+}
+
+// Publish appends a chunk and wakes waiting subscribers. The chunk is
+// copied, so callers may reuse their buffer.
+func (b *Broadcast) Publish(chunk []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.chunks = append(b.chunks, append([]byte(nil), chunk...))
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// Next returns chunk i, waiting until it is published. It returns false once
+// the stream has ended with no chunk i, or when ctx is cancelled.
+func (b *Broadcast) Next(ctx context.Context, i int) ([]byte, bool) {
+	for {
+		b.mu.Lock()
+		if i < len(b.chunks) {
+			chunk := b.chunks[i]
+			b.mu.Unlock()
+			return chunk, true
+		}
+		if b.done {
+			b.mu.Unlock()
+			return nil, false
+		}
+		notify := b.notify
+		b.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// Subscribers returns how many requests attached to this broadcast besides
+// the one producing it
+func (b *Broadcast) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.subscribers
+}
+
+// Group tracks in-flight broadcasts by key
+type Group struct {
+	mu     sync.Mutex
+	active map[string]*Broadcast
+}
+
+// NewGroup creates an empty broadcast group
+func NewGroup() *Group {
+	return &Group{active: make(map[string]*Broadcast)}
+}
+
+// Join returns the in-flight broadcast for key, creating one when none
+// exists. leader is true for the caller that created it, which must produce
+// the stream and call Finish.
+func (g *Group) Join(key string) (b *Broadcast, leader bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if b, ok := g.active[key]; ok {
+		b.mu.Lock()
+		b.subscribers++
+		b.mu.Unlock()
+		return b, false
+	}
+
+	b = newBroadcast()
+	g.active[key] = b
+	return b, true
+}
+
+// Finish ends the broadcast and detaches it, so later identical requests
+// start a fresh generation
+func (g *Group) Finish(key string, b *Broadcast) {
+	g.mu.Lock()
+	if g.active[key] == b {
+		delete(g.active, key)
+	}
+	g.mu.Unlock()
+
+	b.mu.Lock()
+	b.done = true
+	close(b.notify)
+	b.mu.Unlock()
+}
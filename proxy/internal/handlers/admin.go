@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/requestlog"
+	"github.com/atyronesmith/llama-metrics/proxy/pkg/config"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler handles operator-only endpoints
+type AdminHandler struct {
+	config     *config.Config
+	requestLog *requestlog.Log
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(cfg *config.Config, reqLog *requestlog.Log) *AdminHandler {
+	return &AdminHandler{
+		config:     cfg,
+		requestLog: reqLog,
+	}
+}
+
+// RequireAuth rejects requests that don't carry the configured admin token.
+// Admin endpoints are disabled entirely when no token is configured.
+func (h *AdminHandler) RequireAuth(c *gin.Context) {
+	if h.config.AdminToken == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin endpoints are disabled (ADMIN_TOKEN not set)"})
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.config.AdminToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid admin token"})
+		return
+	}
+
+	c.Next()
+}
+
+// HandleRecentRequests returns the most recent requests, optionally filtered
+// by model, user and status
+func (h *AdminHandler) HandleRecentRequests(c *gin.Context) {
+	records := h.requestLog.Recent(requestlog.ParseFilter(c))
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":    len(records),
+		"requests": records,
+	})
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/backend"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// choiceConcurrency caps the Ollama calls made at once for a request with
+// n > 1, so one request can't occupy every runner slot
+const choiceConcurrency = 2
+
+// callError is a failed upstream call, with the error type it is counted
+// under in ollama_proxy_errors_total
+type callError struct {
+	errorType string
+	err       error
+}
+
+func (e *callError) Error() string {
+	return fmt.Sprintf("%s: %v", e.errorType, e.err)
+}
+
+func (e *callError) Unwrap() error {
+	return e.err
+}
+
+// upstreamPageError is a non-JSON upstream error page, reported with its
+// status when WRAP_UPSTREAM_ERRORS is on
+type upstreamPageError struct {
+	status int
+	body   models.OpenAIError
+}
+
+func (e *upstreamPageError) Error() string {
+	return e.body.Error.Message
+}
+
+// chatChoices makes n non-streaming chat calls for one request, at most
+// choiceConcurrency at a time. With n > 1 every call gets its own seed,
+// counting up from the request's seed or a random one, so the choices
+// differ yet are reproducible when a seed is given. The first failure is
+// returned and cancels the calls still running.
+func (h *OpenAIHandler) chatChoices(c *gin.Context, ollamaReq models.ChatRequest, seed *int, model string, n int) ([]*models.ChatResponse, error) {
+	if n == 1 {
+		resp, err := h.chatCall(c.Request.Context(), c, ollamaReq, model)
+		if err != nil {
+			return nil, err
+		}
+		return []*models.ChatResponse{resp}, nil
+	}
+
+	base := rand.Intn(1 << 30)
+	if seed != nil {
+		base = *seed
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	responses := make([]*models.ChatResponse, n)
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	sem := make(chan struct{}, choiceConcurrency)
+
+	for i := 0; i < n; i++ {
+		req := ollamaReq
+		req.Options = make(map[string]interface{}, len(ollamaReq.Options)+1)
+		for key, value := range ollamaReq.Options {
+			req.Options[key] = value
+		}
+		req.Options["seed"] = base + i
+
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			// A call failed or the client left; start no more
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int, req models.ChatRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			resp, err := h.chatCall(ctx, c, req, model)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			responses[i] = resp
+		}(i, req)
+	}
+
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, &callError{errorType: "proxy_request", err: err}
+	}
+	return responses, nil
+}
+
+// chatCall sends one non-streaming chat request to the next available
+// Ollama backend and parses the response, giving up when ctx is cancelled.
+// It only reads c, so calls can run concurrently; failures are answered by
+// sendChatCallError.
+func (h *OpenAIHandler) chatCall(ctx context.Context, c *gin.Context, ollamaReq models.ChatRequest, model string) (*models.ChatResponse, error) {
+	target, release, err := h.backends.Pick()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Wait behind any other model load there instead of swapping concurrently
+	loaded := func() {}
+	if h.loads != nil {
+		release, err := h.loads.Acquire(ctx, target.URL, model)
+		if err != nil {
+			return nil, &callError{errorType: "model_load_wait", err: err}
+		}
+		defer release()
+		loaded = release
+	}
+
+	reqBody, _ := json.Marshal(ollamaReq)
+	targetURL := fmt.Sprintf("%s/api/chat", target.URL)
+
+	proxyReq, err := http.NewRequestWithContext(ctx, "POST", targetURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, &callError{errorType: "create_request", err: err}
+	}
+
+	proxyReq.Header.Set("Content-Type", "application/json")
+	if h.config.ForwardClientIP {
+		setForwardedHeaders(c, proxyReq)
+	}
+
+	resp, err := h.httpClient.Do(proxyReq)
+	// Ollama only answers once the model is loaded, so free the load slot
+	// now rather than when the response ends
+	loaded()
+	if err != nil {
+		return nil, &callError{errorType: "proxy_request", err: err}
+	}
+	defer resp.Body.Close()
+
+	// Ollama's JSON errors become the matching OpenAI errors
+	if message, _ := readOllamaError(resp); message != "" {
+		return nil, &ollamaError{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	// Keep the upstream status for HTML and other non-JSON error pages
+	if h.config.WrapUpstreamErrors && isNonJSONError(resp) {
+		return nil, &upstreamPageError{status: resp.StatusCode, body: openAIUpstreamError(resp)}
+	}
+
+	body, err := readUpstreamBody(resp, h.config.MaxResponseBytes)
+	if errors.Is(err, errUpstreamTooLarge) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, &callError{errorType: "read_response", err: err}
+	}
+
+	var ollamaResp models.ChatResponse
+	if err := json.Unmarshal(body, &ollamaResp); err != nil {
+		return nil, &upstreamParseError{Err: err, Body: body}
+	}
+	return &ollamaResp, nil
+}
+
+// sendChatCallError answers a chat completion whose upstream call failed
+func (h *OpenAIHandler) sendChatCallError(c *gin.Context, openAIReq models.ChatCompletionRequest, model, requestID string, err error) {
+	var upstreamErr *ollamaError
+	var pageErr *upstreamPageError
+	var parseErr *upstreamParseError
+	var callErr *callError
+
+	switch {
+	case errors.Is(err, backend.ErrUnavailable):
+		h.sendBackendsUnavailable(c, model, err)
+	case errors.As(err, &upstreamErr):
+		h.sendOllamaError(c, model, upstreamErr.StatusCode, upstreamErr.Message)
+	case errors.As(err, &pageErr):
+		h.metrics.RecordError(model, "upstream_error")
+		c.JSON(pageErr.status, pageErr.body)
+	case errors.Is(err, errUpstreamTooLarge):
+		h.metrics.RecordError(model, "upstream_too_large")
+		h.sendOpenAIError(c, http.StatusBadGateway, "upstream_error", "Upstream response too large")
+	case errors.As(err, &parseErr):
+		h.metrics.RecordError(model, "upstream_parse")
+		h.sendUpstreamParseError(c, model, "Failed to parse response", parseErr.Err, parseErr.Body)
+	case errors.As(err, &callErr) && callErr.errorType == "model_load_wait":
+		h.metrics.RecordError(model, callErr.errorType)
+		h.sendOpenAIError(c, http.StatusServiceUnavailable, "server_error", "Request cancelled while waiting for a model load")
+	case errors.As(err, &callErr) && callErr.errorType == "create_request":
+		h.metrics.RecordError(model, callErr.errorType)
+		h.sendOpenAIError(c, http.StatusInternalServerError, "internal_error", "Failed to create request")
+	case errors.As(err, &callErr) && callErr.errorType == "proxy_request":
+		h.metrics.RecordError(model, callErr.errorType)
+		if h.config.FallbackResponse {
+			h.sendChatFallback(c, openAIReq, model, requestID)
+			return
+		}
+		h.sendOpenAIError(c, http.StatusBadGateway, "internal_error", "Failed to proxy request")
+	default:
+		h.metrics.RecordError(model, "read_response")
+		h.sendOpenAIError(c, http.StatusBadGateway, "internal_error", "Failed to read response")
+	}
+}
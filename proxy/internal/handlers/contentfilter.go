@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/contentfilter"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/metrics"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Messages returned when the content filter stops a request
+const (
+	promptFilteredMessage    = "Prompt rejected by content filter"
+	responseFilteredMessage  = "Response blocked by content filter"
+	filterUnavailableMessage = "Content filter unavailable"
+	streamFilteredMessage    = `Responses are content filtered, which streaming doesn't allow; set "stream": false`
+)
+
+// filtersResponses reports whether generated text is redacted or blocked.
+// Streamed text reaches the client before the whole response can be
+// checked, so streaming requests are refused while it is.
+func filtersResponses(f contentfilter.Filter, mode string) bool {
+	return f != nil && mode != contentfilter.ResponseOff
+}
+
+// nativeStreaming reports whether a native API request body asks for a
+// streamed response, which Ollama does unless stream is false
+func nativeStreaming(body []byte) bool {
+	var req struct {
+		Stream *bool `json:"stream"`
+	}
+	json.Unmarshal(body, &req)
+	return req.Stream == nil || *req.Stream
+}
+
+// promptAllowed runs a prompt through the content filter, recording
+// rejections. A nil filter allows everything; a filter error fails closed.
+func promptAllowed(ctx context.Context, f contentfilter.Filter, m *metrics.Collector, model, prompt string) (bool, error) {
+	if f == nil {
+		return true, nil
+	}
+
+	result, err := f.CheckPrompt(ctx, prompt)
+	if err != nil {
+		m.RecordError(model, "content_filter")
+		return false, err
+	}
+
+	if result.Action == contentfilter.ActionBlock {
+		log.Printf("Content filter rejected prompt for model %s: %s", model, result.Reason)
+		m.RecordError(model, "content_filtered")
+		m.RecordContentFiltered(model, "prompt", string(result.Action))
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// filterResponseText runs generated text through the content filter. It
+// returns the text to send, possibly redacted, and whether it may be sent.
+func filterResponseText(ctx context.Context, f contentfilter.Filter, m *metrics.Collector, model, text string) (string, bool, error) {
+	if f == nil {
+		return text, true, nil
+	}
+
+	result, err := f.FilterResponse(ctx, text)
+	if err != nil {
+		m.RecordError(model, "content_filter")
+		return "", false, err
+	}
+
+	switch result.Action {
+	case contentfilter.ActionBlock:
+		log.Printf("Content filter blocked response for model %s: %s", model, result.Reason)
+		m.RecordError(model, "content_filtered")
+		m.RecordContentFiltered(model, "response", string(result.Action))
+		return "", false, nil
+	case contentfilter.ActionRedact:
+		m.RecordContentFiltered(model, "response", string(result.Action))
+		return result.Text, true, nil
+	}
+
+	return text, true, nil
+}
+
+// chatPromptText joins chat message contents for filtering
+func chatPromptText(messages []models.Message) string {
+	parts := make([]string, len(messages))
+	for i, msg := range messages {
+		parts[i] = msg.Content
+	}
+	return strings.Join(parts, "\n")
+}
+
+// sendFilterError reports a content filter rejection in Ollama's error format
+func (h *ProxyHandler) sendFilterError(c *gin.Context, err error, message string) {
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": filterUnavailableMessage})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": message})
+}
+
+// sendFilterError reports a content filter rejection in OpenAI's error format
+func (h *OpenAIHandler) sendFilterError(c *gin.Context, err error, message string) {
+	if err != nil {
+		h.sendOpenAIError(c, http.StatusServiceUnavailable, "internal_error", filterUnavailableMessage)
+		return
+	}
+	h.sendOpenAIError(c, http.StatusBadRequest, "content_filter", message)
+}
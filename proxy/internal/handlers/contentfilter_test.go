@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/backend"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/contentfilter"
+	"github.com/atyronesmith/llama-metrics/proxy/pkg/config"
+	"github.com/gin-gonic/gin"
+)
+
+// newFilteredProxyHandler returns a native API handler that filters
+// responses matching "secret" in the given mode
+func newFilteredProxyHandler(t *testing.T, upstream *httptest.Server, mode string) *ProxyHandler {
+	t.Helper()
+	filter, err := contentfilter.NewPatternFilter([]string{"secret"}, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := testMetrics()
+	return NewProxyHandler(testConfig(nil), m, filter, nil, backend.New([]string{upstream.URL}, "round-robin", nil, m))
+}
+
+func TestRedactionKeepsUpstreamFields(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		path     string
+		upstream string
+		request  string
+		text     func(map[string]interface{}) interface{}
+	}{
+		{"generate", "/api/generate",
+			`{"model":"llama2:7b","response":"the secret is 42","done":true,"done_reason":"stop","context":[1,2,3]}`,
+			`{"model":"llama2:7b","prompt":"hi","stream":false}`,
+			func(resp map[string]interface{}) interface{} { return resp["response"] }},
+		{"chat", "/api/chat",
+			`{"model":"llama2:7b","message":{"role":"assistant","content":"the secret is 42","thinking":"hmm"},"done":true,"done_reason":"stop","context":[1,2,3]}`,
+			`{"model":"llama2:7b","messages":[{"role":"user","content":"hi"}],"stream":false}`,
+			func(resp map[string]interface{}) interface{} {
+				message, _ := resp["message"].(map[string]interface{})
+				if message["thinking"] != "hmm" {
+					return "message lost its thinking field"
+				}
+				return message["content"]
+			}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := stubOllama(http.StatusOK, "application/json", tc.upstream)
+			defer upstream.Close()
+			h := newFilteredProxyHandler(t, upstream, contentfilter.ResponseRedact)
+
+			handler := h.HandleGenerate
+			if tc.path == "/api/chat" {
+				handler = h.HandleChat
+			}
+			rec := serve(handler, tc.path, tc.request)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+			}
+
+			var resp map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("body isn't JSON: %v", err)
+			}
+			if got := tc.text(resp); got != "the [REDACTED] is 42" {
+				t.Errorf("text = %v, want it redacted", got)
+			}
+			if resp["done_reason"] != "stop" || resp["context"] == nil {
+				t.Errorf("redacted response %s lost upstream fields", rec.Body)
+			}
+		})
+	}
+}
+
+func TestStreamingRefusedWhileFilteringResponses(t *testing.T) {
+	upstream := stubOllama(http.StatusOK, "application/json", `{"model":"llama2:7b","response":"hi","done":true}`)
+	defer upstream.Close()
+
+	for _, tc := range []struct {
+		name     string
+		mode     string
+		path     string
+		request  string
+		wantCode int
+	}{
+		{"generate stream", contentfilter.ResponseRedact, "/api/generate", `{"model":"llama2:7b","prompt":"hi","stream":true}`, http.StatusBadRequest},
+		{"generate default", contentfilter.ResponseBlock, "/api/generate", `{"model":"llama2:7b","prompt":"hi"}`, http.StatusBadRequest},
+		{"chat stream", contentfilter.ResponseBlock, "/api/chat", `{"model":"llama2:7b","messages":[{"role":"user","content":"hi"}]}`, http.StatusBadRequest},
+		{"openai chat stream", contentfilter.ResponseRedact, "/v1/chat/completions", `{"model":"llama2:7b","messages":[{"role":"user","content":"hi"}],"stream":true}`, http.StatusBadRequest},
+		{"openai completion stream", contentfilter.ResponseBlock, "/v1/completions", `{"model":"llama2:7b","prompt":"hi","stream":true}`, http.StatusBadRequest},
+		{"generate without stream", contentfilter.ResponseRedact, "/api/generate", `{"model":"llama2:7b","prompt":"hi","stream":false}`, http.StatusOK},
+		{"filtering off", contentfilter.ResponseOff, "/api/generate", `{"model":"llama2:7b","prompt":"hi","stream":true}`, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := contentfilter.NewPatternFilter([]string{"secret"}, tc.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := testMetrics()
+			cfg := testConfig(func(cfg *config.Config) { cfg.ContentFilterResponse = tc.mode })
+			backends := backend.New([]string{upstream.URL}, "round-robin", nil, m)
+
+			var handler gin.HandlerFunc
+			switch tc.path {
+			case "/api/generate":
+				handler = NewProxyHandler(cfg, m, filter, nil, backends).HandleGenerate
+			case "/api/chat":
+				handler = NewProxyHandler(cfg, m, filter, nil, backends).HandleChat
+			case "/v1/chat/completions":
+				handler = NewOpenAIHandler(cfg, m, filter, nil, backends).HandleChatCompletions
+			case "/v1/completions":
+				handler = NewOpenAIHandler(cfg, m, filter, nil, backends).HandleCompletions
+			}
+
+			rec := serve(handler, tc.path, tc.request)
+			if rec.Code != tc.wantCode {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tc.wantCode, rec.Body)
+			}
+			if tc.wantCode == http.StatusBadRequest && !strings.Contains(rec.Body.String(), `\"stream\": false`) {
+				t.Errorf("body %s doesn't say how to avoid the refusal", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// DebugHandler handles endpoints meant for test environments only
+type DebugHandler struct {
+	metrics *metrics.Collector
+}
+
+// NewDebugHandler creates a new debug handler
+func NewDebugHandler(m *metrics.Collector) *DebugHandler {
+	return &DebugHandler{metrics: m}
+}
+
+// HandleMetricsReset zeroes the proxy's counters and histograms and lists
+// the metric families it reset
+func (h *DebugHandler) HandleMetricsReset(c *gin.Context) {
+	families := h.metrics.Reset()
+	log.Printf("Reset %d metric families via %s", len(families), c.Request.URL.Path)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "reset",
+		"count":  len(families),
+		"reset":  families,
+	})
+}
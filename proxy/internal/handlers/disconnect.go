@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/fanout"
+	"github.com/gin-gonic/gin"
+)
+
+// statusClientClosedRequest labels requests whose client disconnected
+// before the response finished, following nginx's 499; codeClientClosedRequest
+// is the same status as a number
+const (
+	statusClientClosedRequest = "499"
+	codeClientClosedRequest   = 499
+)
+
+// clientGone reports whether the client has closed the connection
+func clientGone(c *gin.Context) bool {
+	return c.Request.Context().Err() != nil
+}
+
+// streamContext returns the context for a streaming upstream request, which
+// is cancelled when the client disconnects so Ollama stops generating. A
+// fan-out leader's generation is shared with other clients, so it outlives
+// the leader's own connection.
+func streamContext(c *gin.Context, broadcast *fanout.Broadcast) context.Context {
+	if broadcast != nil {
+		return context.WithoutCancel(c.Request.Context())
+	}
+	return c.Request.Context()
+}
+
+// stopStream reports whether a streaming loop should stop reading from
+// Ollama: the client has gone and no fan-out subscriber still needs the
+// generation
+func stopStream(c *gin.Context, broadcast *fanout.Broadcast) bool {
+	return clientGone(c) && (broadcast == nil || broadcast.Subscribers() == 0)
+}
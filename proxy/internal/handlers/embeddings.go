@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/apikeys"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/backend"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/requestlog"
+	"github.com/gin-gonic/gin"
+)
+
+// errBatchEmbedUnsupported is returned when the upstream has no /api/embed endpoint
+var errBatchEmbedUnsupported = errors.New("upstream does not support batch embeddings")
+
+// HandleEmbeddings handles the /v1/embeddings endpoint
+func (h *OpenAIHandler) HandleEmbeddings(c *gin.Context) {
+	start := time.Now()
+	model := "unknown"
+
+	// Add request ID to response headers
+	if _, ok := h.assignRequestID(c, clientRequestID(c)); !ok {
+		return
+	}
+
+	// Read request body
+	body, err := readRequestBody(c, h.config.MaxRequestBytes)
+	if errors.Is(err, errRequestTooLarge) {
+		h.metrics.RecordError(model, "request_too_large")
+		h.sendOpenAIErrorCode(c, http.StatusRequestEntityTooLarge, "invalid_request_error", "request_too_large", requestTooLargeMessage(h.config.MaxRequestBytes))
+		return
+	}
+	if err != nil {
+		h.metrics.RecordError(model, "read_body")
+		h.sendOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "Failed to read request body")
+		return
+	}
+
+	// Parse OpenAI request
+	var openAIReq models.EmbeddingRequest
+	if err := json.Unmarshal(body, &openAIReq); err != nil {
+		h.metrics.RecordError(model, "parse_request")
+		h.sendOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request format")
+		return
+	}
+
+	inputs, err := embeddingInputs(openAIReq.Input)
+	if err != nil {
+		h.metrics.RecordError(model, "parse_request")
+		h.sendOpenAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	model = h.mapOpenAIModelToOllama(openAIReq.Model)
+	c.Set(requestlog.ModelKey, model)
+	c.Set(requestlog.UserKey, openAIReq.User)
+
+	// Record request size
+	h.metrics.RecordRequestSize(model, "/v1/embeddings", len(body))
+
+	// Enforce the proxy's and the API key's model allow-lists
+	if !h.models.permits(model) {
+		h.sendModelNotServed(c, model)
+		return
+	}
+	if !apikeys.ModelAllowed(c, model) {
+		h.sendModelNotAllowed(c, model)
+		return
+	}
+
+	// Track active requests
+	h.metrics.IncActiveRequests(model)
+	defer h.metrics.DecActiveRequests(model)
+
+	embeddings, promptTokens, err := h.embedInputs(c.Request.Context(), model, inputs)
+	if errors.Is(err, backend.ErrUnavailable) {
+		h.sendBackendsUnavailable(c, model, err)
+		return
+	}
+	var callErr *callError
+	if errors.As(err, &callErr) && callErr.errorType == "model_load_wait" {
+		h.metrics.RecordError(model, callErr.errorType)
+		h.sendOpenAIError(c, http.StatusServiceUnavailable, "server_error", "Request cancelled while waiting for a model load")
+		return
+	}
+	var upstreamErr *ollamaError
+	if errors.As(err, &upstreamErr) {
+		h.sendOllamaError(c, model, upstreamErr.StatusCode, upstreamErr.Message)
+		return
+	}
+	if errors.Is(err, errUpstreamTooLarge) {
+		h.metrics.RecordError(model, "upstream_too_large")
+		h.sendOpenAIError(c, http.StatusBadGateway, "upstream_error", "Upstream response too large")
+		return
+	}
+	var parseErr *upstreamParseError
+	if errors.As(err, &parseErr) {
+		h.metrics.RecordError(model, "upstream_parse")
+		h.sendUpstreamParseError(c, model, fmt.Sprintf("Failed to get embeddings: %v", err), parseErr.Err, parseErr.Body)
+		return
+	}
+	if err != nil {
+		h.metrics.RecordError(model, "proxy_request")
+		h.sendOpenAIError(c, http.StatusBadGateway, "internal_error", fmt.Sprintf("Failed to get embeddings: %v", err))
+		return
+	}
+
+	// Convert to OpenAI format, preserving input order
+	data := make([]models.EmbeddingData, len(embeddings))
+	for i, embedding := range embeddings {
+		data[i] = models.EmbeddingData{
+			Object:    "embedding",
+			Embedding: embedding,
+			Index:     i,
+		}
+	}
+
+	resp := models.EmbeddingResponse{
+		Object: "list",
+		Data:   data,
+		Model:  openAIReq.Model,
+		Usage: &models.Usage{
+			PromptTokens: promptTokens,
+			TotalTokens:  promptTokens,
+		},
+	}
+
+	respBody, err := json.Marshal(resp)
+	if err != nil {
+		h.metrics.RecordError(model, "marshal_response")
+		h.sendOpenAIError(c, http.StatusInternalServerError, "internal_error", "Failed to encode embeddings")
+		return
+	}
+
+	// Record metrics
+	duration := time.Since(start)
+	h.metrics.RecordRequest("POST", "/v1/embeddings", model, "200", duration)
+	h.metrics.RecordResponseSize(model, "/v1/embeddings", len(respBody))
+	h.metrics.RecordTokens(model, promptTokens, 0, 0)
+	c.Set(requestlog.TokensKey, promptTokens)
+
+	c.Data(http.StatusOK, "application/json", respBody)
+}
+
+// embeddingInputs normalizes the OpenAI input field into a list of strings
+func embeddingInputs(input interface{}) ([]string, error) {
+	switch v := input.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		inputs := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("input[%d] must be a string; token array inputs are not supported", i)
+			}
+			inputs[i] = s
+		}
+		if len(inputs) == 0 {
+			return nil, fmt.Errorf("input must not be empty")
+		}
+		return inputs, nil
+	default:
+		return nil, fmt.Errorf("input must be a string or an array of strings")
+	}
+}
+
+// embedInputs returns one embedding per input, in input order, and the
+// number of prompt tokens embedded. Inputs are sent to /api/embed in batches
+// of EmbeddingBatchSize; when the upstream doesn't support batching, each
+// input is sent to /api/embeddings with at most EmbeddingConcurrency calls in
+// flight.
+func (h *OpenAIHandler) embedInputs(ctx context.Context, model string, inputs []string) ([][]float64, int, error) {
+	results := make([][]float64, len(inputs))
+	batchSize := h.config.EmbeddingBatchSize
+	promptTokens := 0
+
+	for offset := 0; offset < len(inputs); offset += batchSize {
+		end := min(offset+batchSize, len(inputs))
+
+		batch, tokens, err := h.embedBatch(ctx, model, inputs[offset:end])
+		if errors.Is(err, errBatchEmbedUnsupported) {
+			// Older Ollama versions only expose the single-prompt endpoint
+			if err := h.embedEach(ctx, model, inputs[offset:], results[offset:]); err != nil {
+				return nil, 0, err
+			}
+			// /api/embeddings doesn't report token counts, so estimate them
+			for _, input := range inputs[offset:] {
+				promptTokens += estimateEmbeddingTokens(input)
+			}
+			return results, promptTokens, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		copy(results[offset:end], batch)
+		promptTokens += tokens
+	}
+
+	return results, promptTokens, nil
+}
+
+// estimateEmbeddingTokens approximates the token count of an input at about
+// four characters per token
+func estimateEmbeddingTokens(input string) int {
+	if input == "" {
+		return 0
+	}
+	return (len([]rune(input)) + 3) / 4
+}
+
+// embedBatch embeds a batch of inputs with a single /api/embed call,
+// returning the embeddings and the upstream's prompt token count
+func (h *OpenAIHandler) embedBatch(ctx context.Context, model string, inputs []string) ([][]float64, int, error) {
+	resp, err := h.postOllamaJSON(ctx, model, "/api/embed", models.EmbedRequest{
+		Model: model,
+		Input: inputs,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := readUpstreamBody(resp, h.config.MaxResponseBytes)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// An unknown route returns a plain-text 404, while an unknown model
+		// returns a JSON error body
+		var errResp models.ErrorResponse
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+			return nil, 0, &ollamaError{StatusCode: resp.StatusCode, Message: errResp.Error}
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, 0, errBatchEmbedUnsupported
+		}
+		return nil, 0, fmt.Errorf("upstream returned HTTP %d", resp.StatusCode)
+	}
+
+	var embedResp models.EmbedResponse
+	if err := json.Unmarshal(body, &embedResp); err != nil {
+		return nil, 0, &upstreamParseError{Err: err, Body: body}
+	}
+	if len(embedResp.Embeddings) != len(inputs) {
+		return nil, 0, fmt.Errorf("upstream returned %d embeddings for %d inputs", len(embedResp.Embeddings), len(inputs))
+	}
+
+	h.metrics.RecordEmbeddingBatch(model, "batch", len(inputs))
+
+	return embedResp.Embeddings, embedResp.PromptEvalCount, nil
+}
+
+// embedEach embeds inputs one at a time via /api/embeddings, writing each
+// result to the matching index of results
+func (h *OpenAIHandler) embedEach(ctx context.Context, model string, inputs []string, results [][]float64) error {
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	sem := make(chan struct{}, h.config.EmbeddingConcurrency)
+
+	for i, input := range inputs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, input string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			embedding, err := h.embedSingle(ctx, model, input)
+			if err != nil {
+				errOnce.Do(func() { firstErr = err })
+				return
+			}
+			results[i] = embedding
+		}(i, input)
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// embedSingle embeds one input with a /api/embeddings call
+func (h *OpenAIHandler) embedSingle(ctx context.Context, model, input string) ([]float64, error) {
+	resp, err := h.postOllamaJSON(ctx, model, "/api/embeddings", models.EmbeddingsRequest{
+		Model:  model,
+		Prompt: input,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := readUpstreamBody(resp, h.config.MaxResponseBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp models.ErrorResponse
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+			return nil, &ollamaError{StatusCode: resp.StatusCode, Message: errResp.Error}
+		}
+		return nil, fmt.Errorf("upstream returned HTTP %d", resp.StatusCode)
+	}
+
+	var embeddingsResp models.EmbeddingsResponse
+	if err := json.Unmarshal(body, &embeddingsResp); err != nil {
+		return nil, &upstreamParseError{Err: err, Body: body}
+	}
+
+	h.metrics.RecordEmbeddingBatch(model, "single", 1)
+
+	return embeddingsResp.Embedding, nil
+}
+
+// postOllamaJSON sends a JSON POST request for model to the given Ollama
+// API path
+func (h *OpenAIHandler) postOllamaJSON(ctx context.Context, model, path string, payload interface{}) (*http.Response, error) {
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	target, release, err := h.backends.Pick()
+	if err != nil {
+		return nil, err
+	}
+	// Callers read the response right away, so the backend counts as idle
+	// once the response headers arrive
+	defer release()
+
+	// Wait behind any other model load there instead of swapping concurrently
+	if h.loads != nil {
+		release, err := h.loads.Acquire(ctx, target.URL, model)
+		if err != nil {
+			return nil, &callError{errorType: "model_load_wait", err: err}
+		}
+		defer release()
+	}
+
+	targetURL := fmt.Sprintf("%s%s", target.URL, path)
+	proxyReq, err := http.NewRequestWithContext(ctx, "POST", targetURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	proxyReq.Header.Set("Content-Type", "application/json")
+
+	return h.httpClient.Do(proxyReq)
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/backend"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/circuit"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
+	"github.com/atyronesmith/llama-metrics/proxy/pkg/config"
+)
+
+// fakeEmbedding derives a distinct vector from an input, so results can be
+// matched back to the input they belong to
+func fakeEmbedding(input string) []float64 {
+	return []float64{float64(len(input)), float64(input[0])}
+}
+
+func embeddingInputsJSON(inputs []string) string {
+	body, _ := json.Marshal(map[string]interface{}{"model": "nomic-embed-text", "input": inputs})
+	return string(body)
+}
+
+func assertEmbeddingOrder(t *testing.T, rec *httptest.ResponseRecorder, inputs []string) {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+
+	var resp models.EmbeddingResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(resp.Data) != len(inputs) {
+		t.Fatalf("got %d embeddings, want %d", len(resp.Data), len(inputs))
+	}
+	for i, data := range resp.Data {
+		want := fakeEmbedding(inputs[i])
+		if data.Index != i || data.Embedding[0] != want[0] || data.Embedding[1] != want[1] {
+			t.Errorf("data[%d] = index %d embedding %v, want index %d embedding %v", i, data.Index, data.Embedding, i, want)
+		}
+	}
+}
+
+var orderInputs = []string{"alpha", "be", "charlie", "d", "echo-echo", "foxtrot"}
+
+func TestEmbeddingsBatchPreservesOrder(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]string
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embed" {
+			t.Errorf("unexpected upstream call to %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		var req models.EmbedRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		mu.Lock()
+		batches = append(batches, req.Input)
+		mu.Unlock()
+
+		resp := models.EmbedResponse{Model: req.Model, PromptEvalCount: len(req.Input)}
+		for _, input := range req.Input {
+			resp.Embeddings = append(resp.Embeddings, fakeEmbedding(input))
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer upstream.Close()
+
+	h := newTestOpenAIHandler(upstream, func(cfg *config.Config) {
+		cfg.EmbeddingBatchSize = 4
+	})
+	rec := serve(h.HandleEmbeddings, "/v1/embeddings", embeddingInputsJSON(orderInputs))
+
+	assertEmbeddingOrder(t, rec, orderInputs)
+	if len(batches) != 2 || len(batches[0]) != 4 || len(batches[1]) != 2 {
+		t.Errorf("upstream batches = %v, want sizes [4 2]", batches)
+	}
+}
+
+func TestEmbeddingsFallsBackToSingleInputEndpoint(t *testing.T) {
+	var mu sync.Mutex
+	singleCalls := 0
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/embed":
+			// Older Ollama: unknown route, plain-text 404
+			http.Error(w, "404 page not found", http.StatusNotFound)
+		case "/api/embeddings":
+			var req models.EmbeddingsRequest
+			json.NewDecoder(r.Body).Decode(&req)
+
+			mu.Lock()
+			singleCalls++
+			mu.Unlock()
+
+			json.NewEncoder(w).Encode(models.EmbeddingsResponse{Embedding: fakeEmbedding(req.Prompt)})
+		default:
+			t.Errorf("unexpected upstream call to %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	h := newTestOpenAIHandler(upstream, func(cfg *config.Config) {
+		cfg.EmbeddingConcurrency = 3
+	})
+	rec := serve(h.HandleEmbeddings, "/v1/embeddings", embeddingInputsJSON(orderInputs))
+
+	assertEmbeddingOrder(t, rec, orderInputs)
+	if singleCalls != len(orderInputs) {
+		t.Errorf("got %d /api/embeddings calls, want %d", singleCalls, len(orderInputs))
+	}
+
+	// Token counts are estimated when the upstream doesn't report them
+	var resp models.EmbeddingResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	want := 0
+	for _, input := range orderInputs {
+		want += estimateEmbeddingTokens(input)
+	}
+	if resp.Usage == nil || resp.Usage.PromptTokens != want {
+		t.Errorf("usage = %+v, want %d prompt tokens", resp.Usage, want)
+	}
+}
+
+func TestEmbeddingInputs(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		input   interface{}
+		want    []string
+		wantErr string
+	}{
+		{"string", "hello", []string{"hello"}, ""},
+		{"list", []interface{}{"a", "b"}, []string{"a", "b"}, ""},
+		{"empty list", []interface{}{}, nil, "must not be empty"},
+		{"token array", []interface{}{1.0, 2.0}, nil, "token array"},
+		{"number", 3.0, nil, "string or an array"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := embeddingInputs(tc.input)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("embeddingInputs(%v) = %v, %v; want %v", tc.input, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddingsCircuitOpen(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+
+	// One failure opens the breaker for a minute
+	m := testMetrics()
+	breaker := &circuit.Options{ErrorThreshold: 0.5, MinRequests: 1, Window: 10 * time.Second, Cooldown: time.Minute}
+	h := NewOpenAIHandler(testConfig(nil), m, nil, nil, backend.New([]string{upstream.URL}, "round-robin", breaker, m))
+
+	body := embeddingInputsJSON([]string{"alpha"})
+	if rec := serve(h.HandleEmbeddings, "/v1/embeddings", body); rec.Code != http.StatusBadGateway {
+		t.Fatalf("first status = %d, want 502 from the failing upstream", rec.Code)
+	}
+
+	var rec *httptest.ResponseRecorder
+	assertErrorCounted(t, "nomic-embed-text", "circuit_open", func() {
+		rec = serve(h.HandleEmbeddings, "/v1/embeddings", body)
+	})
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503 once the breaker is open; body %s", rec.Code, rec.Body)
+	}
+	if retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || retryAfter < 1 {
+		t.Errorf("Retry-After = %q, want the seconds until the breaker half-opens", rec.Header().Get("Retry-After"))
+	}
+	var errResp models.OpenAIError
+	if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil || errResp.Error.Code == nil || *errResp.Error.Code != "circuit_open" {
+		t.Errorf("body = %s, want a circuit_open error", rec.Body)
+	}
+}
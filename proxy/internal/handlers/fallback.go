@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// fallbackHeader flags responses synthesized by the proxy while Ollama is down
+const fallbackHeader = "X-Proxy-Fallback"
+
+// sendFallback writes a canned Ollama-shaped response for the native
+// /api/generate and /api/chat endpoints
+func (h *ProxyHandler) sendFallback(c *gin.Context, model string, chat, stream bool) {
+	h.metrics.RecordError(model, "fallback_response")
+	c.Header(fallbackHeader, "true")
+
+	createdAt := time.Now().UTC().Format(time.RFC3339Nano)
+
+	var payload interface{}
+	if chat {
+		payload = models.ChatResponse{
+			Model:     model,
+			CreatedAt: createdAt,
+			Message: models.Message{
+				Role:    "assistant",
+				Content: h.config.FallbackMessage,
+			},
+			Done: true,
+		}
+	} else {
+		payload = models.GenerateResponse{
+			Model:     model,
+			CreatedAt: createdAt,
+			Response:  h.config.FallbackMessage,
+			Done:      true,
+		}
+	}
+
+	if stream {
+		// A single done chunk is a complete NDJSON stream
+		data, _ := json.Marshal(payload)
+		c.Data(http.StatusOK, "application/x-ndjson", append(data, '\n'))
+		return
+	}
+
+	c.JSON(http.StatusOK, payload)
+}
+
+// sendChatFallback writes a canned OpenAI-shaped chat completion
+func (h *OpenAIHandler) sendChatFallback(c *gin.Context, openAIReq models.ChatCompletionRequest, model, requestID string) {
+	h.metrics.RecordError(model, "fallback_response")
+	c.Header(fallbackHeader, "true")
+
+	if openAIReq.Stream {
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+
+		chunk := models.StreamingChatCompletionResponse{
+			ID:      requestID,
+			Object:  "chat.completion.chunk",
+			Created: time.Now().Unix(),
+			Model:   openAIReq.Model,
+			Choices: []models.ChatChoice{
+				{
+					Index: 0,
+					Delta: &models.ChatMessage{
+						Role:    "assistant",
+						Content: h.config.FallbackMessage,
+					},
+					FinishReason: "stop",
+				},
+			},
+		}
+
+		data, _ := json.Marshal(chunk)
+		c.SSEvent("", fmt.Sprintf("data: %s\n\n", string(data)))
+		c.SSEvent("", "data: [DONE]\n\n")
+		c.Writer.Flush()
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ChatCompletionResponse{
+		ID:      requestID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   openAIReq.Model,
+		Choices: []models.ChatChoice{
+			{
+				Index: 0,
+				Message: models.ChatMessage{
+					Role:    "assistant",
+					Content: h.config.FallbackMessage,
+				},
+				FinishReason: "stop",
+			},
+		},
+		Usage: &models.Usage{},
+	})
+}
+
+// sendCompletionFallback writes a canned OpenAI-shaped text completion
+func (h *OpenAIHandler) sendCompletionFallback(c *gin.Context, openAIReq models.CompletionRequest, model, requestID string) {
+	h.metrics.RecordError(model, "fallback_response")
+	c.Header(fallbackHeader, "true")
+
+	completion := models.CompletionResponse{
+		ID:      requestID,
+		Object:  "text_completion",
+		Created: time.Now().Unix(),
+		Model:   openAIReq.Model,
+		Choices: []models.CompletionChoice{
+			{
+				Text:         h.config.FallbackMessage,
+				Index:        0,
+				FinishReason: "stop",
+			},
+		},
+	}
+
+	if openAIReq.Stream {
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+
+		data, _ := json.Marshal(completion)
+		c.SSEvent("", fmt.Sprintf("data: %s\n\n", string(data)))
+		c.SSEvent("", "data: [DONE]\n\n")
+		c.Writer.Flush()
+		return
+	}
+
+	completion.Usage = &models.Usage{}
+	c.JSON(http.StatusOK, completion)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/fanout"
+	"github.com/gin-gonic/gin"
+)
+
+// serveFanOutSubscriber streams a shared generation to a request that joined
+// it instead of calling the upstream itself. Chunks published before the
+// request joined are replayed first.
+func (h *ProxyHandler) serveFanOutSubscriber(c *gin.Context, b *fanout.Broadcast, model string, start time.Time, priority int) {
+	h.metrics.RecordStreamFanOut(model)
+
+	ctx := c.Request.Context()
+	chunk, ok := b.Next(ctx, 0)
+	if !ok {
+		if ctx.Err() == nil {
+			// The shared generation ended without producing anything
+			h.metrics.RecordError(model, "fanout_failed")
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Shared generation failed"})
+		}
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	for i := 1; ok; i++ {
+		c.Data(http.StatusOK, "application/x-ndjson", chunk)
+		c.Data(http.StatusOK, "application/x-ndjson", []byte("\n"))
+		c.Writer.Flush()
+
+		chunk, ok = b.Next(ctx, i)
+	}
+
+	// Token metrics are recorded once by the request that ran the generation
+	status := "200"
+	if ctx.Err() != nil {
+		h.metrics.RecordClientDisconnect(model)
+		status = statusClientClosedRequest
+	}
+	duration := time.Since(start)
+	h.metrics.RecordRequestWithPriority(c.Request.Method, c.Request.URL.Path, model, status, duration, priority)
+}
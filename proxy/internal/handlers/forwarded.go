@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setForwardedHeaders tells Ollama who the real client is. An existing
+// X-Forwarded-For chain is kept only when the immediate peer is a trusted
+// proxy; otherwise it could be spoofed, so the chain starts at the peer.
+func setForwardedHeaders(c *gin.Context, proxyReq *http.Request) {
+	peer := c.RemoteIP()
+	forwardedFor := peer
+	proto := "http"
+	if c.Request.TLS != nil {
+		proto = "https"
+	}
+
+	// gin's ClientIP only differs from the peer when the peer is trusted
+	if clientIP := c.ClientIP(); clientIP != peer {
+		if prior := c.GetHeader("X-Forwarded-For"); prior != "" {
+			forwardedFor = prior + ", " + peer
+		}
+		if priorProto := c.GetHeader("X-Forwarded-Proto"); priorProto != "" {
+			proto = priorProto
+		}
+	}
+
+	proxyReq.Header.Set("X-Forwarded-For", forwardedFor)
+	proxyReq.Header.Set("X-Forwarded-Proto", proto)
+	proxyReq.Header.Set("X-Real-IP", c.ClientIP())
+}
@@ -4,28 +4,53 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/atyronesmith/llama-metrics/proxy/internal/inflight"
 	"github.com/atyronesmith/llama-metrics/proxy/pkg/config"
 	"github.com/gin-gonic/gin"
 )
 
 // HealthHandler handles health check requests
 type HealthHandler struct {
-	config *config.Config
+	config   *config.Config
+	inFlight *inflight.Tracker
 }
 
 // NewHealthHandler creates a new health handler
-func NewHealthHandler(cfg *config.Config) *HealthHandler {
+func NewHealthHandler(cfg *config.Config, inFlight *inflight.Tracker) *HealthHandler {
 	return &HealthHandler{
-		config: cfg,
+		config:   cfg,
+		inFlight: inFlight,
 	}
 }
 
 // Handle returns the health status
 func (h *HealthHandler) Handle(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"status":         "healthy",
-		"proxy_url":      fmt.Sprintf("http://localhost:%d", h.config.ProxyPort),
-		"metrics_url":    fmt.Sprintf("http://localhost:%d/metrics", h.config.MetricsPort),
-		"ollama_backend": h.config.OllamaURL(),
+		"status":          "healthy",
+		"proxy_url":       fmt.Sprintf("http://localhost:%d", h.config.ProxyPort),
+		"metrics_url":     fmt.Sprintf("http://localhost:%d/metrics", h.config.MetricsPort),
+		"ollama_backend":  h.config.OllamaURL(),
+		"ollama_backends": h.config.OllamaURLs(),
 	})
-}
\ No newline at end of file
+}
+
+// HandleReady reports whether the proxy can take more traffic, based on the
+// in-flight request count rather than the Prometheus gauges
+func (h *HealthHandler) HandleReady(c *gin.Context) {
+	inFlight := h.inFlight.Count()
+
+	if h.config.ReadyMaxInFlight > 0 && inFlight >= int64(h.config.ReadyMaxInFlight) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"ready":         false,
+			"in_flight":     inFlight,
+			"max_in_flight": h.config.ReadyMaxInFlight,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ready":         true,
+		"in_flight":     inFlight,
+		"max_in_flight": h.config.ReadyMaxInFlight,
+	})
+}
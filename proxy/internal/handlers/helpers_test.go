@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/backend"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/metrics"
+	"github.com/atyronesmith/llama-metrics/proxy/pkg/config"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// The collector registers with the default Prometheus registry, so the
+// tests share one
+var (
+	sharedMetrics     *metrics.Collector
+	sharedMetricsOnce sync.Once
+)
+
+func testMetrics() *metrics.Collector {
+	sharedMetricsOnce.Do(func() {
+		gin.SetMode(gin.TestMode)
+		sharedMetrics = metrics.NewCollector(5)
+	})
+	return sharedMetrics
+}
+
+// testConfig returns the default config, adjusted by configure when it is
+// not nil
+func testConfig(configure func(*config.Config)) *config.Config {
+	cfg := config.DefaultConfig()
+	cfg.MaxRetries = 0
+	if configure != nil {
+		configure(cfg)
+	}
+	return cfg
+}
+
+// newTestOpenAIHandler returns an OpenAI handler whose upstream is the
+// given stub Ollama server
+func newTestOpenAIHandler(upstream *httptest.Server, configure func(*config.Config)) *OpenAIHandler {
+	m := testMetrics()
+	return NewOpenAIHandler(testConfig(configure), m, nil, nil, backend.New([]string{upstream.URL}, "round-robin", nil, m))
+}
+
+// newTestProxyHandler returns a native API handler whose upstream is the
+// given stub Ollama server
+func newTestProxyHandler(upstream *httptest.Server, configure func(*config.Config)) *ProxyHandler {
+	m := testMetrics()
+	return NewProxyHandler(testConfig(configure), m, nil, nil, backend.New([]string{upstream.URL}, "round-robin", nil, m))
+}
+
+// serve runs one POST request with a JSON body through handler
+func serve(handler gin.HandlerFunc, path, body string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.POST(path, handler)
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// errorCount returns the current value of ollama_proxy_errors_total for a
+// model and error type
+func errorCount(model, errorType string) float64 {
+	return testutil.ToFloat64(testMetrics().ErrorCount.WithLabelValues(model, errorType))
+}
+
+// assertErrorCounted fails the test unless the error counter grew by one
+// while fn ran
+func assertErrorCounted(t *testing.T, model, errorType string, fn func()) {
+	t.Helper()
+	before := errorCount(model, errorType)
+	fn()
+	if got := errorCount(model, errorType) - before; got != 1 {
+		t.Errorf("errors_total{model=%q,error_type=%q} grew by %v, want 1", model, errorType, got)
+	}
+}
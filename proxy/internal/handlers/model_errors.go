@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error types recorded for Ollama model errors
+const (
+	errModelNotPulled  = "model_not_pulled"
+	errModelLoadFailed = "model_load_failed"
+)
+
+// OpenAI error codes for other Ollama errors, also recorded as error types
+const (
+	errContextLengthExceeded = "context_length_exceeded"
+	errInsufficientMemory    = "insufficient_memory"
+)
+
+// autoPullRetryAfter is the Retry-After hint, in seconds, sent while a missing
+// model is being pulled
+const autoPullRetryAfter = "30"
+
+// maxModelErrorBody caps how much of an upstream error body is inspected
+const maxModelErrorBody = 64 << 10
+
+// modelError is a classified Ollama error about the requested model
+type modelError struct {
+	errorType string
+	message   string
+	body      []byte
+}
+
+// readOllamaError returns the message and body of a JSON error response
+// from Ollama ({"error": "..."}), or an empty message for any other
+// response. resp.Body is left readable from the start.
+func readOllamaError(resp *http.Response) (string, []byte) {
+	if resp.StatusCode < http.StatusBadRequest {
+		return "", nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return "", nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxModelErrorBody))
+	resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), resp.Body))
+	if err != nil {
+		return "", nil
+	}
+
+	var ollamaErr struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &ollamaErr) != nil {
+		return "", nil
+	}
+	return ollamaErr.Error, body
+}
+
+// readModelError inspects a JSON error response from Ollama and classifies
+// it as a missing model ("not found, try pulling it first") or a failure to
+// load a model that is present. It returns nil for other responses, leaving
+// resp.Body readable from the start.
+func readModelError(resp *http.Response) *modelError {
+	message, body := readOllamaError(resp)
+	if message == "" {
+		return nil
+	}
+
+	errorType := classifyModelError(resp.StatusCode, message)
+	if errorType == "" {
+		return nil
+	}
+	return &modelError{errorType: errorType, message: message, body: body}
+}
+
+// classifyModelError maps an Ollama error message to a model error type
+func classifyModelError(statusCode int, message string) string {
+	msg := strings.ToLower(message)
+	switch {
+	case strings.Contains(msg, "model") && strings.Contains(msg, "not found"),
+		statusCode == http.StatusNotFound && strings.Contains(msg, "pull"):
+		return errModelNotPulled
+	case strings.Contains(msg, "load") && strings.Contains(msg, "model"),
+		strings.Contains(msg, "llama runner"):
+		return errModelLoadFailed
+	}
+	return ""
+}
+
+// openAIErrorFor maps an Ollama error that isn't about the model itself to
+// the status, OpenAI error type and code returned to OpenAI clients. The
+// code is empty when the error is not recognized, and the upstream status
+// is kept.
+func openAIErrorFor(statusCode int, message string) (int, string, string) {
+	msg := strings.ToLower(message)
+	switch {
+	case strings.Contains(msg, "context length"), strings.Contains(msg, "context window"):
+		return http.StatusBadRequest, "invalid_request_error", errContextLengthExceeded
+	case strings.Contains(msg, "out of memory"), strings.Contains(msg, "more system memory"),
+		strings.Contains(msg, "insufficient memory"):
+		return statusCode, "server_error", errInsufficientMemory
+	case statusCode < http.StatusInternalServerError:
+		return statusCode, "invalid_request_error", ""
+	default:
+		return statusCode, "server_error", ""
+	}
+}
+
+// handleModelError answers a native request whose model is missing or failed
+// to load. Missing models are pulled in the background when auto-pull is on,
+// with a 503 asking the client to retry; otherwise the upstream error is
+// passed through. It reports whether the response was handled.
+func (h *ProxyHandler) handleModelError(c *gin.Context, resp *http.Response, model string, start time.Time, priority int) bool {
+	modelErr := readModelError(resp)
+	if modelErr == nil {
+		return false
+	}
+	h.metrics.RecordError(model, modelErr.errorType)
+
+	if modelErr.errorType == errModelNotPulled && h.puller != nil {
+		h.puller.Start(model)
+		h.metrics.RecordRequestWithPriority(c.Request.Method, c.Request.URL.Path, model, strconv.Itoa(http.StatusServiceUnavailable), time.Since(start), priority)
+		c.Header("Retry-After", autoPullRetryAfter)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Model %s is being pulled, retry shortly", model)})
+		return true
+	}
+
+	h.metrics.RecordRequestWithPriority(c.Request.Method, c.Request.URL.Path, model, strconv.Itoa(resp.StatusCode), time.Since(start), priority)
+	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), modelErr.body)
+	return true
+}
+
+// handleOllamaError answers an OpenAI request that Ollama failed with a JSON
+// error, with the matching OpenAI error and the upstream message. Missing
+// models are reported as model_not_found, or pulled in the background when
+// auto-pull is on. It reports whether the response was handled.
+func (h *OpenAIHandler) handleOllamaError(c *gin.Context, resp *http.Response, model string) bool {
+	message, _ := readOllamaError(resp)
+	if message == "" {
+		return false
+	}
+	h.sendOllamaError(c, model, resp.StatusCode, message)
+	return true
+}
+
+// sendOllamaError sends the OpenAI error matching an Ollama error message
+func (h *OpenAIHandler) sendOllamaError(c *gin.Context, model string, statusCode int, message string) {
+	switch classifyModelError(statusCode, message) {
+	case errModelLoadFailed:
+		h.metrics.RecordError(model, errModelLoadFailed)
+		h.sendOpenAIErrorCode(c, statusCode, "server_error", errModelLoadFailed, message)
+		return
+	case errModelNotPulled:
+		h.metrics.RecordError(model, errModelNotPulled)
+		if h.puller != nil {
+			h.puller.Start(model)
+			c.Header("Retry-After", autoPullRetryAfter)
+			h.sendOpenAIErrorCode(c, http.StatusServiceUnavailable, "server_error", "model_pulling", fmt.Sprintf("Model %s is being pulled, retry shortly", model))
+			return
+		}
+		h.sendOpenAIErrorCode(c, http.StatusNotFound, "invalid_request_error", "model_not_found", message)
+		return
+	}
+
+	status, errorType, code := openAIErrorFor(statusCode, message)
+	if code == "" {
+		h.metrics.RecordError(model, "upstream_error")
+		h.sendOpenAIError(c, status, errorType, message)
+		return
+	}
+	h.metrics.RecordError(model, code)
+	h.sendOpenAIErrorCode(c, status, errorType, code, message)
+}
+
+// ollamaError is a JSON error response from Ollama, returned by helpers that
+// don't write the response themselves
+type ollamaError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ollamaError) Error() string {
+	return fmt.Sprintf("upstream returned HTTP %d: %s", e.StatusCode, e.Message)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
+)
+
+func TestOpenAIErrorFor(t *testing.T) {
+	for _, tc := range []struct {
+		status     int
+		message    string
+		wantStatus int
+		wantType   string
+		wantCode   string
+	}{
+		{http.StatusBadRequest, "the input length exceeds the context length", http.StatusBadRequest, "invalid_request_error", errContextLengthExceeded},
+		{http.StatusInternalServerError, "prompt too long; exceeded max context length by 1337 tokens", http.StatusBadRequest, "invalid_request_error", errContextLengthExceeded},
+		{http.StatusInternalServerError, "requested tokens exceed the context window", http.StatusBadRequest, "invalid_request_error", errContextLengthExceeded},
+		{http.StatusInternalServerError, "model requires more system memory (12.3 GiB) than is available (8.0 GiB)", http.StatusInternalServerError, "server_error", errInsufficientMemory},
+		{http.StatusInternalServerError, "cudaMalloc failed: out of memory", http.StatusInternalServerError, "server_error", errInsufficientMemory},
+		{http.StatusServiceUnavailable, "Insufficient memory to allocate KV cache", http.StatusServiceUnavailable, "server_error", errInsufficientMemory},
+		{http.StatusBadRequest, "invalid options: num_gpu_layers", http.StatusBadRequest, "invalid_request_error", ""},
+		{http.StatusBadRequest, "json: cannot unmarshal string into Go struct field", http.StatusBadRequest, "invalid_request_error", ""},
+		{http.StatusInternalServerError, "unexpected server status: 1", http.StatusInternalServerError, "server_error", ""},
+		{http.StatusServiceUnavailable, "server busy, please try again", http.StatusServiceUnavailable, "server_error", ""},
+	} {
+		status, errorType, code := openAIErrorFor(tc.status, tc.message)
+		if status != tc.wantStatus || errorType != tc.wantType || code != tc.wantCode {
+			t.Errorf("openAIErrorFor(%d, %q) = %d, %q, %q; want %d, %q, %q",
+				tc.status, tc.message, status, errorType, code, tc.wantStatus, tc.wantType, tc.wantCode)
+		}
+	}
+}
+
+func TestClassifyModelError(t *testing.T) {
+	for _, tc := range []struct {
+		status  int
+		message string
+		want    string
+	}{
+		{http.StatusNotFound, `model "llama9:70b" not found, try pulling it first`, errModelNotPulled},
+		{http.StatusNotFound, "pull the model first", errModelNotPulled},
+		{http.StatusInternalServerError, "error loading model /models/blobs/sha256-abc", errModelLoadFailed},
+		{http.StatusInternalServerError, "llama runner process has terminated: exit status 2", errModelLoadFailed},
+		{http.StatusBadRequest, "the input length exceeds the context length", ""},
+		{http.StatusInternalServerError, "unexpected server status: 1", ""},
+	} {
+		if got := classifyModelError(tc.status, tc.message); got != tc.want {
+			t.Errorf("classifyModelError(%d, %q) = %q, want %q", tc.status, tc.message, got, tc.want)
+		}
+	}
+}
+
+func TestChatCompletionMapsOllamaErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		status     int
+		message    string
+		wantStatus int
+		wantCode   string
+		errorType  string // recorded in errors_total
+	}{
+		{"context length", http.StatusInternalServerError, "prompt too long; exceeded max context length by 12 tokens", http.StatusBadRequest, errContextLengthExceeded, errContextLengthExceeded},
+		{"memory", http.StatusInternalServerError, "model requires more system memory (12.3 GiB) than is available (8.0 GiB)", http.StatusInternalServerError, errInsufficientMemory, errInsufficientMemory},
+		// Model errors are classified first, even when they mention memory
+		{"runner out of memory", http.StatusInternalServerError, "llama runner process has terminated: cudaMalloc failed: out of memory", http.StatusInternalServerError, errModelLoadFailed, errModelLoadFailed},
+		{"missing model", http.StatusNotFound, `model "llama9:70b" not found, try pulling it first`, http.StatusNotFound, "model_not_found", errModelNotPulled},
+		{"unrecognized", http.StatusBadRequest, "invalid options: num_gpu_layers", http.StatusBadRequest, "", "upstream_error"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"error": tc.message})
+			upstream := stubOllama(tc.status, "application/json; charset=utf-8", string(body))
+			defer upstream.Close()
+			h := newTestOpenAIHandler(upstream, nil)
+
+			var rec *httptest.ResponseRecorder
+			assertErrorCounted(t, "llama2:7b", tc.errorType, func() {
+				rec = serve(h.HandleChatCompletions, "/v1/chat/completions", `{"model":"llama2:7b","messages":[{"role":"user","content":"hi"}]}`)
+			})
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			var errResp models.OpenAIError
+			if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil {
+				t.Fatalf("error body isn't JSON: %v", err)
+			}
+			code := ""
+			if errResp.Error.Code != nil {
+				code = *errResp.Error.Code
+			}
+			if code != tc.wantCode || errResp.Error.Message != tc.message {
+				t.Errorf("error code %q, message %q; want code %q with the upstream message", code, errResp.Error.Message, tc.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/atyronesmith/llama-metrics/proxy/pkg/config"
+)
+
+// modelPolicy is the proxy-wide model allow and block list. Names without a
+// tag match ":latest", as they do in Ollama.
+type modelPolicy struct {
+	allowed map[string]bool
+	blocked map[string]bool
+}
+
+func newModelPolicy(cfg *config.Config) modelPolicy {
+	p := modelPolicy{
+		allowed: make(map[string]bool),
+		blocked: make(map[string]bool),
+	}
+	for _, model := range cfg.ParsedAllowedModels() {
+		p.allowed[normalizeModelName(model)] = true
+	}
+	for _, model := range cfg.ParsedBlockedModels() {
+		p.blocked[normalizeModelName(model)] = true
+	}
+	return p
+}
+
+// permits reports whether model may be used; an empty allow list allows
+// every model that isn't blocked
+func (p modelPolicy) permits(model string) bool {
+	model = normalizeModelName(model)
+	if p.blocked[model] {
+		return false
+	}
+	return len(p.allowed) == 0 || p.allowed[model]
+}
+
+func normalizeModelName(model string) string {
+	if !strings.Contains(model, ":") {
+		return model + ":latest"
+	}
+	return model
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleModels handles the /v1/models endpoint, listing Ollama's local
+// models followed by the OpenAI names mapped onto them. Models the proxy
+// doesn't serve are left out.
+func (h *OpenAIHandler) HandleModels(c *gin.Context) {
+	start := time.Now()
+	model := "unknown"
+
+	// Backends are expected to serve the same models, so any one will do
+	target, release, err := h.backends.Pick()
+	if err != nil {
+		h.sendBackendsUnavailable(c, model, err)
+		return
+	}
+	defer release()
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), "GET", fmt.Sprintf("%s/api/tags", target.URL), nil)
+	if err != nil {
+		h.metrics.RecordError(model, "create_request")
+		h.sendOpenAIError(c, http.StatusInternalServerError, "internal_error", "Failed to create request")
+		return
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		h.metrics.RecordError(model, "proxy_request")
+		h.sendOpenAIError(c, http.StatusBadGateway, "internal_error", "Failed to list models")
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		h.metrics.RecordError(model, "upstream_error")
+		c.JSON(resp.StatusCode, openAIUpstreamError(resp))
+		return
+	}
+
+	body, err := readUpstreamBody(resp, h.config.MaxResponseBytes)
+	if errors.Is(err, errUpstreamTooLarge) {
+		h.metrics.RecordError(model, "upstream_too_large")
+		h.sendOpenAIError(c, http.StatusBadGateway, "upstream_error", "Upstream response too large")
+		return
+	}
+	if err != nil {
+		h.metrics.RecordError(model, "read_response")
+		h.sendOpenAIError(c, http.StatusBadGateway, "internal_error", "Failed to read response")
+		return
+	}
+
+	var tags models.TagsResponse
+	if err := json.Unmarshal(body, &tags); err != nil {
+		h.metrics.RecordError(model, "parse_response")
+		h.sendUpstreamParseError(c, model, "Failed to parse upstream response", err, body)
+		return
+	}
+
+	list := models.ModelList{
+		Object: "list",
+		Data:   make([]models.Model, 0, len(tags.Models)+len(openAIModelMap)),
+	}
+	created := make(map[string]int64, len(tags.Models))
+	for _, info := range tags.Models {
+		if !h.models.permits(info.Name) {
+			continue
+		}
+		var ts int64
+		if modified, err := time.Parse(time.RFC3339Nano, info.ModifiedAt); err == nil {
+			ts = modified.Unix()
+		}
+		created[info.Name] = ts
+		list.Data = append(list.Data, models.Model{
+			ID:      info.Name,
+			Object:  "model",
+			Created: ts,
+			OwnedBy: "library",
+		})
+	}
+
+	// Synthesize the OpenAI names so clients that ask for them find them;
+	// Created follows the mapped Ollama model when it is installed
+	openAINames := make([]string, 0, len(openAIModelMap))
+	for name, target := range openAIModelMap {
+		if h.models.permits(target) {
+			openAINames = append(openAINames, name)
+		}
+	}
+	sort.Strings(openAINames)
+	for _, name := range openAINames {
+		list.Data = append(list.Data, models.Model{
+			ID:      name,
+			Object:  "model",
+			Created: created[openAIModelMap[name]],
+			OwnedBy: "ollama-proxy",
+		})
+	}
+
+	respBody, err := json.Marshal(list)
+	if err != nil {
+		h.metrics.RecordError(model, "marshal_response")
+		h.sendOpenAIError(c, http.StatusInternalServerError, "internal_error", "Failed to encode model list")
+		return
+	}
+
+	// Record metrics
+	h.metrics.RecordRequest("GET", "/v1/models", model, "200", time.Since(start))
+	h.metrics.RecordResponseSize(model, "/v1/models", len(respBody))
+
+	c.Data(http.StatusOK, "application/json", respBody)
+}
@@ -4,17 +4,25 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/atyronesmith/llama-metrics/proxy/internal/apikeys"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/backend"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/contentfilter"
 	"github.com/atyronesmith/llama-metrics/proxy/internal/metrics"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/modelload"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/modelpull"
 	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/requestid"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/requestlog"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/tagstrip"
 	"github.com/atyronesmith/llama-metrics/proxy/pkg/config"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 // OpenAIHandler handles OpenAI-compatible API requests
@@ -22,39 +30,68 @@ type OpenAIHandler struct {
 	config     *config.Config
 	metrics    *metrics.Collector
 	httpClient *http.Client
+	filter     contentfilter.Filter
+	puller     *modelpull.Puller
+	stripper   *tagstrip.Stripper
+	loads      *modelload.Guard
+	requestIDs *requestid.Registry
+	models     modelPolicy
+	backends   *backend.Pool
 }
 
 // NewOpenAIHandler creates a new OpenAI handler
-func NewOpenAIHandler(cfg *config.Config, m *metrics.Collector) *OpenAIHandler {
-	return &OpenAIHandler{
+func NewOpenAIHandler(cfg *config.Config, m *metrics.Collector, filter contentfilter.Filter, loads *modelload.Guard, backends *backend.Pool) *OpenAIHandler {
+	h := &OpenAIHandler{
 		config:  cfg,
 		metrics: m,
+		filter:  filter,
+		loads:   loads,
 		httpClient: &http.Client{
-			Timeout: 5 * time.Minute,
+			Timeout: cfg.UpstreamTimeout,
 		},
+		requestIDs: requestid.New(requestIDHistory),
+		models:     newModelPolicy(cfg),
+		backends:   backends,
 	}
+
+	// Report every upstream outcome to its backend's circuit breaker
+	h.httpClient.Transport = backends.Transport(http.DefaultTransport)
+
+	if cfg.AutoPull {
+		h.puller = modelpull.New(backends.URLs(), m)
+	}
+
+	if tags := cfg.ParsedStripTags(); len(tags) > 0 {
+		h.stripper = tagstrip.New(tags)
+	}
+
+	return h
 }
 
 // HandleChatCompletions handles the /v1/chat/completions endpoint
 func (h *OpenAIHandler) HandleChatCompletions(c *gin.Context) {
 	start := time.Now()
-	requestID := uuid.New().String()
 	model := "unknown"
 
 	// Add request ID to response headers
-	c.Header("X-Request-ID", requestID)
+	requestID, ok := h.assignRequestID(c, clientRequestID(c))
+	if !ok {
+		return
+	}
 
 	// Read request body
-	body, err := io.ReadAll(c.Request.Body)
+	body, err := readRequestBody(c, h.config.MaxRequestBytes)
+	if errors.Is(err, errRequestTooLarge) {
+		h.metrics.RecordError(model, "request_too_large")
+		h.sendOpenAIErrorCode(c, http.StatusRequestEntityTooLarge, "invalid_request_error", "request_too_large", requestTooLargeMessage(h.config.MaxRequestBytes))
+		return
+	}
 	if err != nil {
 		h.metrics.RecordError(model, "read_body")
 		h.sendOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "Failed to read request body")
 		return
 	}
 
-	// Record request size
-	h.metrics.RecordRequestSize(model, "/v1/chat/completions", len(body))
-
 	// Parse OpenAI request
 	var openAIReq models.ChatCompletionRequest
 	if err := json.Unmarshal(body, &openAIReq); err != nil {
@@ -64,6 +101,11 @@ func (h *OpenAIHandler) HandleChatCompletions(c *gin.Context) {
 	}
 
 	model = h.mapOpenAIModelToOllama(openAIReq.Model)
+	c.Set(requestlog.ModelKey, model)
+	c.Set(requestlog.UserKey, openAIReq.User)
+
+	// Record request size under the resolved model so it correlates with token counts
+	h.metrics.RecordRequestSize(model, "/v1/chat/completions", len(body))
 
 	// Track active requests
 	h.metrics.IncActiveRequests(model)
@@ -72,6 +114,42 @@ func (h *OpenAIHandler) HandleChatCompletions(c *gin.Context) {
 	// Convert to Ollama format
 	ollamaReq := h.convertChatToOllama(openAIReq)
 
+	// Enforce the proxy's and the API key's model allow-lists
+	if !h.models.permits(model) {
+		h.sendModelNotServed(c, model)
+		return
+	}
+	if !apikeys.ModelAllowed(c, model) {
+		h.sendModelNotAllowed(c, model)
+		return
+	}
+
+	// Each choice is a separate generation, so n is capped and only
+	// supported without streaming
+	if openAIReq.N > h.config.MaxChoices {
+		h.metrics.RecordError(model, "invalid_n")
+		h.sendOpenAIError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("n must be at most %d", h.config.MaxChoices))
+		return
+	}
+	if openAIReq.N > 1 && openAIReq.Stream {
+		h.metrics.RecordError(model, "invalid_n")
+		h.sendOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "n greater than 1 is not supported with stream")
+		return
+	}
+
+	// Filtered responses can only be checked once complete
+	if openAIReq.Stream && filtersResponses(h.filter, h.config.ContentFilterResponse) {
+		h.metrics.RecordError(model, "stream_not_allowed")
+		h.sendOpenAIErrorCode(c, http.StatusBadRequest, "invalid_request_error", "stream_not_allowed", streamFilteredMessage)
+		return
+	}
+
+	// Reject prompts the content filter doesn't allow
+	if allowed, err := promptAllowed(c.Request.Context(), h.filter, h.metrics, model, chatPromptText(ollamaReq.Messages)); !allowed {
+		h.sendFilterError(c, err, promptFilteredMessage)
+		return
+	}
+
 	// Call Ollama
 	if openAIReq.Stream {
 		h.handleStreamingChatCompletion(c, ollamaReq, openAIReq, model, requestID, start)
@@ -83,23 +161,27 @@ func (h *OpenAIHandler) HandleChatCompletions(c *gin.Context) {
 // HandleCompletions handles the /v1/completions endpoint
 func (h *OpenAIHandler) HandleCompletions(c *gin.Context) {
 	start := time.Now()
-	requestID := uuid.New().String()
 	model := "unknown"
 
 	// Add request ID to response headers
-	c.Header("X-Request-ID", requestID)
+	requestID, ok := h.assignRequestID(c, clientRequestID(c))
+	if !ok {
+		return
+	}
 
 	// Read request body
-	body, err := io.ReadAll(c.Request.Body)
+	body, err := readRequestBody(c, h.config.MaxRequestBytes)
+	if errors.Is(err, errRequestTooLarge) {
+		h.metrics.RecordError(model, "request_too_large")
+		h.sendOpenAIErrorCode(c, http.StatusRequestEntityTooLarge, "invalid_request_error", "request_too_large", requestTooLargeMessage(h.config.MaxRequestBytes))
+		return
+	}
 	if err != nil {
 		h.metrics.RecordError(model, "read_body")
 		h.sendOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "Failed to read request body")
 		return
 	}
 
-	// Record request size
-	h.metrics.RecordRequestSize(model, "/v1/completions", len(body))
-
 	// Parse OpenAI request
 	var openAIReq models.CompletionRequest
 	if err := json.Unmarshal(body, &openAIReq); err != nil {
@@ -109,6 +191,11 @@ func (h *OpenAIHandler) HandleCompletions(c *gin.Context) {
 	}
 
 	model = h.mapOpenAIModelToOllama(openAIReq.Model)
+	c.Set(requestlog.ModelKey, model)
+	c.Set(requestlog.UserKey, openAIReq.User)
+
+	// Record request size under the resolved model so it correlates with token counts
+	h.metrics.RecordRequestSize(model, "/v1/completions", len(body))
 
 	// Track active requests
 	h.metrics.IncActiveRequests(model)
@@ -117,6 +204,29 @@ func (h *OpenAIHandler) HandleCompletions(c *gin.Context) {
 	// Convert to Ollama format
 	ollamaReq := h.convertCompletionToOllama(openAIReq)
 
+	// Enforce the proxy's and the API key's model allow-lists
+	if !h.models.permits(model) {
+		h.sendModelNotServed(c, model)
+		return
+	}
+	if !apikeys.ModelAllowed(c, model) {
+		h.sendModelNotAllowed(c, model)
+		return
+	}
+
+	// Filtered responses can only be checked once complete
+	if openAIReq.Stream && filtersResponses(h.filter, h.config.ContentFilterResponse) {
+		h.metrics.RecordError(model, "stream_not_allowed")
+		h.sendOpenAIErrorCode(c, http.StatusBadRequest, "invalid_request_error", "stream_not_allowed", streamFilteredMessage)
+		return
+	}
+
+	// Reject prompts the content filter doesn't allow
+	if allowed, err := promptAllowed(c.Request.Context(), h.filter, h.metrics, model, ollamaReq.Prompt); !allowed {
+		h.sendFilterError(c, err, promptFilteredMessage)
+		return
+	}
+
 	// Call Ollama
 	if openAIReq.Stream {
 		h.handleStreamingCompletion(c, ollamaReq, openAIReq, model, requestID, start)
@@ -130,26 +240,27 @@ func (h *OpenAIHandler) convertChatToOllama(openAIReq models.ChatCompletionReque
 	messages := make([]models.Message, len(openAIReq.Messages))
 	for i, msg := range openAIReq.Messages {
 		messages[i] = models.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
+			Role:      msg.Role,
+			Content:   msg.Content,
+			ToolCalls: ollamaToolCalls(msg.ToolCalls),
 		}
 	}
 
 	options := make(map[string]interface{})
-	if openAIReq.Temperature > 0 {
-		options["temperature"] = openAIReq.Temperature
+	if openAIReq.Temperature != nil {
+		options["temperature"] = *openAIReq.Temperature
 	}
-	if openAIReq.TopP > 0 {
-		options["top_p"] = openAIReq.TopP
+	if openAIReq.TopP != nil {
+		options["top_p"] = *openAIReq.TopP
 	}
 	if openAIReq.MaxTokens > 0 {
 		options["num_predict"] = openAIReq.MaxTokens
 	}
-	if openAIReq.Stop != nil {
-		options["stop"] = openAIReq.Stop
+	if stop := normalizeStop(openAIReq.Stop); len(stop) > 0 {
+		options["stop"] = stop
 	}
-	if openAIReq.Seed > 0 {
-		options["seed"] = openAIReq.Seed
+	if openAIReq.Seed != nil {
+		options["seed"] = *openAIReq.Seed
 	}
 
 	return models.ChatRequest{
@@ -157,9 +268,21 @@ func (h *OpenAIHandler) convertChatToOllama(openAIReq models.ChatCompletionReque
 		Messages: messages,
 		Stream:   openAIReq.Stream,
 		Options:  options,
+		Format:   ollamaFormat(openAIReq.ResponseFormat),
+		Tools:    ollamaTools(openAIReq),
 	}
 }
 
+// ollamaFormat maps an OpenAI response_format to Ollama's format: "json"
+// constrains the output to valid JSON for json_object, and "text" or no
+// response_format leaves it unset
+func ollamaFormat(responseFormat *models.ResponseFormat) string {
+	if responseFormat != nil && responseFormat.Type == "json_object" {
+		return "json"
+	}
+	return ""
+}
+
 // convertCompletionToOllama converts OpenAI completion request to Ollama format
 func (h *OpenAIHandler) convertCompletionToOllama(openAIReq models.CompletionRequest) models.GenerateRequest {
 	prompt := ""
@@ -173,17 +296,20 @@ func (h *OpenAIHandler) convertCompletionToOllama(openAIReq models.CompletionReq
 	}
 
 	options := make(map[string]interface{})
-	if openAIReq.Temperature > 0 {
-		options["temperature"] = openAIReq.Temperature
+	if openAIReq.Temperature != nil {
+		options["temperature"] = *openAIReq.Temperature
 	}
-	if openAIReq.TopP > 0 {
-		options["top_p"] = openAIReq.TopP
+	if openAIReq.TopP != nil {
+		options["top_p"] = *openAIReq.TopP
 	}
 	if openAIReq.MaxTokens > 0 {
 		options["num_predict"] = openAIReq.MaxTokens
 	}
-	if openAIReq.Stop != nil {
-		options["stop"] = openAIReq.Stop
+	if stop := normalizeStop(openAIReq.Stop); len(stop) > 0 {
+		options["stop"] = stop
+	}
+	if openAIReq.Seed != nil {
+		options["seed"] = *openAIReq.Seed
 	}
 
 	return models.GenerateRequest{
@@ -194,13 +320,43 @@ func (h *OpenAIHandler) convertCompletionToOllama(openAIReq models.CompletionReq
 	}
 }
 
+// normalizeStop converts OpenAI's stop parameter, a string or an array of
+// strings, into the []string Ollama expects
+func normalizeStop(stop interface{}) []string {
+	switch s := stop.(type) {
+	case string:
+		if s != "" {
+			return []string{s}
+		}
+	case []string:
+		return s
+	case []interface{}:
+		sequences := make([]string, 0, len(s))
+		for _, item := range s {
+			if str, ok := item.(string); ok && str != "" {
+				sequences = append(sequences, str)
+			}
+		}
+		return sequences
+	}
+	return nil
+}
+
 // handleStreamingChatCompletion handles streaming chat completion
 func (h *OpenAIHandler) handleStreamingChatCompletion(c *gin.Context, ollamaReq models.ChatRequest, openAIReq models.ChatCompletionRequest, model, requestID string, start time.Time) {
 	// Make request to Ollama
+	target, release, err := h.backends.Pick()
+	if err != nil {
+		h.sendBackendsUnavailable(c, model, err)
+		return
+	}
+	defer release()
+
 	reqBody, _ := json.Marshal(ollamaReq)
-	targetURL := fmt.Sprintf("%s/api/chat", h.config.OllamaURL())
+	targetURL := fmt.Sprintf("%s/api/chat", target.URL)
 
-	proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(reqBody))
+	// Cancelled when the client disconnects, so Ollama stops generating
+	proxyReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", targetURL, bytes.NewReader(reqBody))
 	if err != nil {
 		h.metrics.RecordError(model, "create_request")
 		h.sendOpenAIError(c, http.StatusInternalServerError, "internal_error", "Failed to create request")
@@ -208,15 +364,43 @@ func (h *OpenAIHandler) handleStreamingChatCompletion(c *gin.Context, ollamaReq
 	}
 
 	proxyReq.Header.Set("Content-Type", "application/json")
+	if h.config.ForwardClientIP {
+		setForwardedHeaders(c, proxyReq)
+	}
+
+	// Wait behind any other model load there instead of swapping concurrently
+	loaded := func() {}
+	if h.loads != nil {
+		release, err := h.loads.Acquire(c.Request.Context(), target.URL, model)
+		if err != nil {
+			h.metrics.RecordError(model, "model_load_wait")
+			h.sendOpenAIError(c, http.StatusServiceUnavailable, "server_error", "Request cancelled while waiting for a model load")
+			return
+		}
+		defer release()
+		loaded = release
+	}
 
 	resp, err := h.httpClient.Do(proxyReq)
+	// Ollama only answers once the model is loaded, so free the load slot
+	// now rather than when the response ends
+	loaded()
 	if err != nil {
 		h.metrics.RecordError(model, "proxy_request")
+		if h.config.FallbackResponse {
+			h.sendChatFallback(c, openAIReq, model, requestID)
+			return
+		}
 		h.sendOpenAIError(c, http.StatusBadGateway, "internal_error", "Failed to proxy request")
 		return
 	}
 	defer resp.Body.Close()
 
+	// Ollama's JSON errors become the matching OpenAI errors
+	if h.handleOllamaError(c, resp, model) {
+		return
+	}
+
 	// Set SSE headers
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
@@ -225,13 +409,18 @@ func (h *OpenAIHandler) handleStreamingChatCompletion(c *gin.Context, ollamaReq
 
 	// Process streaming response
 	scanner := bufio.NewScanner(resp.Body)
-	firstTokenTime := time.Time{}
+	var firstTokenTime, lastTokenTime time.Time
 	promptTokens := 0
 	generatedTokens := 0
 	var evalDuration int64
 	var accumulatedContent strings.Builder
+	stream := newStripStream(h.stripper)
 
 	for scanner.Scan() {
+		if clientGone(c) {
+			break
+		}
+
 		line := scanner.Bytes()
 
 		var ollamaResp models.ChatResponse
@@ -239,10 +428,25 @@ func (h *OpenAIHandler) handleStreamingChatCompletion(c *gin.Context, ollamaReq
 			continue
 		}
 
-		// Record time to first token
-		if firstTokenTime.IsZero() && ollamaResp.Message.Content != "" {
-			firstTokenTime = time.Now()
-			h.metrics.RecordTimeToFirstToken(model, firstTokenTime.Sub(start))
+		// Record time to first token, then the gap before each later one
+		if ollamaResp.Message.Content != "" {
+			now := time.Now()
+			if firstTokenTime.IsZero() {
+				firstTokenTime = now
+				h.metrics.RecordTimeToFirstToken(model, now.Sub(start))
+			} else {
+				h.metrics.RecordInterTokenLatency(model, now.Sub(lastTokenTime))
+			}
+			lastTokenTime = now
+		}
+
+		// Strip reasoning tag blocks, holding back partial tags between chunks
+		var reasoning string
+		if stream != nil {
+			ollamaResp.Message.Content, reasoning = stripChunk(stream, ollamaResp.Message.Content, ollamaResp.Done)
+			if !h.config.StripTagsReasoning {
+				reasoning = ""
+			}
 		}
 
 		// Accumulate content
@@ -258,7 +462,8 @@ func (h *OpenAIHandler) handleStreamingChatCompletion(c *gin.Context, ollamaReq
 				{
 					Index: 0,
 					Delta: &models.ChatMessage{
-						Content: ollamaResp.Message.Content,
+						Content:          ollamaResp.Message.Content,
+						ReasoningContent: reasoning,
 					},
 				},
 			},
@@ -278,13 +483,42 @@ func (h *OpenAIHandler) handleStreamingChatCompletion(c *gin.Context, ollamaReq
 		c.Writer.Flush()
 	}
 
+	// A client that went away gets nothing more
+	gone := clientGone(c)
+
+	// Report usage in a final chunk with no choices when the client asked for it
+	if !gone && openAIReq.StreamOptions != nil && openAIReq.StreamOptions.IncludeUsage {
+		usageResp := models.StreamingChatCompletionResponse{
+			ID:      requestID,
+			Object:  "chat.completion.chunk",
+			Created: time.Now().Unix(),
+			Model:   openAIReq.Model,
+			Choices: []models.ChatChoice{},
+			Usage: &models.Usage{
+				PromptTokens:     promptTokens,
+				CompletionTokens: generatedTokens,
+				TotalTokens:      promptTokens + generatedTokens,
+			},
+		}
+		data, _ := json.Marshal(usageResp)
+		c.SSEvent("", fmt.Sprintf("data: %s\n\n", string(data)))
+		c.Writer.Flush()
+	}
+
 	// Send final [DONE] message
-	c.SSEvent("", "data: [DONE]\n\n")
-	c.Writer.Flush()
+	if !gone {
+		c.SSEvent("", "data: [DONE]\n\n")
+		c.Writer.Flush()
+	}
 
 	// Record metrics
+	status, statusCode := "200", http.StatusOK
+	if gone {
+		h.metrics.RecordClientDisconnect(model)
+		status, statusCode = statusClientClosedRequest, codeClientClosedRequest
+	}
 	duration := time.Since(start)
-	h.metrics.RecordRequest("POST", "/v1/chat/completions", model, "200", duration)
+	h.metrics.RecordRequest("POST", "/v1/chat/completions", model, status, duration)
 
 	// Calculate and record token metrics
 	totalTokens := promptTokens + generatedTokens
@@ -293,6 +527,7 @@ func (h *OpenAIHandler) handleStreamingChatCompletion(c *gin.Context, ollamaReq
 		tokensPerSec = float64(generatedTokens) / (float64(evalDuration) / 1e9)
 	}
 	h.metrics.RecordTokens(model, promptTokens, generatedTokens, tokensPerSec)
+	c.Set(requestlog.TokensKey, totalTokens)
 
 	// Record enhanced metrics
 	h.metrics.RecordRequestMetadata(models.RequestMetadata{
@@ -305,7 +540,7 @@ func (h *OpenAIHandler) handleStreamingChatCompletion(c *gin.Context, ollamaReq
 		CompletionTokens: generatedTokens,
 		TotalTokens:      totalTokens,
 		Stream:           true,
-		StatusCode:       200,
+		StatusCode:       statusCode,
 		Endpoint:         "/v1/chat/completions",
 		Method:           "POST",
 		ResponseTime:     duration,
@@ -318,11 +553,336 @@ func (h *OpenAIHandler) handleStreamingChatCompletion(c *gin.Context, ollamaReq
 	h.metrics.RecordResponseSize(model, "/v1/chat/completions", responseSize)
 }
 
-// handleNonStreamingChatCompletion handles non-streaming chat completion
+// handleNonStreamingChatCompletion handles non-streaming chat completion,
+// generating each of the n requested choices with its own Ollama call
 func (h *OpenAIHandler) handleNonStreamingChatCompletion(c *gin.Context, ollamaReq models.ChatRequest, openAIReq models.ChatCompletionRequest, model, requestID string, start time.Time) {
+	// Make the requests to Ollama
+	n := openAIReq.N
+	if n < 1 {
+		n = 1
+	}
+	responses, err := h.chatChoices(c, ollamaReq, openAIReq.Seed, model, n)
+	if err != nil {
+		h.sendChatCallError(c, openAIReq, model, requestID, err)
+		return
+	}
+
+	choices := make([]models.ChatChoice, len(responses))
+	var promptTokens, completionTokens int
+	var evalDuration int64
+	for i, ollamaResp := range responses {
+		// Strip reasoning tag blocks from the generated text
+		var reasoning string
+		if h.stripper != nil {
+			ollamaResp.Message.Content, reasoning = h.stripper.Strip(ollamaResp.Message.Content)
+			if !h.config.StripTagsReasoning {
+				reasoning = ""
+			}
+		}
+
+		// Apply the content filter to the generated text
+		content, allowed, err := filterResponseText(c.Request.Context(), h.filter, h.metrics, model, ollamaResp.Message.Content)
+		if !allowed {
+			h.sendFilterError(c, err, responseFilteredMessage)
+			return
+		}
+		ollamaResp.Message.Content = content
+
+		finishReason := "stop"
+		toolCalls := openAIToolCalls(ollamaResp.Message.ToolCalls)
+		if len(toolCalls) > 0 {
+			finishReason = "tool_calls"
+		}
+
+		choices[i] = models.ChatChoice{
+			Index: i,
+			Message: models.ChatMessage{
+				Role:             ollamaResp.Message.Role,
+				Content:          ollamaResp.Message.Content,
+				ReasoningContent: reasoning,
+				ToolCalls:        toolCalls,
+			},
+			FinishReason: finishReason,
+		}
+
+		// Each generation is its own sample for the token metrics
+		var tokensPerSec float64
+		if ollamaResp.EvalDuration > 0 && ollamaResp.EvalCount > 0 {
+			tokensPerSec = float64(ollamaResp.EvalCount) / (float64(ollamaResp.EvalDuration) / 1e9)
+		}
+		h.metrics.RecordTokens(model, ollamaResp.PromptEvalCount, ollamaResp.EvalCount, tokensPerSec)
+
+		promptTokens += ollamaResp.PromptEvalCount
+		completionTokens += ollamaResp.EvalCount
+		evalDuration += ollamaResp.EvalDuration
+	}
+	totalTokens := promptTokens + completionTokens
+
+	// Convert to OpenAI format
+	openAIResp := models.ChatCompletionResponse{
+		ID:      requestID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   openAIReq.Model,
+		Choices: choices,
+		Usage: &models.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      totalTokens,
+		},
+	}
+
+	// Record metrics
+	duration := time.Since(start)
+	h.metrics.RecordRequest("POST", "/v1/chat/completions", model, "200", duration)
+	c.Set(requestlog.TokensKey, totalTokens)
+
+	var tokensPerSec float64
+	if evalDuration > 0 && completionTokens > 0 {
+		tokensPerSec = float64(completionTokens) / (float64(evalDuration) / 1e9)
+	}
+
+	// Record enhanced metrics
+	h.metrics.RecordRequestMetadata(models.RequestMetadata{
+		RequestID:        requestID,
+		Model:            model,
+		User:             openAIReq.User,
+		StartTime:        start,
+		EndTime:          time.Now(),
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      totalTokens,
+		Stream:           false,
+		StatusCode:       200,
+		Endpoint:         "/v1/chat/completions",
+		Method:           "POST",
+		ResponseTime:     duration,
+		TokensPerSecond:  tokensPerSec,
+	})
+
+	// Send response and record size
+	respBody, _ := json.Marshal(openAIResp)
+	h.metrics.RecordResponseSize(model, "/v1/chat/completions", len(respBody))
+
+	c.JSON(http.StatusOK, openAIResp)
+}
+
+// handleStreamingCompletion handles streaming completion (legacy API)
+func (h *OpenAIHandler) handleStreamingCompletion(c *gin.Context, ollamaReq models.GenerateRequest, openAIReq models.CompletionRequest, model, requestID string, start time.Time) {
+	// Make request to Ollama
+	target, release, err := h.backends.Pick()
+	if err != nil {
+		h.sendBackendsUnavailable(c, model, err)
+		return
+	}
+	defer release()
+
+	reqBody, _ := json.Marshal(ollamaReq)
+	targetURL := fmt.Sprintf("%s/api/generate", target.URL)
+
+	// Cancelled when the client disconnects, so Ollama stops generating
+	proxyReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", targetURL, bytes.NewReader(reqBody))
+	if err != nil {
+		h.metrics.RecordError(model, "create_request")
+		h.sendOpenAIError(c, http.StatusInternalServerError, "internal_error", "Failed to create request")
+		return
+	}
+
+	proxyReq.Header.Set("Content-Type", "application/json")
+	if h.config.ForwardClientIP {
+		setForwardedHeaders(c, proxyReq)
+	}
+
+	// Wait behind any other model load there instead of swapping concurrently
+	loaded := func() {}
+	if h.loads != nil {
+		release, err := h.loads.Acquire(c.Request.Context(), target.URL, model)
+		if err != nil {
+			h.metrics.RecordError(model, "model_load_wait")
+			h.sendOpenAIError(c, http.StatusServiceUnavailable, "server_error", "Request cancelled while waiting for a model load")
+			return
+		}
+		defer release()
+		loaded = release
+	}
+
+	resp, err := h.httpClient.Do(proxyReq)
+	// Ollama only answers once the model is loaded, so free the load slot
+	// now rather than when the response ends
+	loaded()
+	if err != nil {
+		h.metrics.RecordError(model, "proxy_request")
+		if h.config.FallbackResponse {
+			h.sendCompletionFallback(c, openAIReq, model, requestID)
+			return
+		}
+		h.sendOpenAIError(c, http.StatusBadGateway, "internal_error", "Failed to proxy request")
+		return
+	}
+	defer resp.Body.Close()
+
+	// Ollama's JSON errors become the matching OpenAI errors
+	if h.handleOllamaError(c, resp, model) {
+		return
+	}
+
+	// Set SSE headers
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	// Process streaming response
+	scanner := bufio.NewScanner(resp.Body)
+	var firstTokenTime, lastTokenTime time.Time
+	promptTokens := 0
+	generatedTokens := 0
+	var evalDuration int64
+	var accumulatedText strings.Builder
+	stream := newStripStream(h.stripper)
+
+	for scanner.Scan() {
+		if clientGone(c) {
+			break
+		}
+
+		line := scanner.Bytes()
+
+		var ollamaResp models.GenerateResponse
+		if err := json.Unmarshal(line, &ollamaResp); err != nil {
+			continue
+		}
+
+		// Record time to first token, then the gap before each later one
+		if ollamaResp.Response != "" {
+			now := time.Now()
+			if firstTokenTime.IsZero() {
+				firstTokenTime = now
+				h.metrics.RecordTimeToFirstToken(model, now.Sub(start))
+			} else {
+				h.metrics.RecordInterTokenLatency(model, now.Sub(lastTokenTime))
+			}
+			lastTokenTime = now
+		}
+
+		// Strip reasoning tag blocks, holding back partial tags between chunks
+		if stream != nil {
+			ollamaResp.Response, _ = stripChunk(stream, ollamaResp.Response, ollamaResp.Done)
+		}
+
+		// Accumulate text
+		accumulatedText.WriteString(ollamaResp.Response)
+
+		// Convert to OpenAI format
+		openAIResp := models.CompletionResponse{
+			ID:      requestID,
+			Object:  "text_completion",
+			Created: time.Now().Unix(),
+			Model:   openAIReq.Model,
+			Choices: []models.CompletionChoice{
+				{
+					Text:  ollamaResp.Response,
+					Index: 0,
+				},
+			},
+		}
+
+		// Add finish reason if done
+		if ollamaResp.Done {
+			openAIResp.Choices[0].FinishReason = "stop"
+			promptTokens = ollamaResp.PromptEvalCount
+			generatedTokens = ollamaResp.EvalCount
+			evalDuration = ollamaResp.EvalDuration
+		}
+
+		// Send the chunk
+		data, _ := json.Marshal(openAIResp)
+		c.SSEvent("", fmt.Sprintf("data: %s\n\n", string(data)))
+		c.Writer.Flush()
+	}
+
+	// A client that went away gets nothing more
+	gone := clientGone(c)
+
+	// Report usage in a final chunk with no choices when the client asked for it
+	if !gone && openAIReq.StreamOptions != nil && openAIReq.StreamOptions.IncludeUsage {
+		usageResp := models.CompletionResponse{
+			ID:      requestID,
+			Object:  "text_completion",
+			Created: time.Now().Unix(),
+			Model:   openAIReq.Model,
+			Choices: []models.CompletionChoice{},
+			Usage: &models.Usage{
+				PromptTokens:     promptTokens,
+				CompletionTokens: generatedTokens,
+				TotalTokens:      promptTokens + generatedTokens,
+			},
+		}
+		data, _ := json.Marshal(usageResp)
+		c.SSEvent("", fmt.Sprintf("data: %s\n\n", string(data)))
+		c.Writer.Flush()
+	}
+
+	// Send final [DONE] message
+	if !gone {
+		c.SSEvent("", "data: [DONE]\n\n")
+		c.Writer.Flush()
+	}
+
+	// Record metrics
+	status, statusCode := "200", http.StatusOK
+	if gone {
+		h.metrics.RecordClientDisconnect(model)
+		status, statusCode = statusClientClosedRequest, codeClientClosedRequest
+	}
+	duration := time.Since(start)
+	h.metrics.RecordRequest("POST", "/v1/completions", model, status, duration)
+
+	// Calculate and record token metrics
+	totalTokens := promptTokens + generatedTokens
+	var tokensPerSec float64
+	if evalDuration > 0 && generatedTokens > 0 {
+		tokensPerSec = float64(generatedTokens) / (float64(evalDuration) / 1e9)
+	}
+	h.metrics.RecordTokens(model, promptTokens, generatedTokens, tokensPerSec)
+	c.Set(requestlog.TokensKey, totalTokens)
+
+	// Record enhanced metrics
+	h.metrics.RecordRequestMetadata(models.RequestMetadata{
+		RequestID:        requestID,
+		Model:            model,
+		User:             openAIReq.User,
+		StartTime:        start,
+		EndTime:          time.Now(),
+		PromptTokens:     promptTokens,
+		CompletionTokens: generatedTokens,
+		TotalTokens:      totalTokens,
+		Stream:           true,
+		StatusCode:       statusCode,
+		Endpoint:         "/v1/completions",
+		Method:           "POST",
+		ResponseTime:     duration,
+		TimeToFirstToken: firstTokenTime.Sub(start),
+		TokensPerSecond:  tokensPerSec,
+	})
+
+	// Record response size (approximate for streaming)
+	responseSize := len(accumulatedText.String()) + 200 // Add overhead for JSON structure
+	h.metrics.RecordResponseSize(model, "/v1/completions", responseSize)
+}
+
+// handleNonStreamingCompletion handles non-streaming completion (legacy API)
+func (h *OpenAIHandler) handleNonStreamingCompletion(c *gin.Context, ollamaReq models.GenerateRequest, openAIReq models.CompletionRequest, model, requestID string, start time.Time) {
 	// Make request to Ollama
+	target, release, err := h.backends.Pick()
+	if err != nil {
+		h.sendBackendsUnavailable(c, model, err)
+		return
+	}
+	defer release()
+
 	reqBody, _ := json.Marshal(ollamaReq)
-	targetURL := fmt.Sprintf("%s/api/chat", h.config.OllamaURL())
+	targetURL := fmt.Sprintf("%s/api/generate", target.URL)
 
 	proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(reqBody))
 	if err != nil {
@@ -332,42 +892,92 @@ func (h *OpenAIHandler) handleNonStreamingChatCompletion(c *gin.Context, ollamaR
 	}
 
 	proxyReq.Header.Set("Content-Type", "application/json")
+	if h.config.ForwardClientIP {
+		setForwardedHeaders(c, proxyReq)
+	}
+
+	// Wait behind any other model load there instead of swapping concurrently
+	loaded := func() {}
+	if h.loads != nil {
+		release, err := h.loads.Acquire(c.Request.Context(), target.URL, model)
+		if err != nil {
+			h.metrics.RecordError(model, "model_load_wait")
+			h.sendOpenAIError(c, http.StatusServiceUnavailable, "server_error", "Request cancelled while waiting for a model load")
+			return
+		}
+		defer release()
+		loaded = release
+	}
 
 	resp, err := h.httpClient.Do(proxyReq)
+	// Ollama only answers once the model is loaded, so free the load slot
+	// now rather than when the response ends
+	loaded()
 	if err != nil {
 		h.metrics.RecordError(model, "proxy_request")
+		if h.config.FallbackResponse {
+			h.sendCompletionFallback(c, openAIReq, model, requestID)
+			return
+		}
 		h.sendOpenAIError(c, http.StatusBadGateway, "internal_error", "Failed to proxy request")
 		return
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	// Ollama's JSON errors become the matching OpenAI errors
+	if h.handleOllamaError(c, resp, model) {
+		return
+	}
+
+	// Keep the upstream status for HTML and other non-JSON error pages
+	if h.config.WrapUpstreamErrors && isNonJSONError(resp) {
+		h.metrics.RecordError(model, "upstream_error")
+		c.JSON(resp.StatusCode, openAIUpstreamError(resp))
+		return
+	}
+
+	body, err := readUpstreamBody(resp, h.config.MaxResponseBytes)
+	if errors.Is(err, errUpstreamTooLarge) {
+		h.metrics.RecordError(model, "upstream_too_large")
+		h.sendOpenAIError(c, http.StatusBadGateway, "upstream_error", "Upstream response too large")
+		return
+	}
 	if err != nil {
 		h.metrics.RecordError(model, "read_response")
 		h.sendOpenAIError(c, http.StatusBadGateway, "internal_error", "Failed to read response")
 		return
 	}
 
-	var ollamaResp models.ChatResponse
+	var ollamaResp models.GenerateResponse
 	if err := json.Unmarshal(body, &ollamaResp); err != nil {
-		h.metrics.RecordError(model, "parse_response")
-		h.sendOpenAIError(c, http.StatusBadGateway, "internal_error", "Failed to parse response")
+		h.metrics.RecordError(model, "upstream_parse")
+		h.sendUpstreamParseError(c, model, "Failed to parse response", err, body)
 		return
 	}
 
+	// Strip reasoning tag blocks from the generated text
+	if h.stripper != nil {
+		ollamaResp.Response, _ = h.stripper.Strip(ollamaResp.Response)
+	}
+
+	// Apply the content filter to the generated text
+	text, allowed, err := filterResponseText(c.Request.Context(), h.filter, h.metrics, model, ollamaResp.Response)
+	if !allowed {
+		h.sendFilterError(c, err, responseFilteredMessage)
+		return
+	}
+	ollamaResp.Response = text
+
 	// Convert to OpenAI format
-	openAIResp := models.ChatCompletionResponse{
+	openAIResp := models.CompletionResponse{
 		ID:      requestID,
-		Object:  "chat.completion",
+		Object:  "text_completion",
 		Created: time.Now().Unix(),
 		Model:   openAIReq.Model,
-		Choices: []models.ChatChoice{
+		Choices: []models.CompletionChoice{
 			{
+				Text:         ollamaResp.Response,
 				Index:        0,
-				Message:      models.ChatMessage{
-					Role:    ollamaResp.Message.Role,
-					Content: ollamaResp.Message.Content,
-				},
 				FinishReason: "stop",
 			},
 		},
@@ -380,7 +990,12 @@ func (h *OpenAIHandler) handleNonStreamingChatCompletion(c *gin.Context, ollamaR
 
 	// Record metrics
 	duration := time.Since(start)
-	h.metrics.RecordRequest("POST", "/v1/chat/completions", model, "200", duration)
+	h.metrics.RecordRequest("POST", "/v1/completions", model, "200", duration)
+
+	// Record model load time
+	if ollamaResp.LoadDuration > 0 {
+		h.metrics.RecordModelLoadTime(model, time.Duration(ollamaResp.LoadDuration))
+	}
 
 	// Calculate and record token metrics
 	var tokensPerSec float64
@@ -388,6 +1003,7 @@ func (h *OpenAIHandler) handleNonStreamingChatCompletion(c *gin.Context, ollamaR
 		tokensPerSec = float64(ollamaResp.EvalCount) / (float64(ollamaResp.EvalDuration) / 1e9)
 	}
 	h.metrics.RecordTokens(model, ollamaResp.PromptEvalCount, ollamaResp.EvalCount, tokensPerSec)
+	c.Set(requestlog.TokensKey, ollamaResp.PromptEvalCount+ollamaResp.EvalCount)
 
 	// Record enhanced metrics
 	h.metrics.RecordRequestMetadata(models.RequestMetadata{
@@ -401,7 +1017,7 @@ func (h *OpenAIHandler) handleNonStreamingChatCompletion(c *gin.Context, ollamaR
 		TotalTokens:      ollamaResp.PromptEvalCount + ollamaResp.EvalCount,
 		Stream:           false,
 		StatusCode:       200,
-		Endpoint:         "/v1/chat/completions",
+		Endpoint:         "/v1/completions",
 		Method:           "POST",
 		ResponseTime:     duration,
 		TokensPerSecond:  tokensPerSec,
@@ -409,38 +1025,26 @@ func (h *OpenAIHandler) handleNonStreamingChatCompletion(c *gin.Context, ollamaR
 
 	// Send response and record size
 	respBody, _ := json.Marshal(openAIResp)
-	h.metrics.RecordResponseSize(model, "/v1/chat/completions", len(respBody))
+	h.metrics.RecordResponseSize(model, "/v1/completions", len(respBody))
 
 	c.JSON(http.StatusOK, openAIResp)
 }
 
-// handleStreamingCompletion handles streaming completion (legacy API)
-func (h *OpenAIHandler) handleStreamingCompletion(c *gin.Context, ollamaReq models.GenerateRequest, openAIReq models.CompletionRequest, model, requestID string, start time.Time) {
-	// Similar to handleStreamingChatCompletion but for the legacy completions API
-	// Implementation omitted for brevity - follows same pattern
-}
-
-// handleNonStreamingCompletion handles non-streaming completion (legacy API)
-func (h *OpenAIHandler) handleNonStreamingCompletion(c *gin.Context, ollamaReq models.GenerateRequest, openAIReq models.CompletionRequest, model, requestID string, start time.Time) {
-	// Similar to handleNonStreamingChatCompletion but for the legacy completions API
-	// Implementation omitted for brevity - follows same pattern
+// openAIModelMap maps common OpenAI models to Ollama equivalents
+var openAIModelMap = map[string]string{
+	"gpt-4":                  "llama2:70b",
+	"gpt-4-turbo":            "llama2:70b",
+	"gpt-3.5-turbo":          "llama2:13b",
+	"gpt-3.5-turbo-16k":      "llama2:13b",
+	"text-davinci-003":       "llama2:7b",
+	"text-davinci-002":       "llama2:7b",
+	"code-davinci-002":       "codellama:7b",
+	"text-embedding-ada-002": "nomic-embed-text",
 }
 
 // mapOpenAIModelToOllama maps OpenAI model names to Ollama model names
 func (h *OpenAIHandler) mapOpenAIModelToOllama(openAIModel string) string {
-	// Map common OpenAI models to Ollama equivalents
-	modelMap := map[string]string{
-		"gpt-4":                    "llama2:70b",
-		"gpt-4-turbo":             "llama2:70b",
-		"gpt-3.5-turbo":           "llama2:13b",
-		"gpt-3.5-turbo-16k":       "llama2:13b",
-		"text-davinci-003":        "llama2:7b",
-		"text-davinci-002":        "llama2:7b",
-		"code-davinci-002":        "codellama:7b",
-		"text-embedding-ada-002":  "nomic-embed-text",
-	}
-
-	if ollamaModel, ok := modelMap[openAIModel]; ok {
+	if ollamaModel, ok := openAIModelMap[openAIModel]; ok {
 		return ollamaModel
 	}
 
@@ -457,4 +1061,50 @@ func (h *OpenAIHandler) sendOpenAIError(c *gin.Context, statusCode int, errorTyp
 		},
 	}
 	c.JSON(statusCode, errorResp)
+}
+
+// sendUpstreamParseError reports an upstream response that couldn't be
+// parsed, with a preview of its body when ERROR_INCLUDE_UPSTREAM_BODY is set
+func (h *OpenAIHandler) sendUpstreamParseError(c *gin.Context, model, message string, err error, body []byte) {
+	logUpstreamParseError(h.config, model, err, body)
+	c.JSON(http.StatusBadGateway, models.OpenAIError{
+		Error: models.ErrorDetail{
+			Message:      message,
+			Type:         "internal_error",
+			UpstreamBody: upstreamBodyPreview(h.config, body),
+		},
+	})
+}
+
+// sendModelNotAllowed rejects a model outside the API key's allow-list
+func (h *OpenAIHandler) sendModelNotAllowed(c *gin.Context, model string) {
+	h.metrics.RecordError(model, "model_not_allowed")
+	h.sendOpenAIErrorCode(c, http.StatusForbidden, "invalid_request_error", "model_not_allowed", fmt.Sprintf("API key may not use model %s", model))
+}
+
+// sendModelNotServed rejects a model outside the proxy's allow-list or on
+// its block list
+func (h *OpenAIHandler) sendModelNotServed(c *gin.Context, model string) {
+	h.metrics.RecordError(model, "model_not_allowed")
+	h.sendOpenAIErrorCode(c, http.StatusForbidden, "invalid_request_error", "model_not_allowed", fmt.Sprintf("Model %s is not allowed on this proxy", model))
+}
+
+// sendBackendsUnavailable answers a request that found every backend's
+// circuit breaker open, like the pool's middleware does
+func (h *OpenAIHandler) sendBackendsUnavailable(c *gin.Context, model string, err error) {
+	h.metrics.RecordError(model, "circuit_open")
+	c.Header("Retry-After", strconv.Itoa(h.backends.RetryAfter()))
+	h.sendOpenAIErrorCode(c, http.StatusServiceUnavailable, "server_error", "circuit_open", err.Error())
+}
+
+// sendOpenAIErrorCode sends an OpenAI-formatted error response with an error code
+func (h *OpenAIHandler) sendOpenAIErrorCode(c *gin.Context, statusCode int, errorType, code, message string) {
+	errorResp := models.OpenAIError{
+		Error: models.ErrorDetail{
+			Message: message,
+			Type:    errorType,
+			Code:    &code,
+		},
+	}
+	c.JSON(statusCode, errorResp)
 }
\ No newline at end of file
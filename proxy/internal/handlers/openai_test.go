@@ -0,0 +1,551 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
+	"github.com/atyronesmith/llama-metrics/proxy/pkg/config"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// recordingOllama is an upstream that answers every request with the same
+// body and keeps the last request body it received
+type recordingOllama struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	last []byte
+}
+
+func newRecordingOllama(body string) *recordingOllama {
+	r := &recordingOllama{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.last = data
+		r.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	return r
+}
+
+// decodeLast decodes the last request body into v
+func (r *recordingOllama) decodeLast(t *testing.T, v interface{}) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := json.Unmarshal(r.last, v); err != nil {
+		t.Fatalf("upstream request isn't JSON: %v (%s)", err, r.last)
+	}
+}
+
+// lastRequest decodes the last request body into a generic map
+func (r *recordingOllama) lastRequest(t *testing.T) map[string]interface{} {
+	t.Helper()
+	var req map[string]interface{}
+	r.decodeLast(t, &req)
+	return req
+}
+
+// lastOptions returns the options of the last upstream request
+func (r *recordingOllama) lastOptions(t *testing.T) map[string]interface{} {
+	t.Helper()
+	options, _ := r.lastRequest(t)["options"].(map[string]interface{})
+	return options
+}
+
+// sseEvents returns the JSON payload of each SSE event in a streamed
+// response, leaving out the closing [DONE]
+func sseEvents(t *testing.T, rec *httptest.ResponseRecorder) []string {
+	t.Helper()
+	var events []string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		i := strings.Index(line, "{")
+		if !strings.Contains(line, "data:") || i < 0 {
+			continue
+		}
+		events = append(events, line[i:])
+	}
+	if len(events) == 0 {
+		t.Fatalf("no SSE events in response: %s", rec.Body)
+	}
+	return events
+}
+
+const (
+	chatStreamBody = `{"model":"llama2:7b","message":{"role":"assistant","content":"Hi"},"done":false}
+{"model":"llama2:7b","message":{"role":"assistant","content":" there"},"done":true,"prompt_eval_count":7,"eval_count":2}
+`
+	completionStreamBody = `{"model":"llama2:7b","response":"Hi","done":false}
+{"model":"llama2:7b","response":" there","done":true,"prompt_eval_count":7,"eval_count":2}
+`
+)
+
+func TestStreamingUsageChunkOnlyWhenRequested(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		path     string
+		upstream string
+		body     string
+	}{
+		{"chat", "/v1/chat/completions", chatStreamBody, `{"model":"llama2:7b","messages":[{"role":"user","content":"hi"}],"stream":true`},
+		{"completion", "/v1/completions", completionStreamBody, `{"model":"llama2:7b","prompt":"hi","stream":true`},
+	} {
+		for _, options := range []struct {
+			name      string
+			extra     string
+			wantUsage bool
+		}{
+			{"no stream_options", "", false},
+			{"include_usage false", `,"stream_options":{"include_usage":false}`, false},
+			{"include_usage true", `,"stream_options":{"include_usage":true}`, true},
+		} {
+			t.Run(tc.name+"/"+options.name, func(t *testing.T) {
+				upstream := newRecordingOllama(tc.upstream)
+				defer upstream.Close()
+				h := newTestOpenAIHandler(upstream.Server, nil)
+
+				handler := h.HandleChatCompletions
+				if tc.path == "/v1/completions" {
+					handler = h.HandleCompletions
+				}
+				rec := serve(handler, tc.path, tc.body+options.extra+"}")
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+				}
+
+				var usage []*models.Usage
+				for _, event := range sseEvents(t, rec) {
+					var chunk struct {
+						Choices []json.RawMessage `json:"choices"`
+						Usage   *models.Usage     `json:"usage"`
+					}
+					if err := json.Unmarshal([]byte(event), &chunk); err != nil {
+						t.Fatalf("chunk isn't JSON: %v (%s)", err, event)
+					}
+					if chunk.Usage != nil {
+						if len(chunk.Choices) != 0 {
+							t.Errorf("usage chunk has %d choices, want none", len(chunk.Choices))
+						}
+						usage = append(usage, chunk.Usage)
+					}
+				}
+
+				if !options.wantUsage {
+					if len(usage) != 0 {
+						t.Errorf("got %d usage chunks, want none", len(usage))
+					}
+					return
+				}
+				if len(usage) != 1 {
+					t.Fatalf("got %d usage chunks, want 1", len(usage))
+				}
+				if *usage[0] != (models.Usage{PromptTokens: 7, CompletionTokens: 2, TotalTokens: 9}) {
+					t.Errorf("usage = %+v, want 7 prompt and 2 completion tokens", *usage[0])
+				}
+			})
+		}
+	}
+}
+
+const (
+	chatBody       = `{"model":"llama2:7b","message":{"role":"assistant","content":"Hi"},"done":true}`
+	completionBody = `{"model":"llama2:7b","response":"Hi","done":true}`
+)
+
+// forwardedOptions sends a chat and a completion request, each with extra
+// appended to its JSON fields, and returns the options each one sent to Ollama
+func forwardedOptions(t *testing.T, extra string) map[string]map[string]interface{} {
+	t.Helper()
+	options := make(map[string]map[string]interface{})
+	for _, tc := range []struct {
+		name     string
+		path     string
+		upstream string
+		body     string
+	}{
+		{"chat", "/v1/chat/completions", chatBody, `{"model":"llama2:7b","messages":[{"role":"user","content":"hi"}]`},
+		{"completion", "/v1/completions", completionBody, `{"model":"llama2:7b","prompt":"hi"`},
+	} {
+		upstream := newRecordingOllama(tc.upstream)
+		h := newTestOpenAIHandler(upstream.Server, nil)
+
+		handler := h.HandleChatCompletions
+		if tc.path == "/v1/completions" {
+			handler = h.HandleCompletions
+		}
+		rec := serve(handler, tc.path, tc.body+extra+"}")
+		upstream.Close()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200; body %s", tc.name, rec.Code, rec.Body)
+		}
+		options[tc.name] = upstream.lastOptions(t)
+	}
+	return options
+}
+
+func TestNormalizeStop(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		stop interface{}
+		want []string
+	}{
+		{"nil", nil, nil},
+		{"string", "\n\n", []string{"\n\n"}},
+		{"empty string", "", nil},
+		{"string slice", []string{"END", "STOP"}, []string{"END", "STOP"}},
+		{"decoded JSON array", []interface{}{"END", "STOP"}, []string{"END", "STOP"}},
+		{"array skips empty and non-strings", []interface{}{"END", "", 4.0, "STOP"}, []string{"END", "STOP"}},
+		{"number", 4.0, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := normalizeStop(tc.stop)
+			if strings.Join(got, "|") != strings.Join(tc.want, "|") || len(got) != len(tc.want) {
+				t.Errorf("normalizeStop(%#v) = %q, want %q", tc.stop, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStopReachesOllamaOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		extra string
+		want  []interface{}
+	}{
+		{"string", `,"stop":"END"`, []interface{}{"END"}},
+		{"array", `,"stop":["END","STOP"]`, []interface{}{"END", "STOP"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for endpoint, options := range forwardedOptions(t, tc.extra) {
+				stop, _ := options["stop"].([]interface{})
+				if len(stop) != len(tc.want) {
+					t.Errorf("%s: options.stop = %v, want %v", endpoint, options["stop"], tc.want)
+					continue
+				}
+				for i := range stop {
+					if stop[i] != tc.want[i] {
+						t.Errorf("%s: options.stop = %v, want %v", endpoint, stop, tc.want)
+						break
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("absent", func(t *testing.T) {
+		for endpoint, options := range forwardedOptions(t, "") {
+			if stop, ok := options["stop"]; ok {
+				t.Errorf("%s: options.stop = %v, want it omitted", endpoint, stop)
+			}
+		}
+	})
+}
+
+func TestSeedForwarding(t *testing.T) {
+	for endpoint, options := range forwardedOptions(t, `,"seed":0`) {
+		if seed, ok := options["seed"]; !ok || seed != 0.0 {
+			t.Errorf("%s: options.seed = %v (present %v), want 0", endpoint, seed, ok)
+		}
+	}
+	for endpoint, options := range forwardedOptions(t, `,"seed":42`) {
+		if seed := options["seed"]; seed != 42.0 {
+			t.Errorf("%s: options.seed = %v, want 42", endpoint, seed)
+		}
+	}
+	for endpoint, options := range forwardedOptions(t, "") {
+		if seed, ok := options["seed"]; ok {
+			t.Errorf("%s: options.seed = %v, want it omitted", endpoint, seed)
+		}
+	}
+}
+
+func TestSamplingOptionsForwarding(t *testing.T) {
+	for _, name := range []string{"temperature", "top_p"} {
+		t.Run(name, func(t *testing.T) {
+			for endpoint, options := range forwardedOptions(t, `,"`+name+`":0`) {
+				if value, ok := options[name]; !ok || value != 0.0 {
+					t.Errorf("%s: options.%s = %v (present %v), want 0", endpoint, name, value, ok)
+				}
+			}
+			for endpoint, options := range forwardedOptions(t, `,"`+name+`":0.7`) {
+				if value := options[name]; value != 0.7 {
+					t.Errorf("%s: options.%s = %v, want 0.7", endpoint, name, value)
+				}
+			}
+			for endpoint, options := range forwardedOptions(t, "") {
+				if value, ok := options[name]; ok {
+					t.Errorf("%s: options.%s = %v, want it omitted", endpoint, name, value)
+				}
+			}
+		})
+	}
+}
+
+func TestNonStreamingCompletionSchema(t *testing.T) {
+	upstream := newRecordingOllama(`{"model":"llama2:7b","response":"Paris.","done":true,"prompt_eval_count":5,"eval_count":3}`)
+	defer upstream.Close()
+	h := newTestOpenAIHandler(upstream.Server, nil)
+
+	rec := serve(h.HandleCompletions, "/v1/completions", `{"model":"llama2:7b","prompt":"The capital of France is"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+
+	// Decode loosely, so missing and null fields can be told apart
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response isn't JSON: %v", err)
+	}
+	if id, _ := resp["id"].(string); id == "" {
+		t.Errorf("id = %v, want a non-empty string", resp["id"])
+	}
+	if resp["object"] != "text_completion" {
+		t.Errorf("object = %v, want text_completion", resp["object"])
+	}
+	if created, _ := resp["created"].(float64); created <= 0 {
+		t.Errorf("created = %v, want a Unix timestamp", resp["created"])
+	}
+	if resp["model"] != "llama2:7b" {
+		t.Errorf("model = %v, want llama2:7b", resp["model"])
+	}
+
+	choices, _ := resp["choices"].([]interface{})
+	if len(choices) != 1 {
+		t.Fatalf("choices = %v, want exactly one", resp["choices"])
+	}
+	choice, _ := choices[0].(map[string]interface{})
+	if choice["text"] != "Paris." || choice["index"] != 0.0 || choice["finish_reason"] != "stop" {
+		t.Errorf("choice = %v, want text \"Paris.\", index 0 and finish_reason stop", choice)
+	}
+	if logprobs, ok := choice["logprobs"]; !ok || logprobs != nil {
+		t.Errorf("choice logprobs = %v (present %v), want null", logprobs, ok)
+	}
+
+	usage, _ := resp["usage"].(map[string]interface{})
+	if usage["prompt_tokens"] != 5.0 || usage["completion_tokens"] != 3.0 || usage["total_tokens"] != 8.0 {
+		t.Errorf("usage = %v, want 5 prompt, 3 completion and 8 total tokens", resp["usage"])
+	}
+
+	// The prompt reaches Ollama's generate endpoint as is, without streaming
+	req := upstream.lastRequest(t)
+	if req["prompt"] != "The capital of France is" || req["stream"] != false {
+		t.Errorf("upstream request = %v, want the prompt with stream false", req)
+	}
+}
+
+func TestResponseFormatSetsOllamaFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		extra string
+		want  string // "" when format must be omitted
+	}{
+		{"json_object", `,"response_format":{"type":"json_object"}`, "json"},
+		{"text", `,"response_format":{"type":"text"}`, ""},
+		{"json_schema", `,"response_format":{"type":"json_schema"}`, ""},
+		{"absent", "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newRecordingOllama(chatBody)
+			defer upstream.Close()
+			h := newTestOpenAIHandler(upstream.Server, nil)
+
+			rec := serve(h.HandleChatCompletions, "/v1/chat/completions",
+				`{"model":"llama2:7b","messages":[{"role":"user","content":"hi"}]`+tc.extra+`}`)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+			}
+
+			format, ok := upstream.lastRequest(t)["format"]
+			if tc.want == "" {
+				if ok {
+					t.Errorf("format = %v, want it omitted", format)
+				}
+				return
+			}
+			if format != tc.want {
+				t.Errorf("format = %v, want %q", format, tc.want)
+			}
+		})
+	}
+}
+
+// firstWriteRecorder closes written when the handler first writes a body
+type firstWriteRecorder struct {
+	*httptest.ResponseRecorder
+	once    sync.Once
+	written chan struct{}
+}
+
+func (r *firstWriteRecorder) Write(data []byte) (int, error) {
+	n, err := r.ResponseRecorder.Write(data)
+	r.once.Do(func() { close(r.written) })
+	return n, err
+}
+
+func TestStreamingStopsWritingAfterDisconnect(t *testing.T) {
+	for _, tc := range []struct {
+		path, request, firstLine string
+		handler                  func(*OpenAIHandler) gin.HandlerFunc
+	}{
+		{"/v1/chat/completions",
+			`{"model":"llama2:7b","messages":[{"role":"user","content":"hi"}],"stream":true,"stream_options":{"include_usage":true}}`,
+			`{"model":"llama2:7b","message":{"role":"assistant","content":"Hel"},"done":false}`,
+			func(h *OpenAIHandler) gin.HandlerFunc { return h.HandleChatCompletions }},
+		{"/v1/completions",
+			`{"model":"llama2:7b","prompt":"hi","stream":true,"stream_options":{"include_usage":true}}`,
+			`{"model":"llama2:7b","response":"Hel","done":false}`,
+			func(h *OpenAIHandler) gin.HandlerFunc { return h.HandleCompletions }},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			// The upstream sends one chunk, then stalls until the proxy
+			// gives up on it
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				io.WriteString(w, tc.firstLine+"\n")
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+			}))
+			defer upstream.Close()
+			h := newTestOpenAIHandler(upstream, nil)
+
+			router := gin.New()
+			router.POST(tc.path, tc.handler(h))
+			ctx, cancel := context.WithCancel(context.Background())
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.request)).WithContext(ctx)
+			req.Header.Set("Content-Type", "application/json")
+			rec := &firstWriteRecorder{ResponseRecorder: httptest.NewRecorder(), written: make(chan struct{})}
+
+			disconnects := testutil.ToFloat64(testMetrics().RequestCount.WithLabelValues("POST", tc.path, "llama2:7b", statusClientClosedRequest))
+			done := make(chan struct{})
+			go func() {
+				router.ServeHTTP(rec, req)
+				close(done)
+			}()
+			// Disconnect once the first chunk reached the client
+			select {
+			case <-rec.written:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("no chunk streamed; status %d, body %s", rec.Code, rec.Body)
+			}
+			cancel()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("handler didn't return after the client disconnected")
+			}
+
+			if body := rec.Body.String(); strings.Contains(body, "[DONE]") || strings.Contains(body, `"usage"`) {
+				t.Errorf("usage chunk or [DONE] written after the client left: %s", body)
+			}
+			if got := testutil.ToFloat64(testMetrics().RequestCount.WithLabelValues("POST", tc.path, "llama2:7b", statusClientClosedRequest)) - disconnects; got != 1 {
+				t.Errorf("requests_total{status=%q} grew by %v, want 1", statusClientClosedRequest, got)
+			}
+		})
+	}
+}
+
+func TestChoicesCancelledAfterFirstFailure(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	stop := make(chan struct{})
+	// The first call fails; the rest only end when the proxy cancels them
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		if first {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"error":"runner crashed"}`)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	}))
+	defer upstream.Close()
+	defer close(stop)
+	h := newTestOpenAIHandler(upstream, nil)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serve(h.HandleChatCompletions, "/v1/chat/completions",
+			`{"model":"llama2:7b","messages":[{"role":"user","content":"hi"}],"n":4}`)
+	}()
+	var rec *httptest.ResponseRecorder
+	select {
+	case rec = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request still waiting on its other choices after one failed")
+	}
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500; body %s", rec.Code, rec.Body)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != choiceConcurrency {
+		t.Errorf("%d upstream calls, want %d: none started after the failure", calls, choiceConcurrency)
+	}
+}
+
+func TestCompletionFallbackWhileOllamaDown(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstream.Close()
+	h := newTestOpenAIHandler(upstream, func(cfg *config.Config) {
+		cfg.FallbackResponse = true
+		cfg.FallbackMessage = "try again later"
+	})
+
+	for _, tc := range []struct {
+		name    string
+		request string
+		body    func(*testing.T, *httptest.ResponseRecorder) string
+	}{
+		{"non-streaming", `{"model":"llama2:7b","prompt":"hi"}`,
+			func(t *testing.T, rec *httptest.ResponseRecorder) string { return rec.Body.String() }},
+		{"streaming", `{"model":"llama2:7b","prompt":"hi","stream":true}`,
+			func(t *testing.T, rec *httptest.ResponseRecorder) string {
+				if !strings.Contains(rec.Body.String(), "[DONE]") {
+					t.Errorf("stream %s doesn't end with [DONE]", rec.Body)
+				}
+				return sseEvents(t, rec)[0]
+			}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(h.HandleCompletions, "/v1/completions", tc.request)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+			}
+			if rec.Header().Get(fallbackHeader) != "true" {
+				t.Errorf("%s header missing", fallbackHeader)
+			}
+
+			var resp models.CompletionResponse
+			if err := json.Unmarshal([]byte(tc.body(t, rec)), &resp); err != nil {
+				t.Fatalf("body isn't a completion: %v", err)
+			}
+			if resp.Object != "text_completion" || len(resp.Choices) != 1 {
+				t.Fatalf("response = %+v, want one text_completion choice", resp)
+			}
+			if choice := resp.Choices[0]; choice.Text != "try again later" || choice.FinishReason != "stop" {
+				t.Errorf("choice = %+v, want the fallback message with finish_reason stop", choice)
+			}
+		})
+	}
+}
@@ -3,16 +3,27 @@ package handlers
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/atyronesmith/llama-metrics/proxy/internal/apikeys"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/backend"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/contentfilter"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/fanout"
 	"github.com/atyronesmith/llama-metrics/proxy/internal/metrics"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/modelload"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/modelpull"
 	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
 	"github.com/atyronesmith/llama-metrics/proxy/internal/queue"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/requestlog"
+	"github.com/atyronesmith/llama-metrics/proxy/internal/tagstrip"
 	"github.com/atyronesmith/llama-metrics/proxy/pkg/config"
 	"github.com/gin-gonic/gin"
 )
@@ -23,37 +34,111 @@ type ProxyHandler struct {
 	metrics     *metrics.Collector
 	httpClient  *http.Client
 	queue       *queue.Manager
+	fanout      *fanout.Group
+	filter      contentfilter.Filter
+	puller      *modelpull.Puller
+	stripper    *tagstrip.Stripper
+	loads       *modelload.Guard
+	models      modelPolicy
+	backends    *backend.Pool
 }
 
 // NewProxyHandler creates a new proxy handler
-func NewProxyHandler(cfg *config.Config, m *metrics.Collector) *ProxyHandler {
+func NewProxyHandler(cfg *config.Config, m *metrics.Collector, filter contentfilter.Filter, loads *modelload.Guard, backends *backend.Pool) *ProxyHandler {
 	h := &ProxyHandler{
-		config:  cfg,
-		metrics: m,
+		config:   cfg,
+		metrics:  m,
+		filter:   filter,
+		loads:    loads,
+		models:   newModelPolicy(cfg),
+		backends: backends,
 		httpClient: &http.Client{
-			Timeout: 5 * time.Minute, // Long timeout for LLM requests
+			Timeout: cfg.UpstreamTimeout, // Long by default for LLM requests
 		},
 	}
 
 	// Initialize queue manager
-	h.queue = queue.NewManager(cfg.MaxQueueSize, cfg.MaxConcurrency, m)
+	userLimits, _ := cfg.ParsedUserQueueLimits()
+	h.queue = queue.NewManager(cfg.MaxQueueSize, cfg.MaxConcurrency, m, queue.Options{
+		StallTimeout:   cfg.QueueStallTimeout,
+		MaxWait:        cfg.QueueMaxWait,
+		MaxPerUser:     cfg.MaxQueuedPerUser,
+		UserLimits:     userLimits,
+		FastPath:       cfg.QueueFastPath,
+		StuckThreshold: cfg.WorkerStuckThreshold,
+		AgingInterval:  cfg.QueueAgingInterval,
+	})
+
+	// Report every upstream outcome to its backend's circuit breaker
+	h.httpClient.Transport = backends.Transport(http.DefaultTransport)
+
+	if cfg.StreamFanOut {
+		h.fanout = fanout.NewGroup()
+	}
+
+	if cfg.AutoPull {
+		h.puller = modelpull.New(backends.URLs(), m)
+	}
+
+	if tags := cfg.ParsedStripTags(); len(tags) > 0 {
+		h.stripper = tagstrip.New(tags)
+	}
 
 	return h
 }
 
+// Queue returns the queue manager, so it can be drained on shutdown
+func (h *ProxyHandler) Queue() *queue.Manager {
+	return h.queue
+}
+
+// HandleQueueStats reports the queue's current statistics
+func (h *ProxyHandler) HandleQueueStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.queue.GetStats())
+}
+
+// requestPriority maps the X-Priority header to a queue priority; anything
+// other than "high" or "critical" is normal
+func requestPriority(c *gin.Context) int {
+	switch c.GetHeader("X-Priority") {
+	case "critical":
+		return queue.PriorityCritical
+	case "high":
+		return queue.PriorityHigh
+	default:
+		return queue.PriorityNormal
+	}
+}
+
 // HandleGenerate handles the /api/generate endpoint
 func (h *ProxyHandler) HandleGenerate(c *gin.Context) {
 	start := time.Now()
 	model := "unknown"
 
+	// Keep the client's request ID, or give the request one it can quote
+	// from the logs
+	setRequestID(c, clientRequestID(c))
+
 	// Extract priority from header (default to normal)
-	priority := queue.PriorityNormal
-	if priorityHeader := c.GetHeader("X-Priority"); priorityHeader == "high" {
-		priority = queue.PriorityHigh
+	priority := requestPriority(c)
+	c.Set(requestlog.PriorityKey, queue.PriorityName(priority))
+
+	// Identify the caller for per-user queue limits, falling back to the
+	// client IP (resolved through TRUSTED_PROXIES) for anonymous requests
+	user := c.GetHeader("X-User")
+	c.Set(requestlog.UserKey, user)
+	queueUser := user
+	if queueUser == "" {
+		queueUser = c.ClientIP()
 	}
 
 	// Read request body
-	body, err := io.ReadAll(c.Request.Body)
+	body, err := readRequestBody(c, h.config.MaxRequestBytes)
+	if errors.Is(err, errRequestTooLarge) {
+		h.metrics.RecordError(model, "request_too_large")
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": requestTooLargeMessage(h.config.MaxRequestBytes)})
+		return
+	}
 	if err != nil {
 		h.metrics.RecordError(model, "read_body")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request"})
@@ -65,16 +150,81 @@ func (h *ProxyHandler) HandleGenerate(c *gin.Context) {
 	if err := json.Unmarshal(body, &req); err == nil {
 		model = req.Model
 	}
+	c.Set(requestlog.ModelKey, model)
+
+	// Record request size
+	h.metrics.RecordRequestSize(model, c.Request.URL.Path, len(body))
+
+	// Enforce the proxy's and the API key's model allow-lists
+	if !h.models.permits(model) {
+		h.metrics.RecordError(model, "model_not_allowed")
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Model %s is not allowed on this proxy", model)})
+		return
+	}
+	if !apikeys.ModelAllowed(c, model) {
+		h.metrics.RecordError(model, "model_not_allowed")
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("API key may not use model %s", model)})
+		return
+	}
+
+	// Filtered responses can only be checked once complete
+	if filtersResponses(h.filter, h.config.ContentFilterResponse) && nativeStreaming(body) {
+		h.metrics.RecordError(model, "stream_not_allowed")
+		c.JSON(http.StatusBadRequest, gin.H{"error": streamFilteredMessage})
+		return
+	}
+
+	// Reject prompts the content filter doesn't allow
+	if allowed, err := promptAllowed(c.Request.Context(), h.filter, h.metrics, model, req.System+"\n"+req.Prompt); !allowed {
+		h.sendFilterError(c, err, promptFilteredMessage)
+		return
+	}
+
+	// Attach identical streaming requests to an in-flight generation
+	var broadcast *fanout.Broadcast
+	if req.Stream && h.fanout != nil {
+		key := fanout.Key(c.Request.URL.Path, body)
+		b, leader := h.fanout.Join(key)
+		if !leader {
+			h.serveFanOutSubscriber(c, b, model, start, priority)
+			return
+		}
+		defer h.fanout.Finish(key, b)
+		broadcast = b
+	}
 
 	// Submit to queue with priority
-	err = h.queue.Submit(c.Request.Context(), model, priority, func() error {
+	err = h.queue.Submit(c.Request.Context(), model, queueUser, priority, func() error {
 		// Track active requests
 		h.metrics.IncActiveRequests(model)
 		defer h.metrics.DecActiveRequests(model)
 
+		// Send it to the next available Ollama backend
+		target, release, err := h.backends.Pick()
+		if err != nil {
+			h.sendBackendsUnavailable(c, model, err)
+			return nil
+		}
+		defer release()
+
+		// Wait behind any other model load there instead of swapping concurrently
+		loaded := func() {}
+		if h.loads != nil {
+			release, err := h.loads.Acquire(c.Request.Context(), target.URL, model)
+			if err != nil {
+				return err
+			}
+			defer release()
+			loaded = release
+		}
+
 		// Create request to Ollama
-		targetURL := fmt.Sprintf("%s%s", h.config.OllamaURL(), c.Request.URL.Path)
-		proxyReq, err := http.NewRequest(c.Request.Method, targetURL, bytes.NewReader(body))
+		targetURL := fmt.Sprintf("%s%s", target.URL, c.Request.URL.Path)
+		ctx := context.Background()
+		if req.Stream {
+			ctx = streamContext(c, broadcast)
+		}
+		proxyReq, err := http.NewRequestWithContext(ctx, c.Request.Method, targetURL, bytes.NewReader(body))
 		if err != nil {
 			h.metrics.RecordError(model, "create_request")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
@@ -87,19 +237,34 @@ func (h *ProxyHandler) HandleGenerate(c *gin.Context) {
 				proxyReq.Header.Add(key, value)
 			}
 		}
+		if h.config.ForwardClientIP {
+			setForwardedHeaders(c, proxyReq)
+		}
 
 		// Make request
-		resp, err := h.httpClient.Do(proxyReq)
+		resp, err := h.doWithRetry(c.Request.Context(), proxyReq, model, !req.Stream)
+		// Ollama only answers once the model is loaded, so free the load slot
+		// now rather than when the response ends
+		loaded()
 		if err != nil {
 			h.metrics.RecordError(model, "proxy_request")
+			if h.config.FallbackResponse {
+				h.sendFallback(c, model, false, req.Stream)
+				return nil
+			}
 			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to proxy request"})
 			return err
 		}
 		defer resp.Body.Close()
 
+		// Missing or unloadable models get a distinct error type
+		if h.handleModelError(c, resp, model, start, priority) {
+			return nil
+		}
+
 		// Handle streaming vs non-streaming
 		if req.Stream {
-			h.handleStreamingResponse(c, resp, model, start, priority)
+			h.handleStreamingResponse(c, resp, model, start, priority, broadcast)
 		} else {
 			h.handleNonStreamingResponse(c, resp, model, start, priority)
 		}
@@ -108,12 +273,11 @@ func (h *ProxyHandler) HandleGenerate(c *gin.Context) {
 	})
 
 	if err != nil {
-		h.metrics.RecordError(model, "queue_error")
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		h.sendQueueError(c, model, err)
 	}
 }
 
-func (h *ProxyHandler) handleStreamingResponse(c *gin.Context, resp *http.Response, model string, start time.Time, priority int) {
+func (h *ProxyHandler) handleStreamingResponse(c *gin.Context, resp *http.Response, model string, start time.Time, priority int, broadcast *fanout.Broadcast) {
 	// Set headers for SSE
 	c.Header("Content-Type", "application/x-ndjson")
 	c.Header("Cache-Control", "no-cache")
@@ -121,20 +285,31 @@ func (h *ProxyHandler) handleStreamingResponse(c *gin.Context, resp *http.Respon
 
 	// Create a scanner to read the response line by line
 	scanner := bufio.NewScanner(resp.Body)
-	firstTokenTime := time.Time{}
+	var firstTokenTime, lastTokenTime time.Time
 	var totalPromptTokens, totalGeneratedTokens int
 	var evalDuration int64
+	stream := newStripStream(h.stripper)
 
 	for scanner.Scan() {
+		if stopStream(c, broadcast) {
+			break
+		}
+
 		line := scanner.Bytes()
 
 		// Parse the JSON to extract metrics
 		var chunk models.GenerateResponse
 		if err := json.Unmarshal(line, &chunk); err == nil {
-			// Record time to first token
-			if firstTokenTime.IsZero() && chunk.Response != "" {
-				firstTokenTime = time.Now()
-				h.metrics.RecordTimeToFirstToken(model, firstTokenTime.Sub(start))
+			// Record time to first token, then the gap before each later one
+			if chunk.Response != "" {
+				now := time.Now()
+				if firstTokenTime.IsZero() {
+					firstTokenTime = now
+					h.metrics.RecordTimeToFirstToken(model, now.Sub(start))
+				} else {
+					h.metrics.RecordInterTokenLatency(model, now.Sub(lastTokenTime))
+				}
+				lastTokenTime = now
 			}
 
 			// Extract final metrics from done chunk
@@ -148,17 +323,42 @@ func (h *ProxyHandler) handleStreamingResponse(c *gin.Context, resp *http.Respon
 					h.metrics.RecordModelLoadTime(model, time.Duration(chunk.LoadDuration))
 				}
 			}
+
+			// Strip reasoning tag blocks, re-encoding the chunk only when
+			// its text changed
+			if stream != nil {
+				content, reasoning := stripChunk(stream, chunk.Response, chunk.Done)
+				if content != chunk.Response || reasoning != "" {
+					fields := map[string]interface{}{"response": content}
+					if h.config.StripTagsReasoning && reasoning != "" {
+						fields["thinking"] = chunk.Thinking + reasoning
+					}
+					if patched, err := setJSONFields(line, fields); err == nil {
+						line = patched
+					}
+				}
+			}
 		}
 
 		// Write the chunk to response
 		c.Data(http.StatusOK, "application/x-ndjson", line)
 		c.Data(http.StatusOK, "application/x-ndjson", []byte("\n"))
 		c.Writer.Flush()
+
+		// Share the chunk with any fan-out subscribers
+		if broadcast != nil {
+			broadcast.Publish(line)
+		}
 	}
 
 	// Record final metrics
+	status := strconv.Itoa(resp.StatusCode)
+	if clientGone(c) {
+		h.metrics.RecordClientDisconnect(model)
+		status = statusClientClosedRequest
+	}
 	duration := time.Since(start)
-	h.metrics.RecordRequestWithPriority(c.Request.Method, c.Request.URL.Path, model, strconv.Itoa(resp.StatusCode), duration, priority)
+	h.metrics.RecordRequestWithPriority(c.Request.Method, c.Request.URL.Path, model, status, duration, priority)
 
 	// Record token metrics
 	var tokensPerSec float64
@@ -166,20 +366,38 @@ func (h *ProxyHandler) handleStreamingResponse(c *gin.Context, resp *http.Respon
 		tokensPerSec = float64(totalGeneratedTokens) / (float64(evalDuration) / 1e9)
 	}
 	h.metrics.RecordTokens(model, totalPromptTokens, totalGeneratedTokens, tokensPerSec)
+	c.Set(requestlog.TokensKey, totalPromptTokens+totalGeneratedTokens)
 }
 
 func (h *ProxyHandler) handleNonStreamingResponse(c *gin.Context, resp *http.Response, model string, start time.Time, priority int) {
 	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	body, err := readUpstreamBody(resp, h.config.MaxResponseBytes)
+	if errors.Is(err, errUpstreamTooLarge) {
+		h.metrics.RecordError(model, "upstream_too_large")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Upstream response too large"})
+		return
+	}
 	if err != nil {
 		h.metrics.RecordError(model, "read_response")
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to read response"})
 		return
 	}
 
+	// Wrap HTML and other non-JSON error pages so JSON clients can parse them
+	if h.config.WrapUpstreamErrors && isNonJSONError(resp) {
+		h.metrics.RecordError(model, "upstream_error")
+		h.metrics.RecordRequestWithPriority(c.Request.Method, c.Request.URL.Path, model, strconv.Itoa(resp.StatusCode), time.Since(start), priority)
+		c.JSON(resp.StatusCode, gin.H{"error": upstreamErrorMessage(resp)})
+		return
+	}
+
 	// Parse response to extract metrics
 	var genResp models.GenerateResponse
-	if err := json.Unmarshal(body, &genResp); err == nil {
+	if err := json.Unmarshal(body, &genResp); err != nil {
+		// Still forward the body, but count the failure since token metrics are lost
+		logUpstreamParseError(h.config, model, err, body)
+		h.metrics.RecordError(model, "upstream_parse")
+	} else {
 		// Record model load time
 		if genResp.LoadDuration > 0 {
 			h.metrics.RecordModelLoadTime(model, time.Duration(genResp.LoadDuration))
@@ -191,18 +409,62 @@ func (h *ProxyHandler) handleNonStreamingResponse(c *gin.Context, resp *http.Res
 			tokensPerSec = float64(genResp.EvalCount) / (float64(genResp.EvalDuration) / 1e9)
 		}
 		h.metrics.RecordTokens(model, genResp.PromptEvalCount, genResp.EvalCount, tokensPerSec)
+		c.Set(requestlog.TokensKey, genResp.PromptEvalCount+genResp.EvalCount)
 	}
 
 	// Record request metrics
 	duration := time.Since(start)
 	h.metrics.RecordRequestWithPriority(c.Request.Method, c.Request.URL.Path, model, strconv.Itoa(resp.StatusCode), duration, priority)
 
+	redacted := false
+
+	// Strip reasoning tag blocks from the generated text
+	if h.stripper != nil && genResp.Response != "" {
+		content, reasoning := h.stripper.Strip(genResp.Response)
+		if content != genResp.Response {
+			genResp.Response = content
+			fields := map[string]interface{}{"response": content}
+			if h.config.StripTagsReasoning && reasoning != "" {
+				genResp.Thinking += reasoning
+				fields["thinking"] = genResp.Thinking
+			}
+			if patched, err := setJSONFields(body, fields); err == nil {
+				body = patched
+				redacted = true
+			}
+		}
+	}
+
+	// Apply the content filter to the generated text
+	if h.filter != nil && genResp.Response != "" {
+		text, allowed, err := filterResponseText(c.Request.Context(), h.filter, h.metrics, model, genResp.Response)
+		if !allowed {
+			h.sendFilterError(c, err, responseFilteredMessage)
+			return
+		}
+		if text != genResp.Response {
+			genResp.Response = text
+			// The redacted text must replace the original even if the
+			// upstream fields can't be kept
+			patched, err := setJSONFields(body, map[string]interface{}{"response": text})
+			if err != nil {
+				patched, _ = json.Marshal(genResp)
+			}
+			body = patched
+			redacted = true
+		}
+	}
+
 	// Copy response headers
 	for key, values := range resp.Header {
 		for _, value := range values {
 			c.Header(key, value)
 		}
 	}
+	if redacted {
+		// The body was re-encoded, so the upstream length no longer applies
+		c.Writer.Header().Del("Content-Length")
+	}
 
 	// Write response
 	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
@@ -213,14 +475,30 @@ func (h *ProxyHandler) HandleChat(c *gin.Context) {
 	start := time.Now()
 	model := "unknown"
 
+	// Keep the client's request ID, or give the request one it can quote
+	// from the logs
+	setRequestID(c, clientRequestID(c))
+
 	// Extract priority from header (default to normal)
-	priority := queue.PriorityNormal
-	if priorityHeader := c.GetHeader("X-Priority"); priorityHeader == "high" {
-		priority = queue.PriorityHigh
+	priority := requestPriority(c)
+	c.Set(requestlog.PriorityKey, queue.PriorityName(priority))
+
+	// Identify the caller for per-user queue limits, falling back to the
+	// client IP (resolved through TRUSTED_PROXIES) for anonymous requests
+	user := c.GetHeader("X-User")
+	c.Set(requestlog.UserKey, user)
+	queueUser := user
+	if queueUser == "" {
+		queueUser = c.ClientIP()
 	}
 
 	// Read request body
-	body, err := io.ReadAll(c.Request.Body)
+	body, err := readRequestBody(c, h.config.MaxRequestBytes)
+	if errors.Is(err, errRequestTooLarge) {
+		h.metrics.RecordError(model, "request_too_large")
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": requestTooLargeMessage(h.config.MaxRequestBytes)})
+		return
+	}
 	if err != nil {
 		h.metrics.RecordError(model, "read_body")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request"})
@@ -232,16 +510,81 @@ func (h *ProxyHandler) HandleChat(c *gin.Context) {
 	if err := json.Unmarshal(body, &req); err == nil {
 		model = req.Model
 	}
+	c.Set(requestlog.ModelKey, model)
+
+	// Record request size
+	h.metrics.RecordRequestSize(model, c.Request.URL.Path, len(body))
+
+	// Enforce the proxy's and the API key's model allow-lists
+	if !h.models.permits(model) {
+		h.metrics.RecordError(model, "model_not_allowed")
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Model %s is not allowed on this proxy", model)})
+		return
+	}
+	if !apikeys.ModelAllowed(c, model) {
+		h.metrics.RecordError(model, "model_not_allowed")
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("API key may not use model %s", model)})
+		return
+	}
+
+	// Filtered responses can only be checked once complete
+	if filtersResponses(h.filter, h.config.ContentFilterResponse) && nativeStreaming(body) {
+		h.metrics.RecordError(model, "stream_not_allowed")
+		c.JSON(http.StatusBadRequest, gin.H{"error": streamFilteredMessage})
+		return
+	}
+
+	// Reject prompts the content filter doesn't allow
+	if allowed, err := promptAllowed(c.Request.Context(), h.filter, h.metrics, model, chatPromptText(req.Messages)); !allowed {
+		h.sendFilterError(c, err, promptFilteredMessage)
+		return
+	}
+
+	// Attach identical streaming requests to an in-flight generation
+	var broadcast *fanout.Broadcast
+	if req.Stream && h.fanout != nil {
+		key := fanout.Key(c.Request.URL.Path, body)
+		b, leader := h.fanout.Join(key)
+		if !leader {
+			h.serveFanOutSubscriber(c, b, model, start, priority)
+			return
+		}
+		defer h.fanout.Finish(key, b)
+		broadcast = b
+	}
 
 	// Submit to queue with priority
-	err = h.queue.Submit(c.Request.Context(), model, priority, func() error {
+	err = h.queue.Submit(c.Request.Context(), model, queueUser, priority, func() error {
 		// Track active requests
 		h.metrics.IncActiveRequests(model)
 		defer h.metrics.DecActiveRequests(model)
 
+		// Send it to the next available Ollama backend
+		target, release, err := h.backends.Pick()
+		if err != nil {
+			h.sendBackendsUnavailable(c, model, err)
+			return nil
+		}
+		defer release()
+
+		// Wait behind any other model load there instead of swapping concurrently
+		loaded := func() {}
+		if h.loads != nil {
+			release, err := h.loads.Acquire(c.Request.Context(), target.URL, model)
+			if err != nil {
+				return err
+			}
+			defer release()
+			loaded = release
+		}
+
 		// Create request to Ollama
-		targetURL := fmt.Sprintf("%s%s", h.config.OllamaURL(), c.Request.URL.Path)
-		proxyReq, err := http.NewRequest(c.Request.Method, targetURL, bytes.NewReader(body))
+		targetURL := fmt.Sprintf("%s%s", target.URL, c.Request.URL.Path)
+		ctx := context.Background()
+		if req.Stream {
+			ctx = streamContext(c, broadcast)
+		}
+		proxyReq, err := http.NewRequestWithContext(ctx, c.Request.Method, targetURL, bytes.NewReader(body))
 		if err != nil {
 			h.metrics.RecordError(model, "create_request")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
@@ -254,19 +597,34 @@ func (h *ProxyHandler) HandleChat(c *gin.Context) {
 				proxyReq.Header.Add(key, value)
 			}
 		}
+		if h.config.ForwardClientIP {
+			setForwardedHeaders(c, proxyReq)
+		}
 
 		// Make request
-		resp, err := h.httpClient.Do(proxyReq)
+		resp, err := h.doWithRetry(c.Request.Context(), proxyReq, model, !req.Stream)
+		// Ollama only answers once the model is loaded, so free the load slot
+		// now rather than when the response ends
+		loaded()
 		if err != nil {
 			h.metrics.RecordError(model, "proxy_request")
+			if h.config.FallbackResponse {
+				h.sendFallback(c, model, true, req.Stream)
+				return nil
+			}
 			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to proxy request"})
 			return err
 		}
 		defer resp.Body.Close()
 
+		// Missing or unloadable models get a distinct error type
+		if h.handleModelError(c, resp, model, start, priority) {
+			return nil
+		}
+
 		// Handle streaming vs non-streaming
 		if req.Stream {
-			h.handleStreamingChatResponse(c, resp, model, start, priority)
+			h.handleStreamingChatResponse(c, resp, model, start, priority, broadcast)
 		} else {
 			h.handleNonStreamingChatResponse(c, resp, model, start, priority)
 		}
@@ -275,12 +633,11 @@ func (h *ProxyHandler) HandleChat(c *gin.Context) {
 	})
 
 	if err != nil {
-		h.metrics.RecordError(model, "queue_error")
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		h.sendQueueError(c, model, err)
 	}
 }
 
-func (h *ProxyHandler) handleStreamingChatResponse(c *gin.Context, resp *http.Response, model string, start time.Time, priority int) {
+func (h *ProxyHandler) handleStreamingChatResponse(c *gin.Context, resp *http.Response, model string, start time.Time, priority int, broadcast *fanout.Broadcast) {
 	// Set headers for SSE
 	c.Header("Content-Type", "application/x-ndjson")
 	c.Header("Cache-Control", "no-cache")
@@ -288,20 +645,31 @@ func (h *ProxyHandler) handleStreamingChatResponse(c *gin.Context, resp *http.Re
 
 	// Create a scanner to read the response line by line
 	scanner := bufio.NewScanner(resp.Body)
-	firstTokenTime := time.Time{}
+	var firstTokenTime, lastTokenTime time.Time
 	var totalPromptTokens, totalGeneratedTokens int
 	var evalDuration int64
+	stream := newStripStream(h.stripper)
 
 	for scanner.Scan() {
+		if stopStream(c, broadcast) {
+			break
+		}
+
 		line := scanner.Bytes()
 
 		// Parse the JSON to extract metrics
 		var chunk models.ChatResponse
 		if err := json.Unmarshal(line, &chunk); err == nil {
-			// Record time to first token
-			if firstTokenTime.IsZero() && chunk.Message.Content != "" {
-				firstTokenTime = time.Now()
-				h.metrics.RecordTimeToFirstToken(model, firstTokenTime.Sub(start))
+			// Record time to first token, then the gap before each later one
+			if chunk.Message.Content != "" {
+				now := time.Now()
+				if firstTokenTime.IsZero() {
+					firstTokenTime = now
+					h.metrics.RecordTimeToFirstToken(model, now.Sub(start))
+				} else {
+					h.metrics.RecordInterTokenLatency(model, now.Sub(lastTokenTime))
+				}
+				lastTokenTime = now
 			}
 
 			// Extract final metrics from done chunk
@@ -315,17 +683,42 @@ func (h *ProxyHandler) handleStreamingChatResponse(c *gin.Context, resp *http.Re
 					h.metrics.RecordModelLoadTime(model, time.Duration(chunk.LoadDuration))
 				}
 			}
+
+			// Strip reasoning tag blocks, re-encoding the chunk only when
+			// its text changed
+			if stream != nil {
+				content, reasoning := stripChunk(stream, chunk.Message.Content, chunk.Done)
+				if content != chunk.Message.Content || reasoning != "" {
+					fields := map[string]interface{}{"content": content}
+					if h.config.StripTagsReasoning && reasoning != "" {
+						fields["thinking"] = chunk.Message.Thinking + reasoning
+					}
+					if patched, err := setMessageFields(line, fields); err == nil {
+						line = patched
+					}
+				}
+			}
 		}
 
 		// Write the chunk to response
 		c.Data(http.StatusOK, "application/x-ndjson", line)
 		c.Data(http.StatusOK, "application/x-ndjson", []byte("\n"))
 		c.Writer.Flush()
+
+		// Share the chunk with any fan-out subscribers
+		if broadcast != nil {
+			broadcast.Publish(line)
+		}
 	}
 
 	// Record final metrics
+	status := strconv.Itoa(resp.StatusCode)
+	if clientGone(c) {
+		h.metrics.RecordClientDisconnect(model)
+		status = statusClientClosedRequest
+	}
 	duration := time.Since(start)
-	h.metrics.RecordRequestWithPriority(c.Request.Method, c.Request.URL.Path, model, strconv.Itoa(resp.StatusCode), duration, priority)
+	h.metrics.RecordRequestWithPriority(c.Request.Method, c.Request.URL.Path, model, status, duration, priority)
 
 	// Record token metrics
 	var tokensPerSec float64
@@ -333,20 +726,38 @@ func (h *ProxyHandler) handleStreamingChatResponse(c *gin.Context, resp *http.Re
 		tokensPerSec = float64(totalGeneratedTokens) / (float64(evalDuration) / 1e9)
 	}
 	h.metrics.RecordTokens(model, totalPromptTokens, totalGeneratedTokens, tokensPerSec)
+	c.Set(requestlog.TokensKey, totalPromptTokens+totalGeneratedTokens)
 }
 
 func (h *ProxyHandler) handleNonStreamingChatResponse(c *gin.Context, resp *http.Response, model string, start time.Time, priority int) {
 	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	body, err := readUpstreamBody(resp, h.config.MaxResponseBytes)
+	if errors.Is(err, errUpstreamTooLarge) {
+		h.metrics.RecordError(model, "upstream_too_large")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Upstream response too large"})
+		return
+	}
 	if err != nil {
 		h.metrics.RecordError(model, "read_response")
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to read response"})
 		return
 	}
 
+	// Wrap HTML and other non-JSON error pages so JSON clients can parse them
+	if h.config.WrapUpstreamErrors && isNonJSONError(resp) {
+		h.metrics.RecordError(model, "upstream_error")
+		h.metrics.RecordRequestWithPriority(c.Request.Method, c.Request.URL.Path, model, strconv.Itoa(resp.StatusCode), time.Since(start), priority)
+		c.JSON(resp.StatusCode, gin.H{"error": upstreamErrorMessage(resp)})
+		return
+	}
+
 	// Parse response to extract metrics
 	var chatResp models.ChatResponse
-	if err := json.Unmarshal(body, &chatResp); err == nil {
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		// Still forward the body, but count the failure since token metrics are lost
+		logUpstreamParseError(h.config, model, err, body)
+		h.metrics.RecordError(model, "upstream_parse")
+	} else {
 		// Record model load time
 		if chatResp.LoadDuration > 0 {
 			h.metrics.RecordModelLoadTime(model, time.Duration(chatResp.LoadDuration))
@@ -358,35 +769,126 @@ func (h *ProxyHandler) handleNonStreamingChatResponse(c *gin.Context, resp *http
 			tokensPerSec = float64(chatResp.EvalCount) / (float64(chatResp.EvalDuration) / 1e9)
 		}
 		h.metrics.RecordTokens(model, chatResp.PromptEvalCount, chatResp.EvalCount, tokensPerSec)
+		c.Set(requestlog.TokensKey, chatResp.PromptEvalCount+chatResp.EvalCount)
 	}
 
 	// Record request metrics
 	duration := time.Since(start)
 	h.metrics.RecordRequestWithPriority(c.Request.Method, c.Request.URL.Path, model, strconv.Itoa(resp.StatusCode), duration, priority)
 
+	redacted := false
+
+	// Strip reasoning tag blocks from the generated text
+	if h.stripper != nil && chatResp.Message.Content != "" {
+		content, reasoning := h.stripper.Strip(chatResp.Message.Content)
+		if content != chatResp.Message.Content {
+			chatResp.Message.Content = content
+			fields := map[string]interface{}{"content": content}
+			if h.config.StripTagsReasoning && reasoning != "" {
+				chatResp.Message.Thinking += reasoning
+				fields["thinking"] = chatResp.Message.Thinking
+			}
+			if patched, err := setMessageFields(body, fields); err == nil {
+				body = patched
+				redacted = true
+			}
+		}
+	}
+
+	// Apply the content filter to the generated text
+	if h.filter != nil && chatResp.Message.Content != "" {
+		text, allowed, err := filterResponseText(c.Request.Context(), h.filter, h.metrics, model, chatResp.Message.Content)
+		if !allowed {
+			h.sendFilterError(c, err, responseFilteredMessage)
+			return
+		}
+		if text != chatResp.Message.Content {
+			chatResp.Message.Content = text
+			// The redacted text must replace the original even if the
+			// upstream fields can't be kept
+			patched, err := setMessageFields(body, map[string]interface{}{"content": text})
+			if err != nil {
+				patched, _ = json.Marshal(chatResp)
+			}
+			body = patched
+			redacted = true
+		}
+	}
+
 	// Copy response headers
 	for key, values := range resp.Header {
 		for _, value := range values {
 			c.Header(key, value)
 		}
 	}
+	if redacted {
+		// The body was re-encoded, so the upstream length no longer applies
+		c.Writer.Header().Del("Content-Length")
+	}
 
 	// Write response
 	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
 }
 
+// sendBackendsUnavailable answers a request that found every backend's
+// circuit breaker open, like the pool's middleware does
+func (h *ProxyHandler) sendBackendsUnavailable(c *gin.Context, model string, err error) {
+	h.metrics.RecordError(model, "circuit_open")
+	c.Header("Retry-After", strconv.Itoa(h.backends.RetryAfter()))
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+}
+
+// sendQueueError reports a failed queue submission
+func (h *ProxyHandler) sendQueueError(c *gin.Context, model string, err error) {
+	if errors.Is(err, queue.ErrUserLimit) {
+		h.metrics.RecordError(model, "user_queue_full")
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, queue.ErrQueueTimeout) {
+		// Counted by the queue as queue_timeout
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, queue.ErrShuttingDown) {
+		// Counted by the queue as shutting_down
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.metrics.RecordError(model, "queue_error")
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+}
+
 // HandleDefault handles all other requests
 func (h *ProxyHandler) HandleDefault(c *gin.Context) {
 	start := time.Now()
 	model := "unknown"
+	setRequestID(c, clientRequestID(c))
 
-	// Forward the request as-is
-	targetURL := fmt.Sprintf("%s%s", h.config.OllamaURL(), c.Request.URL.Path)
+	// Forward the request as-is to the next available Ollama backend
+	target, release, err := h.backends.Pick()
+	if err != nil {
+		h.sendBackendsUnavailable(c, model, err)
+		return
+	}
+	defer release()
+	targetURL := fmt.Sprintf("%s%s", target.URL, c.Request.URL.Path)
 
 	// Read body if present
 	var bodyBytes []byte
 	if c.Request.Body != nil {
-		bodyBytes, _ = io.ReadAll(c.Request.Body)
+		// Model blobs uploaded by ollama create are far larger than any prompt
+		limit := h.config.MaxRequestBytes
+		if strings.HasPrefix(c.Request.URL.Path, "/api/blobs/") {
+			limit = 0
+		}
+		bodyBytes, err = readRequestBody(c, limit)
+		if errors.Is(err, errRequestTooLarge) {
+			h.metrics.RecordError(model, "request_too_large")
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": requestTooLargeMessage(limit)})
+			return
+		}
 		c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 	}
 
@@ -404,9 +906,13 @@ func (h *ProxyHandler) HandleDefault(c *gin.Context) {
 			proxyReq.Header.Add(key, value)
 		}
 	}
+	if h.config.ForwardClientIP {
+		setForwardedHeaders(c, proxyReq)
+	}
 
-	// Make request
-	resp, err := h.httpClient.Do(proxyReq)
+	// Make request; only reads are retried, since other methods may change state
+	idempotent := c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead
+	resp, err := h.doWithRetry(c.Request.Context(), proxyReq, model, idempotent)
 	if err != nil {
 		h.metrics.RecordError(model, "proxy_request")
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to proxy request"})
@@ -415,7 +921,12 @@ func (h *ProxyHandler) HandleDefault(c *gin.Context) {
 	defer resp.Body.Close()
 
 	// Read response
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err := readUpstreamBody(resp, h.config.MaxResponseBytes)
+	if errors.Is(err, errUpstreamTooLarge) {
+		h.metrics.RecordError(model, "upstream_too_large")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Upstream response too large"})
+		return
+	}
 	if err != nil {
 		h.metrics.RecordError(model, "read_response")
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to read response"})
@@ -426,6 +937,13 @@ func (h *ProxyHandler) HandleDefault(c *gin.Context) {
 	duration := time.Since(start)
 	h.metrics.RecordRequest(c.Request.Method, c.Request.URL.Path, model, strconv.Itoa(resp.StatusCode), duration)
 
+	// OpenAI clients expect JSON errors; native routes keep raw passthrough
+	if h.config.WrapUpstreamErrors && strings.HasPrefix(c.Request.URL.Path, "/v1/") && isNonJSONError(resp) {
+		h.metrics.RecordError(model, "upstream_error")
+		c.JSON(resp.StatusCode, openAIUpstreamError(resp))
+		return
+	}
+
 	// Copy response headers
 	for key, values := range resp.Header {
 		for _, value := range values {
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
+)
+
+// stubOllama returns an upstream that answers every request with status,
+// content type and body
+func stubOllama(status int, contentType, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+}
+
+func TestGenerateForwardsUnparseableUpstreamBody(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+	}{
+		{"truncated", `{"model":"llama2:7b","response":"Hel`},
+		{"garbage", "\x00\x01 not json at all"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := stubOllama(http.StatusOK, "application/json", tc.body)
+			defer upstream.Close()
+			h := newTestProxyHandler(upstream, nil)
+
+			var rec *httptest.ResponseRecorder
+			assertErrorCounted(t, "llama2:7b", "upstream_parse", func() {
+				rec = serve(h.HandleGenerate, "/api/generate", `{"model":"llama2:7b","prompt":"hi","stream":false}`)
+			})
+
+			// The body is still forwarded as is; only token metrics are lost
+			if rec.Code != http.StatusOK {
+				t.Errorf("status = %d, want 200", rec.Code)
+			}
+			if rec.Body.String() != tc.body {
+				t.Errorf("body = %q, want the upstream body %q", rec.Body.String(), tc.body)
+			}
+		})
+	}
+}
+
+func TestChatCompletionRejectsUnparseableUpstreamBody(t *testing.T) {
+	upstream := stubOllama(http.StatusOK, "application/json", `{"model":"llama2:7b","message":{"role":"assis`)
+	defer upstream.Close()
+	h := newTestOpenAIHandler(upstream, nil)
+
+	var rec *httptest.ResponseRecorder
+	assertErrorCounted(t, "llama2:7b", "upstream_parse", func() {
+		rec = serve(h.HandleChatCompletions, "/v1/chat/completions", `{"model":"llama2:7b","messages":[{"role":"user","content":"hi"}]}`)
+	})
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502; body %s", rec.Code, rec.Body)
+	}
+	var errResp models.OpenAIError
+	if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("error body isn't JSON: %v", err)
+	}
+	if errResp.Error.Type != "internal_error" || errResp.Error.Message != "Failed to parse response" {
+		t.Errorf("error = %+v, want an internal_error about parsing the response", errResp.Error)
+	}
+}
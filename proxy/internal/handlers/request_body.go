@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errRequestTooLarge is returned when a client request body exceeds the
+// configured size limit
+var errRequestTooLarge = errors.New("request body too large")
+
+// readRequestBody reads the client's request body, giving up with
+// errRequestTooLarge once it exceeds limit bytes (0 means no limit)
+func readRequestBody(c *gin.Context, limit int64) ([]byte, error) {
+	if limit > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, errRequestTooLarge
+	}
+	return body, err
+}
+
+// requestTooLargeMessage explains a 413 response
+func requestTooLargeMessage(limit int64) string {
+	return fmt.Sprintf("Request body exceeds the %d byte limit", limit)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/requestlog"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// requestIDHistory is how many recent request IDs are checked for reuse
+const requestIDHistory = 10000
+
+// maxRequestIDLength bounds client-supplied request IDs, which are echoed in
+// response headers and written to logs
+const maxRequestIDLength = 128
+
+// clientRequestID returns the ID the client sent in X-Request-ID or, failing
+// that, its W3C traceparent, so the proxy's logs and request metadata line
+// up with the caller's traces. A new ID is generated when neither is usable.
+func clientRequestID(c *gin.Context) string {
+	for _, header := range []string{"X-Request-ID", "traceparent"} {
+		if id := c.GetHeader(header); validRequestID(id) {
+			return id
+		}
+	}
+	return uuid.New().String()
+}
+
+// validRequestID accepts a non-empty ID of printable ASCII without spaces
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// assignRequestID makes requestID the request's ID, in the X-Request-ID
+// response header and the request log. An ID used recently would be counted
+// twice in per-request metrics, so it is replaced with a fresh one, or
+// rejected when DUPLICATE_REQUEST_ID is "reject". It reports false after
+// responding to a rejected request.
+func (h *OpenAIHandler) assignRequestID(c *gin.Context, requestID string) (string, bool) {
+	if !h.requestIDs.Claim(requestID) {
+		h.metrics.RecordDuplicateRequestID()
+		if h.config.DuplicateRequestID == "reject" {
+			h.sendOpenAIErrorCode(c, http.StatusConflict, "invalid_request_error", "duplicate_request_id", "Request ID "+requestID+" was already used")
+			return "", false
+		}
+
+		requestID = uuid.New().String()
+		h.requestIDs.Claim(requestID)
+	}
+
+	setRequestID(c, requestID)
+	return requestID, true
+}
+
+// setRequestID returns requestID to the client in X-Request-ID and records
+// it for the request log and the structured request log line
+func setRequestID(c *gin.Context, requestID string) {
+	c.Header("X-Request-ID", requestID)
+	c.Set(requestlog.RequestIDKey, requestID)
+}
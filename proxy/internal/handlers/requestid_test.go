@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// serveWithHeaders runs one chat completion through h with extra request
+// headers
+func serveWithHeaders(h *OpenAIHandler, headers map[string]string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.POST("/v1/chat/completions", h.HandleChatCompletions)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		bytes.NewBufferString(`{"model":"llama2:7b","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRequestIDEcho(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		want    string // "" when a fresh UUID is expected
+	}{
+		{"client ID", map[string]string{"X-Request-ID": "req-abc123"}, "req-abc123"},
+		{"client ID wins over traceparent", map[string]string{"X-Request-ID": "req-abc123", "traceparent": traceparent}, "req-abc123"},
+		{"traceparent", map[string]string{"traceparent": traceparent}, traceparent},
+		{"invalid ID falls back to traceparent", map[string]string{"X-Request-ID": "has space", "traceparent": traceparent}, traceparent},
+		{"no headers", nil, ""},
+		{"ID with a space", map[string]string{"X-Request-ID": "has space"}, ""},
+		{"ID too long", map[string]string{"X-Request-ID": strings.Repeat("a", maxRequestIDLength+1)}, ""},
+		{"non-ASCII ID", map[string]string{"X-Request-ID": "req-é"}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := stubOllama(http.StatusOK, "application/json", chatBody)
+			defer upstream.Close()
+			h := newTestOpenAIHandler(upstream, nil)
+
+			rec := serveWithHeaders(h, tc.headers)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+			}
+			got := rec.Header().Get("X-Request-ID")
+			if tc.want != "" {
+				if got != tc.want {
+					t.Errorf("X-Request-ID = %q, want %q echoed", got, tc.want)
+				}
+				return
+			}
+			if _, err := uuid.Parse(got); err != nil {
+				t.Errorf("X-Request-ID = %q, want a generated UUID", got)
+			}
+		})
+	}
+}
+
+func TestDuplicateRequestIDIsReplaced(t *testing.T) {
+	upstream := stubOllama(http.StatusOK, "application/json", chatBody)
+	defer upstream.Close()
+	h := newTestOpenAIHandler(upstream, nil)
+
+	headers := map[string]string{"X-Request-ID": "req-reused"}
+	if got := serveWithHeaders(h, headers).Header().Get("X-Request-ID"); got != "req-reused" {
+		t.Fatalf("first X-Request-ID = %q, want req-reused", got)
+	}
+	got := serveWithHeaders(h, headers).Header().Get("X-Request-ID")
+	if _, err := uuid.Parse(got); err != nil {
+		t.Errorf("second X-Request-ID = %q, want a fresh UUID in place of the reused ID", got)
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	for _, tc := range []struct {
+		id   string
+		want bool
+	}{
+		{"req-abc123", true},
+		{traceparent, true},
+		{"~!@#$%^&*()", true},
+		{strings.Repeat("a", maxRequestIDLength), true},
+		{"", false},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+		{"has space", false},
+		{"tab\there", false},
+		{"new\nline", false},
+		{"del\x7f", false},
+		{"req-é", false},
+	} {
+		if got := validRequestID(tc.id); got != tc.want {
+			t.Errorf("validRequestID(%q) = %v, want %v", tc.id, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// doWithRetry sends an upstream request, retrying connection errors and 5xx
+// responses up to MaxRetries times with exponential backoff starting at
+// RetryBackoff. Only requests that are safe to repeat may set retry; a
+// streaming response is never retried, since the client may already have
+// part of it. ctx ends the backoff wait early when the client goes away.
+func (h *ProxyHandler) doWithRetry(ctx context.Context, req *http.Request, model string, retry bool) (*http.Response, error) {
+	maxRetries := h.config.MaxRetries
+	if !retry || req.GetBody == nil && req.Body != nil && req.Body != http.NoBody {
+		maxRetries = 0
+	}
+
+	backoff := h.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := h.httpClient.Do(req)
+
+		var reason string
+		switch {
+		case err != nil:
+			reason = "connection_error"
+		case resp.StatusCode >= http.StatusInternalServerError:
+			reason = fmt.Sprintf("status_%d", resp.StatusCode)
+		default:
+			return resp, nil
+		}
+		if attempt >= maxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		// Discard the failed response so its connection can be reused
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		h.metrics.RecordRetry(model, reason)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+
+		next := req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			next.Body = body
+		}
+		req = next
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/tagstrip"
+)
+
+// newStripStream starts tag stripping for one streaming response, or
+// returns nil when no tags are configured
+func newStripStream(stripper *tagstrip.Stripper) *tagstrip.Stream {
+	if stripper == nil {
+		return nil
+	}
+	return stripper.NewStream()
+}
+
+// stripChunk passes one chunk of generated text through the stream,
+// releasing anything held back once the response is done
+func stripChunk(stream *tagstrip.Stream, text string, done bool) (content, reasoning string) {
+	content, reasoning = stream.Write(text)
+	if done {
+		restContent, restReasoning := stream.Flush()
+		content += restContent
+		reasoning += restReasoning
+	}
+	return content, reasoning
+}
+
+// setJSONFields replaces top-level fields of the JSON object in data. The
+// object is patched rather than decoded into a response struct, so fields
+// the structs don't declare, such as done_reason, are kept.
+func setJSONFields(data []byte, fields map[string]interface{}) ([]byte, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	for name, value := range fields {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		object[name] = raw
+	}
+	return json.Marshal(object)
+}
+
+// setMessageFields replaces fields of the message object in a chat
+// response, keeping every other field of the response and the message
+func setMessageFields(data []byte, fields map[string]interface{}) ([]byte, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	message, err := setJSONFields(object["message"], fields)
+	if err != nil {
+		return nil, err
+	}
+	object["message"] = message
+	return json.Marshal(object)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/atyronesmith/llama-metrics/proxy/pkg/config"
+)
+
+func TestStreamingGenerateStripsTagsAndKeepsUnknownFields(t *testing.T) {
+	upstreamLines := []string{
+		`{"model":"llama2:7b","response":"<thi","done":false}`,
+		`{"model":"llama2:7b","response":"nk>plan</think>Hi","done":false}`,
+		`{"model":"llama2:7b","response":" there","done":false}`,
+		`{"model":"llama2:7b","response":"","done":true,"done_reason":"stop","eval_count":3}`,
+	}
+	upstream := stubOllama(http.StatusOK, "application/x-ndjson", strings.Join(upstreamLines, "\n")+"\n")
+	defer upstream.Close()
+	h := newTestProxyHandler(upstream, func(cfg *config.Config) {
+		cfg.StripTags = "think"
+		cfg.StripTagsReasoning = true
+	})
+
+	rec := serve(h.HandleGenerate, "/api/generate", `{"model":"llama2:7b","prompt":"hi","stream":true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != len(upstreamLines) {
+		t.Fatalf("got %d lines, want %d: %q", len(lines), len(upstreamLines), lines)
+	}
+
+	// A chunk with nothing to strip is forwarded byte for byte
+	if lines[2] != upstreamLines[2] {
+		t.Errorf("unchanged chunk re-encoded: %s", lines[2])
+	}
+
+	var content, thinking strings.Builder
+	var last map[string]interface{}
+	for _, line := range lines {
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			t.Fatalf("chunk %q isn't JSON: %v", line, err)
+		}
+		if chunk["model"] != "llama2:7b" {
+			t.Errorf("chunk %s lost its model field", line)
+		}
+		content.WriteString(chunk["response"].(string))
+		if s, ok := chunk["thinking"].(string); ok {
+			thinking.WriteString(s)
+		}
+		last = chunk
+	}
+
+	if content.String() != "Hi there" || thinking.String() != "plan" {
+		t.Errorf("content %q, thinking %q; want %q, %q", content.String(), thinking.String(), "Hi there", "plan")
+	}
+	if last["done_reason"] != "stop" {
+		t.Errorf("final chunk %v lost done_reason", last)
+	}
+}
+
+func TestSetMessageFieldsKeepsOtherFields(t *testing.T) {
+	in := `{"model":"m","message":{"role":"assistant","content":"<think>x</think>y","images":null},"done":true,"done_reason":"stop"}`
+
+	out, err := setMessageFields([]byte(in), map[string]interface{}{"content": "y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		DoneReason string                 `json:"done_reason"`
+		Message    map[string]interface{} `json:"message"`
+	}
+	json.Unmarshal(out, &got)
+	if got.DoneReason != "stop" || got.Message["content"] != "y" || got.Message["role"] != "assistant" {
+		t.Errorf("setMessageFields() = %s", out)
+	}
+	if _, ok := got.Message["images"]; !ok {
+		t.Errorf("setMessageFields() dropped message.images: %s", out)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
+	"github.com/google/uuid"
+)
+
+// ollamaTools returns the tools to offer the model: Tools, or the
+// deprecated Functions as function tools. A tool_choice (or function_call)
+// of "none" offers none; Ollama has no way to force a particular tool.
+func ollamaTools(req models.ChatCompletionRequest) []models.Tool {
+	if req.ToolChoice == "none" || req.FunctionCall == "none" {
+		return nil
+	}
+	if len(req.Tools) > 0 {
+		return req.Tools
+	}
+
+	var tools []models.Tool
+	for _, fn := range req.Functions {
+		tools = append(tools, models.Tool{Type: "function", Function: fn})
+	}
+	return tools
+}
+
+// ollamaToolCalls converts an assistant message's OpenAI tool calls, whose
+// arguments are JSON strings, into Ollama tool calls
+func ollamaToolCalls(calls []models.ToolCall) []models.OllamaToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	converted := make([]models.OllamaToolCall, len(calls))
+	for i, call := range calls {
+		var args map[string]interface{}
+		if call.Function.Arguments != "" {
+			// Malformed arguments are forwarded as an empty object
+			_ = json.Unmarshal([]byte(call.Function.Arguments), &args)
+		}
+		converted[i] = models.OllamaToolCall{
+			Function: models.OllamaFunctionCall{
+				Name:      call.Function.Name,
+				Arguments: args,
+			},
+		}
+	}
+	return converted
+}
+
+// openAIToolCalls converts Ollama tool calls into OpenAI tool calls, giving
+// each a fresh ID since Ollama doesn't assign one
+func openAIToolCalls(calls []models.OllamaToolCall) []models.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	converted := make([]models.ToolCall, len(calls))
+	for i, call := range calls {
+		args := call.Function.Arguments
+		if args == nil {
+			args = map[string]interface{}{}
+		}
+		encoded, _ := json.Marshal(args)
+		converted[i] = models.ToolCall{
+			ID:   "call_" + uuid.New().String(),
+			Type: "function",
+			Function: models.FunctionCall{
+				Name:      call.Function.Name,
+				Arguments: string(encoded),
+			},
+		}
+	}
+	return converted
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
+)
+
+const weatherTool = `{"type":"function","function":{"name":"get_weather","description":"Current weather for a city","parameters":{"type":"object","properties":{"city":{"type":"string"}},"required":["city"]}}}`
+
+const toolCallResponse = `{"model":"llama3.1:8b","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"get_weather","arguments":{"city":"Paris"}}}]},"done":true,"prompt_eval_count":40,"eval_count":12}`
+
+func TestChatCompletionToolRoundTrip(t *testing.T) {
+	upstream := newRecordingOllama(toolCallResponse)
+	defer upstream.Close()
+	h := newTestOpenAIHandler(upstream.Server, nil)
+
+	rec := serve(h.HandleChatCompletions, "/v1/chat/completions",
+		`{"model":"llama3.1:8b","messages":[{"role":"user","content":"Weather in Paris?"}],"tools":[`+weatherTool+`]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+
+	// The function definition reaches Ollama unchanged
+	var sent models.ChatRequest
+	upstream.decodeLast(t, &sent)
+	if len(sent.Tools) != 1 {
+		t.Fatalf("upstream tools = %+v, want the one function", sent.Tools)
+	}
+	fn := sent.Tools[0].Function
+	if sent.Tools[0].Type != "function" || fn.Name != "get_weather" || fn.Description != "Current weather for a city" {
+		t.Errorf("upstream tool = %+v, want get_weather as a function", sent.Tools[0])
+	}
+	if props, _ := fn.Parameters["properties"].(map[string]interface{}); props["city"] == nil {
+		t.Errorf("upstream tool parameters = %v, want the city property", fn.Parameters)
+	}
+
+	// Ollama's tool call comes back in OpenAI's shape
+	var resp models.ChatCompletionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(resp.Choices) != 1 {
+		t.Fatalf("choices = %+v, want one", resp.Choices)
+	}
+	choice := resp.Choices[0]
+	if choice.FinishReason != "tool_calls" {
+		t.Errorf("finish_reason = %q, want tool_calls", choice.FinishReason)
+	}
+	if len(choice.Message.ToolCalls) != 1 {
+		t.Fatalf("tool_calls = %+v, want one", choice.Message.ToolCalls)
+	}
+	call := choice.Message.ToolCalls[0]
+	if !strings.HasPrefix(call.ID, "call_") || call.Type != "function" || call.Function.Name != "get_weather" {
+		t.Errorf("tool call = %+v, want a call_ ID and a get_weather function call", call)
+	}
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil || args["city"] != "Paris" {
+		t.Errorf("arguments = %q, want a JSON string with city Paris", call.Function.Arguments)
+	}
+}
+
+func TestChatCompletionToolResultRoundTrip(t *testing.T) {
+	upstream := newRecordingOllama(`{"model":"llama3.1:8b","message":{"role":"assistant","content":"It is sunny."},"done":true}`)
+	defer upstream.Close()
+	h := newTestOpenAIHandler(upstream.Server, nil)
+
+	// The client replays the assistant's tool call along with its result
+	rec := serve(h.HandleChatCompletions, "/v1/chat/completions", `{"model":"llama3.1:8b","tools":[`+weatherTool+`],"messages":[
+		{"role":"user","content":"Weather in Paris?"},
+		{"role":"assistant","content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},
+		{"role":"tool","tool_call_id":"call_1","content":"sunny"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+
+	var sent models.ChatRequest
+	upstream.decodeLast(t, &sent)
+	if len(sent.Messages) != 3 {
+		t.Fatalf("upstream messages = %+v, want three", sent.Messages)
+	}
+	calls := sent.Messages[1].ToolCalls
+	if len(calls) != 1 || calls[0].Function.Name != "get_weather" || calls[0].Function.Arguments["city"] != "Paris" {
+		t.Errorf("upstream assistant tool calls = %+v, want get_weather with decoded arguments", calls)
+	}
+	if sent.Messages[2].Role != "tool" || sent.Messages[2].Content != "sunny" {
+		t.Errorf("upstream tool message = %+v, want the tool result", sent.Messages[2])
+	}
+
+	var resp models.ChatCompletionResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if len(resp.Choices) != 1 || resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("choices = %+v, want one with finish_reason stop", resp.Choices)
+	}
+}
+
+func TestOllamaTools(t *testing.T) {
+	var tool models.Tool
+	if err := json.Unmarshal([]byte(weatherTool), &tool); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		req  models.ChatCompletionRequest
+		want int
+	}{
+		{"tools", models.ChatCompletionRequest{Tools: []models.Tool{tool}}, 1},
+		{"tool_choice none", models.ChatCompletionRequest{Tools: []models.Tool{tool}, ToolChoice: "none"}, 0},
+		{"functions", models.ChatCompletionRequest{Functions: []models.Function{tool.Function}}, 1},
+		{"function_call none", models.ChatCompletionRequest{Functions: []models.Function{tool.Function}, FunctionCall: "none"}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ollamaTools(tc.req); len(got) != tc.want {
+				t.Errorf("ollamaTools() = %+v, want %d tools", got, tc.want)
+			}
+		})
+	}
+}
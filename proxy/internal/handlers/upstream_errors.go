@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
+	"github.com/atyronesmith/llama-metrics/proxy/pkg/config"
+)
+
+// errUpstreamTooLarge is returned when a buffered upstream response exceeds
+// the configured size limit
+var errUpstreamTooLarge = errors.New("upstream response too large")
+
+// readUpstreamBody buffers a non-streaming upstream response, giving up with
+// errUpstreamTooLarge once it exceeds limit bytes (0 means no limit)
+func readUpstreamBody(resp *http.Response, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, errUpstreamTooLarge
+	}
+	return body, nil
+}
+
+// upstreamParseError is returned when an upstream response body can't be
+// parsed; Body is kept so the error can be reported with a preview of it
+type upstreamParseError struct {
+	Err  error
+	Body []byte
+}
+
+func (e *upstreamParseError) Error() string {
+	return fmt.Sprintf("failed to parse upstream response: %v", e.Err)
+}
+
+func (e *upstreamParseError) Unwrap() error {
+	return e.Err
+}
+
+// upstreamBodyPreview returns the start of an upstream body for error
+// details and logs, or "" unless ERROR_INCLUDE_UPSTREAM_BODY is set
+func upstreamBodyPreview(cfg *config.Config, body []byte) string {
+	if !cfg.ErrorIncludeUpstreamBody {
+		return ""
+	}
+	if len(body) <= cfg.ErrorUpstreamBodyLimit {
+		return string(body)
+	}
+
+	// Don't cut a multi-byte character in half
+	cut := cfg.ErrorUpstreamBodyLimit
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", body[:cut], len(body)-cut)
+}
+
+// logUpstreamParseError logs an upstream response that couldn't be parsed,
+// with a preview of its body when enabled
+func logUpstreamParseError(cfg *config.Config, model string, err error, body []byte) {
+	if preview := upstreamBodyPreview(cfg, body); preview != "" {
+		log.Printf("Failed to parse Ollama response for model %s: %v; body: %q", model, err, preview)
+		return
+	}
+	log.Printf("Failed to parse Ollama response for model %s: %v", model, err)
+}
+
+// isNonJSONError reports whether an upstream response is an error whose body
+// isn't JSON, such as an HTML 502 page from a reverse proxy in front of Ollama
+func isNonJSONError(resp *http.Response) bool {
+	if resp.StatusCode < http.StatusBadRequest {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType != "application/json"
+}
+
+// upstreamErrorMessage describes a non-JSON upstream error without echoing its body
+func upstreamErrorMessage(resp *http.Response) string {
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "no content type"
+	}
+	return fmt.Sprintf("Upstream returned HTTP %d (%s)", resp.StatusCode, contentType)
+}
+
+// openAIUpstreamError wraps a non-JSON upstream error in OpenAI's error shape
+func openAIUpstreamError(resp *http.Response) models.OpenAIError {
+	return models.OpenAIError{
+		Error: models.ErrorDetail{
+			Message: upstreamErrorMessage(resp),
+			Type:    "upstream_error",
+		},
+	}
+}
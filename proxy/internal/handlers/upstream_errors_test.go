@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
+	"github.com/atyronesmith/llama-metrics/proxy/pkg/config"
+)
+
+const badGatewayPage = "<html><head><title>502 Bad Gateway</title></head><body><h1>502 Bad Gateway</h1></body></html>"
+
+const wrappedBadGateway = "Upstream returned HTTP 502 (text/html; charset=utf-8)"
+
+func TestGenerateWrapsHTMLUpstreamError(t *testing.T) {
+	upstream := stubOllama(http.StatusBadGateway, "text/html; charset=utf-8", badGatewayPage)
+	defer upstream.Close()
+	h := newTestProxyHandler(upstream, nil)
+
+	var rec *httptest.ResponseRecorder
+	assertErrorCounted(t, "llama2:7b", "upstream_error", func() {
+		rec = serve(h.HandleGenerate, "/api/generate", `{"model":"llama2:7b","prompt":"hi","stream":false}`)
+	})
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want the upstream's 502", rec.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q isn't JSON: %v", rec.Body, err)
+	}
+	if body["error"] != wrappedBadGateway {
+		t.Errorf("error = %q, want %q", body["error"], wrappedBadGateway)
+	}
+}
+
+func TestChatCompletionWrapsHTMLUpstreamError(t *testing.T) {
+	upstream := stubOllama(http.StatusBadGateway, "text/html; charset=utf-8", badGatewayPage)
+	defer upstream.Close()
+	h := newTestOpenAIHandler(upstream, nil)
+
+	var rec *httptest.ResponseRecorder
+	assertErrorCounted(t, "llama2:7b", "upstream_error", func() {
+		rec = serve(h.HandleChatCompletions, "/v1/chat/completions", `{"model":"llama2:7b","messages":[{"role":"user","content":"hi"}]}`)
+	})
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want the upstream's 502", rec.Code)
+	}
+	var errResp models.OpenAIError
+	if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("body %q isn't JSON: %v", rec.Body, err)
+	}
+	if errResp.Error.Type != "upstream_error" || errResp.Error.Message != wrappedBadGateway {
+		t.Errorf("error = %+v, want upstream_error %q", errResp.Error, wrappedBadGateway)
+	}
+}
+
+func TestGeneratePassesHTMLThroughWhenWrappingIsOff(t *testing.T) {
+	upstream := stubOllama(http.StatusBadGateway, "text/html; charset=utf-8", badGatewayPage)
+	defer upstream.Close()
+	h := newTestProxyHandler(upstream, func(cfg *config.Config) {
+		cfg.WrapUpstreamErrors = false
+	})
+
+	rec := serve(h.HandleGenerate, "/api/generate", `{"model":"llama2:7b","prompt":"hi","stream":false}`)
+
+	if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "<h1>502 Bad Gateway</h1>") {
+		t.Errorf("got %d %q, want the upstream page unchanged", rec.Code, rec.Body)
+	}
+}
+
+func TestIsNonJSONError(t *testing.T) {
+	for _, tc := range []struct {
+		status      int
+		contentType string
+		want        bool
+	}{
+		{http.StatusBadGateway, "text/html", true},
+		{http.StatusServiceUnavailable, "", true},
+		{http.StatusNotFound, "application/json; charset=utf-8", false},
+		{http.StatusOK, "text/html", false},
+	} {
+		resp := &http.Response{StatusCode: tc.status, Header: http.Header{}}
+		if tc.contentType != "" {
+			resp.Header.Set("Content-Type", tc.contentType)
+		}
+		if got := isNonJSONError(resp); got != tc.want {
+			t.Errorf("isNonJSONError(%d, %q) = %v, want %v", tc.status, tc.contentType, got, tc.want)
+		}
+	}
+}
+
+// oversizedGenerate is a valid Ollama response longer than the 64-byte
+// limit the tests below set
+var oversizedGenerate = `{"model":"llama2:7b","response":"` + strings.Repeat("a", 256) + `","done":true}`
+
+func TestGenerateRejectsOversizedUpstreamBody(t *testing.T) {
+	upstream := stubOllama(http.StatusOK, "application/json", oversizedGenerate)
+	defer upstream.Close()
+	h := newTestProxyHandler(upstream, func(cfg *config.Config) {
+		cfg.MaxResponseBytes = 64
+	})
+
+	var rec *httptest.ResponseRecorder
+	assertErrorCounted(t, "llama2:7b", "upstream_too_large", func() {
+		rec = serve(h.HandleGenerate, "/api/generate", `{"model":"llama2:7b","prompt":"hi","stream":false}`)
+	})
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502; body %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "aaaa") {
+		t.Errorf("body %q contains the oversized upstream response", rec.Body)
+	}
+}
+
+func TestCompletionRejectsOversizedUpstreamBody(t *testing.T) {
+	upstream := stubOllama(http.StatusOK, "application/json", oversizedGenerate)
+	defer upstream.Close()
+	h := newTestOpenAIHandler(upstream, func(cfg *config.Config) {
+		cfg.MaxResponseBytes = 64
+	})
+
+	var rec *httptest.ResponseRecorder
+	assertErrorCounted(t, "llama2:7b", "upstream_too_large", func() {
+		rec = serve(h.HandleCompletions, "/v1/completions", `{"model":"llama2:7b","prompt":"hi"}`)
+	})
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502; body %s", rec.Code, rec.Body)
+	}
+	var errResp models.OpenAIError
+	if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("error body isn't JSON: %v", err)
+	}
+	if errResp.Error.Type != "upstream_error" {
+		t.Errorf("error = %+v, want an upstream_error", errResp.Error)
+	}
+}
+
+func TestGenerateAcceptsBodyWithinLimit(t *testing.T) {
+	upstream := stubOllama(http.StatusOK, "application/json", oversizedGenerate)
+	defer upstream.Close()
+	h := newTestProxyHandler(upstream, func(cfg *config.Config) {
+		cfg.MaxResponseBytes = int64(len(oversizedGenerate))
+	})
+
+	rec := serve(h.HandleGenerate, "/api/generate", `{"model":"llama2:7b","prompt":"hi","stream":false}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 for a body exactly at the limit", rec.Code)
+	}
+}
+
+func TestEmbeddingsRejectOversizedUpstreamBody(t *testing.T) {
+	vector := "[" + strings.TrimSuffix(strings.Repeat("0.125,", 64), ",") + "]"
+	for _, tc := range []struct {
+		name     string
+		upstream http.HandlerFunc
+	}{
+		{"batch", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"embeddings":[` + vector + `]}`))
+		}},
+		{"single", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/embed" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"embedding":` + vector + `}`))
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := httptest.NewServer(tc.upstream)
+			defer upstream.Close()
+			h := newTestOpenAIHandler(upstream, func(cfg *config.Config) {
+				cfg.MaxResponseBytes = 64
+			})
+
+			var rec *httptest.ResponseRecorder
+			assertErrorCounted(t, "nomic-embed-text", "upstream_too_large", func() {
+				rec = serve(h.HandleEmbeddings, "/v1/embeddings", `{"model":"nomic-embed-text","input":"hi"}`)
+			})
+
+			if rec.Code != http.StatusBadGateway {
+				t.Fatalf("status = %d, want 502; body %s", rec.Code, rec.Body)
+			}
+			var errResp models.OpenAIError
+			if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil || errResp.Error.Type != "upstream_error" {
+				t.Errorf("body = %s, want an upstream_error", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package inflight
+
+import (
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tracker counts requests currently being served. Unlike the Prometheus
+// active-requests gauge it is maintained in one place, so a handler that
+// forgets to decrement or panics can't leave it permanently inflated.
+type Tracker struct {
+	count atomic.Int64
+}
+
+// New creates an in-flight request tracker
+func New() *Tracker {
+	return &Tracker{}
+}
+
+// Middleware counts a request for as long as its handlers run. The
+// decrement is deferred, so it also happens when a handler panics.
+func (t *Tracker) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t.count.Add(1)
+		defer t.count.Add(-1)
+
+		c.Next()
+	}
+}
+
+// Count returns the number of requests currently in flight
+func (t *Tracker) Count() int64 {
+	return t.count.Load()
+}
@@ -0,0 +1,57 @@
+package inflight
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRouter(t *Tracker, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	router.Use(t.Middleware())
+	router.GET("/", handler)
+	return router
+}
+
+func TestMiddlewareCountsRequestWhileHandlerRuns(t *testing.T) {
+	tracker := New()
+	var during int64
+	router := newRouter(tracker, func(c *gin.Context) {
+		during = tracker.Count()
+		c.Status(http.StatusOK)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if during != 1 {
+		t.Errorf("Count() during the request = %d, want 1", during)
+	}
+	if got := tracker.Count(); got != 0 {
+		t.Errorf("Count() after the request = %d, want 0", got)
+	}
+}
+
+func TestMiddlewareReleasesCountWhenHandlerPanics(t *testing.T) {
+	tracker := New()
+	router := newRouter(tracker, func(c *gin.Context) {
+		panic("handler bug")
+	})
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want 500 from the recovery middleware", rec.Code)
+		}
+	}
+
+	if got := tracker.Count(); got != 0 {
+		t.Errorf("Count() after panicking handlers = %d, want 0", got)
+	}
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"log"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/requestlog"
+	"github.com/gin-gonic/gin"
+)
+
+// New returns a logger writing JSON lines to stderr at level: debug, info,
+// warn or error. Messages from the standard log package are turned into
+// JSON lines too; they are always written, since they include fatal errors.
+func New(level string) *slog.Logger {
+	log.SetFlags(0)
+	log.SetOutput(slog.NewLogLogger(slog.NewJSONHandler(os.Stderr, nil), slog.LevelInfo).Writer())
+
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+		Level: parseLevel(level),
+	}))
+}
+
+func parseLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Middleware logs one line per request. Handlers add the request ID, model
+// and priority through the requestlog context keys. Server errors are
+// logged at error level and client errors at warn.
+func Middleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		if !logger.Enabled(c.Request.Context(), level) {
+			return
+		}
+
+		model := c.GetString(requestlog.ModelKey)
+		if model == "" {
+			model = "unknown"
+		}
+		attrs := []slog.Attr{
+			slog.String("request_id", c.GetString(requestlog.RequestIDKey)),
+			slog.String("model", model),
+			slog.String("method", c.Request.Method),
+			slog.String("endpoint", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000.0),
+		}
+		if priority := c.GetString(requestlog.PriorityKey); priority != "" {
+			attrs = append(attrs, slog.String("priority", priority))
+		}
+		if user := c.GetString(requestlog.UserKey); user != "" {
+			attrs = append(attrs, slog.String("user", user))
+		}
+
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+)
+
+// iostatSample is disk activity from one macOS iostat report
+type iostatSample struct {
+	KBPerTransfer   float64
+	TransfersPerSec float64
+	MegabytesPerSec float64
+}
+
+// parseIostat reads the output of macOS "iostat -c 1", whose first header
+// line names the devices ("disk0 disk2 cpu load average"), the second names
+// three columns per disk (KB/t tps MB/s), then the cpu and load columns
+// follow. With device set, only that disk is reported; otherwise transfers
+// and throughput are summed over all disks and KB/t is their weighted mean.
+func parseIostat(output, device string) (iostatSample, bool) {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 3 {
+		return iostatSample{}, false
+	}
+
+	var disks []string
+	for _, name := range strings.Fields(lines[0]) {
+		if strings.HasPrefix(name, "disk") {
+			disks = append(disks, name)
+		}
+	}
+	// The last line is the most recent report
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(disks) == 0 || len(fields) < 3*len(disks) {
+		return iostatSample{}, false
+	}
+
+	var sample iostatSample
+	var totalKB float64
+	found := false
+	for i, disk := range disks {
+		if device != "" && disk != device {
+			continue
+		}
+		kbt, err1 := strconv.ParseFloat(fields[3*i], 64)
+		tps, err2 := strconv.ParseFloat(fields[3*i+1], 64)
+		mbs, err3 := strconv.ParseFloat(fields[3*i+2], 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return iostatSample{}, false
+		}
+		totalKB += kbt * tps
+		sample.TransfersPerSec += tps
+		sample.MegabytesPerSec += mbs
+		found = true
+	}
+	if !found {
+		return iostatSample{}, false
+	}
+
+	if sample.TransfersPerSec > 0 {
+		sample.KBPerTransfer = totalKB / sample.TransfersPerSec
+	}
+	return sample, true
+}
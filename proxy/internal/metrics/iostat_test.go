@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+const (
+	singleDiskIostat = `              disk0       cpu    load average
+    KB/t  tps  MB/s  us sy id   1m   5m   15m
+   24.36   45  1.07   8  4 88  2.10 2.05 1.98
+`
+	multiDiskIostat = `              disk0               disk2       cpu    load average
+    KB/t  tps  MB/s     KB/t  tps  MB/s  us sy id   1m   5m   15m
+   20.00   30  0.59   100.00   10  0.98   8  4 88  2.10 2.05 1.98
+`
+	// With more than one report, as from iostat -c 2, the last one counts
+	twoReportIostat = `              disk0       cpu    load average
+    KB/t  tps  MB/s  us sy id   1m   5m   15m
+   30.12   12  0.35   8  4 88  2.10 2.05 1.98
+   16.00   64  1.00   9  5 86  2.12 2.06 1.98
+`
+)
+
+func TestParseIostat(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		output string
+		device string
+		want   iostatSample
+		wantOK bool
+	}{
+		{"single disk", singleDiskIostat, "", iostatSample{KBPerTransfer: 24.36, TransfersPerSec: 45, MegabytesPerSec: 1.07}, true},
+		{"single disk by name", singleDiskIostat, "disk0", iostatSample{KBPerTransfer: 24.36, TransfersPerSec: 45, MegabytesPerSec: 1.07}, true},
+		// KB/t is weighted by transfers: (20*30 + 100*10) / 40
+		{"multi disk summed", multiDiskIostat, "", iostatSample{KBPerTransfer: 40, TransfersPerSec: 40, MegabytesPerSec: 1.57}, true},
+		{"multi disk second device", multiDiskIostat, "disk2", iostatSample{KBPerTransfer: 100, TransfersPerSec: 10, MegabytesPerSec: 0.98}, true},
+		{"latest report", twoReportIostat, "", iostatSample{KBPerTransfer: 16, TransfersPerSec: 64, MegabytesPerSec: 1}, true},
+		{"idle disk", "disk0 cpu\nKB/t tps MB/s us\n0.00 0 0.00 3\n", "", iostatSample{}, true},
+		{"unknown device", multiDiskIostat, "disk5", iostatSample{}, false},
+		{"no disks", "cpu load average\nus sy id\n8 4 88\n", "", iostatSample{}, false},
+		{"truncated", "disk0 disk2 cpu\nKB/t tps MB/s KB/t tps MB/s\n20.00 30\n", "", iostatSample{}, false},
+		{"not numbers", "disk0 cpu\nKB/t tps MB/s us\nx y z 3\n", "", iostatSample{}, false},
+		{"empty", "", "", iostatSample{}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseIostat(tc.output, tc.device)
+			if ok != tc.wantOK || !closeTo(got.KBPerTransfer, tc.want.KBPerTransfer) ||
+				!closeTo(got.TransfersPerSec, tc.want.TransfersPerSec) || !closeTo(got.MegabytesPerSec, tc.want.MegabytesPerSec) {
+				t.Errorf("parseIostat() = %+v, %v; want %+v, %v", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+// closeTo compares floats that went through decimal arithmetic
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
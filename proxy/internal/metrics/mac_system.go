@@ -4,27 +4,69 @@
 package metrics
 
 import (
-	"bufio"
 	"context"
 	"log"
 	"os/exec"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/atyronesmith/llama-metrics/proxy/pkg/ratelog"
 )
 
+// MacCollectorOptions selects which Mac metrics are collected each cycle;
+// GPU, temperature, memory pressure and disk I/O shell out to subprocesses
+type MacCollectorOptions struct {
+	Helper         bool
+	GPU            bool
+	Temperature    bool
+	MemoryPressure bool
+	DiskIO         bool
+
+	// DiskDevice limits disk I/O to one iostat device, e.g. "disk0";
+	// empty sums all disks
+	DiskDevice string
+
+	// Debug logs which source supplied the CPU temperature
+	Debug bool
+}
+
+// temperatureSource reads the CPU temperature in Celsius one way
+type temperatureSource struct {
+	name string
+	read func() (float64, bool)
+}
+
 // MacSystemCollector collects Mac-specific system metrics
 type MacSystemCollector struct {
 	metrics  *Collector
 	interval time.Duration
+	opts     MacCollectorOptions
+	errLog   *ratelog.Logger
+
+	// temperatureSources are tried in order until one returns a reading
+	temperatureSources []temperatureSource
+	temperatureSource  string // name of the last source that succeeded
+
+	// helperTemperature is the helper's cpu_temperature from this cycle, 0
+	// when it had none
+	helperTemperature float64
 }
 
 // NewMacSystemCollector creates a new Mac system metrics collector
-func NewMacSystemCollector(metrics *Collector, interval time.Duration) *MacSystemCollector {
-	return &MacSystemCollector{
+func NewMacSystemCollector(metrics *Collector, interval time.Duration, opts MacCollectorOptions) *MacSystemCollector {
+	m := &MacSystemCollector{
 		metrics:  metrics,
 		interval: interval,
+		opts:     opts,
+		errLog:   ratelog.New(errLogInterval),
 	}
+	m.temperatureSources = []temperatureSource{
+		{name: "osx-cpu-temp", read: m.temperatureFromOsxCPUTemp},
+		{name: "powermetrics", read: m.temperatureFromPowermetrics},
+		{name: "metrics helper", read: m.temperatureFromHelper},
+	}
+	return m
 }
 
 // Start begins collecting Mac system metrics in the background
@@ -51,27 +93,38 @@ func (m *MacSystemCollector) collect(ctx context.Context) {
 
 func (m *MacSystemCollector) collectOnce() {
 	// First try to get metrics from the helper service
-	m.fetchMacMetricsFromHelper()
+	m.helperTemperature = 0
+	if m.opts.Helper {
+		m.fetchMacMetricsFromHelper()
+	}
 
 	// Collect GPU metrics using powermetrics (requires sudo)
-	m.collectGPUMetrics()
+	if m.opts.GPU {
+		m.collectGPUMetrics()
+	}
 
-	// Collect temperature using osx-cpu-temp if available
-	m.collectTemperature()
+	// Collect temperature from the first source that has a reading
+	if m.opts.Temperature {
+		m.collectTemperature()
+	}
 
 	// Collect memory pressure
-	m.collectMemoryPressure()
+	if m.opts.MemoryPressure {
+		m.collectMemoryPressure()
+	}
 
 	// Collect disk I/O
-	m.collectDiskIO()
+	if m.opts.DiskIO {
+		m.collectDiskIO()
+	}
 }
 
 func (m *MacSystemCollector) collectGPUMetrics() {
 	// Try to get GPU metrics using ioreg (doesn't require sudo)
 	cmd := exec.Command("ioreg", "-r", "-d", "1", "-w", "0", "-c", "IOAccelerator")
 	output, err := cmd.Output()
+	m.errLog.Report("collecting GPU metrics via ioreg", err)
 	if err != nil {
-		log.Printf("Error collecting GPU metrics via ioreg: %v", err)
 		return
 	}
 
@@ -95,87 +148,66 @@ func (m *MacSystemCollector) tryPowerMetrics() {
 		"--sample-count", "1")
 
 	output, err := cmd.Output()
+	m.errLog.Report("running powermetrics", err)
 	if err != nil {
-		// Log the error instead of silently failing
-		log.Printf("Error running powermetrics: %v", err)
 		return
 	}
 
-	// Parse text output line by line
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	for scanner.Scan() {
-		line := scanner.Text()
+	sample := parsePowerMetrics(string(output))
+	if sample.hasGPUPower {
+		m.metrics.GPUPower.Set(milliwattsToWatts(sample.gpuPower))
+	}
+	if sample.hasCPUPower {
+		m.metrics.CPUPower.Set(milliwattsToWatts(sample.cpuPower))
+	}
+	if sample.hasGPUUtilization {
+		m.metrics.GPUUtilization.Set(sample.gpuUtilization)
+	}
+}
 
-		// Look for GPU Power line
-		if strings.Contains(line, "GPU Power:") {
-			// Extract power value: "GPU Power: 7510 mW"
-			parts := strings.Fields(line)
-			for i, part := range parts {
-				if part == "Power:" && i+1 < len(parts) {
-					if powerStr := strings.TrimSpace(parts[i+1]); powerStr != "" {
-						if power, err := strconv.ParseFloat(powerStr, 64); err == nil {
-							m.metrics.GPUPower.Set(power)
-						}
-					}
-					break
-				}
-			}
+// collectTemperature sets the CPU temperature from the first source with a
+// reading. When every source fails the gauge is left alone rather than set
+// to 0.
+func (m *MacSystemCollector) collectTemperature() {
+	for _, source := range m.temperatureSources {
+		temp, ok := source.read()
+		if !ok {
+			continue
 		}
-
-		// Look for CPU/Package Power line
-		if strings.Contains(line, "CPU Power:") || strings.Contains(line, "Package Power:") {
-			// Extract power value
-			parts := strings.Fields(line)
-			for i, part := range parts {
-				if part == "Power:" && i+1 < len(parts) {
-					if powerStr := strings.TrimSpace(parts[i+1]); powerStr != "" {
-						if power, err := strconv.ParseFloat(powerStr, 64); err == nil {
-							m.metrics.CPUPower.Set(power)
-						}
-					}
-					break
-				}
-			}
+		if m.opts.Debug && source.name != m.temperatureSource {
+			log.Printf("CPU temperature now read from %s (%.1f°C)", source.name, temp)
 		}
+		m.temperatureSource = source.name
+		m.metrics.CPUTemperature.Set(temp)
+		return
+	}
 
-		// Look for GPU active residency to calculate utilization
-		if strings.Contains(line, "GPU HW active residency:") {
-			// Extract percentage: "GPU HW active residency:  58.06%"
-			if idx := strings.Index(line, ":"); idx != -1 {
-				percentStr := strings.TrimSpace(line[idx+1:])
-				percentStr = strings.TrimSuffix(percentStr, "%")
-				// Remove any extra info in parentheses
-				if parenIdx := strings.Index(percentStr, "("); parenIdx != -1 {
-					percentStr = strings.TrimSpace(percentStr[:parenIdx])
-				}
-				if util, err := strconv.ParseFloat(percentStr, 64); err == nil {
-					m.metrics.GPUUtilization.Set(util)
-				}
-			}
-		}
+	if m.opts.Debug && m.temperatureSource != "" {
+		log.Printf("No CPU temperature source has a reading; leaving the last value")
 	}
+	m.temperatureSource = ""
 }
 
-func (m *MacSystemCollector) collectTemperature() {
-	// Try using osx-cpu-temp if installed
-	cmd := exec.Command("osx-cpu-temp")
-	output, err := cmd.Output()
+// temperatureFromOsxCPUTemp runs osx-cpu-temp, if installed
+func (m *MacSystemCollector) temperatureFromOsxCPUTemp() (float64, bool) {
+	output, err := exec.Command("osx-cpu-temp").Output()
 	if err != nil {
-		// Try alternative method using powermetrics
-		m.collectTemperatureViaPowermetrics()
-		return
+		return 0, false
 	}
 
 	// Parse output like "45.5°C"
 	tempStr := strings.TrimSpace(string(output))
 	tempStr = strings.TrimSuffix(tempStr, "°C")
 
-	if temp, err := strconv.ParseFloat(tempStr, 64); err == nil {
-		m.metrics.CPUTemperature.Set(temp)
-	}
+	temp, err := strconv.ParseFloat(tempStr, 64)
+	// osx-cpu-temp prints 0.0°C when it can't read the sensor, as on
+	// Apple Silicon
+	return temp, err == nil && temp > 0
 }
 
-func (m *MacSystemCollector) collectTemperatureViaPowermetrics() {
+// temperatureFromPowermetrics reads the SMC sampler, which needs
+// passwordless sudo
+func (m *MacSystemCollector) temperatureFromPowermetrics() (float64, bool) {
 	cmd := exec.Command("sudo", "-n", "powermetrics",
 		"--samplers", "smc",
 		"--sample-count", "1",
@@ -183,7 +215,7 @@ func (m *MacSystemCollector) collectTemperatureViaPowermetrics() {
 
 	output, err := cmd.Output()
 	if err != nil {
-		return
+		return 0, false
 	}
 
 	// Parse SMC output for temperature sensors
@@ -195,20 +227,26 @@ func (m *MacSystemCollector) collectTemperatureViaPowermetrics() {
 			for i, part := range parts {
 				if strings.Contains(part, "C") && i > 0 {
 					if temp, err := strconv.ParseFloat(parts[i-1], 64); err == nil {
-						m.metrics.CPUTemperature.Set(temp)
-						break
+						return temp, true
 					}
 				}
 			}
 		}
 	}
+	return 0, false
+}
+
+// temperatureFromHelper uses the cpu_temperature the metrics helper
+// reported this cycle
+func (m *MacSystemCollector) temperatureFromHelper() (float64, bool) {
+	return m.helperTemperature, m.helperTemperature > 0
 }
 
 func (m *MacSystemCollector) collectMemoryPressure() {
 	cmd := exec.Command("memory_pressure")
 	output, err := cmd.Output()
+	m.errLog.Report("collecting memory pressure", err)
 	if err != nil {
-		log.Printf("Error collecting memory pressure: %v", err)
 		return
 	}
 
@@ -235,33 +273,23 @@ func (m *MacSystemCollector) collectMemoryPressure() {
 func (m *MacSystemCollector) collectDiskIO() {
 	cmd := exec.Command("iostat", "-c", "1")
 	output, err := cmd.Output()
+	m.errLog.Report("collecting disk I/O", err)
 	if err != nil {
-		log.Printf("Error collecting disk I/O: %v", err)
 		return
 	}
 
-	// Parse iostat output
-	lines := strings.Split(string(output), "\n")
-	if len(lines) > 2 {
-		// Skip headers and get the data line
-		dataLine := lines[len(lines)-2]
-		fields := strings.Fields(dataLine)
-
-		if len(fields) >= 3 {
-			// KB/t (kilobytes per transfer)
-			if kbt, err := strconv.ParseFloat(fields[0], 64); err == nil {
-				m.metrics.DiskReadRate.Set(kbt * 1024) // Convert to bytes
-			}
+	// Parse iostat output, which has three columns per disk
+	sample, ok := parseIostat(string(output), m.opts.DiskDevice)
+	if !ok {
+		return
+	}
 
-			// tps (transfers per second)
-			if tps, err := strconv.ParseFloat(fields[1], 64); err == nil {
-				m.metrics.DiskIOPS.Set(tps)
-			}
+	// KB/t (kilobytes per transfer)
+	m.metrics.DiskReadRate.Set(sample.KBPerTransfer * 1024) // Convert to bytes
 
-			// MB/s
-			if mbs, err := strconv.ParseFloat(fields[2], 64); err == nil {
-				m.metrics.DiskWriteRate.Set(mbs * 1024 * 1024) // Convert to bytes/sec
-			}
-		}
-	}
+	// tps (transfers per second)
+	m.metrics.DiskIOPS.Set(sample.TransfersPerSec)
+
+	// MB/s
+	m.metrics.DiskWriteRate.Set(sample.MegabytesPerSec * 1024 * 1024) // Convert to bytes/sec
 }
\ No newline at end of file
@@ -11,7 +11,8 @@ import (
 	"time"
 )
 
-// MacMetricsResponse represents the response from mac_metrics_helper.py
+// MacMetricsResponse represents the response from mac_metrics_helper.py.
+// Power readings are in milliwatts, as powermetrics reports them.
 type MacMetricsResponse struct {
 	GPUUtilization  float64 `json:"gpu_utilization"`
 	GPUPower        float64 `json:"gpu_power"`
@@ -57,35 +58,19 @@ func (m *MacSystemCollector) fetchMacMetricsFromHelper() {
 	}
 
 	if metrics.GPUPower > 0 {
-		m.metrics.GPUPower.Set(metrics.GPUPower)
+		m.metrics.GPUPower.Set(milliwattsToWatts(metrics.GPUPower))
 	}
 
 	if metrics.CPUPower > 0 {
-		m.metrics.CPUPower.Set(metrics.CPUPower)
+		m.metrics.CPUPower.Set(milliwattsToWatts(metrics.CPUPower))
 	}
 
-	if metrics.CPUTemperature > 0 {
-		m.metrics.CPUTemperature.Set(metrics.CPUTemperature)
-	}
+	// Set by collectTemperature, which prefers other sources
+	m.helperTemperature = metrics.CPUTemperature
 
 	if metrics.MemoryPressure > 0 {
 		m.metrics.MemoryPressure.Set(metrics.MemoryPressure)
 	}
 
-	// Set thermal pressure as a label metric
-	thermalValue := 0.0
-	switch metrics.ThermalPressure {
-	case "nominal":
-		thermalValue = 0.0
-	case "fair":
-		thermalValue = 0.33
-	case "serious":
-		thermalValue = 0.66
-	case "critical":
-		thermalValue = 1.0
-	}
-
-	// For simplicity, we can use memory pressure gauge to represent thermal pressure
-	// In a real implementation, you'd create a separate metric
-	_ = thermalValue // Placeholder
+	m.metrics.RecordThermalPressure(metrics.ThermalPressure)
 }
\ No newline at end of file
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/atyronesmith/llama-metrics/proxy/internal/models"
@@ -22,8 +24,12 @@ type Collector struct {
 	GeneratedTokens *prometheus.CounterVec
 	TokensPerSecond *prometheus.HistogramVec
 
+	// Tokens/sec of the most recent request per model
+	LastTokensPerSecond *prometheus.GaugeVec
+
 	// Performance metrics
 	TimeToFirstToken  *prometheus.HistogramVec
+	InterTokenLatency *prometheus.HistogramVec
 	ModelLoadDuration *prometheus.HistogramVec
 
 	// Error tracking
@@ -32,7 +38,12 @@ type Collector struct {
 	// System metrics
 	CPUUsage    prometheus.Gauge
 	MemoryUsage prometheus.Gauge
+	// OllamaCPUUsage is the Ollama processes' CPU use as a percentage of
+	// one core, so it exceeds 100 when Ollama uses several cores
+	OllamaCPUUsage     prometheus.Gauge
 	OllamaServeMemory prometheus.Gauge
+	OllamaRunnerMemory *prometheus.GaugeVec
+	ModelMemory        *prometheus.GaugeVec
 
 	// Queue metrics
 	QueueSize            prometheus.Gauge
@@ -41,13 +52,24 @@ type Collector struct {
 	QueuePeakSize        prometheus.Gauge
 	QueueHighPriorityCount    prometheus.Gauge
 	QueueNormalPriorityCount  prometheus.Gauge
-	QueueHighPriorityWaitTime prometheus.Histogram
-	QueueNormalPriorityWaitTime prometheus.Histogram
+	QueueHighPriorityWaitTime *prometheus.HistogramVec
+	QueueNormalPriorityWaitTime *prometheus.HistogramVec
+	QueueStalled         prometheus.Gauge
+	UserQueued           *prometheus.GaugeVec
+	WorkerBusy           prometheus.Gauge
+	WorkersStuck         prometheus.Gauge
+
+	// Busy execution slots as a fraction of MaxConcurrency
+	ConcurrencySaturation prometheus.Gauge
+
+	// Service-neutral queue metrics, registered only by EnableSharedQueueMetrics
+	SharedQueueSize     *prometheus.GaugeVec
+	SharedQueueWaitTime *prometheus.HistogramVec
 
 	// Context length
 	ContextLength *prometheus.HistogramVec
 
-	// Mac-specific metrics
+	// Mac-specific metrics; power is in watts
 	GPUUtilization prometheus.Gauge
 	GPUPower       prometheus.Gauge
 	CPUPower       prometheus.Gauge
@@ -57,17 +79,85 @@ type Collector struct {
 	DiskWriteRate  prometheus.Gauge
 	DiskIOPS       prometheus.Gauge
 
+	// ThermalPressure is macOS thermal pressure from 0 (nominal) to 1
+	// (critical); ThermalPressureState is 1 for the current state only
+	ThermalPressure      prometheus.Gauge
+	ThermalPressureState *prometheus.GaugeVec
+
 	// Enhanced AI metrics
 	RequestID        *prometheus.CounterVec
 	UserRequests     *prometheus.CounterVec
 	TokenCost        *prometheus.CounterVec
 	RequestSizeByte  *prometheus.HistogramVec
 	ResponseSizeByte *prometheus.HistogramVec
+
+	// Token cost split by token type; TokenCost is their sum
+	PromptTokenCost     *prometheus.CounterVec
+	CompletionTokenCost *prometheus.CounterVec
+
+	// Embedding metrics
+	EmbeddingBatchSize *prometheus.HistogramVec
+
+	// Streaming fan-out metrics
+	StreamFanOutSubscribers *prometheus.CounterVec
+
+	// Streams abandoned by the client before they finished
+	ClientDisconnects *prometheus.CounterVec
+
+	// Content filter metrics
+	ContentFiltered *prometheus.CounterVec
+
+	// Background model pulls
+	ModelPulls *prometheus.CounterVec
+
+	// Model loads started while another model was loaded
+	ModelSwaps *prometheus.CounterVec
+
+	// Request IDs that were already used recently
+	DuplicateRequestIDs *prometheus.CounterVec
+
+	// Upstream requests retried after transient failures
+	Retries *prometheus.CounterVec
+
+	// Circuit breaker state per backend (0=closed, 1=open, 2=half-open)
+	CircuitState *prometheus.GaugeVec
+
+	// Requests routed to each Ollama backend
+	BackendRequests       *prometheus.CounterVec
+	BackendActiveRequests *prometheus.GaugeVec
+
+	// Per-API-key usage, labeled by key ID (never the secret)
+	APIKeyRequests *prometheus.CounterVec
+	APIKeyTokens   *prometheus.CounterVec
+	APIKeyRejected *prometheus.CounterVec
+
+	// Token prices in cents per 1,000 tokens, by model and token type
+	TokenPrice *prometheus.GaugeVec
+
+	// pricing prices requests for TokenCost; set with SetPricing
+	pricing Pricing
+
+	// minRateTokens is the fewest generated tokens observed into TokensPerSecond
+	minRateTokens int
+}
+
+// SetConstLabels adds labels to every metric registered from now on, which
+// includes all of a Collector's metrics when called before NewCollector.
+// The Go runtime and process metrics registered at startup are unaffected.
+func SetConstLabels(labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	prometheus.DefaultRegisterer = prometheus.WrapRegistererWith(labels, prometheus.DefaultRegisterer)
 }
 
-// NewCollector creates and registers all Prometheus metrics
-func NewCollector() *Collector {
-	return &Collector{
+// NewCollector creates and registers all Prometheus metrics. Responses with
+// fewer than minRateTokens generated tokens are left out of the tokens/sec
+// histogram.
+func NewCollector(minRateTokens int) *Collector {
+	c := &Collector{
+		minRateTokens: minRateTokens,
+
 		RequestCount: promauto.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "ollama_proxy_requests_total",
@@ -130,12 +220,20 @@ func NewCollector() *Collector {
 		TokensPerSecond: promauto.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "ollama_proxy_tokens_per_second",
-				Help:    "Tokens generated per second",
+				Help:    fmt.Sprintf("Tokens generated per second (responses under %d generated tokens are not observed)", minRateTokens),
 				Buckets: []float64{10, 50, 100, 200, 500, 1000, 2000},
 			},
 			[]string{"model"},
 		),
 
+		LastTokensPerSecond: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "ollama_proxy_last_tokens_per_second",
+				Help: "Tokens generated per second by the most recent request for the model",
+			},
+			[]string{"model"},
+		),
+
 		TimeToFirstToken: promauto.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "ollama_proxy_time_to_first_token_seconds",
@@ -145,6 +243,15 @@ func NewCollector() *Collector {
 			[]string{"model"},
 		),
 
+		InterTokenLatency: promauto.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "ollama_proxy_inter_token_latency_seconds",
+				Help:    "Time between consecutive streamed chunks with content, in seconds",
+				Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5},
+			},
+			[]string{"model"},
+		),
+
 		ModelLoadDuration: promauto.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "ollama_proxy_model_load_duration_seconds",
@@ -169,6 +276,13 @@ func NewCollector() *Collector {
 			},
 		),
 
+		OllamaCPUUsage: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "ollama_proxy_ollama_cpu_percent",
+				Help: "CPU used by the Ollama serve and runner processes, as a percentage of one core",
+			},
+		),
+
 		MemoryUsage: promauto.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "ollama_proxy_memory_usage_bytes",
@@ -183,6 +297,22 @@ func NewCollector() *Collector {
 			},
 		),
 
+		OllamaRunnerMemory: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "ollama_proxy_ollama_runner_memory_bytes",
+				Help: "Memory usage of the largest Ollama model runner processes in bytes (RSS), by pid and model blob",
+			},
+			[]string{"pid", "model"},
+		),
+
+		ModelMemory: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "ollama_proxy_model_memory_bytes",
+				Help: "Memory usage of Ollama model runners in bytes (RSS), summed per model name",
+			},
+			[]string{"model"},
+		),
+
 		QueueSize: promauto.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "ollama_proxy_queue_size",
@@ -227,20 +357,50 @@ func NewCollector() *Collector {
 			},
 		),
 
-		QueueHighPriorityWaitTime: promauto.NewHistogram(
+		QueueHighPriorityWaitTime: promauto.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "ollama_proxy_queue_high_priority_wait_time_seconds",
 				Help:    "Time spent waiting in high priority queue before processing",
 				Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1.0, 2.0, 5.0, 10.0, 30.0},
 			},
+			nil,
 		),
 
-		QueueNormalPriorityWaitTime: promauto.NewHistogram(
+		QueueNormalPriorityWaitTime: promauto.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "ollama_proxy_queue_normal_priority_wait_time_seconds",
 				Help:    "Time spent waiting in normal priority queue before processing",
 				Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1.0, 2.0, 5.0, 10.0, 30.0},
 			},
+			nil,
+		),
+
+		QueueStalled: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "ollama_proxy_queue_stalled",
+				Help: "1 if requests are queued but none have been processed within the stall timeout",
+			},
+		),
+
+		WorkerBusy: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "ollama_proxy_worker_busy",
+				Help: "Queue execution slots currently processing a request",
+			},
+		),
+
+		ConcurrencySaturation: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "ollama_proxy_concurrency_saturation",
+				Help: "Busy queue execution slots divided by MAX_CONCURRENCY (1 means every slot is in use)",
+			},
+		),
+
+		WorkersStuck: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "ollama_proxy_workers_stuck",
+				Help: "Queue execution slots processing the same request for longer than the stuck threshold",
+			},
 		),
 
 		ContextLength: promauto.NewHistogramVec(
@@ -262,15 +422,15 @@ func NewCollector() *Collector {
 
 		GPUPower: promauto.NewGauge(
 			prometheus.GaugeOpts{
-				Name: "ollama_proxy_gpu_power_milliwatts",
-				Help: "GPU power consumption in milliwatts",
+				Name: "ollama_proxy_gpu_power_watts",
+				Help: "GPU power consumption in watts",
 			},
 		),
 
 		CPUPower: promauto.NewGauge(
 			prometheus.GaugeOpts{
-				Name: "ollama_proxy_cpu_power_milliwatts",
-				Help: "CPU package power consumption in milliwatts",
+				Name: "ollama_proxy_cpu_power_watts",
+				Help: "CPU package power consumption in watts",
 			},
 		),
 
@@ -288,6 +448,21 @@ func NewCollector() *Collector {
 			},
 		),
 
+		ThermalPressure: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "ollama_proxy_thermal_pressure",
+				Help: "macOS thermal pressure: 0 nominal, 0.33 fair, 0.66 serious, 1 critical",
+			},
+		),
+
+		ThermalPressureState: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "ollama_proxy_thermal_pressure_state",
+				Help: "macOS thermal pressure state; 1 for the current state, 0 for the others",
+			},
+			[]string{"state"},
+		),
+
 		DiskReadRate: promauto.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "ollama_proxy_disk_read_bytes_per_second",
@@ -334,6 +509,22 @@ func NewCollector() *Collector {
 			[]string{"model", "user"},
 		),
 
+		PromptTokenCost: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ollama_proxy_prompt_token_cost_total",
+				Help: "Estimated cost of prompt tokens in cents",
+			},
+			[]string{"model", "user"},
+		),
+
+		CompletionTokenCost: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ollama_proxy_completion_token_cost_total",
+				Help: "Estimated cost of completion tokens in cents",
+			},
+			[]string{"model", "user"},
+		),
+
 		RequestSizeByte: promauto.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "ollama_proxy_request_size_bytes",
@@ -351,7 +542,139 @@ func NewCollector() *Collector {
 			},
 			[]string{"model", "endpoint"},
 		),
+
+		EmbeddingBatchSize: promauto.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "ollama_proxy_embedding_batch_size",
+				Help:    "Number of inputs per upstream embedding call (mode=batch uses /api/embed, mode=single uses /api/embeddings)",
+				Buckets: []float64{1, 2, 4, 8, 16, 32, 64, 128},
+			},
+			[]string{"model", "mode"},
+		),
+
+		StreamFanOutSubscribers: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ollama_proxy_stream_fanout_subscribers_total",
+				Help: "Streaming requests served from an identical in-flight generation instead of the upstream",
+			},
+			[]string{"model"},
+		),
+
+		ClientDisconnects: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ollama_proxy_client_disconnects_total",
+				Help: "Streaming requests whose client disconnected before the response finished",
+			},
+			[]string{"model"},
+		),
+
+		UserQueued: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "ollama_proxy_user_queued",
+				Help: "Requests queued or in flight per user (users with none are not reported)",
+			},
+			[]string{"user"},
+		),
+
+		ContentFiltered: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ollama_proxy_content_filtered_total",
+				Help: "Prompts and responses stopped or redacted by the content filter",
+			},
+			[]string{"model", "stage", "action"},
+		),
+
+		ModelPulls: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ollama_proxy_model_pulls_total",
+				Help: "Background pulls of missing models by outcome (started, success, error)",
+			},
+			[]string{"model", "status"},
+		),
+
+		ModelSwaps: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ollama_proxy_model_swaps_total",
+				Help: "Model loads started while another model was loaded, by model being loaded",
+			},
+			[]string{"model"},
+		),
+
+		DuplicateRequestIDs: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ollama_proxy_duplicate_request_id_total",
+				Help: "Requests whose request ID was already used recently",
+			},
+			nil,
+		),
+
+		Retries: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ollama_proxy_retries_total",
+				Help: "Upstream requests retried after a connection error or 5xx response",
+			},
+			[]string{"model", "reason"},
+		),
+
+		CircuitState: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "ollama_proxy_circuit_state",
+				Help: "Circuit breaker state for each Ollama backend (0=closed, 1=open, 2=half-open)",
+			},
+			[]string{"backend"},
+		),
+
+		BackendRequests: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ollama_proxy_backend_requests_total",
+				Help: "Upstream requests routed to each Ollama backend",
+			},
+			[]string{"backend"},
+		),
+
+		BackendActiveRequests: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "ollama_proxy_backend_active_requests",
+				Help: "Upstream requests in flight to each Ollama backend",
+			},
+			[]string{"backend"},
+		),
+
+		APIKeyRequests: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ollama_proxy_api_key_requests_total",
+				Help: "Requests per API key by response status",
+			},
+			[]string{"key_id", "status"},
+		),
+
+		APIKeyTokens: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ollama_proxy_api_key_tokens_total",
+				Help: "Prompt plus generated tokens per API key",
+			},
+			[]string{"key_id"},
+		),
+
+		APIKeyRejected: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ollama_proxy_api_key_rejected_total",
+				Help: "Requests rejected by API key policy (unauthorized, rate_limit, token_budget, model_not_allowed)",
+			},
+			[]string{"key_id", "reason"},
+		),
+
+		TokenPrice: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "ollama_proxy_token_price_cents",
+				Help: "Token price used for ollama_proxy_token_cost_total, in cents per 1,000 tokens, by model (\"default\" for unlisted models) and type (prompt, completion)",
+			},
+			[]string{"model", "type"},
+		),
 	}
+	c.initUnlabeled()
+	c.SetPricing(DefaultPricing())
+	return c
 }
 
 // RecordRequest records metrics for a request
@@ -367,13 +690,39 @@ func (c *Collector) RecordRequestWithPriority(method, endpoint, model, status st
 	c.RequestDuration.WithLabelValues(method, endpoint, model).Observe(duration.Seconds())
 
 	// Record priority-specific latencies
-	if priority == 1 { // High priority
+	if priority >= 1 { // High or critical priority
 		c.HighPriorityRequestDuration.WithLabelValues(method, endpoint, model).Observe(duration.Seconds())
 	} else { // Normal priority
 		c.NormalPriorityRequestDuration.WithLabelValues(method, endpoint, model).Observe(duration.Seconds())
 	}
 }
 
+// thermalPressureLevels maps the macOS thermal pressure states to the
+// ollama_proxy_thermal_pressure scale
+var thermalPressureLevels = map[string]float64{
+	"nominal":  0.0,
+	"fair":     0.33,
+	"serious":  0.66,
+	"critical": 1.0,
+}
+
+// RecordThermalPressure records a macOS thermal pressure state such as
+// "serious". Unknown states are ignored.
+func (c *Collector) RecordThermalPressure(state string) {
+	level, ok := thermalPressureLevels[state]
+	if !ok {
+		return
+	}
+	c.ThermalPressure.Set(level)
+	for s := range thermalPressureLevels {
+		current := 0.0
+		if s == state {
+			current = 1.0
+		}
+		c.ThermalPressureState.WithLabelValues(s).Set(current)
+	}
+}
+
 // RecordTokens records token metrics from a response
 func (c *Collector) RecordTokens(model string, promptTokens, generatedTokens int, tokensPerSec float64) {
 	if promptTokens > 0 {
@@ -385,8 +734,10 @@ func (c *Collector) RecordTokens(model string, promptTokens, generatedTokens int
 		c.GeneratedTokens.WithLabelValues(model).Add(float64(generatedTokens))
 	}
 
-	if tokensPerSec > 0 {
+	// Rates from very short generations are mostly noise
+	if tokensPerSec > 0 && generatedTokens >= c.minRateTokens {
 		c.TokensPerSecond.WithLabelValues(model).Observe(tokensPerSec)
+		c.LastTokensPerSecond.WithLabelValues(model).Set(tokensPerSec)
 	}
 }
 
@@ -395,6 +746,11 @@ func (c *Collector) RecordModelLoadTime(model string, duration time.Duration) {
 	c.ModelLoadDuration.WithLabelValues(model).Observe(duration.Seconds())
 }
 
+// RecordInterTokenLatency records the gap between two streamed tokens
+func (c *Collector) RecordInterTokenLatency(model string, gap time.Duration) {
+	c.InterTokenLatency.WithLabelValues(model).Observe(gap.Seconds())
+}
+
 // RecordTimeToFirstToken records the time to first token
 func (c *Collector) RecordTimeToFirstToken(model string, duration time.Duration) {
 	c.TimeToFirstToken.WithLabelValues(model).Observe(duration.Seconds())
@@ -430,11 +786,12 @@ func (c *Collector) RecordRequestMetadata(metadata models.RequestMetadata) {
 		c.UserRequests.WithLabelValues(metadata.User, metadata.Model, metadata.Endpoint).Inc()
 	}
 
-	// Estimate and record token cost (example pricing)
-	costPerToken := c.getTokenCost(metadata.Model)
-	totalCost := float64(metadata.TotalTokens) * costPerToken
-	if totalCost > 0 && metadata.User != "" {
+	// Estimate and record token cost; the total is kept for existing dashboards
+	promptCost, completionCost := c.pricing.Cost(metadata.Model, metadata.PromptTokens, metadata.CompletionTokens)
+	if totalCost := promptCost + completionCost; totalCost > 0 && metadata.User != "" {
 		c.TokenCost.WithLabelValues(metadata.Model, metadata.User).Add(totalCost)
+		c.PromptTokenCost.WithLabelValues(metadata.Model, metadata.User).Add(promptCost)
+		c.CompletionTokenCost.WithLabelValues(metadata.Model, metadata.User).Add(completionCost)
 	}
 }
 
@@ -448,6 +805,104 @@ func (c *Collector) RecordResponseSize(model, endpoint string, sizeBytes int) {
 	c.ResponseSizeByte.WithLabelValues(model, endpoint).Observe(float64(sizeBytes))
 }
 
+// RecordEmbeddingBatch records a single upstream embedding call
+func (c *Collector) RecordEmbeddingBatch(model, mode string, size int) {
+	c.EmbeddingBatchSize.WithLabelValues(model, mode).Observe(float64(size))
+}
+
+// RecordStreamFanOut records a streaming request attached to a shared generation
+func (c *Collector) RecordStreamFanOut(model string) {
+	c.StreamFanOutSubscribers.WithLabelValues(model).Inc()
+}
+
+// RecordClientDisconnect records a client that went away mid-stream
+func (c *Collector) RecordClientDisconnect(model string) {
+	c.ClientDisconnects.WithLabelValues(model).Inc()
+}
+
+// RecordContentFiltered records a content filter decision at the prompt or response stage
+func (c *Collector) RecordContentFiltered(model, stage, action string) {
+	c.ContentFiltered.WithLabelValues(model, stage, action).Inc()
+}
+
+// RecordModelPull records a background model pull starting or finishing
+func (c *Collector) RecordModelPull(model, status string) {
+	c.ModelPulls.WithLabelValues(model, status).Inc()
+}
+
+// RecordModelSwap records a model load that displaces or competes with a loaded model
+func (c *Collector) RecordModelSwap(model string) {
+	c.ModelSwaps.WithLabelValues(model).Inc()
+}
+
+// RecordDuplicateRequestID records a reused request ID
+func (c *Collector) RecordDuplicateRequestID() {
+	c.DuplicateRequestIDs.WithLabelValues().Inc()
+}
+
+// RecordRetry records an upstream request retried for the given reason
+func (c *Collector) RecordRetry(model, reason string) {
+	c.Retries.WithLabelValues(model, reason).Inc()
+}
+
+// RecordBackendRequest counts a request routed to a backend
+func (c *Collector) RecordBackendRequest(backend string) {
+	c.BackendRequests.WithLabelValues(backend).Inc()
+}
+
+// RecordAPIKeyUsage records a completed request and its tokens for an API key
+func (c *Collector) RecordAPIKeyUsage(keyID string, status, tokens int) {
+	c.APIKeyRequests.WithLabelValues(keyID, strconv.Itoa(status)).Inc()
+	if tokens > 0 {
+		c.APIKeyTokens.WithLabelValues(keyID).Add(float64(tokens))
+	}
+}
+
+// RecordAPIKeyRejected records a request rejected by API key policy
+func (c *Collector) RecordAPIKeyRejected(keyID, reason string) {
+	c.APIKeyRejected.WithLabelValues(keyID, reason).Inc()
+}
+
+// sharedQueueService is the service label on the service-neutral queue metrics
+const sharedQueueService = "ollama-proxy"
+
+// EnableSharedQueueMetrics registers the service-neutral queue_size and
+// queue_wait_time_seconds metrics, labeled by service and queue_name, so a
+// generic queue dashboard can cover this service. They duplicate the
+// ollama_proxy_queue_* series and are off unless enabled.
+func (c *Collector) EnableSharedQueueMetrics() {
+	c.SharedQueueSize = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "queue_size",
+			Help: "Current number of requests waiting in a queue",
+		},
+		[]string{"service", "queue_name"},
+	)
+
+	c.SharedQueueWaitTime = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "queue_wait_time_seconds",
+			Help:    "Time requests spend waiting in a queue before processing",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1.0, 2.0, 5.0, 10.0, 30.0},
+		},
+		[]string{"service", "queue_name"},
+	)
+}
+
+// RecordSharedQueueSize sets the service-neutral size of a queue, if enabled
+func (c *Collector) RecordSharedQueueSize(queueName string, size int) {
+	if c.SharedQueueSize != nil {
+		c.SharedQueueSize.WithLabelValues(sharedQueueService, queueName).Set(float64(size))
+	}
+}
+
+// RecordSharedQueueWaitTime records the service-neutral wait time of a queue, if enabled
+func (c *Collector) RecordSharedQueueWaitTime(queueName string, duration time.Duration) {
+	if c.SharedQueueWaitTime != nil {
+		c.SharedQueueWaitTime.WithLabelValues(sharedQueueService, queueName).Observe(duration.Seconds())
+	}
+}
+
 // RecordQueueWaitTime records the time a request spent in the queue
 func (c *Collector) RecordQueueWaitTime(model string, duration time.Duration) {
 	c.QueueWaitTime.WithLabelValues(model).Observe(duration.Seconds())
@@ -458,24 +913,11 @@ func (c *Collector) RecordQueueProcessingRate(rate float64) {
 	c.QueueProcessingRate.Set(rate)
 }
 
-// getTokenCost returns the cost per token in cents for a given model
-func (c *Collector) getTokenCost(model string) float64 {
-	// Example pricing in cents per 1000 tokens
-	// These are example prices - adjust based on your actual costs
-	costPer1000Tokens := map[string]float64{
-		"llama2:7b":          0.01,   // $0.0001 per 1K tokens
-		"llama2:13b":         0.02,   // $0.0002 per 1K tokens
-		"llama2:70b":         0.10,   // $0.001 per 1K tokens
-		"codellama:7b":       0.01,   // $0.0001 per 1K tokens
-		"mistral:7b":         0.01,   // $0.0001 per 1K tokens
-		"mixtral:8x7b":       0.05,   // $0.0005 per 1K tokens
-		"nomic-embed-text":   0.005,  // $0.00005 per 1K tokens
-	}
-
-	if cost, ok := costPer1000Tokens[model]; ok {
-		return cost / 1000.0 // Convert to cost per token
+// RecordQueueStalled records whether the queue is stalled
+func (c *Collector) RecordQueueStalled(stalled bool) {
+	if stalled {
+		c.QueueStalled.Set(1)
+	} else {
+		c.QueueStalled.Set(0)
 	}
-
-	// Default cost for unknown models
-	return 0.01 / 1000.0
-}
\ No newline at end of file
+}
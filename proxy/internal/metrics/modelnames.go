@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// modelLayerType is the manifest layer holding a model's weights, the blob a
+// runner loads
+const modelLayerType = "application/vnd.ollama.image.model"
+
+// manifestRescanInterval limits how often a models directory is rescanned
+// for a blob no manifest named, e.g. one pulled since the last scan
+const manifestRescanInterval = time.Minute
+
+// modelNames resolves runner model blobs to model names such as
+// "llama2:7b" by reading the manifests next to the blobs. It is used from
+// the system collector's goroutine only.
+type modelNames struct {
+	byBlob  map[string]string    // blob file name -> model name
+	scanned map[string]time.Time // models directory -> last scan
+}
+
+func newModelNames() *modelNames {
+	return &modelNames{
+		byBlob:  make(map[string]string),
+		scanned: make(map[string]time.Time),
+	}
+}
+
+// lookup names the model whose weights are the blob at blobPath, e.g.
+// ~/.ollama/models/blobs/sha256-<digest>, or returns "unknown"
+func (n *modelNames) lookup(blobPath string) string {
+	if blobPath == "" {
+		return "unknown"
+	}
+	blob := filepath.Base(blobPath)
+	if name, ok := n.byBlob[blob]; ok {
+		return name
+	}
+
+	// Blobs live in <models>/blobs and manifests in <models>/manifests
+	root := filepath.Dir(filepath.Dir(blobPath))
+	if time.Since(n.scanned[root]) >= manifestRescanInterval {
+		n.scanned[root] = time.Now()
+		n.scan(filepath.Join(root, "manifests"))
+		if name, ok := n.byBlob[blob]; ok {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// scan records the model blob of every manifest under dir, laid out as
+// <host>/<namespace>/<model>/<tag>. When several names share a blob the
+// first in lexical order wins.
+func (n *modelNames) scan(dir string) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
+		}
+		name := manifestModelName(strings.Split(filepath.ToSlash(rel), "/"))
+		if name == "" {
+			return nil
+		}
+		blob := manifestModelBlob(path)
+		if _, seen := n.byBlob[blob]; blob != "" && !seen {
+			n.byBlob[blob] = name
+		}
+		return nil
+	})
+}
+
+// manifestModelName turns a manifest path into the name Ollama shows:
+// library models drop the registry and namespace, other models on the
+// default registry keep the namespace, and other registries keep all three
+func manifestModelName(parts []string) string {
+	if len(parts) != 4 {
+		return ""
+	}
+	host, namespace, model, tag := parts[0], parts[1], parts[2], parts[3]
+	switch {
+	case host == "registry.ollama.ai" && namespace == "library":
+		return model + ":" + tag
+	case host == "registry.ollama.ai":
+		return namespace + "/" + model + ":" + tag
+	default:
+		return host + "/" + namespace + "/" + model + ":" + tag
+	}
+}
+
+// manifestModelBlob returns the blob file name, sha256-<digest>, of a
+// manifest's model layer
+func manifestModelBlob(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var manifest struct {
+		Layers []struct {
+			MediaType string `json:"mediaType"`
+			Digest    string `json:"digest"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return ""
+	}
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == modelLayerType {
+			return strings.Replace(layer.Digest, ":", "-", 1)
+		}
+	}
+	return ""
+}
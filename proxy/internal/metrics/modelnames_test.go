@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const (
+	llamaDigest   = "sha256-8934d96d3f08982e95922b2b7a2c626a1fe873d7c3b06e8e56d7bc0a1fef9246"
+	mistralDigest = "sha256-f5074b1221da0f5a2910d33b642efa5b9eb58cfdddca1c79e16d7ad28aa2b31f"
+	privateDigest = "sha256-3a43f93b78ec50f7c4e4dc8bd1cb3fff5a900e7d574c51a6f7495e48486e0dac"
+	orphanDigest  = "sha256-0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+// writeManifest writes an Ollama manifest whose model layer is blob under
+// <models>/manifests/<name>
+func writeManifest(t *testing.T, models, name, blob string) {
+	t.Helper()
+	digest := strings.Replace(blob, "-", ":", 1)
+	manifest := `{"schemaVersion":2,"layers":[
+		{"mediaType":"application/vnd.ollama.image.template","digest":"sha256:aaaa"},
+		{"mediaType":"application/vnd.ollama.image.model","digest":"` + digest + `","size":3825819519}]}`
+
+	path := filepath.Join(models, "manifests", filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testModelsDir lays out a models directory with a library model, a
+// namespaced model and a model from another registry. The orphan blob is
+// named only by a manifest outside the expected layout.
+func testModelsDir(t *testing.T) string {
+	t.Helper()
+	models := t.TempDir()
+	writeManifest(t, models, "registry.ollama.ai/library/llama2/7b", llamaDigest)
+	writeManifest(t, models, "registry.ollama.ai/jmorgan/mistral/latest", mistralDigest)
+	writeManifest(t, models, "registry.example.com/team/private/v1", privateDigest)
+	// Not <host>/<namespace>/<model>/<tag>, so ignored
+	writeManifest(t, models, "registry.ollama.ai/library/stray", orphanDigest)
+	return models
+}
+
+func TestManifestModelName(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		want string
+	}{
+		{"registry.ollama.ai/library/llama2/7b", "llama2:7b"},
+		{"registry.ollama.ai/jmorgan/mistral/latest", "jmorgan/mistral:latest"},
+		{"registry.example.com/team/private/v1", "registry.example.com/team/private:v1"},
+		{"registry.ollama.ai/library/llama2", ""},
+		{"extra/registry.ollama.ai/library/llama2/7b", ""},
+	} {
+		if got := manifestModelName(strings.Split(tc.path, "/")); got != tc.want {
+			t.Errorf("manifestModelName(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestManifestModelBlob(t *testing.T) {
+	models := testModelsDir(t)
+	if got := manifestModelBlob(filepath.Join(models, "manifests", "registry.ollama.ai", "library", "llama2", "7b")); got != llamaDigest {
+		t.Errorf("manifestModelBlob() = %q, want %q", got, llamaDigest)
+	}
+
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"no model layer": `{"layers":[{"mediaType":"application/vnd.ollama.image.template","digest":"sha256:aaaa"}]}`,
+		"not json":       `not a manifest`,
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-"))
+		os.WriteFile(path, []byte(contents), 0o644)
+		if got := manifestModelBlob(path); got != "" {
+			t.Errorf("%s: manifestModelBlob() = %q, want \"\"", name, got)
+		}
+	}
+	if got := manifestModelBlob(filepath.Join(dir, "missing")); got != "" {
+		t.Errorf("missing file: manifestModelBlob() = %q, want \"\"", got)
+	}
+}
+
+func TestModelNamesLookup(t *testing.T) {
+	models := testModelsDir(t)
+	names := newModelNames()
+	blob := func(digest string) string { return filepath.Join(models, "blobs", digest) }
+
+	for _, tc := range []struct {
+		blobPath string
+		want     string
+	}{
+		{blob(llamaDigest), "llama2:7b"},
+		{blob(mistralDigest), "jmorgan/mistral:latest"},
+		{blob(privateDigest), "registry.example.com/team/private:v1"},
+		{blob(orphanDigest), "unknown"},
+		{"", "unknown"},
+	} {
+		if got := names.lookup(tc.blobPath); got != tc.want {
+			t.Errorf("lookup(%q) = %q, want %q", tc.blobPath, got, tc.want)
+		}
+	}
+
+	// A model pulled after the scan is found once the rescan interval has
+	// passed, not before
+	const newDigest = "sha256-1111111111111111111111111111111111111111111111111111111111111111"
+	writeManifest(t, models, "registry.ollama.ai/library/phi3/mini", newDigest)
+	if got := names.lookup(blob(newDigest)); got != "unknown" {
+		t.Errorf("lookup() right after a scan = %q, want \"unknown\"", got)
+	}
+	names.scanned[models] = names.scanned[models].Add(-manifestRescanInterval)
+	if got := names.lookup(blob(newDigest)); got != "phi3:mini" {
+		t.Errorf("lookup() after the rescan interval = %q, want \"phi3:mini\"", got)
+	}
+}
+
+func TestRunnerCmdline(t *testing.T) {
+	const blobPath = "/Users/me/.ollama/models/blobs/" + llamaDigest
+	for _, tc := range []struct {
+		name       string
+		args       []string
+		wantRunner bool
+		wantPath   string
+		wantModel  string
+	}{
+		{"current runner", []string{"/usr/local/bin/ollama", "runner", "--model", blobPath, "--ctx-size", "8192", "--port", "53219"},
+			true, blobPath, "sha256-8934d96d3f08"},
+		{"model with equals", []string{"/usr/local/bin/ollama", "runner", "--model=" + blobPath},
+			true, blobPath, "sha256-8934d96d3f08"},
+		{"legacy server", []string{"/tmp/ollama123/runners/metal/ollama_llama_server", "--model", blobPath},
+			true, blobPath, "sha256-8934d96d3f08"},
+		{"runner without a model", []string{"/usr/local/bin/ollama", "runner"},
+			true, "", "unknown"},
+		{"model flag without a value", []string{"/usr/local/bin/ollama", "runner", "--model"},
+			true, "", "unknown"},
+		{"serve", []string{"/usr/local/bin/ollama", "serve"},
+			false, "", "unknown"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isRunnerCmdline(tc.args); got != tc.wantRunner {
+				t.Errorf("isRunnerCmdline() = %v, want %v", got, tc.wantRunner)
+			}
+			if got := runnerModelPath(tc.args); got != tc.wantPath {
+				t.Errorf("runnerModelPath() = %q, want %q", got, tc.wantPath)
+			}
+			if got := runnerModel(tc.args); got != tc.wantModel {
+				t.Errorf("runnerModel() = %q, want %q", got, tc.wantModel)
+			}
+		})
+	}
+}
+
+func TestSetModelMemoryBucketsUnknownRunners(t *testing.T) {
+	models := testModelsDir(t)
+	names := newModelNames()
+	runner := func(pid int32, digest string, rss uint64) runnerMemory {
+		args := []string{"ollama", "runner", "--model", filepath.Join(models, "blobs", digest)}
+		return runnerMemory{pid: pid, model: runnerModel(args), name: names.lookup(runnerModelPath(args)), rss: rss}
+	}
+
+	s := &SystemCollector{metrics: testCollector()}
+	s.setModelMemory([]runnerMemory{
+		runner(101, llamaDigest, 4000),
+		runner(102, llamaDigest, 1000),
+		runner(103, orphanDigest, 700),
+		{pid: 104, model: "unknown", name: names.lookup(""), rss: 300},
+	})
+
+	for model, want := range map[string]float64{
+		"llama2:7b": 5000,
+		"unknown":   1000,
+	} {
+		if got := testutil.ToFloat64(s.metrics.ModelMemory.WithLabelValues(model)); got != want {
+			t.Errorf(`ollama_proxy_model_memory_bytes{model=%q} = %v, want %v`, model, got, want)
+		}
+	}
+	if got := testutil.CollectAndCount(s.metrics.ModelMemory); got != 2 {
+		t.Errorf("%d model memory series, want 2", got)
+	}
+}
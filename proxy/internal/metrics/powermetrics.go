@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// powerSample holds the readings found in one powermetrics sample. Power is
+// in milliwatts, as parsePowerMilliwatts returns it; the has fields report
+// which readings were present.
+type powerSample struct {
+	gpuPower          float64
+	cpuPower          float64
+	gpuUtilization    float64
+	hasGPUPower       bool
+	hasCPUPower       bool
+	hasGPUUtilization bool
+}
+
+// parsePowerMetrics reads GPU power, CPU package power and GPU active
+// residency from powermetrics text output
+func parsePowerMetrics(output string) powerSample {
+	var sample powerSample
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Look for GPU Power line: "GPU Power: 7510 mW"
+		if strings.Contains(line, "GPU Power:") {
+			if power, ok := parsePowerMilliwatts(line); ok {
+				sample.gpuPower, sample.hasGPUPower = power, true
+			}
+		}
+
+		// Look for CPU/Package Power line. Intel Macs report it as
+		// "Intel energy model derived package power (CPUs+GT+SA): 1.63W"
+		lower := strings.ToLower(line)
+		if strings.Contains(lower, "cpu power:") || strings.Contains(lower, "package power") {
+			if power, ok := parsePowerMilliwatts(line); ok {
+				sample.cpuPower, sample.hasCPUPower = power, true
+			}
+		}
+
+		// Look for GPU active residency to calculate utilization
+		if strings.Contains(line, "GPU HW active residency:") {
+			// Extract percentage: "GPU HW active residency:  58.06% (389 MHz: 12% ...)"
+			if idx := strings.Index(line, ":"); idx != -1 {
+				percentStr := strings.TrimSpace(line[idx+1:])
+				// Remove any extra info in parentheses
+				if parenIdx := strings.Index(percentStr, "("); parenIdx != -1 {
+					percentStr = strings.TrimSpace(percentStr[:parenIdx])
+				}
+				percentStr = strings.TrimSuffix(percentStr, "%")
+				if util, err := strconv.ParseFloat(percentStr, 64); err == nil {
+					sample.gpuUtilization, sample.hasGPUUtilization = util, true
+				}
+			}
+		}
+	}
+	return sample
+}
+
+// milliwattsToWatts converts a powermetrics reading to the watts the power
+// gauges are exported in
+func milliwattsToWatts(milliwatts float64) float64 {
+	return milliwatts / 1000
+}
+
+// parsePowerMilliwatts extracts the power reading following the first ":"
+// in a powermetrics line, in milliwatts. macOS versions differ in spacing
+// and units: "GPU Power: 7510 mW", "GPU Power: 7510mW", "GPU Power:7510 mW"
+// and "GPU Power: 7.51 W" all parse. A bare number is taken as milliwatts.
+func parsePowerMilliwatts(line string) (float64, bool) {
+	idx := strings.Index(line, ":")
+	if idx == -1 {
+		return 0, false
+	}
+	value := strings.TrimSpace(line[idx+1:])
+
+	// Split the number from an adjacent or space-separated unit
+	end := 0
+	for end < len(value) && (value[end] >= '0' && value[end] <= '9' || value[end] == '.') {
+		end++
+	}
+	power, err := strconv.ParseFloat(value[:end], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	unit := strings.ToLower(strings.TrimSpace(value[end:]))
+	if fields := strings.Fields(unit); len(fields) > 0 {
+		unit = fields[0]
+	}
+	switch unit {
+	case "", "mw":
+		return power, true
+	case "w":
+		return power * 1000, true
+	default:
+		return 0, false
+	}
+}
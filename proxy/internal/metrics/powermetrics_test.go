@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// The collector registers with the default Prometheus registry, so the
+// tests share one
+var (
+	sharedCollector     *Collector
+	sharedCollectorOnce sync.Once
+)
+
+func testCollector() *Collector {
+	sharedCollectorOnce.Do(func() {
+		sharedCollector = NewCollector(5)
+	})
+	return sharedCollector
+}
+
+func TestParsePowerMilliwatts(t *testing.T) {
+	for _, tc := range []struct {
+		line   string
+		want   float64
+		wantOK bool
+	}{
+		{"GPU Power: 7510 mW", 7510, true},
+		{"GPU Power: 7510mW", 7510, true},
+		{"GPU Power:7510 mW", 7510, true},
+		{"GPU Power:7510mW", 7510, true},
+		{"CPU Power: 1234 mW", 1234, true},
+		{"GPU Power: 7.51 W", 7510, true},
+		{"GPU Power: 7.51W", 7510, true},
+		{"GPU Power: 7510", 7510, true},
+		{"GPU Power: 0 mW", 0, true},
+		{"GPU Power: 7510 mW (estimated)", 7510, true},
+		{"GPU Power: n/a", 0, false},
+		{"GPU Power: 7510 kW", 0, false},
+		{"GPU Power:", 0, false},
+		{"GPU Power 7510 mW", 0, false},
+	} {
+		t.Run(tc.line, func(t *testing.T) {
+			got, ok := parsePowerMilliwatts(tc.line)
+			if ok != tc.wantOK || got != tc.want {
+				t.Errorf("parsePowerMilliwatts(%q) = %v, %v; want %v, %v", tc.line, got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+// Trimmed from `powermetrics --samplers gpu_power,cpu_power` on an Apple
+// Silicon and an Intel Mac
+const (
+	appleSiliconSample = `**** Processor usage ****
+
+E-Cluster HW active frequency: 1054 MHz
+E-Cluster HW active residency:  42.14% (600 MHz:   0% 972 MHz:  59%)
+CPU 0 frequency: 1134 MHz
+CPU Power: 1234 mW
+GPU Power: 7510 mW
+ANE Power: 0 mW
+Combined Power (CPU + GPU + ANE): 8744 mW
+
+**** GPU usage ****
+
+GPU HW active frequency: 1296 MHz
+GPU HW active residency:  58.06% (389 MHz:   0% 486 MHz:   0% 1296 MHz:  58%)
+GPU SW requested state: (P1 :   0% P2 :   0% P3 : 100%)
+GPU idle residency:  41.94%
+GPU Power: 7510 mW
+`
+	intelSample = `**** Processor usage ****
+
+Intel energy model derived package power (CPUs+GT+SA): 1.63W
+
+System Average frequency as fraction of nominal: 68.41% (1573.51 Mhz)
+
+**** GPU usage ****
+
+GPU 0 name IntelIGPU
+GPU 0 active residency:   3.51%
+`
+)
+
+func TestParsePowerMetrics(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		output string
+		want   powerSample
+	}{
+		{"apple silicon", appleSiliconSample, powerSample{
+			gpuPower: 7510, hasGPUPower: true,
+			cpuPower: 1234, hasCPUPower: true,
+			gpuUtilization: 58.06, hasGPUUtilization: true,
+		}},
+		{"intel package power in watts", intelSample, powerSample{
+			cpuPower: 1630, hasCPUPower: true,
+		}},
+		{"watts with a space", "CPU Power: 1.5 W\nGPU Power: 2 W\n", powerSample{
+			cpuPower: 1500, hasCPUPower: true,
+			gpuPower: 2000, hasGPUPower: true,
+		}},
+		{"unreadable values", "CPU Power: n/a\nGPU Power: -\nGPU HW active residency: n/a\n", powerSample{}},
+		{"empty", "", powerSample{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := parsePowerMetrics(tc.output); got != tc.want {
+				t.Errorf("parsePowerMetrics() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestPowerGaugeUnits documents the units along the power path:
+// powermetrics and the helper report milliwatts, parsePowerMilliwatts
+// normalizes W readings to milliwatts, and the gauges are exported in watts
+func TestPowerGaugeUnits(t *testing.T) {
+	if got := milliwattsToWatts(7510); got != 7.51 {
+		t.Errorf("milliwattsToWatts(7510) = %v, want 7.51", got)
+	}
+
+	c := testCollector()
+	sample := parsePowerMetrics(appleSiliconSample)
+	for _, tc := range []struct {
+		name       string
+		gauge      prometheus.Gauge
+		milliwatts float64
+		wantWatts  float64
+	}{
+		{"ollama_proxy_gpu_power_watts", c.GPUPower, sample.gpuPower, 7.51},
+		{"ollama_proxy_cpu_power_watts", c.CPUPower, sample.cpuPower, 1.234},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			desc := tc.gauge.Desc().String()
+			if !strings.Contains(desc, `"`+tc.name+`"`) || !strings.Contains(desc, "in watts") {
+				t.Errorf("gauge %s, want %s documented in watts", desc, tc.name)
+			}
+
+			tc.gauge.Set(milliwattsToWatts(tc.milliwatts))
+			if got := testutil.ToFloat64(tc.gauge); got != tc.wantWatts {
+				t.Errorf("%s = %v after a %v mW reading, want %v", tc.name, got, tc.milliwatts, tc.wantWatts)
+			}
+		})
+	}
+}
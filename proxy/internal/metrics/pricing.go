@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultModelPrice is the built-in price, in cents per 1,000 tokens, of
+// models without one of their own
+const defaultModelPrice = 0.01
+
+// defaultModelPrices are example prices in cents per 1,000 tokens, used
+// when no pricing file is configured. Adjust them to your actual costs.
+var defaultModelPrices = map[string]float64{
+	"llama2:7b":        0.01,  // $0.0001 per 1K tokens
+	"llama2:13b":       0.02,  // $0.0002 per 1K tokens
+	"llama2:70b":       0.10,  // $0.001 per 1K tokens
+	"codellama:7b":     0.01,  // $0.0001 per 1K tokens
+	"mistral:7b":       0.01,  // $0.0001 per 1K tokens
+	"mixtral:8x7b":     0.05,  // $0.0005 per 1K tokens
+	"nomic-embed-text": 0.005, // $0.00005 per 1K tokens
+}
+
+// ModelPrice is a model's token price in cents per 1,000 tokens
+type ModelPrice struct {
+	Prompt     float64 `yaml:"prompt"`
+	Completion float64 `yaml:"completion"`
+}
+
+// Pricing holds the token prices used to estimate request cost. Default
+// applies to models not in Models.
+type Pricing struct {
+	Default ModelPrice
+	Models  map[string]ModelPrice
+}
+
+// DefaultPricing returns the built-in example prices, which charge prompt
+// and completion tokens alike
+func DefaultPricing() Pricing {
+	p := Pricing{
+		Default: ModelPrice{Prompt: defaultModelPrice, Completion: defaultModelPrice},
+		Models:  make(map[string]ModelPrice, len(defaultModelPrices)),
+	}
+	for model, price := range defaultModelPrices {
+		p.Models[model] = ModelPrice{Prompt: price, Completion: price}
+	}
+	return p
+}
+
+// LoadPricing reads token prices from a YAML or JSON file:
+//
+//	default: {prompt: 0.01, completion: 0.02}
+//	models:
+//	  llama3.1:8b: {prompt: 0.01, completion: 0.03}
+//
+// The file's models replace the built-in ones; without a default, the
+// built-in default is kept. Unknown keys and negative prices are errors.
+func LoadPricing(path string) (Pricing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Pricing{}, fmt.Errorf("failed to read pricing file: %w", err)
+	}
+
+	var file struct {
+		Default *ModelPrice           `yaml:"default"`
+		Models  map[string]ModelPrice `yaml:"models"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return Pricing{}, fmt.Errorf("pricing file %s: %w", path, err)
+	}
+
+	p := Pricing{
+		Default: DefaultPricing().Default,
+		Models:  make(map[string]ModelPrice, len(file.Models)),
+	}
+	if file.Default != nil {
+		if err := file.Default.validate(); err != nil {
+			return Pricing{}, fmt.Errorf("pricing file %s: default: %w", path, err)
+		}
+		p.Default = *file.Default
+	}
+	for model, price := range file.Models {
+		if model == "" {
+			return Pricing{}, fmt.Errorf("pricing file %s: empty model name", path)
+		}
+		if err := price.validate(); err != nil {
+			return Pricing{}, fmt.Errorf("pricing file %s: model %s: %w", path, model, err)
+		}
+		p.Models[model] = price
+	}
+	return p, nil
+}
+
+func (mp ModelPrice) validate() error {
+	if mp.Prompt < 0 || mp.Completion < 0 {
+		return fmt.Errorf("prices cannot be negative (prompt %v, completion %v)", mp.Prompt, mp.Completion)
+	}
+	return nil
+}
+
+// Price returns a model's price, or the default for unlisted models
+func (p Pricing) Price(model string) ModelPrice {
+	if price, ok := p.Models[model]; ok {
+		return price
+	}
+	return p.Default
+}
+
+// Cost returns the cost in cents of a request's prompt and completion
+// tokens
+func (p Pricing) Cost(model string, promptTokens, completionTokens int) (prompt, completion float64) {
+	price := p.Price(model)
+	return float64(promptTokens) * price.Prompt / 1000.0, float64(completionTokens) * price.Completion / 1000.0
+}
+
+// SetPricing replaces the token prices and republishes them in
+// ollama_proxy_token_price_cents. Call it before requests are served.
+func (c *Collector) SetPricing(p Pricing) {
+	c.pricing = p
+
+	c.TokenPrice.Reset()
+	c.TokenPrice.WithLabelValues("default", "prompt").Set(p.Default.Prompt)
+	c.TokenPrice.WithLabelValues("default", "completion").Set(p.Default.Completion)
+	for model, price := range p.Models {
+		c.TokenPrice.WithLabelValues(model, "prompt").Set(price.Prompt)
+		c.TokenPrice.WithLabelValues(model, "completion").Set(price.Completion)
+	}
+}
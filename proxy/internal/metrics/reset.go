@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// resettable is a metric family whose series can all be deleted at once
+type resettable interface {
+	Reset()
+}
+
+// cumulativeFamilies returns the counter and histogram families by name.
+// Gauges are left out: they report current state, such as active requests,
+// that a reset would corrupt.
+func (c *Collector) cumulativeFamilies() map[string]resettable {
+	families := map[string]resettable{
+		"ollama_proxy_requests_total":                           c.RequestCount,
+		"ollama_proxy_request_duration_seconds":                 c.RequestDuration,
+		"ollama_proxy_high_priority_request_duration_seconds":   c.HighPriorityRequestDuration,
+		"ollama_proxy_normal_priority_request_duration_seconds": c.NormalPriorityRequestDuration,
+		"ollama_proxy_prompt_tokens_total":                      c.PromptTokens,
+		"ollama_proxy_generated_tokens_total":                   c.GeneratedTokens,
+		"ollama_proxy_tokens_per_second":                        c.TokensPerSecond,
+		"ollama_proxy_time_to_first_token_seconds":              c.TimeToFirstToken,
+		"ollama_proxy_inter_token_latency_seconds":              c.InterTokenLatency,
+		"ollama_proxy_model_load_duration_seconds":              c.ModelLoadDuration,
+		"ollama_proxy_errors_total":                             c.ErrorCount,
+		"ollama_proxy_queue_wait_time_seconds":                  c.QueueWaitTime,
+		"ollama_proxy_queue_high_priority_wait_time_seconds":    c.QueueHighPriorityWaitTime,
+		"ollama_proxy_queue_normal_priority_wait_time_seconds":  c.QueueNormalPriorityWaitTime,
+		"ollama_proxy_context_length":                           c.ContextLength,
+		"ollama_proxy_request_by_id_total":                      c.RequestID,
+		"ollama_proxy_user_requests_total":                      c.UserRequests,
+		"ollama_proxy_token_cost_total":                         c.TokenCost,
+		"ollama_proxy_prompt_token_cost_total":                  c.PromptTokenCost,
+		"ollama_proxy_completion_token_cost_total":              c.CompletionTokenCost,
+		"ollama_proxy_request_size_bytes":                       c.RequestSizeByte,
+		"ollama_proxy_response_size_bytes":                      c.ResponseSizeByte,
+		"ollama_proxy_embedding_batch_size":                     c.EmbeddingBatchSize,
+		"ollama_proxy_stream_fanout_subscribers_total":          c.StreamFanOutSubscribers,
+		"ollama_proxy_client_disconnects_total":                 c.ClientDisconnects,
+		"ollama_proxy_content_filtered_total":                   c.ContentFiltered,
+		"ollama_proxy_model_pulls_total":                        c.ModelPulls,
+		"ollama_proxy_model_swaps_total":                        c.ModelSwaps,
+		"ollama_proxy_duplicate_request_id_total":               c.DuplicateRequestIDs,
+		"ollama_proxy_retries_total":                            c.Retries,
+		"ollama_proxy_backend_requests_total":                   c.BackendRequests,
+		"ollama_proxy_api_key_requests_total":                   c.APIKeyRequests,
+		"ollama_proxy_api_key_tokens_total":                     c.APIKeyTokens,
+		"ollama_proxy_api_key_rejected_total":                   c.APIKeyRejected,
+	}
+	if c.SharedQueueWaitTime != nil {
+		families["queue_wait_time_seconds"] = c.SharedQueueWaitTime
+	}
+	return families
+}
+
+// initUnlabeled creates the single series of the unlabeled families so they
+// are exported, as zero, before their first observation
+func (c *Collector) initUnlabeled() {
+	for _, vec := range []*prometheus.HistogramVec{c.QueueHighPriorityWaitTime, c.QueueNormalPriorityWaitTime} {
+		vec.WithLabelValues()
+	}
+	c.DuplicateRequestIDs.WithLabelValues()
+}
+
+// Reset zeroes every counter and histogram, for load tests and demos that
+// want a clean slate without restarting the proxy, and returns the names of
+// the families it reset. Prometheus counters can't go down, so each family
+// drops all of its series; they reappear from zero on their next update.
+// Scrapers see this as a counter reset, which rate() already handles.
+func (c *Collector) Reset() []string {
+	families := c.cumulativeFamilies()
+	names := make([]string, 0, len(families))
+	for name, family := range families {
+		family.Reset()
+		names = append(names, name)
+	}
+	c.initUnlabeled()
+
+	sort.Strings(names)
+	return names
+}
@@ -2,25 +2,61 @@ package metrics
 
 import (
 	"context"
+	"errors"
 	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/atyronesmith/llama-metrics/proxy/pkg/ratelog"
+
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/process"
 )
 
+// errLogInterval is how often an ongoing collection failure is logged again
+const errLogInterval = 5 * time.Minute
+
+var errOllamaNotFound = errors.New("no Ollama process running")
+
 // SystemCollector collects system metrics periodically
 type SystemCollector struct {
-	metrics  *Collector
-	interval time.Duration
+	metrics    *Collector
+	interval   time.Duration
+	topRunners int
+	errLog     *ratelog.Logger
+	modelNames *modelNames
+
+	// Ollama CPU time at the last collection, to turn into a usage rate
+	cpuSamples    map[int32]cpuSample
+	lastCPUSample time.Time
 }
 
-// NewSystemCollector creates a new system metrics collector
-func NewSystemCollector(metrics *Collector, interval time.Duration) *SystemCollector {
+// cpuSample is one Ollama process's cumulative CPU time
+type cpuSample struct {
+	created    int64 // process start in Unix milliseconds, to catch pid reuse
+	cpuSeconds float64
+}
+
+// runnerMemory is the memory of one Ollama model runner process
+type runnerMemory struct {
+	pid   int32
+	model string // shortened blob name
+	name  string // model name, or "unknown"
+	rss   uint64
+}
+
+// NewSystemCollector creates a new system metrics collector. Per-runner
+// memory is exported for the topRunners largest runners (0 disables it).
+func NewSystemCollector(metrics *Collector, interval time.Duration, topRunners int) *SystemCollector {
 	return &SystemCollector{
-		metrics:  metrics,
-		interval: interval,
+		metrics:    metrics,
+		interval:   interval,
+		topRunners: topRunners,
+		errLog:     ratelog.New(errLogInterval),
+		modelNames: newModelNames(),
 	}
 }
 
@@ -49,22 +85,22 @@ func (s *SystemCollector) collect(ctx context.Context) {
 func (s *SystemCollector) collectOnce() {
 	// Collect CPU usage
 	cpuPercent, err := cpu.Percent(time.Second, false)
-	if err != nil {
-		log.Printf("Error collecting CPU metrics: %v", err)
-	} else if len(cpuPercent) > 0 {
+	s.errLog.Report("collecting CPU metrics", err)
+	if err == nil && len(cpuPercent) > 0 {
 		s.metrics.CPUUsage.Set(cpuPercent[0])
 	}
 
-	// Collect Ollama process memory usage
-	s.collectOllamaMemory()
+	// Collect Ollama process memory and CPU usage
+	s.collectOllamaProcesses()
 }
 
-// collectOllamaMemory finds and monitors the Ollama process memory usage
-func (s *SystemCollector) collectOllamaMemory() {
+// collectOllamaProcesses finds the Ollama processes and monitors their
+// memory and CPU usage
+func (s *SystemCollector) collectOllamaProcesses() {
 	// Get all processes
 	processes, err := process.Processes()
+	s.errLog.Report("getting processes", err)
 	if err != nil {
-		log.Printf("Error getting processes: %v", err)
 		return
 	}
 
@@ -73,6 +109,9 @@ func (s *SystemCollector) collectOllamaMemory() {
 	var serveMemory uint64 = 0
 	foundOllama := false
 	foundServe := false
+	var runners []runnerMemory
+	cpuSamples := make(map[int32]cpuSample)
+	now := time.Now()
 
 	for _, p := range processes {
 		name, err := p.Name()
@@ -86,6 +125,11 @@ func (s *SystemCollector) collectOllamaMemory() {
 		// Check if this is an Ollama process (main serve or runner)
 		if strings.Contains(strings.ToLower(name), "ollama") ||
 		   strings.Contains(strings.ToLower(cmdline), "ollama") {
+			if times, err := p.Times(); err == nil {
+				created, _ := p.CreateTime()
+				cpuSamples[p.Pid] = cpuSample{created: created, cpuSeconds: times.User + times.System}
+			}
+
 			// Get memory info
 			memInfo, err := p.MemoryInfo()
 			if err != nil {
@@ -100,18 +144,30 @@ func (s *SystemCollector) collectOllamaMemory() {
 			if strings.Contains(cmdline, "serve") && !strings.Contains(cmdline, "runner") {
 				serveMemory = memInfo.RSS
 				foundServe = true
+			} else if args, err := p.CmdlineSlice(); err == nil && isRunnerCmdline(args) {
+				runners = append(runners, runnerMemory{
+					pid:   p.Pid,
+					model: runnerModel(args),
+					name:  s.modelNames.lookup(runnerModelPath(args)),
+					rss:   memInfo.RSS,
+				})
 			}
 		}
 	}
 
+	s.setModelMemory(runners)
+	s.setRunnerMemory(runners)
+	s.setOllamaCPU(cpuSamples, now)
+
 	// Set the total memory usage metric
 	if foundOllama {
+		s.errLog.Report("finding Ollama process", nil)
 		s.metrics.MemoryUsage.Set(float64(totalMemory))
 		log.Printf("Ollama total memory usage: %.2f MB", float64(totalMemory)/(1024*1024))
 	} else {
 		// If Ollama process not found, set to 0
 		s.metrics.MemoryUsage.Set(0)
-		log.Printf("Ollama process not found")
+		s.errLog.Report("finding Ollama process", errOllamaNotFound)
 	}
 
 	// Set the serve process memory metric
@@ -121,4 +177,106 @@ func (s *SystemCollector) collectOllamaMemory() {
 	} else {
 		s.metrics.OllamaServeMemory.Set(0)
 	}
-}
\ No newline at end of file
+}
+
+// setOllamaCPU exports the CPU Ollama used since the last collection, as a
+// percentage of one core. The first collection only records a baseline, so
+// no lifetime average is reported at startup.
+func (s *SystemCollector) setOllamaCPU(samples map[int32]cpuSample, now time.Time) {
+	previous, last := s.cpuSamples, s.lastCPUSample
+	s.cpuSamples, s.lastCPUSample = samples, now
+	if last.IsZero() {
+		return
+	}
+	elapsed := now.Sub(last).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	var used float64
+	for pid, sample := range samples {
+		prev, ok := previous[pid]
+		switch {
+		case ok && prev.created == sample.created:
+			used += sample.cpuSeconds - prev.cpuSeconds
+		case sample.created >= last.UnixMilli():
+			// Started since the last collection, so all its CPU time is new
+			used += sample.cpuSeconds
+		}
+	}
+	if used < 0 {
+		used = 0
+	}
+	s.metrics.OllamaCPUUsage.Set(used / elapsed * 100)
+}
+
+// setModelMemory exports runner memory summed per model name, replacing the
+// previous set so unloaded models don't linger
+func (s *SystemCollector) setModelMemory(runners []runnerMemory) {
+	byModel := make(map[string]uint64)
+	for _, r := range runners {
+		byModel[r.name] += r.rss
+	}
+
+	s.metrics.ModelMemory.Reset()
+	for name, rss := range byModel {
+		s.metrics.ModelMemory.WithLabelValues(name).Set(float64(rss))
+	}
+}
+
+// setRunnerMemory exports the largest runners, replacing the previous set
+// so runners that exited don't linger
+func (s *SystemCollector) setRunnerMemory(runners []runnerMemory) {
+	s.metrics.OllamaRunnerMemory.Reset()
+	if s.topRunners <= 0 {
+		return
+	}
+
+	sort.Slice(runners, func(i, j int) bool { return runners[i].rss > runners[j].rss })
+	if len(runners) > s.topRunners {
+		runners = runners[:s.topRunners]
+	}
+	for _, r := range runners {
+		s.metrics.OllamaRunnerMemory.WithLabelValues(strconv.Itoa(int(r.pid)), r.model).Set(float64(r.rss))
+	}
+}
+
+// isRunnerCmdline reports whether args belong to a model runner: "ollama
+// runner" in current versions, ollama_llama_server in older ones
+func isRunnerCmdline(args []string) bool {
+	for _, arg := range args {
+		if arg == "runner" || strings.Contains(arg, "ollama_llama_server") {
+			return true
+		}
+	}
+	return false
+}
+
+// runnerModelPath returns a runner's --model argument, a blob path like
+// ~/.ollama/models/blobs/sha256-<digest>, or "" when it has none
+func runnerModelPath(args []string) string {
+	for i, arg := range args {
+		if arg == "--model" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if value, ok := strings.CutPrefix(arg, "--model="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// runnerModel names the model blob a runner serves, with the digest
+// shortened to 12 characters
+func runnerModel(args []string) string {
+	model := runnerModelPath(args)
+	if model == "" {
+		return "unknown"
+	}
+
+	model = filepath.Base(model)
+	if digest, ok := strings.CutPrefix(model, "sha256-"); ok && len(digest) > 12 {
+		model = "sha256-" + digest[:12]
+	}
+	return model
+}
@@ -0,0 +1,186 @@
+package modelload
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/metrics"
+)
+
+// residentTTL is how long the list of loaded models from /api/ps is trusted
+const residentTTL = 5 * time.Second
+
+// residentPoll is how often a request waiting for a load slot checks
+// whether its model got loaded in the meantime
+const residentPoll = time.Second
+
+// Guard limits how many model loads run at once on each Ollama backend. On
+// a single GPU, requests for two models that aren't loaded make Ollama swap
+// them back and forth; the guard makes the second load wait until the first
+// finishes instead. Requests for models that are already loaded never wait.
+type Guard struct {
+	maxLoads   int
+	metrics    *metrics.Collector
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	hosts map[string]*host
+}
+
+// host is the load state of one Ollama backend
+type host struct {
+	url   string
+	slots chan struct{}
+
+	mu        sync.Mutex
+	resident  map[string]bool
+	refreshed time.Time
+}
+
+// New creates a guard allowing maxLoads concurrent model loads per backend
+func New(maxLoads int, m *metrics.Collector) *Guard {
+	return &Guard{
+		maxLoads:   maxLoads,
+		metrics:    m,
+		httpClient: &http.Client{Timeout: 2 * time.Second},
+		hosts:      make(map[string]*host),
+	}
+}
+
+// Acquire waits, if model has to be loaded on the Ollama backend at
+// ollamaURL, until one of that backend's load slots is free or the model is
+// loaded by someone else. The returned release must be called once Ollama
+// starts answering, which it only does with the model loaded; it is safe to
+// call more than once.
+func (g *Guard) Acquire(ctx context.Context, ollamaURL, model string) (func(), error) {
+	h := g.host(ollamaURL)
+	model = normalize(model)
+	if g.isResident(h, model) {
+		return func() {}, nil
+	}
+
+	ticker := time.NewTicker(residentPoll)
+	defer ticker.Stop()
+	for acquired := false; !acquired; {
+		select {
+		case h.slots <- struct{}{}:
+			acquired = true
+		case <-ticker.C:
+			if g.isResident(h, model) {
+				return func() {}, nil
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// Another request may have loaded the model while this one waited
+	if g.isResident(h, model) {
+		<-h.slots
+		return func() {}, nil
+	}
+
+	if others := h.residentCount(); others > 0 {
+		// Loading this model will evict or compete with a loaded one
+		g.metrics.RecordModelSwap(model)
+		log.Printf("Loading model %s on %s while %d other model(s) are loaded", model, ollamaURL, others)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.mu.Lock()
+			h.resident[model] = true
+			h.mu.Unlock()
+			<-h.slots
+		})
+	}, nil
+}
+
+// host returns the state of the backend at ollamaURL, creating it on first use
+func (g *Guard) host(ollamaURL string) *host {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	h, ok := g.hosts[ollamaURL]
+	if !ok {
+		h = &host{
+			url:      ollamaURL,
+			slots:    make(chan struct{}, g.maxLoads),
+			resident: make(map[string]bool),
+		}
+		g.hosts[ollamaURL] = h
+	}
+	return h
+}
+
+// isResident reports whether the backend has the model loaded, refreshing
+// the list from its /api/ps when it is stale. If /api/ps can't be reached,
+// the models this guard saw loaded there are used until the next attempt
+// a residentTTL later, so a down backend isn't asked on every request.
+func (g *Guard) isResident(h *host, model string) bool {
+	h.mu.Lock()
+	stale := time.Since(h.refreshed) > residentTTL
+	if stale {
+		// Counts as refreshed for concurrent callers too, so only one asks
+		h.refreshed = time.Now()
+	}
+	h.mu.Unlock()
+
+	if stale {
+		g.refresh(h)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.resident[model]
+}
+
+func (h *host) residentCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.resident)
+}
+
+func (g *Guard) refresh(h *host) {
+	resp, err := g.httpClient.Get(h.url + "/api/ps")
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var ps struct {
+		Models []struct {
+			Name  string `json:"name"`
+			Model string `json:"model"`
+		} `json:"models"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&ps) != nil {
+		return
+	}
+
+	resident := make(map[string]bool, len(ps.Models))
+	for _, m := range ps.Models {
+		resident[normalize(m.Name)] = true
+		if m.Model != "" {
+			resident[normalize(m.Model)] = true
+		}
+	}
+
+	h.mu.Lock()
+	h.resident = resident
+	h.mu.Unlock()
+}
+
+// normalize adds the implicit ":latest" tag so "llama2" matches "llama2:latest"
+func normalize(model string) string {
+	if !strings.Contains(model, ":") {
+		return model + ":latest"
+	}
+	return model
+}
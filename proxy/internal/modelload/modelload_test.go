@@ -0,0 +1,210 @@
+package modelload
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/metrics"
+)
+
+// The collector registers with the default Prometheus registry, so the
+// tests share one
+var (
+	sharedMetrics     *metrics.Collector
+	sharedMetricsOnce sync.Once
+)
+
+func testMetrics() *metrics.Collector {
+	sharedMetricsOnce.Do(func() {
+		sharedMetrics = metrics.NewCollector(5)
+	})
+	return sharedMetrics
+}
+
+// stubOllama answers /api/ps with the models set by load
+type stubOllama struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	loaded []string
+}
+
+func newStubOllama(t *testing.T) *stubOllama {
+	s := &stubOllama{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		models := make([]map[string]string, len(s.loaded))
+		for i, name := range s.loaded {
+			models[i] = map[string]string{"name": name, "model": name}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"models": models})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubOllama) load(model string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loaded = append(s.loaded, model)
+}
+
+// acquireAsync calls Acquire in the background; the channel receives its
+// release once it returns
+func acquireAsync(t *testing.T, g *Guard, ollamaURL, model string) <-chan func() {
+	done := make(chan func(), 1)
+	go func() {
+		release, err := g.Acquire(context.Background(), ollamaURL, model)
+		if err != nil {
+			t.Errorf("Acquire(%s) error = %v", model, err)
+			return
+		}
+		done <- release
+	}()
+	return done
+}
+
+func TestResidentModelNeverWaits(t *testing.T) {
+	ollama := newStubOllama(t)
+	ollama.load("llama2:latest")
+	g := New(1, testMetrics())
+
+	// Hold the only slot with a cold model
+	hold, err := g.Acquire(context.Background(), ollama.URL, "mistral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hold()
+
+	select {
+	case release := <-acquireAsync(t, g, ollama.URL, "llama2"):
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("request for a loaded model waited for a load slot")
+	}
+}
+
+func TestSlotFreedOnceOllamaAnswers(t *testing.T) {
+	ollama := newStubOllama(t)
+	g := New(1, testMetrics())
+
+	first, err := g.Acquire(context.Background(), ollama.URL, "mistral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiting := acquireAsync(t, g, ollama.URL, "phi3")
+	select {
+	case <-waiting:
+		t.Fatal("second cold load didn't wait for the first")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The first request's response started; its generation may run on
+	first()
+	first()
+	select {
+	case release := <-waiting:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("second cold load still waiting after the first model loaded")
+	}
+}
+
+func TestWaiterSeesModelLoadedElsewhere(t *testing.T) {
+	ollama := newStubOllama(t)
+	g := New(1, testMetrics())
+
+	hold, err := g.Acquire(context.Background(), ollama.URL, "mistral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hold()
+	waiting := acquireAsync(t, g, ollama.URL, "llama2")
+
+	// Another client loads the model directly; once the resident list is
+	// stale the waiter finds it without taking a slot
+	ollama.load("llama2:latest")
+	h := g.host(ollama.URL)
+	h.mu.Lock()
+	h.refreshed = time.Time{}
+	h.mu.Unlock()
+
+	select {
+	case release := <-waiting:
+		release()
+	case <-time.After(3 * residentPoll):
+		t.Fatal("waiter didn't notice the model was loaded")
+	}
+	if held := len(h.slots); held != 1 {
+		t.Errorf("%d load slots held, want only the first request's", held)
+	}
+}
+
+func TestSlotsArePerBackend(t *testing.T) {
+	gpu1, gpu2 := newStubOllama(t), newStubOllama(t)
+	g := New(1, testMetrics())
+
+	hold, err := g.Acquire(context.Background(), gpu1.URL, "mistral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hold()
+
+	select {
+	case release := <-acquireAsync(t, g, gpu2.URL, "phi3"):
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("cold load on one backend waited for a load on another")
+	}
+}
+
+func TestAcquireCancelled(t *testing.T) {
+	ollama := newStubOllama(t)
+	g := New(1, testMetrics())
+
+	hold, err := g.Acquire(context.Background(), ollama.URL, "mistral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hold()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := g.Acquire(ctx, ollama.URL, "phi3"); err != context.DeadlineExceeded {
+		t.Errorf("Acquire() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestFailedRefreshIsNotRetriedPerRequest(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ollama.Close()
+	g := New(4, testMetrics())
+
+	// Each model is cold, so each Acquire checks residency twice
+	for _, model := range []string{"llama2", "mistral", "phi3"} {
+		release, err := g.Acquire(context.Background(), ollama.URL, model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Errorf("/api/ps asked %d times, want once per %v while it fails", calls, residentTTL)
+	}
+}
@@ -0,0 +1,121 @@
+package modelpull
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/metrics"
+)
+
+// pullTimeout bounds a single background pull; large models can take a while
+const pullTimeout = 30 * time.Minute
+
+// Puller downloads missing models in the background so that a request for a
+// model that hasn't been pulled yet succeeds on a later attempt. Models are
+// pulled onto every Ollama backend, since the retry may be sent to any of
+// them. At most one pull per model runs at a time.
+type Puller struct {
+	ollamaURLs []string
+	metrics    *metrics.Collector
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	pulling map[string]bool
+}
+
+// New creates a puller for the Ollama servers at ollamaURLs
+func New(ollamaURLs []string, m *metrics.Collector) *Puller {
+	return &Puller{
+		ollamaURLs: ollamaURLs,
+		metrics:    m,
+		httpClient: &http.Client{Timeout: pullTimeout},
+		pulling:    make(map[string]bool),
+	}
+}
+
+// Start begins pulling model in the background unless a pull for it is
+// already running. It reports whether a new pull was started.
+func (p *Puller) Start(model string) bool {
+	p.mu.Lock()
+	if p.pulling[model] {
+		p.mu.Unlock()
+		return false
+	}
+	p.pulling[model] = true
+	p.mu.Unlock()
+
+	p.metrics.RecordModelPull(model, "started")
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			delete(p.pulling, model)
+			p.mu.Unlock()
+		}()
+
+		start := time.Now()
+		if err := p.pullAll(model); err != nil {
+			p.metrics.RecordModelPull(model, "error")
+			log.Printf("Failed to pull model %s: %v", model, err)
+			return
+		}
+		p.metrics.RecordModelPull(model, "success")
+		log.Printf("Pulled model %s in %v", model, time.Since(start).Round(time.Second))
+	}()
+	return true
+}
+
+// pullAll pulls model onto every backend at once. Backends that already
+// have it finish quickly.
+func (p *Puller) pullAll(model string) error {
+	errs := make([]error, len(p.ollamaURLs))
+	var wg sync.WaitGroup
+	for i, ollamaURL := range p.ollamaURLs {
+		wg.Add(1)
+		go func(i int, ollamaURL string) {
+			defer wg.Done()
+			if err := p.pull(ollamaURL, model); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", ollamaURL, err)
+			}
+		}(i, ollamaURL)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (p *Puller) pull(ollamaURL, model string) error {
+	body, err := json.Marshal(map[string]interface{}{"name": model, "stream": false})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pullTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ollamaURL+"/api/pull", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var pullErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&pullErr)
+		return fmt.Errorf("upstream returned %d: %s", resp.StatusCode, pullErr.Error)
+	}
+	return nil
+}
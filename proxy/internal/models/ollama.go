@@ -15,6 +15,7 @@ type GenerateResponse struct {
 	Model              string  `json:"model"`
 	CreatedAt          string  `json:"created_at"`
 	Response           string  `json:"response"`
+	Thinking           string  `json:"thinking,omitempty"`
 	Done               bool    `json:"done"`
 	Context            []int   `json:"context,omitempty"`
 	TotalDuration      int64   `json:"total_duration,omitempty"`
@@ -32,12 +33,27 @@ type ChatRequest struct {
 	Stream   bool                   `json:"stream"`
 	Options  map[string]interface{} `json:"options,omitempty"`
 	Format   string                 `json:"format,omitempty"`
+	Tools    []Tool                 `json:"tools,omitempty"`
 }
 
 // Message represents a chat message
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+}
+
+// OllamaToolCall represents a tool call in an Ollama chat message
+type OllamaToolCall struct {
+	Function OllamaFunctionCall `json:"function"`
+}
+
+// OllamaFunctionCall is a function call with decoded arguments; OpenAI
+// sends the arguments as a JSON string instead
+type OllamaFunctionCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
 }
 
 // ChatResponse represents an Ollama chat API response
@@ -57,4 +73,41 @@ type ChatResponse struct {
 // ErrorResponse represents an error response from Ollama
 type ErrorResponse struct {
 	Error string `json:"error"`
-}
\ No newline at end of file
+}
+
+// EmbedRequest represents an Ollama batch embed API request (/api/embed)
+type EmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// EmbedResponse represents an Ollama batch embed API response
+type EmbedResponse struct {
+	Model           string      `json:"model"`
+	Embeddings      [][]float64 `json:"embeddings"`
+	PromptEvalCount int         `json:"prompt_eval_count,omitempty"`
+}
+
+// EmbeddingsRequest represents an Ollama single-prompt embeddings API request (/api/embeddings)
+type EmbeddingsRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+// EmbeddingsResponse represents an Ollama single-prompt embeddings API response
+type EmbeddingsResponse struct {
+	Embedding []float64 `json:"embedding"`
+}
+
+// TagsResponse represents an Ollama list models API response (/api/tags)
+type TagsResponse struct {
+	Models []ModelInfo `json:"models"`
+}
+
+// ModelInfo represents a locally available model in an Ollama tags response
+type ModelInfo struct {
+	Name       string `json:"name"`
+	Model      string `json:"model"`
+	ModifiedAt string `json:"modified_at"`
+	Size       int64  `json:"size"`
+}
@@ -8,8 +8,8 @@ import "time"
 type ChatCompletionRequest struct {
 	Model            string                 `json:"model"`
 	Messages         []ChatMessage          `json:"messages"`
-	Temperature      float64                `json:"temperature,omitempty"`
-	TopP             float64                `json:"top_p,omitempty"`
+	Temperature      *float64               `json:"temperature,omitempty"` // nil when unset; 0 means greedy
+	TopP             *float64               `json:"top_p,omitempty"`
 	N                int                    `json:"n,omitempty"`
 	Stream           bool                   `json:"stream,omitempty"`
 	Stop             interface{}            `json:"stop,omitempty"`
@@ -19,21 +19,28 @@ type ChatCompletionRequest struct {
 	LogitBias        map[string]float64     `json:"logit_bias,omitempty"`
 	User             string                 `json:"user,omitempty"`
 	ResponseFormat   *ResponseFormat        `json:"response_format,omitempty"`
-	Seed             int                    `json:"seed,omitempty"`
+	Seed             *int                   `json:"seed,omitempty"` // nil when unset; 0 is a valid seed
 	Tools            []Tool                 `json:"tools,omitempty"`
 	ToolChoice       interface{}            `json:"tool_choice,omitempty"`
 	Functions        []Function             `json:"functions,omitempty"` // Deprecated
 	FunctionCall     interface{}            `json:"function_call,omitempty"` // Deprecated
+	StreamOptions    *StreamOptions         `json:"stream_options,omitempty"`
+}
+
+// StreamOptions configures streaming responses
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // ChatMessage represents a message in a chat conversation
 type ChatMessage struct {
-	Role         string       `json:"role"`
-	Content      string       `json:"content"`
-	Name         string       `json:"name,omitempty"`
-	ToolCalls    []ToolCall   `json:"tool_calls,omitempty"`
-	ToolCallID   string       `json:"tool_call_id,omitempty"`
-	FunctionCall *FunctionCall `json:"function_call,omitempty"` // Deprecated
+	Role             string        `json:"role"`
+	Content          string        `json:"content"`
+	ReasoningContent string        `json:"reasoning_content,omitempty"` // Stripped reasoning, when exposed
+	Name             string        `json:"name,omitempty"`
+	ToolCalls        []ToolCall    `json:"tool_calls,omitempty"`
+	ToolCallID       string        `json:"tool_call_id,omitempty"`
+	FunctionCall     *FunctionCall `json:"function_call,omitempty"` // Deprecated
 }
 
 // ChatCompletionResponse represents an OpenAI chat completion response
@@ -64,6 +71,7 @@ type StreamingChatCompletionResponse struct {
 	Model             string       `json:"model"`
 	Choices           []ChatChoice `json:"choices"`
 	SystemFingerprint string       `json:"system_fingerprint,omitempty"`
+	Usage             *Usage       `json:"usage,omitempty"` // Final chunk only, with stream_options.include_usage
 }
 
 // Completion API (legacy)
@@ -74,8 +82,8 @@ type CompletionRequest struct {
 	Prompt           interface{}        `json:"prompt"`
 	Suffix           string             `json:"suffix,omitempty"`
 	MaxTokens        int                `json:"max_tokens,omitempty"`
-	Temperature      float64            `json:"temperature,omitempty"`
-	TopP             float64            `json:"top_p,omitempty"`
+	Temperature      *float64           `json:"temperature,omitempty"` // nil when unset; 0 means greedy
+	TopP             *float64           `json:"top_p,omitempty"`
 	N                int                `json:"n,omitempty"`
 	Stream           bool               `json:"stream,omitempty"`
 	LogProbs         int                `json:"logprobs,omitempty"`
@@ -86,6 +94,8 @@ type CompletionRequest struct {
 	BestOf           int                `json:"best_of,omitempty"`
 	LogitBias        map[string]float64 `json:"logit_bias,omitempty"`
 	User             string             `json:"user,omitempty"`
+	Seed             *int               `json:"seed,omitempty"` // nil when unset; 0 is a valid seed
+	StreamOptions    *StreamOptions     `json:"stream_options,omitempty"`
 }
 
 // CompletionResponse represents an OpenAI completion response
@@ -102,10 +112,51 @@ type CompletionResponse struct {
 type CompletionChoice struct {
 	Text         string    `json:"text"`
 	Index        int       `json:"index"`
-	LogProbs     *LogProbs `json:"logprobs,omitempty"`
+	LogProbs     *LogProbs `json:"logprobs"` // Always present; null when not requested
 	FinishReason string    `json:"finish_reason,omitempty"`
 }
 
+// Embeddings API
+
+// EmbeddingRequest represents an OpenAI embeddings request
+type EmbeddingRequest struct {
+	Model          string      `json:"model"`
+	Input          interface{} `json:"input"` // string or []string
+	EncodingFormat string      `json:"encoding_format,omitempty"`
+	User           string      `json:"user,omitempty"`
+}
+
+// EmbeddingResponse represents an OpenAI embeddings response
+type EmbeddingResponse struct {
+	Object string          `json:"object"`
+	Data   []EmbeddingData `json:"data"`
+	Model  string          `json:"model"`
+	Usage  *Usage          `json:"usage,omitempty"`
+}
+
+// EmbeddingData represents a single embedding in an embeddings response
+type EmbeddingData struct {
+	Object    string    `json:"object"`
+	Embedding []float64 `json:"embedding"`
+	Index     int       `json:"index"`
+}
+
+// Models API
+
+// Model represents an OpenAI model object
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// ModelList represents an OpenAI list models response
+type ModelList struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
+
 // Common structures
 
 // Usage represents token usage information
@@ -179,6 +230,9 @@ type ErrorDetail struct {
 	Type    string  `json:"type"`
 	Param   string  `json:"param,omitempty"`
 	Code    *string `json:"code,omitempty"`
+	// UpstreamBody previews an unparseable upstream response when
+	// ERROR_INCLUDE_UPSTREAM_BODY is set
+	UpstreamBody string `json:"upstream_body,omitempty"`
 }
 
 // Enhanced metrics tracking
@@ -3,7 +3,9 @@ package queue
 import (
 	"container/heap"
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"sync"
 	"time"
 
@@ -12,19 +14,35 @@ import (
 
 // Priority levels
 const (
-	PriorityNormal = 0
-	PriorityHigh   = 1
+	PriorityNormal   = 0
+	PriorityHigh     = 1
+	PriorityCritical = 2
 )
 
+// ErrUserLimit is returned when a user already has as many requests queued
+// or in flight as their limit allows
+var ErrUserLimit = errors.New("too many queued requests for user")
+
+// ErrQueueTimeout is returned when a request waits in the queue longer than
+// Options.MaxWait without starting
+var ErrQueueTimeout = errors.New("queue wait timeout")
+
+// ErrShuttingDown is returned for requests submitted while the queue drains,
+// and for queued requests still waiting when the drain times out
+var ErrShuttingDown = errors.New("proxy is shutting down")
+
 // Request represents a queued request
 type Request struct {
 	ID        string
 	Model     string
+	User      string
 	Priority  int
 	Handler   func() error
 	Submitted time.Time
 	ctx       context.Context
 	result    chan error
+	deadline  time.Time // zero when the wait is unlimited
+	rank      float64   // effective priority including aging, see Manager.rank
 }
 
 // PriorityQueue implements heap.Interface for priority queuing
@@ -33,9 +51,9 @@ type PriorityQueue []*Request
 func (pq PriorityQueue) Len() int { return len(pq) }
 
 func (pq PriorityQueue) Less(i, j int) bool {
-	// Higher priority first
-	if pq[i].Priority != pq[j].Priority {
-		return pq[i].Priority > pq[j].Priority
+	// Higher effective priority first
+	if pq[i].rank != pq[j].rank {
+		return pq[i].rank > pq[j].rank
 	}
 	// For same priority, earlier submission time first (FIFO)
 	return pq[i].Submitted.Before(pq[j].Submitted)
@@ -58,6 +76,42 @@ func (pq *PriorityQueue) Pop() interface{} {
 	return item
 }
 
+// Options holds optional tuning for the queue manager; zero values disable
+// the corresponding behavior
+type Options struct {
+	// StallTimeout is how long the queue may hold requests while processing
+	// nothing before it is reported as stalled
+	StallTimeout time.Duration
+
+	// MaxWait is how long a request may wait in the queue before it is
+	// dropped with ErrQueueTimeout
+	MaxWait time.Duration
+
+	// MaxPerUser caps how many requests one user may have queued or in
+	// flight; UserLimits overrides it for specific users
+	MaxPerUser int
+	UserLimits map[string]int
+
+	// FastPath runs a request directly on the submitting goroutine when the
+	// queue is empty and a worker slot is free, skipping the heap
+	FastPath bool
+
+	// StuckThreshold is how long a worker may process one request before
+	// it is reported as stuck
+	StuckThreshold time.Duration
+
+	// AgingInterval is how long a request waits to gain one priority level,
+	// so lower priorities can't starve under sustained higher-priority load
+	AgingInterval time.Duration
+}
+
+// execution tracks a request currently holding an execution slot
+type execution struct {
+	worker  string
+	started time.Time
+	stuck   bool
+}
+
 // Manager handles request queuing and processing with priority
 type Manager struct {
 	pq          PriorityQueue
@@ -65,25 +119,33 @@ type Manager struct {
 	maxSize     int
 	maxWorkers  int
 	metrics     *metrics.Collector
+	opts        Options
 	workerPool  sync.WaitGroup
 	ctx         context.Context
 	cancel      context.CancelFunc
 	workSignal  chan struct{}
+	slots       chan struct{} // execution slots shared by workers and the fast path
+	draining    bool          // guarded by pqMutex
+	epoch       time.Time     // reference point for aging ranks
 
 	// Queue statistics
 	mu               sync.RWMutex
 	totalQueued      int64
 	totalProcessed   int64
 	totalRejected    int64
+	totalFastPath    int64
 	currentSize      int
 	peakSize         int
 	lastProcessed    time.Time
+	criticalPriorityCount int
 	highPriorityCount int
 	normalPriorityCount int
+	userCounts       map[string]int
+	running          map[*Request]*execution
 }
 
 // NewManager creates a new queue manager with priority support
-func NewManager(maxSize, maxWorkers int, m *metrics.Collector) *Manager {
+func NewManager(maxSize, maxWorkers int, m *metrics.Collector, opts Options) *Manager {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	qm := &Manager{
@@ -91,9 +153,14 @@ func NewManager(maxSize, maxWorkers int, m *metrics.Collector) *Manager {
 		maxSize:    maxSize,
 		maxWorkers: maxWorkers,
 		metrics:    m,
+		opts:       opts,
 		ctx:        ctx,
 		cancel:     cancel,
 		workSignal: make(chan struct{}, maxSize),
+		slots:      make(chan struct{}, maxWorkers),
+		userCounts: make(map[string]int),
+		running:    make(map[*Request]*execution),
+		epoch:      time.Now(),
 	}
 
 	// Initialize the priority queue
@@ -111,11 +178,13 @@ func NewManager(maxSize, maxWorkers int, m *metrics.Collector) *Manager {
 	return qm
 }
 
-// Submit adds a request to the queue with a priority
-func (qm *Manager) Submit(ctx context.Context, model string, priority int, handler func() error) error {
+// Submit adds a request to the queue with a priority. user identifies the
+// caller for per-user limits; an empty user is not limited.
+func (qm *Manager) Submit(ctx context.Context, model, user string, priority int, handler func() error) error {
 	req := &Request{
 		ID:        fmt.Sprintf("%d", time.Now().UnixNano()),
 		Model:     model,
+		User:      user,
 		Priority:  priority,
 		Handler:   handler,
 		Submitted: time.Now(),
@@ -123,11 +192,38 @@ func (qm *Manager) Submit(ctx context.Context, model string, priority int, handl
 		result:    make(chan error, 1),
 	}
 
+	req.rank = qm.rank(req)
+	if qm.opts.MaxWait > 0 {
+		req.deadline = req.Submitted.Add(qm.opts.MaxWait)
+	}
+
+	// Reserve a per-user slot before taking shared queue capacity
+	if !qm.acquireUserSlot(user) {
+		return ErrUserLimit
+	}
+
 	// Add to priority queue
 	qm.pqMutex.Lock()
+	if qm.draining {
+		qm.pqMutex.Unlock()
+		qm.releaseUserSlot(user)
+		qm.updateRejectedStats(model, "shutting_down")
+		return ErrShuttingDown
+	}
+	if qm.opts.FastPath && len(qm.pq) == 0 {
+		// Nothing is waiting, so a free slot can be taken without jumping
+		// ahead of anyone
+		select {
+		case qm.slots <- struct{}{}:
+			qm.pqMutex.Unlock()
+			return qm.runFastPath(req)
+		default:
+		}
+	}
 	if len(qm.pq) >= qm.maxSize {
 		qm.pqMutex.Unlock()
-		qm.updateRejectedStats()
+		qm.releaseUserSlot(user)
+		qm.updateRejectedStats(model, "queue_full")
 		return fmt.Errorf("queue is full (size: %d)", qm.maxSize)
 	}
 
@@ -142,12 +238,48 @@ func (qm *Manager) Submit(ctx context.Context, model string, priority int, handl
 	}
 
 	// Wait for result
+	var expired <-chan time.Time
+	if !req.deadline.IsZero() {
+		timer := time.NewTimer(qm.opts.MaxWait)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
 	select {
 	case err := <-req.result:
 		return err
 	case <-ctx.Done():
 		return ctx.Err()
+	case <-expired:
+		if qm.removeQueued(req) {
+			qm.releaseUserSlot(req.User)
+			qm.updateRejectedStats(req.Model, "queue_timeout")
+			return ErrQueueTimeout
+		}
+		// A worker took it just in time
+		select {
+		case err := <-req.result:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// removeQueued takes req out of the priority queue, reporting false if a
+// worker already picked it up
+func (qm *Manager) removeQueued(req *Request) bool {
+	qm.pqMutex.Lock()
+	defer qm.pqMutex.Unlock()
+
+	for i, queued := range qm.pq {
+		if queued == req {
+			heap.Remove(&qm.pq, i)
+			qm.updateQueueStatsLocked(false, req.Priority)
+			return true
+		}
 	}
+	return false
 }
 
 // worker processes requests from the priority queue
@@ -159,33 +291,60 @@ func (qm *Manager) worker(id int) {
 		case <-qm.ctx.Done():
 			return
 		case <-qm.workSignal:
+			// Wait for an execution slot; fast-path requests may hold some
+			select {
+			case qm.slots <- struct{}{}:
+			case <-qm.ctx.Done():
+				return
+			}
+
 			// Get next request from priority queue
 			qm.pqMutex.Lock()
 			if len(qm.pq) == 0 {
 				qm.pqMutex.Unlock()
+				<-qm.slots
 				continue
 			}
 			req := heap.Pop(&qm.pq).(*Request)
 			qm.updateQueueStatsLocked(false, req.Priority)
 			qm.pqMutex.Unlock()
 
-			qm.processRequest(req)
+			qm.processRequest(req, fmt.Sprintf("worker-%d", id))
+			<-qm.slots
 		}
 	}
 }
 
-// processRequest handles a single request
-func (qm *Manager) processRequest(req *Request) {
+// runFastPath executes a request on the caller's goroutine using an
+// already acquired execution slot
+func (qm *Manager) runFastPath(req *Request) error {
+	defer func() { <-qm.slots }()
+
+	qm.mu.Lock()
+	qm.totalFastPath++
+	qm.mu.Unlock()
+
+	// Goes through the normal processing so wait time (~0), per-user
+	// accounting and processed stats stay consistent with queued requests
+	qm.processRequest(req, "fast-path")
+	return <-req.result
+}
+
+// processRequest handles a single request on the named worker
+func (qm *Manager) processRequest(req *Request, worker string) {
+	defer qm.releaseUserSlot(req.User)
+
 	// Record queue wait time
 	waitTime := time.Since(req.Submitted)
 	qm.metrics.RecordQueueWaitTime(req.Model, waitTime)
 
-	// Record priority-specific wait time
-	if req.Priority == PriorityHigh {
-		qm.metrics.QueueHighPriorityWaitTime.Observe(waitTime.Seconds())
+	// Record priority-specific wait time; critical requests count as high
+	if req.Priority >= PriorityHigh {
+		qm.metrics.QueueHighPriorityWaitTime.WithLabelValues().Observe(waitTime.Seconds())
 	} else {
-		qm.metrics.QueueNormalPriorityWaitTime.Observe(waitTime.Seconds())
+		qm.metrics.QueueNormalPriorityWaitTime.WithLabelValues().Observe(waitTime.Seconds())
 	}
+	qm.metrics.RecordSharedQueueWaitTime(PriorityName(req.Priority), waitTime)
 
 	// Check if request context is still valid
 	select {
@@ -195,14 +354,96 @@ func (qm *Manager) processRequest(req *Request) {
 	default:
 	}
 
+	// Skip a request that waited past its deadline
+	if !req.deadline.IsZero() && time.Now().After(req.deadline) {
+		qm.updateRejectedStats(req.Model, "queue_timeout")
+		req.result <- ErrQueueTimeout
+		return
+	}
+
 	// Execute the handler
-	err := req.Handler()
+	qm.startExecution(req, worker)
+	err := qm.runHandler(req)
+	qm.finishExecution(req)
 	req.result <- err
 
 	// Update processed stats
 	qm.updateProcessedStats()
 }
 
+// startExecution records that worker began running req
+func (qm *Manager) startExecution(req *Request, worker string) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	qm.running[req] = &execution{worker: worker, started: time.Now()}
+	qm.updateBusyGaugesLocked()
+}
+
+// finishExecution records that req's handler returned
+func (qm *Manager) finishExecution(req *Request) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	if exec := qm.running[req]; exec != nil && exec.stuck {
+		log.Printf("Worker %s finished request %s for model %s after %v", exec.worker, req.ID, req.Model, time.Since(exec.started).Round(time.Second))
+	}
+	delete(qm.running, req)
+	qm.updateBusyGaugesLocked()
+	qm.updateStuckGaugeLocked()
+}
+
+// updateBusyGaugesLocked updates the busy workers and saturation gauges (must
+// be called with mu locked)
+func (qm *Manager) updateBusyGaugesLocked() {
+	busy := len(qm.running)
+	qm.metrics.WorkerBusy.Set(float64(busy))
+	if qm.maxWorkers > 0 {
+		qm.metrics.ConcurrencySaturation.Set(float64(busy) / float64(qm.maxWorkers))
+	}
+}
+
+// checkStuckWorkers warns once about each request that has held a worker
+// longer than the stuck threshold, typically a hung upstream call
+func (qm *Manager) checkStuckWorkers() {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	for req, exec := range qm.running {
+		if exec.stuck || time.Since(exec.started) < qm.opts.StuckThreshold {
+			continue
+		}
+		exec.stuck = true
+		log.Printf("⚠️  Worker %s stuck on request %s for model %s for %v", exec.worker, req.ID, req.Model, time.Since(exec.started).Round(time.Second))
+	}
+	qm.updateStuckGaugeLocked()
+}
+
+// updateStuckGaugeLocked updates the stuck workers gauge (must be called with mu locked)
+func (qm *Manager) updateStuckGaugeLocked() {
+	stuck := 0
+	for _, exec := range qm.running {
+		if exec.stuck {
+			stuck++
+		}
+	}
+	qm.metrics.WorkersStuck.Set(float64(stuck))
+}
+
+// runHandler executes a request handler, converting a panic into an error so
+// the worker survives and the handler's deferred cleanup still runs
+func (qm *Manager) runHandler(req *Request) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("⚠️  Recovered panic in queued request %s for model %s: %v", req.ID, req.Model, r)
+			qm.metrics.RecordError(req.Model, "panic")
+			err = fmt.Errorf("request handler panicked: %v", r)
+		}
+	}()
+
+	return req.Handler()
+}
+
 // updateQueueStatsLocked updates queue statistics (must be called with pqMutex locked)
 func (qm *Manager) updateQueueStatsLocked(added bool, priority int) {
 	qm.mu.Lock()
@@ -214,24 +455,148 @@ func (qm *Manager) updateQueueStatsLocked(added bool, priority int) {
 		if qm.currentSize > qm.peakSize {
 			qm.peakSize = qm.currentSize
 		}
-		if priority == PriorityHigh {
-			qm.highPriorityCount++
-		} else {
-			qm.normalPriorityCount++
-		}
+		*qm.priorityCountLocked(priority)++
 	} else {
 		qm.currentSize--
-		if priority == PriorityHigh {
-			qm.highPriorityCount--
-		} else {
-			qm.normalPriorityCount--
-		}
+		*qm.priorityCountLocked(priority)--
 	}
 
-	// Update metrics
+	qm.publishQueueGaugesLocked()
+}
+
+// priorityCountLocked returns the queued-request counter for a priority
+// level (qm.mu must be held)
+func (qm *Manager) priorityCountLocked(priority int) *int {
+	switch {
+	case priority >= PriorityCritical:
+		return &qm.criticalPriorityCount
+	case priority == PriorityHigh:
+		return &qm.highPriorityCount
+	default:
+		return &qm.normalPriorityCount
+	}
+}
+
+// publishQueueGaugesLocked exports the queue size counters (qm.mu must be held)
+func (qm *Manager) publishQueueGaugesLocked() {
 	qm.metrics.QueueSize.Set(float64(qm.currentSize))
-	qm.metrics.QueueHighPriorityCount.Set(float64(qm.highPriorityCount))
+	qm.metrics.QueueHighPriorityCount.Set(float64(qm.criticalPriorityCount + qm.highPriorityCount))
 	qm.metrics.QueueNormalPriorityCount.Set(float64(qm.normalPriorityCount))
+	qm.metrics.RecordSharedQueueSize(PriorityName(PriorityCritical), qm.criticalPriorityCount)
+	qm.metrics.RecordSharedQueueSize(PriorityName(PriorityHigh), qm.highPriorityCount)
+	qm.metrics.RecordSharedQueueSize(PriorityName(PriorityNormal), qm.normalPriorityCount)
+}
+
+// reconcileStats resets the size counters from the heap itself if they have
+// drifted, so a missed update can't skew the gauges permanently
+func (qm *Manager) reconcileStats() {
+	qm.pqMutex.Lock()
+	defer qm.pqMutex.Unlock()
+
+	critical, high, normal := 0, 0, 0
+	for _, req := range qm.pq {
+		switch {
+		case req.Priority >= PriorityCritical:
+			critical++
+		case req.Priority == PriorityHigh:
+			high++
+		default:
+			normal++
+		}
+	}
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	if qm.currentSize == len(qm.pq) && qm.criticalPriorityCount == critical &&
+		qm.highPriorityCount == high && qm.normalPriorityCount == normal {
+		return
+	}
+
+	log.Printf("⚠️  Queue stats out of sync (size %d, critical %d, high %d, normal %d; heap has %d, %d, %d, %d), repairing",
+		qm.currentSize, qm.criticalPriorityCount, qm.highPriorityCount, qm.normalPriorityCount,
+		len(qm.pq), critical, high, normal)
+	qm.currentSize = len(qm.pq)
+	qm.criticalPriorityCount = critical
+	qm.highPriorityCount = high
+	qm.normalPriorityCount = normal
+	qm.publishQueueGaugesLocked()
+}
+
+// PriorityName names a priority level, as in the queue_name label of the
+// service-neutral queue metrics
+func PriorityName(priority int) string {
+	switch {
+	case priority >= PriorityCritical:
+		return "critical"
+	case priority == PriorityHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// rank returns a request's effective priority for heap ordering. With
+// aging, a request gains one level per AgingInterval waited. Every queued
+// request ages at the same rate, so rather than re-ranking the heap as time
+// passes, later submissions start lower by the time elapsed since the
+// manager's epoch; comparisons between ranks then match comparisons of the
+// aged priorities at any instant.
+func (qm *Manager) rank(req *Request) float64 {
+	rank := float64(req.Priority)
+	if qm.opts.AgingInterval > 0 {
+		rank -= float64(req.Submitted.Sub(qm.epoch)) / float64(qm.opts.AgingInterval)
+	}
+	return rank
+}
+
+// userLimit returns the queue limit for a user, or 0 when unlimited
+func (qm *Manager) userLimit(user string) int {
+	if user == "" {
+		return 0
+	}
+	if limit, ok := qm.opts.UserLimits[user]; ok {
+		return limit
+	}
+	return qm.opts.MaxPerUser
+}
+
+// acquireUserSlot counts a request against its user, returning false when
+// the user is already at their limit
+func (qm *Manager) acquireUserSlot(user string) bool {
+	if user == "" {
+		return true
+	}
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	if limit := qm.userLimit(user); limit > 0 && qm.userCounts[user] >= limit {
+		return false
+	}
+
+	qm.userCounts[user]++
+	qm.metrics.UserQueued.WithLabelValues(user).Set(float64(qm.userCounts[user]))
+	return true
+}
+
+// releaseUserSlot frees a slot taken by acquireUserSlot
+func (qm *Manager) releaseUserSlot(user string) {
+	if user == "" {
+		return
+	}
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	qm.userCounts[user]--
+	if qm.userCounts[user] <= 0 {
+		// Drop idle users so the gauge doesn't grow without bound
+		delete(qm.userCounts, user)
+		qm.metrics.UserQueued.DeleteLabelValues(user)
+		return
+	}
+	qm.metrics.UserQueued.WithLabelValues(user).Set(float64(qm.userCounts[user]))
 }
 
 // updateProcessedStats updates processing statistics
@@ -243,13 +608,14 @@ func (qm *Manager) updateProcessedStats() {
 	qm.lastProcessed = time.Now()
 }
 
-// updateRejectedStats updates rejection statistics
-func (qm *Manager) updateRejectedStats() {
+// updateRejectedStats counts a request the queue turned away, recording
+// the error against the request's model
+func (qm *Manager) updateRejectedStats(model, errorType string) {
 	qm.mu.Lock()
 	defer qm.mu.Unlock()
 
 	qm.totalRejected++
-	qm.metrics.RecordError("unknown", "queue_full")
+	qm.metrics.RecordError(model, errorType)
 }
 
 // metricsUpdater periodically updates queue metrics
@@ -259,14 +625,19 @@ func (qm *Manager) metricsUpdater() {
 
 	var lastProcessed int64
 	lastUpdate := time.Now()
+	var stallStart time.Time
+	stalled := false
 
 	for {
 		select {
 		case <-qm.ctx.Done():
 			return
 		case <-ticker.C:
+			qm.reconcileStats()
+
 			qm.mu.RLock()
 			processed := qm.totalProcessed
+			currentSize := qm.currentSize
 			qm.mu.RUnlock()
 
 			// Calculate processing rate
@@ -275,6 +646,32 @@ func (qm *Manager) metricsUpdater() {
 
 			qm.metrics.RecordQueueProcessingRate(rate)
 
+			// Detect workers stuck on a hung upstream: requests are waiting
+			// but nothing has completed for longer than the stall timeout
+			if qm.opts.StallTimeout > 0 {
+				if currentSize > 0 && rate == 0 {
+					if stallStart.IsZero() {
+						stallStart = time.Now()
+					}
+					if !stalled && time.Since(stallStart) >= qm.opts.StallTimeout {
+						stalled = true
+						qm.metrics.RecordQueueStalled(true)
+						log.Printf("⚠️  Queue stalled: %d requests waiting, none processed in %v", currentSize, time.Since(stallStart).Round(time.Second))
+					}
+				} else {
+					if stalled {
+						log.Printf("Queue recovered after stalling for %v", time.Since(stallStart).Round(time.Second))
+						qm.metrics.RecordQueueStalled(false)
+					}
+					stalled = false
+					stallStart = time.Time{}
+				}
+			}
+
+			if qm.opts.StuckThreshold > 0 {
+				qm.checkStuckWorkers()
+			}
+
 			lastProcessed = processed
 			lastUpdate = time.Now()
 		}
@@ -286,35 +683,86 @@ func (qm *Manager) GetStats() map[string]interface{} {
 	qm.mu.RLock()
 	defer qm.mu.RUnlock()
 
+	utilization := 0.0
+	if qm.maxSize > 0 {
+		utilization = float64(qm.currentSize) / float64(qm.maxSize) * 100
+	}
+
 	return map[string]interface{}{
-		"current_size":       qm.currentSize,
-		"max_size":           qm.maxSize,
-		"peak_size":          qm.peakSize,
-		"total_queued":       qm.totalQueued,
-		"total_processed":    qm.totalProcessed,
-		"total_rejected":     qm.totalRejected,
-		"workers":            qm.maxWorkers,
-		"high_priority":      qm.highPriorityCount,
-		"normal_priority":    qm.normalPriorityCount,
+		"current_size":        qm.currentSize,
+		"max_size":            qm.maxSize,
+		"peak_size":           qm.peakSize,
+		"total_queued":        qm.totalQueued,
+		"total_processed":     qm.totalProcessed,
+		"total_rejected":      qm.totalRejected,
+		"total_fast_path":     qm.totalFastPath,
+		"busy_workers":        len(qm.running),
+		"workers":             qm.maxWorkers,
+		"critical_priority":   qm.criticalPriorityCount,
+		"high_priority":       qm.highPriorityCount,
+		"normal_priority":     qm.normalPriorityCount,
+		"utilization_percent": utilization,
 	}
 }
 
-// Shutdown gracefully shuts down the queue manager
+// Pending returns how many requests are waiting in the queue and how many
+// are executing
+func (qm *Manager) Pending() (queued, running int) {
+	qm.pqMutex.Lock()
+	queued = len(qm.pq)
+	qm.pqMutex.Unlock()
+	return queued, len(qm.slots)
+}
+
+// Shutdown drains the queue: new requests are rejected with
+// ErrShuttingDown while queued and running ones finish. If that takes
+// longer than timeout, requests still queued are rejected with
+// ErrShuttingDown and an error is returned; requests already running are
+// left to their own timeouts.
 func (qm *Manager) Shutdown(timeout time.Duration) error {
-	// Stop accepting new requests
+	qm.pqMutex.Lock()
+	qm.draining = true
+	qm.pqMutex.Unlock()
+
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if queued, running := qm.Pending(); queued == 0 && running == 0 {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			rejected := qm.rejectQueued()
+			qm.cancel()
+			return fmt.Errorf("queue drain timed out after %v; rejected %d queued requests", timeout, rejected)
+		}
+	}
+
+	// Stop the idle workers
 	qm.cancel()
+	qm.workerPool.Wait()
+	return nil
+}
 
-	// Wait for workers to finish or timeout
-	done := make(chan struct{})
-	go func() {
-		qm.workerPool.Wait()
-		close(done)
-	}()
+// rejectQueued fails every request still waiting in the queue and returns
+// how many there were
+func (qm *Manager) rejectQueued() int {
+	qm.pqMutex.Lock()
+	var rejected []*Request
+	for len(qm.pq) > 0 {
+		req := heap.Pop(&qm.pq).(*Request)
+		qm.updateQueueStatsLocked(false, req.Priority)
+		rejected = append(rejected, req)
+	}
+	qm.pqMutex.Unlock()
 
-	select {
-	case <-done:
-		return nil
-	case <-time.After(timeout):
-		return fmt.Errorf("shutdown timeout after %v", timeout)
+	for _, req := range rejected {
+		qm.releaseUserSlot(req.User)
+		qm.updateRejectedStats(req.Model, "shutting_down")
+		req.result <- ErrShuttingDown
 	}
+	return len(rejected)
 }
\ No newline at end of file
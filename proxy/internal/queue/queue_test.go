@@ -0,0 +1,320 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atyronesmith/llama-metrics/proxy/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// The collector registers with the default Prometheus registry, so the
+// tests share one
+var (
+	sharedMetrics     *metrics.Collector
+	sharedMetricsOnce sync.Once
+)
+
+func testMetrics() *metrics.Collector {
+	sharedMetricsOnce.Do(func() {
+		sharedMetrics = metrics.NewCollector(5)
+	})
+	return sharedMetrics
+}
+
+// newTestManager creates a manager that is shut down when the test ends
+func newTestManager(tb testing.TB, maxSize, maxWorkers int, opts Options) *Manager {
+	qm := NewManager(maxSize, maxWorkers, testMetrics(), opts)
+	tb.Cleanup(func() { qm.Shutdown(5 * time.Second) })
+	return qm
+}
+
+func BenchmarkSubmit(b *testing.B) {
+	for _, tc := range []struct {
+		name     string
+		fastPath bool
+	}{
+		{"fast_path", true},
+		{"queued", false},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			// Light load: one request at a time, so a worker slot is
+			// always free
+			qm := newTestManager(b, 100, 4, Options{FastPath: tc.fastPath})
+			ctx := context.Background()
+			handler := func() error { return nil }
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := qm.Submit(ctx, "llama2:7b", "", PriorityNormal, handler); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// waitFor polls cond until it holds, failing the test with describe's
+// output if it doesn't within two seconds. Some bookkeeping, such as
+// releasing the user's slot, finishes just after Submit returns.
+func waitFor(t *testing.T, cond func() bool, describe func() string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(describe())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// userCount returns how many users hold queue slots
+func userCount(qm *Manager) int {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+	return len(qm.userCounts)
+}
+
+func TestPanickingHandlerReleasesQueueState(t *testing.T) {
+	for _, fastPath := range []bool{false, true} {
+		name := "queued"
+		if fastPath {
+			name = "fast_path"
+		}
+		t.Run(name, func(t *testing.T) {
+			qm := newTestManager(t, 10, 1, Options{FastPath: fastPath, MaxPerUser: 1})
+			panics := testutil.ToFloat64(testMetrics().ErrorCount.WithLabelValues("llama2:7b", "panic"))
+
+			err := qm.Submit(context.Background(), "llama2:7b", "alice", PriorityNormal, func() error {
+				panic("boom")
+			})
+			if err == nil || !strings.Contains(err.Error(), "panicked: boom") {
+				t.Fatalf("Submit() = %v, want the recovered panic as an error", err)
+			}
+			if got := testutil.ToFloat64(testMetrics().ErrorCount.WithLabelValues("llama2:7b", "panic")) - panics; got != 1 {
+				t.Errorf("panic errors grew by %v, want 1", got)
+			}
+
+			waitFor(t, func() bool {
+				stats := qm.GetStats()
+				return stats["current_size"] == 0 && stats["busy_workers"] == 0 && userCount(qm) == 0
+			}, func() string {
+				stats := qm.GetStats()
+				return fmt.Sprintf("current_size %v, busy_workers %v, %d users counted after the panic; want all 0",
+					stats["current_size"], stats["busy_workers"], userCount(qm))
+			})
+
+			// The worker and alice's only slot are free for the next request
+			if err := qm.Submit(context.Background(), "llama2:7b", "alice", PriorityNormal, func() error { return nil }); err != nil {
+				t.Errorf("Submit() after the panic = %v, want nil", err)
+			}
+		})
+	}
+}
+
+// blocker is a handler that holds its worker until released
+type blocker struct {
+	release chan struct{}
+	once    sync.Once
+}
+
+// newBlocker returns a blocker that is released when the test ends at the
+// latest, before the manager is shut down
+func newBlocker(tb testing.TB) *blocker {
+	b := &blocker{release: make(chan struct{})}
+	tb.Cleanup(b.Release)
+	return b
+}
+
+func (b *blocker) handler() error {
+	<-b.release
+	return nil
+}
+
+// Release lets every blocked handler return
+func (b *blocker) Release() {
+	b.once.Do(func() { close(b.release) })
+}
+
+// submitAsync submits a request on its own goroutine and returns a channel
+// that receives Submit's result
+func submitAsync(qm *Manager, user string, priority int, handler func() error) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- qm.Submit(context.Background(), "llama2:7b", user, priority, handler)
+	}()
+	return result
+}
+
+func TestGetStatsWithBlockedWorker(t *testing.T) {
+	qm := newTestManager(t, 10, 1, Options{})
+	b := newBlocker(t)
+
+	running := submitAsync(qm, "", PriorityNormal, b.handler)
+	waitFor(t, func() bool { return qm.GetStats()["busy_workers"] == 1 }, func() string {
+		return fmt.Sprintf("busy_workers = %v, want 1", qm.GetStats()["busy_workers"])
+	})
+
+	const queued = 3
+	var results []<-chan error
+	for i := 0; i < queued; i++ {
+		results = append(results, submitAsync(qm, "", PriorityNormal, b.handler))
+	}
+	waitFor(t, func() bool { return qm.GetStats()["current_size"] == queued }, func() string {
+		return fmt.Sprintf("current_size = %v, want %d", qm.GetStats()["current_size"], queued)
+	})
+
+	stats := qm.GetStats()
+	if stats["busy_workers"] != 1 || stats["workers"] != 1 {
+		t.Errorf("busy_workers %v of %v, want 1 of 1", stats["busy_workers"], stats["workers"])
+	}
+	if stats["utilization_percent"] != 30.0 {
+		t.Errorf("utilization_percent = %v, want 30 for 3 of 10 slots", stats["utilization_percent"])
+	}
+	if stats["normal_priority"] != queued {
+		t.Errorf("normal_priority = %v, want %d", stats["normal_priority"], queued)
+	}
+
+	b.Release()
+	for _, result := range append(results, running) {
+		if err := <-result; err != nil {
+			t.Errorf("Submit() = %v, want nil", err)
+		}
+	}
+	waitFor(t, func() bool {
+		stats := qm.GetStats()
+		return stats["busy_workers"] == 0 && stats["current_size"] == 0 && stats["utilization_percent"] == 0.0
+	}, func() string {
+		return fmt.Sprintf("stats after draining = %v, want no busy workers and an empty queue", qm.GetStats())
+	})
+}
+
+// feedHighPriority keeps submitting short high-priority requests, faster
+// than one worker can process them, until the returned stop is called
+func feedHighPriority(qm *Manager) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			submitAsync(qm, "", PriorityHigh, func() error {
+				time.Sleep(2 * time.Millisecond)
+				return nil
+			})
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func TestAgingPreventsStarvation(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	const bound = 10 * interval
+
+	for _, tc := range []struct {
+		name          string
+		agingInterval time.Duration
+		wantStarved   bool
+	}{
+		{"aging", interval, false},
+		{"no aging", 0, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			qm := newTestManager(t, 1000, 1, Options{AgingInterval: tc.agingInterval})
+			b := newBlocker(t)
+
+			// Hold the only worker so the normal request has to queue
+			submitAsync(qm, "", PriorityNormal, b.handler)
+			waitFor(t, func() bool { return qm.GetStats()["busy_workers"] == 1 }, func() string {
+				return fmt.Sprintf("busy_workers = %v, want 1", qm.GetStats()["busy_workers"])
+			})
+
+			ran := make(chan time.Time, 1)
+			submitted := time.Now()
+			normal := submitAsync(qm, "", PriorityNormal, func() error {
+				ran <- time.Now()
+				return nil
+			})
+			waitFor(t, func() bool { return qm.GetStats()["normal_priority"] == 1 }, func() string {
+				return fmt.Sprintf("normal_priority = %v, want 1", qm.GetStats()["normal_priority"])
+			})
+
+			// Let high-priority requests pile up ahead of it before the
+			// worker frees up
+			stop := feedHighPriority(qm)
+			waitFor(t, func() bool {
+				high, _ := qm.GetStats()["high_priority"].(int)
+				return high >= 3
+			}, func() string {
+				return fmt.Sprintf("high_priority = %v, want at least 3", qm.GetStats()["high_priority"])
+			})
+			b.Release()
+
+			select {
+			case at := <-ran:
+				stop()
+				if tc.wantStarved {
+					t.Fatalf("normal request ran after %v despite sustained high-priority load and no aging", at.Sub(submitted))
+				}
+				if waited := at.Sub(submitted); waited > bound {
+					t.Errorf("normal request waited %v, want at most %v (%d aging intervals)", waited, bound, bound/interval)
+				}
+			case <-time.After(bound):
+				stop()
+				if !tc.wantStarved {
+					t.Fatalf("normal request still waiting after %v of high-priority load", bound)
+				}
+			}
+
+			// Once the high-priority load stops, the normal request runs
+			if err := <-normal; err != nil {
+				t.Errorf("Submit() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestFullQueueCountsQueueFullError(t *testing.T) {
+	qm := newTestManager(t, 2, 1, Options{})
+	b := newBlocker(t)
+
+	// One request holds the worker, then two fill the queue
+	submitAsync(qm, "", PriorityNormal, b.handler)
+	waitFor(t, func() bool { return qm.GetStats()["busy_workers"] == 1 }, func() string {
+		return fmt.Sprintf("busy_workers = %v, want 1", qm.GetStats()["busy_workers"])
+	})
+	for i := 0; i < 2; i++ {
+		submitAsync(qm, "", PriorityNormal, b.handler)
+	}
+	waitFor(t, func() bool { return qm.GetStats()["current_size"] == 2 }, func() string {
+		return fmt.Sprintf("current_size = %v, want 2", qm.GetStats()["current_size"])
+	})
+
+	queueFull := testMetrics().ErrorCount.WithLabelValues("llama2:7b", "queue_full")
+	before := testutil.ToFloat64(queueFull)
+	rejected := qm.GetStats()["total_rejected"].(int64)
+
+	err := qm.Submit(context.Background(), "llama2:7b", "", PriorityNormal, b.handler)
+	if err == nil || !strings.Contains(err.Error(), "queue is full") {
+		t.Fatalf("Submit() = %v, want a queue full error", err)
+	}
+	if got := testutil.ToFloat64(queueFull) - before; got != 1 {
+		t.Errorf(`ollama_proxy_errors_total{model="llama2:7b",error_type="queue_full"} grew by %v, want 1`, got)
+	}
+	if got := qm.GetStats()["total_rejected"].(int64) - rejected; got != 1 {
+		t.Errorf("total_rejected grew by %d, want 1", got)
+	}
+}
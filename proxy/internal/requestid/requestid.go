@@ -0,0 +1,43 @@
+package requestid
+
+import "sync"
+
+// Registry remembers the most recent request IDs so a reused ID can be
+// detected before it is counted twice in per-request metrics
+type Registry struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+	ring []string
+	next int
+}
+
+// New creates a registry remembering the last size IDs
+func New(size int) *Registry {
+	if size <= 0 {
+		size = 1
+	}
+	return &Registry{
+		seen: make(map[string]struct{}, size),
+		ring: make([]string, size),
+	}
+}
+
+// Claim records id and reports whether it was unused. An ID seen among the
+// last size claims is reported as a duplicate and not recorded again.
+func (r *Registry) Claim(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.seen[id]; ok {
+		return false
+	}
+
+	// Forget the oldest ID to make room
+	if oldest := r.ring[r.next]; oldest != "" {
+		delete(r.seen, oldest)
+	}
+	r.ring[r.next] = id
+	r.seen[id] = struct{}{}
+	r.next = (r.next + 1) % len(r.ring)
+	return true
+}
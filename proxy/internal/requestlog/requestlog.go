@@ -0,0 +1,145 @@
+package requestlog
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context keys handlers use to annotate a request for the log
+const (
+	RequestIDKey = "requestlog.request_id"
+	ModelKey     = "requestlog.model"
+	UserKey      = "requestlog.user"
+	TokensKey    = "requestlog.tokens"
+	PriorityKey  = "requestlog.priority"
+)
+
+// Record represents a single completed request
+type Record struct {
+	RequestID  string    `json:"request_id,omitempty"`
+	User       string    `json:"user,omitempty"`
+	Model      string    `json:"model"`
+	Endpoint   string    `json:"endpoint"`
+	Method     string    `json:"method"`
+	Status     int       `json:"status"`
+	DurationMs float64   `json:"duration_ms"`
+	Tokens     int       `json:"tokens"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// Filter selects records from the log; empty fields match everything
+type Filter struct {
+	Model  string
+	User   string
+	Status int
+	Limit  int
+}
+
+// Log is a bounded, concurrency-safe ring buffer of recent requests
+type Log struct {
+	mu      sync.RWMutex
+	records []Record
+	next    int
+	full    bool
+}
+
+// New creates a request log holding at most size records
+func New(size int) *Log {
+	if size <= 0 {
+		size = 1
+	}
+	return &Log{
+		records: make([]Record, size),
+	}
+}
+
+// Add appends a record, overwriting the oldest one when the log is full
+func (l *Log) Add(r Record) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.records[l.next] = r
+	l.next = (l.next + 1) % len(l.records)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Recent returns matching records, newest first
+func (l *Log) Recent(f Filter) []Record {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	count := l.next
+	if l.full {
+		count = len(l.records)
+	}
+
+	result := make([]Record, 0, count)
+	for i := 0; i < count; i++ {
+		idx := (l.next - 1 - i + len(l.records)) % len(l.records)
+		r := l.records[idx]
+
+		if f.Model != "" && r.Model != f.Model {
+			continue
+		}
+		if f.User != "" && r.User != f.User {
+			continue
+		}
+		if f.Status != 0 && r.Status != f.Status {
+			continue
+		}
+
+		result = append(result, r)
+		if f.Limit > 0 && len(result) >= f.Limit {
+			break
+		}
+	}
+
+	return result
+}
+
+// Middleware records every request passing through the router.
+// Handlers enrich the record by setting the context keys above.
+func (l *Log) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		model := c.GetString(ModelKey)
+		if model == "" {
+			model = "unknown"
+		}
+
+		l.Add(Record{
+			RequestID:  c.GetString(RequestIDKey),
+			User:       c.GetString(UserKey),
+			Model:      model,
+			Endpoint:   c.Request.URL.Path,
+			Method:     c.Request.Method,
+			Status:     c.Writer.Status(),
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000.0,
+			Tokens:     c.GetInt(TokensKey),
+			Timestamp:  start,
+		})
+	}
+}
+
+// ParseFilter builds a Filter from the query parameters of a request
+func ParseFilter(c *gin.Context) Filter {
+	f := Filter{
+		Model: c.Query("model"),
+		User:  c.Query("user"),
+	}
+	if status, err := strconv.Atoi(c.Query("status")); err == nil {
+		f.Status = status
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil {
+		f.Limit = limit
+	}
+	return f
+}
@@ -0,0 +1,149 @@
+package tagstrip
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Stripper removes configured tag blocks, such as <think>...</think> emitted
+// by reasoning models, from generated text
+type Stripper struct {
+	tags []string
+}
+
+// New creates a stripper for the given tag names, e.g. "think"
+func New(tags []string) *Stripper {
+	return &Stripper{tags: tags}
+}
+
+// Strip removes the tag blocks from a complete response. It returns the
+// remaining content and the text that was inside the blocks.
+func (s *Stripper) Strip(text string) (content, reasoning string) {
+	stream := s.NewStream()
+	content, reasoning = stream.Write(text)
+	restContent, restReasoning := stream.Flush()
+	return content + restContent, reasoning + restReasoning
+}
+
+// NewStream starts stripping a response that arrives in chunks
+func (s *Stripper) NewStream() *Stream {
+	return &Stream{tags: s.tags}
+}
+
+// Stream strips tag blocks from a chunked response. Text that may be the
+// start of a tag is held back until the next chunk shows whether it is one,
+// so blocks and tags split across chunks are handled.
+type Stream struct {
+	tags    []string
+	pending string
+	// inside is the tag whose block is open, or "" outside any block
+	inside string
+	// trimLeading drops whitespace following a closed block
+	trimLeading bool
+}
+
+// Write adds a chunk and returns the content and reasoning that can be
+// released so far
+func (st *Stream) Write(chunk string) (content, reasoning string) {
+	st.pending += chunk
+	var contentOut, reasoningOut strings.Builder
+
+	for st.pending != "" {
+		if st.inside == "" {
+			tag, idx := st.findOpen()
+			if idx < 0 {
+				keep := heldPrefix(st.pending, st.openTags())
+				st.emitContent(&contentOut, st.pending[:len(st.pending)-keep])
+				st.pending = st.pending[len(st.pending)-keep:]
+				break
+			}
+			st.emitContent(&contentOut, st.pending[:idx])
+			st.pending = st.pending[idx+len(openTag(tag)):]
+			st.inside = tag
+			continue
+		}
+
+		closing := closeTag(st.inside)
+		idx := strings.Index(st.pending, closing)
+		if idx < 0 {
+			keep := heldPrefix(st.pending, []string{closing})
+			reasoningOut.WriteString(st.pending[:len(st.pending)-keep])
+			st.pending = st.pending[len(st.pending)-keep:]
+			break
+		}
+		reasoningOut.WriteString(st.pending[:idx])
+		st.pending = st.pending[idx+len(closing):]
+		st.inside = ""
+		st.trimLeading = true
+	}
+
+	return contentOut.String(), reasoningOut.String()
+}
+
+// Flush releases anything held back at the end of the response. An
+// unterminated block is treated as reasoning.
+func (st *Stream) Flush() (content, reasoning string) {
+	rest := st.pending
+	st.pending = ""
+	if st.inside != "" {
+		st.inside = ""
+		return "", rest
+	}
+
+	var contentOut strings.Builder
+	st.emitContent(&contentOut, rest)
+	return contentOut.String(), ""
+}
+
+func (st *Stream) emitContent(out *strings.Builder, text string) {
+	if st.trimLeading {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if text == "" {
+			return
+		}
+		st.trimLeading = false
+	}
+	out.WriteString(text)
+}
+
+// findOpen returns the earliest opening tag in the pending text
+func (st *Stream) findOpen() (string, int) {
+	bestTag, bestIdx := "", -1
+	for _, tag := range st.tags {
+		if idx := strings.Index(st.pending, openTag(tag)); idx >= 0 && (bestIdx < 0 || idx < bestIdx) {
+			bestTag, bestIdx = tag, idx
+		}
+	}
+	return bestTag, bestIdx
+}
+
+func (st *Stream) openTags() []string {
+	opens := make([]string, len(st.tags))
+	for i, tag := range st.tags {
+		opens[i] = openTag(tag)
+	}
+	return opens
+}
+
+// heldPrefix returns the length of the longest suffix of text that is a
+// proper prefix of one of the markers
+func heldPrefix(text string, markers []string) int {
+	longest := 0
+	for _, marker := range markers {
+		for n := len(marker) - 1; n > longest; n-- {
+			if strings.HasSuffix(text, marker[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
+
+func openTag(tag string) string {
+	return "<" + tag + ">"
+}
+
+func closeTag(tag string) string {
+	return "</" + tag + ">"
+}
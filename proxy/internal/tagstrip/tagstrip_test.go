@@ -0,0 +1,108 @@
+package tagstrip
+
+import "testing"
+
+// streamAll feeds chunks through a stream and returns everything it releases
+func streamAll(s *Stripper, chunks []string) (content, reasoning string) {
+	stream := s.NewStream()
+	for _, chunk := range chunks {
+		c, r := stream.Write(chunk)
+		content += c
+		reasoning += r
+	}
+	c, r := stream.Flush()
+	return content + c, reasoning + r
+}
+
+func TestStreamHandlesTagsSplitAcrossChunks(t *testing.T) {
+	s := New([]string{"think"})
+
+	stream := s.NewStream()
+	if content, reasoning := stream.Write("<thi"); content != "" || reasoning != "" {
+		t.Errorf("Write(%q) = %q, %q; want the partial tag held back", "<thi", content, reasoning)
+	}
+	content, reasoning := stream.Write("nk>plan the answer</think>\n\nThe answer is 4.")
+	restContent, restReasoning := stream.Flush()
+	content += restContent
+	reasoning += restReasoning
+
+	if content != "The answer is 4." {
+		t.Errorf("content = %q, want %q", content, "The answer is 4.")
+	}
+	if reasoning != "plan the answer" {
+		t.Errorf("reasoning = %q, want %q", reasoning, "plan the answer")
+	}
+}
+
+func TestStream(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		tags          []string
+		chunks        []string
+		wantContent   string
+		wantReasoning string
+	}{
+		{
+			name:        "no tags",
+			tags:        []string{"think"},
+			chunks:      []string{"Hello", ", world"},
+			wantContent: "Hello, world",
+		},
+		{
+			name:          "closing tag split",
+			tags:          []string{"think"},
+			chunks:        []string{"<think>abc</th", "ink>done"},
+			wantContent:   "done",
+			wantReasoning: "abc",
+		},
+		{
+			name:          "one character at a time",
+			tags:          []string{"think"},
+			chunks:        []string{"<", "t", "h", "i", "n", "k", ">", "x", "<", "/", "t", "h", "i", "n", "k", ">", "y"},
+			wantContent:   "y",
+			wantReasoning: "x",
+		},
+		{
+			name:        "lookalike released",
+			tags:        []string{"think"},
+			chunks:      []string{"a <thi", "s> b"},
+			wantContent: "a <this> b",
+		},
+		{
+			name:        "trailing partial tag released at the end",
+			tags:        []string{"think"},
+			chunks:      []string{"x <thi"},
+			wantContent: "x <thi",
+		},
+		{
+			name:          "unterminated block is reasoning",
+			tags:          []string{"think"},
+			chunks:        []string{"<think>never", " closed"},
+			wantReasoning: "never closed",
+		},
+		{
+			name:          "several tag names",
+			tags:          []string{"think", "reasoning"},
+			chunks:        []string{"<reasoning>r</reasoning>a<think>t</think>b"},
+			wantContent:   "ab",
+			wantReasoning: "rt",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			content, reasoning := streamAll(New(tc.tags), tc.chunks)
+			if content != tc.wantContent || reasoning != tc.wantReasoning {
+				t.Errorf("got content %q reasoning %q, want %q, %q", content, reasoning, tc.wantContent, tc.wantReasoning)
+			}
+		})
+	}
+}
+
+func TestStripMatchesStreaming(t *testing.T) {
+	s := New([]string{"think"})
+	text := "<think>step 1, step 2</think> Result."
+
+	content, reasoning := s.Strip(text)
+	if content != "Result." || reasoning != "step 1, step 2" {
+		t.Errorf("Strip(%q) = %q, %q", text, content, reasoning)
+	}
+}
@@ -3,42 +3,315 @@ package config
 import (
 	"flag"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds the proxy configuration
 type Config struct {
-	OllamaHost     string
-	OllamaPort     int
-	ProxyPort      int
-	MetricsPort    int
-	LogLevel       string
-	MaxQueueSize   int
-	MaxConcurrency int
+	OllamaHost     string `yaml:"ollama_host"`
+	OllamaPort     int    `yaml:"ollama_port"`
+	ProxyPort      int    `yaml:"proxy_port"`
+	MetricsPort    int    `yaml:"metrics_port"`
+	LogLevel       string `yaml:"log_level"`
+	MaxQueueSize   int    `yaml:"max_queue_size"`
+	MaxConcurrency int    `yaml:"max_concurrency"`
+	RequestLogSize int    `yaml:"request_log_size"`
+	AdminToken     string `yaml:"admin_token"`
+
+	// OllamaHosts is a comma-separated list of Ollama backends as host,
+	// host:port or URL; when set it replaces OllamaHost and OllamaPort, and
+	// a host without a port uses OllamaPort. LoadBalanceStrategy picks a
+	// backend per request: round-robin or least-active.
+	OllamaHosts         string `yaml:"ollama_hosts"`
+	LoadBalanceStrategy string `yaml:"load_balance_strategy"`
+
+	// UpstreamTimeout bounds each request to Ollama, including the whole of
+	// a streamed response
+	UpstreamTimeout time.Duration `yaml:"upstream_timeout"`
+
+	// ShutdownTimeout is how long queued and running requests get to finish
+	// after SIGTERM before the remaining ones are rejected
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// MaxRetries is how many times a non-streaming upstream request is
+	// retried after a connection error or 5xx response (0 disables);
+	// RetryBackoff is the wait before the first retry, doubling each time
+	MaxRetries   int           `yaml:"max_retries"`
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+
+	// CircuitErrorThreshold opens the circuit breaker, failing requests fast
+	// for CircuitCooldown, once this fraction of at least CircuitMinRequests
+	// upstream requests in CircuitWindow fail (0 disables the breaker)
+	CircuitErrorThreshold float64       `yaml:"circuit_error_threshold"`
+	CircuitMinRequests    int           `yaml:"circuit_min_requests"`
+	CircuitWindow         time.Duration `yaml:"circuit_window"`
+	CircuitCooldown       time.Duration `yaml:"circuit_cooldown"`
+
+	// QueueStallTimeout flags the queue as stalled when requests are waiting
+	// but none complete for this long (0 disables detection)
+	QueueStallTimeout time.Duration `yaml:"queue_stall_timeout"`
+	// QueueMaxWait fails a request that has waited this long in the queue
+	// without starting (0 waits until the client gives up)
+	QueueMaxWait time.Duration `yaml:"queue_max_wait"`
+	// QueueAgingInterval raises a queued request by one priority level for
+	// each interval it waits, so normal requests can't starve (0 disables)
+	QueueAgingInterval time.Duration `yaml:"queue_aging_interval"`
+	// WorkerStuckThreshold reports a worker as stuck when it has processed
+	// the same request for this long (0 disables detection)
+	WorkerStuckThreshold time.Duration `yaml:"worker_stuck_threshold"`
+	// QueueFastPath runs requests immediately, without queueing, when the
+	// queue is empty and a worker slot is free
+	QueueFastPath bool `yaml:"queue_fast_path"`
+	// Environment and Cluster, when set, are added as env and cluster labels
+	// to every proxy metric, so one Prometheus can tell deployments apart
+	Environment string `yaml:"environment"`
+	Cluster     string `yaml:"cluster"`
+	// SharedQueueMetrics also exports queue_size and queue_wait_time_seconds
+	// with service/queue_name labels for cross-service dashboards
+	SharedQueueMetrics bool `yaml:"shared_queue_metrics"`
+	// EnableDebugEndpoints serves POST /metrics/reset on the metrics port;
+	// debug endpoints are also on when LogLevel is debug
+	EnableDebugEndpoints bool `yaml:"enable_debug_endpoints"`
+
+	// EmbeddingBatchSize is the number of inputs sent per upstream embed call
+	EmbeddingBatchSize int `yaml:"embedding_batch_size"`
+	// EmbeddingConcurrency caps parallel per-input calls when the upstream
+	// has no batch embed endpoint
+	EmbeddingConcurrency int `yaml:"embedding_concurrency"`
+
+	// FallbackResponse returns a well-formed canned completion instead of a
+	// 502 when Ollama is unreachable
+	FallbackResponse bool   `yaml:"fallback_response"`
+	FallbackMessage  string `yaml:"fallback_message"`
+
+	// WrapUpstreamErrors turns non-JSON upstream error pages into JSON errors
+	// on the JSON routes, keeping the upstream status
+	WrapUpstreamErrors bool `yaml:"wrap_upstream_errors"`
+
+	// AutoPull pulls models Ollama reports as missing in the background and
+	// asks the client to retry, instead of returning not found
+	AutoPull bool `yaml:"auto_pull"`
+
+	// APIKeysFile is a JSON file of API keys and their QoS policies; when
+	// set, every proxy request must present a key
+	APIKeysFile string `yaml:"api_keys_file"`
+
+	// StripTags lists tag blocks removed from generated content, e.g.
+	// "<think>,<reasoning>"; StripTagsReasoning returns the removed text in a
+	// separate field instead of discarding it
+	StripTags          string `yaml:"strip_tags"`
+	StripTagsReasoning bool   `yaml:"strip_tags_reasoning"`
+
+	// MaxModelLoads limits concurrent loads of models that aren't resident,
+	// so requests for different models don't make Ollama swap them back and
+	// forth (0 disables)
+	MaxModelLoads int `yaml:"max_model_loads"`
+
+	// DuplicateRequestID is what happens to a request whose ID was used
+	// recently: "regenerate" assigns a fresh ID, "reject" returns 409
+	DuplicateRequestID string `yaml:"duplicate_request_id"`
+
+	// PricingFile is a YAML or JSON file of token prices per model used for
+	// ollama_proxy_token_cost_total; empty uses the built-in example prices
+	PricingFile string `yaml:"pricing_file"`
+
+	// MaxChoices is the largest n a chat completion may ask for; each
+	// choice is a separate Ollama generation
+	MaxChoices int `yaml:"max_choices"`
+
+	// MaxRequestBytes caps the size of a client request body; larger
+	// requests fail with 413 (0 disables)
+	MaxRequestBytes int64 `yaml:"max_request_bytes"`
+
+	// MaxResponseBytes caps how much of a non-streaming upstream response
+	// is buffered before the request fails with 502 (0 disables)
+	MaxResponseBytes int64 `yaml:"max_response_bytes"`
+
+	// ErrorIncludeUpstreamBody adds the first ErrorUpstreamBodyLimit bytes
+	// of an upstream response the proxy couldn't parse to the error response
+	// and log. Off by default since the body may contain generated content.
+	ErrorIncludeUpstreamBody bool `yaml:"error_include_upstream_body"`
+	ErrorUpstreamBodyLimit   int  `yaml:"error_upstream_body_limit"`
+
+	// ForwardClientIP sets X-Forwarded-For, X-Forwarded-Proto and X-Real-IP
+	// on upstream requests; TrustedProxies lists the load balancers (IPs or
+	// CIDRs) whose X-Forwarded-For is believed when resolving the client IP
+	ForwardClientIP bool   `yaml:"forward_client_ip"`
+	TrustedProxies  string `yaml:"trusted_proxies"`
+
+	// AllowedModels and BlockedModels are comma-separated Ollama model
+	// names; a non-empty allow list rejects every other model, and blocked
+	// models are always rejected
+	AllowedModels string `yaml:"allowed_models"`
+	BlockedModels string `yaml:"blocked_models"`
+
+	// SystemMetricsInterval is how often the system and macOS collectors
+	// run; at least 1s
+	SystemMetricsInterval time.Duration `yaml:"system_metrics_interval"`
+
+	// MacCollect* turn individual macOS collectors on or off; all but the
+	// helper shell out to a subprocess every collection cycle
+	MacCollectHelper         bool `yaml:"mac_collect_helper"`
+	MacCollectGPU            bool `yaml:"mac_collect_gpu"`
+	MacCollectTemp           bool `yaml:"mac_collect_temp"`
+	MacCollectMemoryPressure bool `yaml:"mac_collect_memory_pressure"`
+	MacCollectDiskIO         bool `yaml:"mac_collect_diskio"`
+	// MacDiskDevice reports disk I/O for one device, e.g. "disk0", instead
+	// of the sum over all disks
+	MacDiskDevice string `yaml:"mac_disk_device"`
+
+	// RunnerMemoryTopN exports per-runner memory for this many of the
+	// largest Ollama runner processes (0 disables), bounding label cardinality
+	RunnerMemoryTopN int `yaml:"runner_memory_top_n"`
+
+	// MinRateTokens is the fewest generated tokens a response needs before
+	// its tokens/sec is observed; shorter generations give noisy rates
+	MinRateTokens int `yaml:"min_rate_tokens"`
+
+	// ReadyMaxInFlight makes /ready report not-ready once this many requests
+	// are in flight (0 disables the limit)
+	ReadyMaxInFlight int `yaml:"ready_max_in_flight"`
+
+	// StreamFanOut lets concurrent byte-identical streaming requests share one
+	// upstream generation; only sensible for deterministic requests
+	StreamFanOut bool `yaml:"stream_fanout"`
+
+	// ContentFilterFile lists banned terms (or "re:" regexes), one per line;
+	// empty disables content filtering. ContentFilterResponse controls what
+	// happens to matching responses: off, redact or block.
+	ContentFilterFile     string `yaml:"content_filter_file"`
+	ContentFilterResponse string `yaml:"content_filter_response"`
+
+	// MaxQueuedPerUser caps queued plus in-flight requests per X-User (0
+	// disables); UserQueueLimits overrides it per user as "alice=10,bob=2"
+	MaxQueuedPerUser int    `yaml:"max_queued_per_user"`
+	UserQueueLimits  string `yaml:"user_queue_limits"`
+
+	// sources records where each non-default setting came from, keyed by
+	// flag name; warnings collects ignored or conflicting settings
+	sources  map[string]string
+	warnings []string
 }
 
 // DefaultConfig returns a Config with default values
 func DefaultConfig() *Config {
 	return &Config{
-		OllamaHost:     "localhost",
-		OllamaPort:     11434,
-		ProxyPort:      11435,
-		MetricsPort:    8001,
-		LogLevel:       "info",
-		MaxQueueSize:   100,
-		MaxConcurrency: 4,  // Reduced to prevent Ollama overload
+		OllamaHost:             "localhost",
+		OllamaPort:             11434,
+		LoadBalanceStrategy:    "round-robin",
+		ProxyPort:              11435,
+		MetricsPort:            8001,
+		LogLevel:               "info",
+		MaxQueueSize:           100,
+		MaxConcurrency:         4, // Reduced to prevent Ollama overload
+		RequestLogSize:         200,
+		UpstreamTimeout:        5 * time.Minute,
+		ShutdownTimeout:        30 * time.Second,
+		MaxRetries:             2,
+		RetryBackoff:           500 * time.Millisecond,
+		CircuitMinRequests:     10,
+		CircuitWindow:          30 * time.Second,
+		CircuitCooldown:        30 * time.Second,
+		QueueStallTimeout:      2 * time.Minute,
+		QueueAgingInterval:     time.Minute,
+		WorkerStuckThreshold:   10 * time.Minute,
+		QueueFastPath:          true,
+		EmbeddingBatchSize:     32,
+		EmbeddingConcurrency:   4,
+		FallbackMessage:        "The service is temporarily unavailable, please retry shortly.",
+		MinRateTokens:          5,
+		WrapUpstreamErrors:     true,
+		DuplicateRequestID:     "regenerate",
+		MaxChoices:             4,
+		MaxRequestBytes:        10 << 20,
+		MaxResponseBytes:       64 << 20,
+		ErrorUpstreamBodyLimit: 512,
+		ForwardClientIP:        true,
+		ContentFilterResponse:  "off",
+		RunnerMemoryTopN:       5,
+		SystemMetricsInterval:  10 * time.Second,
+
+		MacCollectHelper:         true,
+		MacCollectGPU:            true,
+		MacCollectTemp:           true,
+		MacCollectMemoryPressure: true,
+		MacCollectDiskIO:         true,
 	}
 }
 
 // LoadFromFlags loads configuration from command-line flags
 func (c *Config) LoadFromFlags() {
+	// Read by Load before flag parsing; registered so flag.Parse accepts it
+	flag.String("config", "", "YAML config file (shared config.yml format); overridden by environment and flags")
 	flag.StringVar(&c.OllamaHost, "ollama-host", c.OllamaHost, "Ollama server host")
 	flag.IntVar(&c.OllamaPort, "ollama-port", c.OllamaPort, "Ollama server port")
+	flag.StringVar(&c.OllamaHosts, "ollama-hosts", c.OllamaHosts, "Comma-separated Ollama backends to balance across, e.g. gpu1:11434,gpu2:11434 (overrides -ollama-host)")
+	flag.StringVar(&c.LoadBalanceStrategy, "load-balance-strategy", c.LoadBalanceStrategy, "How requests are spread across Ollama backends (round-robin, least-active)")
 	flag.IntVar(&c.ProxyPort, "proxy-port", c.ProxyPort, "Proxy server port")
 	flag.IntVar(&c.MetricsPort, "metrics-port", c.MetricsPort, "Metrics server port")
 	flag.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Log level (debug, info, warn, error)")
 	flag.IntVar(&c.MaxQueueSize, "max-queue-size", c.MaxQueueSize, "Maximum request queue size")
 	flag.IntVar(&c.MaxConcurrency, "max-concurrency", c.MaxConcurrency, "Maximum concurrent requests to Ollama")
+	flag.IntVar(&c.RequestLogSize, "request-log-size", c.RequestLogSize, "Number of recent requests kept for /admin/requests/recent")
+	flag.StringVar(&c.AdminToken, "admin-token", c.AdminToken, "Bearer token required for /admin endpoints (empty disables them)")
+	flag.DurationVar(&c.UpstreamTimeout, "upstream-timeout", c.UpstreamTimeout, "Timeout for requests to Ollama, including streamed responses")
+	flag.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "Time queued and running requests get to finish on shutdown")
+	flag.IntVar(&c.MaxRetries, "max-retries", c.MaxRetries, "Retries of non-streaming upstream requests after connection errors or 5xx responses")
+	flag.DurationVar(&c.RetryBackoff, "retry-backoff", c.RetryBackoff, "Wait before the first upstream retry, doubling for each further retry")
+	flag.Float64Var(&c.CircuitErrorThreshold, "circuit-error-threshold", c.CircuitErrorThreshold, "Upstream failure ratio that opens the circuit breaker (0 disables)")
+	flag.IntVar(&c.CircuitMinRequests, "circuit-min-requests", c.CircuitMinRequests, "Upstream requests in the window before the circuit breaker can open")
+	flag.DurationVar(&c.CircuitWindow, "circuit-window", c.CircuitWindow, "Window over which the circuit breaker measures the failure ratio")
+	flag.DurationVar(&c.CircuitCooldown, "circuit-cooldown", c.CircuitCooldown, "How long the circuit breaker stays open before probing")
+	flag.DurationVar(&c.QueueStallTimeout, "queue-stall-timeout", c.QueueStallTimeout, "Report the queue as stalled after this long without progress (0 disables)")
+	flag.DurationVar(&c.QueueMaxWait, "queue-max-wait", c.QueueMaxWait, "Fail requests that wait in the queue longer than this (0 disables)")
+	flag.DurationVar(&c.QueueAgingInterval, "queue-aging-interval", c.QueueAgingInterval, "Raise a queued request one priority level per interval waited (0 disables)")
+	flag.DurationVar(&c.WorkerStuckThreshold, "worker-stuck-threshold", c.WorkerStuckThreshold, "Report a worker as stuck after processing one request this long (0 disables)")
+	flag.BoolVar(&c.QueueFastPath, "queue-fast-path", c.QueueFastPath, "Skip the queue when it is empty and a worker slot is free")
+	flag.StringVar(&c.Environment, "environment", c.Environment, "Value of the env label added to every metric (empty omits the label)")
+	flag.StringVar(&c.Cluster, "cluster", c.Cluster, "Value of the cluster label added to every metric (empty omits the label)")
+	flag.BoolVar(&c.SharedQueueMetrics, "shared-queue-metrics", c.SharedQueueMetrics, "Also export service-neutral queue_size and queue_wait_time_seconds metrics")
+	flag.BoolVar(&c.EnableDebugEndpoints, "enable-debug-endpoints", c.EnableDebugEndpoints, "Serve POST /metrics/reset on the metrics port (for test environments)")
+	flag.IntVar(&c.EmbeddingBatchSize, "embedding-batch-size", c.EmbeddingBatchSize, "Number of inputs per upstream embedding call")
+	flag.IntVar(&c.EmbeddingConcurrency, "embedding-concurrency", c.EmbeddingConcurrency, "Maximum parallel embedding calls when batching is unsupported")
+	flag.BoolVar(&c.FallbackResponse, "fallback-response", c.FallbackResponse, "Return a canned completion instead of an error when Ollama is down")
+	flag.StringVar(&c.FallbackMessage, "fallback-message", c.FallbackMessage, "Message content used for fallback responses")
+	flag.BoolVar(&c.WrapUpstreamErrors, "wrap-upstream-errors", c.WrapUpstreamErrors, "Return non-JSON upstream error pages as JSON errors on JSON routes")
+	flag.StringVar(&c.APIKeysFile, "api-keys-file", c.APIKeysFile, "JSON file of API keys and per-key policies (priority, rate limit, token budget, models)")
+	flag.StringVar(&c.StripTags, "strip-tags", c.StripTags, "Tag blocks to remove from generated content, e.g. <think>,<reasoning>")
+	flag.BoolVar(&c.StripTagsReasoning, "strip-tags-reasoning", c.StripTagsReasoning, "Return stripped tag content in a separate reasoning field")
+	flag.IntVar(&c.MaxModelLoads, "max-model-loads", c.MaxModelLoads, "Maximum concurrent model loads (0 = unlimited)")
+	flag.StringVar(&c.DuplicateRequestID, "duplicate-request-id", c.DuplicateRequestID, "Handling of reused request IDs (regenerate, reject)")
+	flag.StringVar(&c.PricingFile, "pricing-file", c.PricingFile, "YAML or JSON file of token prices per model (default: built-in example prices)")
+	flag.IntVar(&c.MaxChoices, "max-choices", c.MaxChoices, "Maximum n (choices per request) for chat completions")
+	flag.Int64Var(&c.MaxRequestBytes, "max-request-bytes", c.MaxRequestBytes, "Maximum client request body size in bytes (0 = unlimited)")
+	flag.Int64Var(&c.MaxResponseBytes, "max-response-bytes", c.MaxResponseBytes, "Maximum buffered non-streaming upstream response size in bytes (0 = unlimited)")
+	flag.BoolVar(&c.ErrorIncludeUpstreamBody, "error-include-upstream-body", c.ErrorIncludeUpstreamBody, "Include a preview of unparseable upstream responses in errors and logs (debugging only)")
+	flag.IntVar(&c.ErrorUpstreamBodyLimit, "error-upstream-body-limit", c.ErrorUpstreamBodyLimit, "Maximum bytes of upstream body included by -error-include-upstream-body")
+	flag.BoolVar(&c.ForwardClientIP, "forward-client-ip", c.ForwardClientIP, "Set X-Forwarded-For, X-Forwarded-Proto and X-Real-IP on upstream requests")
+	flag.StringVar(&c.TrustedProxies, "trusted-proxies", c.TrustedProxies, "Comma-separated IPs or CIDRs of proxies whose X-Forwarded-For is trusted")
+	flag.StringVar(&c.AllowedModels, "allowed-models", c.AllowedModels, "Comma-separated models the proxy serves (empty allows all)")
+	flag.StringVar(&c.BlockedModels, "blocked-models", c.BlockedModels, "Comma-separated models the proxy refuses")
+	flag.BoolVar(&c.AutoPull, "auto-pull", c.AutoPull, "Pull missing models in the background and return 503 with Retry-After")
+	flag.BoolVar(&c.MacCollectHelper, "mac-collect-helper", c.MacCollectHelper, "Fetch macOS metrics from the helper service")
+	flag.BoolVar(&c.MacCollectGPU, "mac-collect-gpu", c.MacCollectGPU, "Collect macOS GPU and power metrics (runs ioreg and powermetrics)")
+	flag.BoolVar(&c.MacCollectTemp, "mac-collect-temp", c.MacCollectTemp, "Collect macOS temperature (runs osx-cpu-temp or powermetrics, falling back to the helper's reading)")
+	flag.BoolVar(&c.MacCollectMemoryPressure, "mac-collect-memory-pressure", c.MacCollectMemoryPressure, "Collect macOS memory pressure (runs memory_pressure)")
+	flag.BoolVar(&c.MacCollectDiskIO, "mac-collect-diskio", c.MacCollectDiskIO, "Collect macOS disk I/O (runs iostat)")
+	flag.StringVar(&c.MacDiskDevice, "mac-disk-device", c.MacDiskDevice, "macOS disk to report I/O for, e.g. disk0 (empty sums all disks)")
+	flag.DurationVar(&c.SystemMetricsInterval, "system-metrics-interval", c.SystemMetricsInterval, "How often system and macOS metrics are collected (at least 1s)")
+	flag.IntVar(&c.RunnerMemoryTopN, "runner-memory-top-n", c.RunnerMemoryTopN, "Number of largest Ollama runners to export memory for (0 disables)")
+	flag.IntVar(&c.MinRateTokens, "min-rate-tokens", c.MinRateTokens, "Minimum generated tokens before a response's tokens/sec is observed")
+	flag.IntVar(&c.ReadyMaxInFlight, "ready-max-in-flight", c.ReadyMaxInFlight, "In-flight requests at which /ready reports not ready (0 disables)")
+	flag.BoolVar(&c.StreamFanOut, "stream-fanout", c.StreamFanOut, "Share one upstream generation among identical concurrent streaming requests")
+	flag.StringVar(&c.ContentFilterFile, "content-filter-file", c.ContentFilterFile, "File of banned terms or re: patterns checked against prompts (empty disables)")
+	flag.StringVar(&c.ContentFilterResponse, "content-filter-response", c.ContentFilterResponse, "Action for responses matching the content filter (off, redact, block)")
+	flag.IntVar(&c.MaxQueuedPerUser, "max-queued-per-user", c.MaxQueuedPerUser, "Maximum queued or in-flight requests per user (0 disables)")
+	flag.StringVar(&c.UserQueueLimits, "user-queue-limits", c.UserQueueLimits, "Per-user queue limits overriding -max-queued-per-user, e.g. alice=10,bob=2")
 
 	flag.Parse()
 }
@@ -53,6 +326,14 @@ func (c *Config) LoadFromEnv() {
 		fmt.Sscanf(port, "%d", &c.OllamaPort)
 	}
 
+	if hosts := os.Getenv("OLLAMA_HOSTS"); hosts != "" {
+		c.OllamaHosts = hosts
+	}
+
+	if strategy := os.Getenv("LOAD_BALANCE_STRATEGY"); strategy != "" {
+		c.LoadBalanceStrategy = strategy
+	}
+
 	if port := os.Getenv("PROXY_PORT"); port != "" {
 		fmt.Sscanf(port, "%d", &c.ProxyPort)
 	}
@@ -72,6 +353,248 @@ func (c *Config) LoadFromEnv() {
 	if concurrency := os.Getenv("MAX_CONCURRENCY"); concurrency != "" {
 		fmt.Sscanf(concurrency, "%d", &c.MaxConcurrency)
 	}
+
+	if size := os.Getenv("REQUEST_LOG_SIZE"); size != "" {
+		fmt.Sscanf(size, "%d", &c.RequestLogSize)
+	}
+
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		c.AdminToken = token
+	}
+
+	if timeout := os.Getenv("UPSTREAM_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.UpstreamTimeout = d
+		}
+	}
+
+	if timeout := os.Getenv("SHUTDOWN_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.ShutdownTimeout = d
+		}
+	}
+
+	if retries := os.Getenv("MAX_RETRIES"); retries != "" {
+		fmt.Sscanf(retries, "%d", &c.MaxRetries)
+	}
+
+	if backoff := os.Getenv("RETRY_BACKOFF"); backoff != "" {
+		if d, err := time.ParseDuration(backoff); err == nil {
+			c.RetryBackoff = d
+		}
+	}
+
+	if threshold := os.Getenv("CIRCUIT_ERROR_THRESHOLD"); threshold != "" {
+		if f, err := strconv.ParseFloat(threshold, 64); err == nil {
+			c.CircuitErrorThreshold = f
+		}
+	}
+
+	if minRequests := os.Getenv("CIRCUIT_MIN_REQUESTS"); minRequests != "" {
+		fmt.Sscanf(minRequests, "%d", &c.CircuitMinRequests)
+	}
+
+	if window := os.Getenv("CIRCUIT_WINDOW"); window != "" {
+		if d, err := time.ParseDuration(window); err == nil {
+			c.CircuitWindow = d
+		}
+	}
+
+	if cooldown := os.Getenv("CIRCUIT_COOLDOWN"); cooldown != "" {
+		if d, err := time.ParseDuration(cooldown); err == nil {
+			c.CircuitCooldown = d
+		}
+	}
+
+	if timeout := os.Getenv("QUEUE_STALL_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.QueueStallTimeout = d
+		}
+	}
+
+	if wait := os.Getenv("QUEUE_MAX_WAIT"); wait != "" {
+		if d, err := time.ParseDuration(wait); err == nil {
+			c.QueueMaxWait = d
+		}
+	}
+
+	if interval := os.Getenv("QUEUE_AGING_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			c.QueueAgingInterval = d
+		}
+	}
+
+	if threshold := os.Getenv("WORKER_STUCK_THRESHOLD"); threshold != "" {
+		if d, err := time.ParseDuration(threshold); err == nil {
+			c.WorkerStuckThreshold = d
+		}
+	}
+
+	if fastPath := os.Getenv("QUEUE_FAST_PATH"); fastPath != "" {
+		c.QueueFastPath = fastPath == "true"
+	}
+
+	if env := os.Getenv("ENVIRONMENT"); env != "" {
+		c.Environment = env
+	}
+
+	if cluster := os.Getenv("CLUSTER"); cluster != "" {
+		c.Cluster = cluster
+	}
+
+	if shared := os.Getenv("SHARED_QUEUE_METRICS"); shared != "" {
+		c.SharedQueueMetrics = shared == "true"
+	}
+
+	if debug := os.Getenv("ENABLE_DEBUG_ENDPOINTS"); debug != "" {
+		c.EnableDebugEndpoints = debug == "true"
+	}
+
+	if size := os.Getenv("EMBEDDING_BATCH_SIZE"); size != "" {
+		fmt.Sscanf(size, "%d", &c.EmbeddingBatchSize)
+	}
+
+	if concurrency := os.Getenv("EMBEDDING_CONCURRENCY"); concurrency != "" {
+		fmt.Sscanf(concurrency, "%d", &c.EmbeddingConcurrency)
+	}
+
+	if fallback := os.Getenv("FALLBACK_RESPONSE"); fallback != "" {
+		c.FallbackResponse = fallback == "true"
+	}
+
+	if message := os.Getenv("FALLBACK_MESSAGE"); message != "" {
+		c.FallbackMessage = message
+	}
+
+	if wrap := os.Getenv("WRAP_UPSTREAM_ERRORS"); wrap != "" {
+		c.WrapUpstreamErrors = wrap == "true"
+	}
+
+	if keysFile := os.Getenv("API_KEYS_FILE"); keysFile != "" {
+		c.APIKeysFile = keysFile
+	}
+
+	if stripTags := os.Getenv("STRIP_TAGS"); stripTags != "" {
+		c.StripTags = stripTags
+	}
+
+	if reasoning := os.Getenv("STRIP_TAGS_REASONING"); reasoning != "" {
+		c.StripTagsReasoning = reasoning == "true"
+	}
+
+	if maxLoads := os.Getenv("MAX_MODEL_LOADS"); maxLoads != "" {
+		fmt.Sscanf(maxLoads, "%d", &c.MaxModelLoads)
+	}
+
+	if duplicate := os.Getenv("DUPLICATE_REQUEST_ID"); duplicate != "" {
+		c.DuplicateRequestID = duplicate
+	}
+
+	if pricingFile := os.Getenv("PRICING_FILE"); pricingFile != "" {
+		c.PricingFile = pricingFile
+	}
+
+	if maxChoices := os.Getenv("MAX_CHOICES"); maxChoices != "" {
+		fmt.Sscanf(maxChoices, "%d", &c.MaxChoices)
+	}
+
+	if maxRequest := os.Getenv("MAX_REQUEST_BYTES"); maxRequest != "" {
+		fmt.Sscanf(maxRequest, "%d", &c.MaxRequestBytes)
+	}
+
+	if maxResponse := os.Getenv("MAX_RESPONSE_BYTES"); maxResponse != "" {
+		fmt.Sscanf(maxResponse, "%d", &c.MaxResponseBytes)
+	}
+
+	if include := os.Getenv("ERROR_INCLUDE_UPSTREAM_BODY"); include != "" {
+		c.ErrorIncludeUpstreamBody = include == "true"
+	}
+
+	if limit := os.Getenv("ERROR_UPSTREAM_BODY_LIMIT"); limit != "" {
+		fmt.Sscanf(limit, "%d", &c.ErrorUpstreamBodyLimit)
+	}
+
+	if forward := os.Getenv("FORWARD_CLIENT_IP"); forward != "" {
+		c.ForwardClientIP = forward == "true"
+	}
+
+	if trusted := os.Getenv("TRUSTED_PROXIES"); trusted != "" {
+		c.TrustedProxies = trusted
+	}
+
+	if allowed := os.Getenv("ALLOWED_MODELS"); allowed != "" {
+		c.AllowedModels = allowed
+	}
+
+	if blocked := os.Getenv("BLOCKED_MODELS"); blocked != "" {
+		c.BlockedModels = blocked
+	}
+
+	if autoPull := os.Getenv("AUTO_PULL"); autoPull != "" {
+		c.AutoPull = autoPull == "true"
+	}
+
+	if helper := os.Getenv("MAC_COLLECT_HELPER"); helper != "" {
+		c.MacCollectHelper = helper == "true"
+	}
+
+	if gpu := os.Getenv("MAC_COLLECT_GPU"); gpu != "" {
+		c.MacCollectGPU = gpu == "true"
+	}
+
+	if temp := os.Getenv("MAC_COLLECT_TEMP"); temp != "" {
+		c.MacCollectTemp = temp == "true"
+	}
+
+	if pressure := os.Getenv("MAC_COLLECT_MEMORY_PRESSURE"); pressure != "" {
+		c.MacCollectMemoryPressure = pressure == "true"
+	}
+
+	if diskIO := os.Getenv("MAC_COLLECT_DISKIO"); diskIO != "" {
+		c.MacCollectDiskIO = diskIO == "true"
+	}
+
+	if device := os.Getenv("MAC_DISK_DEVICE"); device != "" {
+		c.MacDiskDevice = device
+	}
+
+	if interval := os.Getenv("SYSTEM_METRICS_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			c.SystemMetricsInterval = d
+		}
+	}
+
+	if topN := os.Getenv("RUNNER_MEMORY_TOP_N"); topN != "" {
+		fmt.Sscanf(topN, "%d", &c.RunnerMemoryTopN)
+	}
+
+	if tokens := os.Getenv("MIN_RATE_TOKENS"); tokens != "" {
+		fmt.Sscanf(tokens, "%d", &c.MinRateTokens)
+	}
+
+	if limit := os.Getenv("READY_MAX_IN_FLIGHT"); limit != "" {
+		fmt.Sscanf(limit, "%d", &c.ReadyMaxInFlight)
+	}
+
+	if fanOut := os.Getenv("STREAM_FANOUT"); fanOut != "" {
+		c.StreamFanOut = fanOut == "true"
+	}
+
+	if file := os.Getenv("CONTENT_FILTER_FILE"); file != "" {
+		c.ContentFilterFile = file
+	}
+
+	if action := os.Getenv("CONTENT_FILTER_RESPONSE"); action != "" {
+		c.ContentFilterResponse = action
+	}
+
+	if limit := os.Getenv("MAX_QUEUED_PER_USER"); limit != "" {
+		fmt.Sscanf(limit, "%d", &c.MaxQueuedPerUser)
+	}
+
+	if limits := os.Getenv("USER_QUEUE_LIMITS"); limits != "" {
+		c.UserQueueLimits = limits
+	}
 }
 
 // Validate checks if the configuration is valid
@@ -80,6 +603,18 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid Ollama port: %d", c.OllamaPort)
 	}
 
+	for _, host := range splitList(c.OllamaHosts) {
+		if _, err := backendURL(host, c.OllamaPort); err != nil {
+			return err
+		}
+	}
+
+	switch c.LoadBalanceStrategy {
+	case "round-robin", "least-active":
+	default:
+		return fmt.Errorf("invalid load balance strategy: %q (must be round-robin or least-active)", c.LoadBalanceStrategy)
+	}
+
 	if c.ProxyPort <= 0 || c.ProxyPort > 65535 {
 		return fmt.Errorf("invalid proxy port: %d", c.ProxyPort)
 	}
@@ -88,6 +623,128 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid metrics port: %d", c.MetricsPort)
 	}
 
+	if c.RequestLogSize <= 0 {
+		return fmt.Errorf("request log size must be positive: %d", c.RequestLogSize)
+	}
+
+	if c.UpstreamTimeout <= 0 {
+		return fmt.Errorf("upstream timeout must be positive: %v", c.UpstreamTimeout)
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("shutdown timeout must be positive: %v", c.ShutdownTimeout)
+	}
+
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("max retries cannot be negative: %d", c.MaxRetries)
+	}
+
+	if c.RetryBackoff < 0 {
+		return fmt.Errorf("retry backoff cannot be negative: %v", c.RetryBackoff)
+	}
+
+	if c.CircuitErrorThreshold < 0 || c.CircuitErrorThreshold > 1 {
+		return fmt.Errorf("circuit error threshold must be between 0 and 1: %v", c.CircuitErrorThreshold)
+	}
+
+	if c.CircuitErrorThreshold > 0 {
+		if c.CircuitMinRequests < 1 {
+			return fmt.Errorf("circuit min requests must be positive: %d", c.CircuitMinRequests)
+		}
+		if c.CircuitWindow < time.Second {
+			return fmt.Errorf("circuit window must be at least 1s: %v", c.CircuitWindow)
+		}
+		if c.CircuitCooldown <= 0 {
+			return fmt.Errorf("circuit cooldown must be positive: %v", c.CircuitCooldown)
+		}
+	}
+
+	if c.SystemMetricsInterval < time.Second {
+		return fmt.Errorf("system metrics interval must be at least 1s: %v", c.SystemMetricsInterval)
+	}
+
+	if c.RunnerMemoryTopN < 0 {
+		return fmt.Errorf("runner memory top N cannot be negative: %d", c.RunnerMemoryTopN)
+	}
+
+	if c.QueueStallTimeout < 0 {
+		return fmt.Errorf("queue stall timeout cannot be negative: %v", c.QueueStallTimeout)
+	}
+
+	if c.QueueMaxWait < 0 {
+		return fmt.Errorf("queue max wait cannot be negative: %v", c.QueueMaxWait)
+	}
+
+	if c.QueueAgingInterval < 0 {
+		return fmt.Errorf("queue aging interval cannot be negative: %v", c.QueueAgingInterval)
+	}
+
+	if c.WorkerStuckThreshold < 0 {
+		return fmt.Errorf("worker stuck threshold cannot be negative: %v", c.WorkerStuckThreshold)
+	}
+
+	if c.EmbeddingBatchSize <= 0 {
+		return fmt.Errorf("embedding batch size must be positive: %d", c.EmbeddingBatchSize)
+	}
+
+	if c.EmbeddingConcurrency <= 0 {
+		return fmt.Errorf("embedding concurrency must be positive: %d", c.EmbeddingConcurrency)
+	}
+
+	if c.MinRateTokens < 0 {
+		return fmt.Errorf("min rate tokens cannot be negative: %d", c.MinRateTokens)
+	}
+
+	if c.ReadyMaxInFlight < 0 {
+		return fmt.Errorf("ready max in-flight cannot be negative: %d", c.ReadyMaxInFlight)
+	}
+
+	switch c.ContentFilterResponse {
+	case "off", "redact", "block":
+	default:
+		return fmt.Errorf("invalid content filter response action: %s", c.ContentFilterResponse)
+	}
+
+	if c.MaxChoices < 1 {
+		return fmt.Errorf("max choices must be at least 1: %d", c.MaxChoices)
+	}
+
+	if c.MaxRequestBytes < 0 {
+		return fmt.Errorf("max request bytes cannot be negative: %d", c.MaxRequestBytes)
+	}
+
+	if c.MaxResponseBytes < 0 {
+		return fmt.Errorf("max response bytes cannot be negative: %d", c.MaxResponseBytes)
+	}
+
+	if c.ErrorUpstreamBodyLimit <= 0 {
+		return fmt.Errorf("error upstream body limit must be positive: %d", c.ErrorUpstreamBodyLimit)
+	}
+
+	if c.MaxModelLoads < 0 {
+		return fmt.Errorf("max model loads cannot be negative: %d", c.MaxModelLoads)
+	}
+
+	switch c.DuplicateRequestID {
+	case "regenerate", "reject":
+	default:
+		return fmt.Errorf("invalid duplicate request ID action: %s", c.DuplicateRequestID)
+	}
+
+	if c.MaxQueuedPerUser < 0 {
+		return fmt.Errorf("max queued per user cannot be negative: %d", c.MaxQueuedPerUser)
+	}
+
+	if _, err := c.ParsedUserQueueLimits(); err != nil {
+		return err
+	}
+
+	for _, tag := range c.ParsedStripTags() {
+		if strings.ContainsAny(tag, "<>/ ") {
+			return fmt.Errorf("invalid strip tag: %q", tag)
+		}
+	}
+
 	if c.ProxyPort == c.MetricsPort {
 		return fmt.Errorf("proxy port and metrics port cannot be the same")
 	}
@@ -95,7 +752,118 @@ func (c *Config) Validate() error {
 	return nil
 }
 
-// OllamaURL returns the full URL for the Ollama server
+// ParsedUserQueueLimits parses UserQueueLimits into a map of user to limit
+func (c *Config) ParsedUserQueueLimits() (map[string]int, error) {
+	limits := make(map[string]int)
+	if c.UserQueueLimits == "" {
+		return limits, nil
+	}
+
+	for _, entry := range strings.Split(c.UserQueueLimits, ",") {
+		user, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		limit, err := strconv.Atoi(value)
+		if !ok || user == "" || err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid user queue limit: %q", entry)
+		}
+		limits[user] = limit
+	}
+
+	return limits, nil
+}
+
+// ParsedStripTags returns the tag names in StripTags without angle brackets
+func (c *Config) ParsedStripTags() []string {
+	var tags []string
+	for _, entry := range strings.Split(c.StripTags, ",") {
+		tag := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(entry), "<"), ">")
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ParsedTrustedProxies returns the entries of TrustedProxies, or nil to
+// trust no proxies
+func (c *Config) ParsedTrustedProxies() []string {
+	return splitList(c.TrustedProxies)
+}
+
+// ParsedAllowedModels returns the entries of AllowedModels, or nil to allow
+// all models
+func (c *Config) ParsedAllowedModels() []string {
+	return splitList(c.AllowedModels)
+}
+
+// ParsedBlockedModels returns the entries of BlockedModels
+func (c *Config) ParsedBlockedModels() []string {
+	return splitList(c.BlockedModels)
+}
+
+// splitList returns the non-empty, trimmed entries of a comma-separated list
+func splitList(list string) []string {
+	var entries []string
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// DebugEndpointsEnabled reports whether debug-only endpoints are served
+func (c *Config) DebugEndpointsEnabled() bool {
+	return c.EnableDebugEndpoints || c.LogLevel == "debug"
+}
+
+// MetricLabels returns the constant labels added to every metric: env and
+// cluster, each only when set
+func (c *Config) MetricLabels() map[string]string {
+	labels := make(map[string]string)
+	if c.Environment != "" {
+		labels["env"] = c.Environment
+	}
+	if c.Cluster != "" {
+		labels["cluster"] = c.Cluster
+	}
+	return labels
+}
+
+// OllamaURL returns the full URL of the first Ollama backend, for requests
+// that must go to a single instance
 func (c *Config) OllamaURL() string {
-	return fmt.Sprintf("http://%s:%d", c.OllamaHost, c.OllamaPort)
-}
\ No newline at end of file
+	return c.OllamaURLs()[0]
+}
+
+// OllamaURLs returns the base URL of every Ollama backend: the entries of
+// OllamaHosts, or OllamaHost and OllamaPort when it is empty
+func (c *Config) OllamaURLs() []string {
+	var urls []string
+	for _, host := range splitList(c.OllamaHosts) {
+		if u, err := backendURL(host, c.OllamaPort); err == nil {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		urls = append(urls, fmt.Sprintf("http://%s:%d", c.OllamaHost, c.OllamaPort))
+	}
+	return urls
+}
+
+// backendURL turns an OllamaHosts entry into a base URL, adding the http
+// scheme and defaultPort when they are missing
+func backendURL(entry string, defaultPort int) (string, error) {
+	raw := entry
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid Ollama host: %q", entry)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), strconv.Itoa(defaultPort))
+	}
+	return u.Scheme + "://" + host, nil
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the subset of the shared config.yml the proxy reads. The
+// proxy section holds any Config field by its yaml name and takes precedence
+// over the shared sections.
+type fileConfig struct {
+	Server struct {
+		OllamaURL   string `yaml:"ollama_url"`
+		ProxyPort   int    `yaml:"proxy_port"`
+		MetricsPort int    `yaml:"metrics_port"`
+	} `yaml:"server"`
+	Monitoring struct {
+		MaxConcurrentRequests int `yaml:"max_concurrent_requests"`
+		MaxQueueSize          int `yaml:"max_queue_size"`
+	} `yaml:"monitoring"`
+	Proxy yaml.Node `yaml:"proxy"`
+}
+
+// Load builds the configuration with the precedence defaults < config file <
+// environment < flags. The file is named by -config or CONFIG_FILE; without
+// either, no file is read.
+func Load() (*Config, error) {
+	c := DefaultConfig()
+
+	if path := configFilePath(os.Args[1:]); path != "" {
+		if err := c.LoadFromFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	c.LoadFromEnv()
+	c.LoadFromFlags()
+	c.recordEnvSources()
+	c.recordFlagSources()
+
+	return c, nil
+}
+
+// LoadFromFile loads the server, monitoring and proxy sections of a YAML
+// config file. Keys missing from the file leave the current values unchanged.
+func (c *Config) LoadFromFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var f fileConfig
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err == nil {
+		c.checkFileKeys(raw)
+	}
+
+	if f.Server.OllamaURL != "" {
+		u, err := url.Parse(f.Server.OllamaURL)
+		if err != nil || u.Hostname() == "" {
+			return fmt.Errorf("config file: invalid server.ollama_url %q", f.Server.OllamaURL)
+		}
+		c.OllamaHost = u.Hostname()
+		c.setSource("ollama-host", SourceFile)
+		if port := u.Port(); port != "" {
+			c.OllamaPort, _ = strconv.Atoi(port)
+			c.setSource("ollama-port", SourceFile)
+		}
+	}
+	if f.Server.ProxyPort != 0 {
+		c.ProxyPort = f.Server.ProxyPort
+		c.setSource("proxy-port", SourceFile)
+	}
+	if f.Server.MetricsPort != 0 {
+		c.MetricsPort = f.Server.MetricsPort
+		c.setSource("metrics-port", SourceFile)
+	}
+	if f.Monitoring.MaxConcurrentRequests != 0 {
+		c.MaxConcurrency = f.Monitoring.MaxConcurrentRequests
+		c.setSource("max-concurrency", SourceFile)
+	}
+	if f.Monitoring.MaxQueueSize != 0 {
+		c.MaxQueueSize = f.Monitoring.MaxQueueSize
+		c.setSource("max-queue-size", SourceFile)
+	}
+
+	if f.Proxy.Kind != 0 {
+		if err := f.Proxy.Decode(c); err != nil {
+			return fmt.Errorf("config file: invalid proxy section: %w", err)
+		}
+		c.recordProxySectionKeys(&f.Proxy)
+	}
+
+	return nil
+}
+
+// configFilePath finds the config file before flags are parsed, since the
+// file has to be applied underneath the environment and the other flags
+func configFilePath(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+		if value, ok := strings.CutPrefix(name, "config="); ok {
+			return value
+		}
+		if name == "config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return os.Getenv("CONFIG_FILE")
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const precedenceFile = `server:
+  proxy_port: 7001
+  metrics_port: 7101
+monitoring:
+  max_queue_size: 300
+  max_concurrent_requests: 6
+`
+
+// writeConfigFile writes contents to a config file in a temp dir and
+// returns its path
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+	return path
+}
+
+// clearEnv unsets the environment variables the tests below read, so the
+// caller's environment can't leak into them
+func clearEnv(t *testing.T) {
+	for _, name := range []string{"CONFIG_FILE", "PROXY_PORT", "METRICS_PORT", "MAX_QUEUE_SIZE", "MAX_CONCURRENCY", "REQUEST_LOG_SIZE"} {
+		t.Setenv(name, "")
+	}
+}
+
+// loadWithArgs runs Load with args as the command line, on a fresh flag set
+// so each call can register the flags again
+func loadWithArgs(t *testing.T, args ...string) *Config {
+	t.Helper()
+	savedArgs, savedFlags := os.Args, flag.CommandLine
+	t.Cleanup(func() {
+		os.Args, flag.CommandLine = savedArgs, savedFlags
+	})
+	os.Args = append([]string{"proxy"}, args...)
+	flag.CommandLine = flag.NewFlagSet("proxy", flag.ContinueOnError)
+
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load(%q): %v", args, err)
+	}
+	return c
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	path := writeConfigFile(t, precedenceFile)
+	t.Setenv("PROXY_PORT", "7002")
+	t.Setenv("METRICS_PORT", "7102")
+
+	c := loadWithArgs(t, "-config", path, "-proxy-port", "7003")
+
+	// Each setting comes from the highest-precedence source that sets it
+	for _, tc := range []struct {
+		name       string
+		got, want  int
+		wantSource string
+	}{
+		{"proxy-port", c.ProxyPort, 7003, SourceFlag},
+		{"metrics-port", c.MetricsPort, 7102, SourceEnv},
+		{"max-queue-size", c.MaxQueueSize, 300, SourceFile},
+		{"max-concurrency", c.MaxConcurrency, 6, SourceFile},
+		{"request-log-size", c.RequestLogSize, DefaultConfig().RequestLogSize, SourceDefault},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %d, want %d from the %s", tc.name, tc.got, tc.want, tc.wantSource)
+		}
+		if source := settingSource(c, tc.name); source != tc.wantSource {
+			t.Errorf("%s source = %q, want %q", tc.name, source, tc.wantSource)
+		}
+	}
+
+	warnings := c.Warnings()
+	if len(warnings) != 1 || warnings[0] != "-proxy-port overrides the value from PROXY_PORT" {
+		t.Errorf("warnings = %q, want one about -proxy-port overriding PROXY_PORT", warnings)
+	}
+}
+
+func TestLoadConfigFlagForms(t *testing.T) {
+	clearEnv(t)
+	path := writeConfigFile(t, precedenceFile)
+	for _, tc := range []struct {
+		name string
+		args []string
+	}{
+		{"separate value", []string{"-config", path}},
+		{"equals", []string{"-config=" + path}},
+		{"double dash separate value", []string{"--config", path}},
+		{"double dash equals", []string{"--config=" + path}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := loadWithArgs(t, tc.args...)
+			if c.ProxyPort != 7001 || c.MaxQueueSize != 300 {
+				t.Errorf("proxy-port %d, max-queue-size %d; want 7001 and 300 from the file", c.ProxyPort, c.MaxQueueSize)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, precedenceFile))
+
+	c := loadWithArgs(t)
+	if c.ProxyPort != 7001 {
+		t.Errorf("proxy-port = %d, want 7001 from the CONFIG_FILE file", c.ProxyPort)
+	}
+
+	// -config names a different file than CONFIG_FILE and wins
+	other := writeConfigFile(t, "server:\n  proxy_port: 7201\n")
+	if c := loadWithArgs(t, "-config", other); c.ProxyPort != 7201 {
+		t.Errorf("proxy-port = %d, want 7201 from the -config file", c.ProxyPort)
+	}
+}
+
+func TestLoadWithoutConfigFile(t *testing.T) {
+	clearEnv(t)
+	c := loadWithArgs(t)
+	defaults := DefaultConfig()
+	if c.ProxyPort != defaults.ProxyPort || c.MaxQueueSize != defaults.MaxQueueSize {
+		t.Errorf("proxy-port %d, max-queue-size %d; want the defaults %d and %d",
+			c.ProxyPort, c.MaxQueueSize, defaults.ProxyPort, defaults.MaxQueueSize)
+	}
+}
+
+// settingSource returns where a setting came from, or SourceDefault when
+// Effective doesn't list it
+func settingSource(c *Config, name string) string {
+	for _, s := range c.Effective() {
+		if s.Name == name {
+			return s.Source
+		}
+	}
+	return SourceDefault
+}
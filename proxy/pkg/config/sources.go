@@ -0,0 +1,171 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of a setting, from lowest to highest precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Setting is one configuration value together with where it came from
+type Setting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// ignoredFileKeys are config.yml keys other services read but the proxy
+// does not, with a hint about what to use instead
+var ignoredFileKeys = map[string]string{
+	"server.proxy_host":                "the proxy listens on all interfaces",
+	"server.metrics_host":              "the metrics server listens on all interfaces",
+	"monitoring.request_timeout":       "set UPSTREAM_TIMEOUT",
+	"monitoring.rate_limit_per_minute": "use rate_limit in API_KEYS_FILE",
+}
+
+// ignoredEnv are environment variables operators commonly set that the
+// proxy does not read, with the variable it reads instead
+var ignoredEnv = map[string]string{
+	"OLLAMA_PROXY_PORT":       "PROXY_PORT",
+	"OLLAMA_METRICS_PORT":     "METRICS_PORT",
+	"OLLAMA_URL":              "OLLAMA_HOST and OLLAMA_PORT, or OLLAMA_HOSTS",
+	"MAX_CONCURRENT_REQUESTS": "MAX_CONCURRENCY",
+}
+
+// secretSettings are never printed
+var secretSettings = map[string]bool{
+	"admin-token": true,
+}
+
+// envName returns the environment variable read for a flag
+func envName(flagName string) string {
+	return strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+func (c *Config) setSource(name, source string) {
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	c.sources[name] = source
+}
+
+func (c *Config) warnf(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// checkFileKeys warns about keys in the proxy's config file sections that
+// the proxy doesn't read
+func (c *Config) checkFileKeys(raw map[string]interface{}) {
+	var keys []string
+	for section, values := range raw {
+		if values, ok := values.(map[string]interface{}); ok {
+			for key := range values {
+				keys = append(keys, section+"."+key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if hint, ok := ignoredFileKeys[key]; ok {
+			c.warnf("config file key %s is ignored by the proxy: %s", key, hint)
+		}
+	}
+}
+
+// recordProxySectionKeys marks the settings given in the config file's proxy
+// section and warns about keys that match no setting
+func (c *Config) recordProxySectionKeys(section *yaml.Node) {
+	known := make(map[string]bool)
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		if tag := configType.Field(i).Tag.Get("yaml"); tag != "" {
+			known[tag] = true
+		}
+	}
+
+	// A mapping node's content alternates keys and values
+	for i := 0; i+1 < len(section.Content); i += 2 {
+		key := section.Content[i].Value
+		if !known[key] {
+			c.warnf("config file key proxy.%s is not a proxy setting", key)
+			continue
+		}
+		c.setSource(strings.ReplaceAll(key, "_", "-"), SourceFile)
+	}
+}
+
+// recordEnvSources marks the settings taken from the environment and warns
+// about variables the proxy doesn't read
+func (c *Config) recordEnvSources() {
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name != "config" && os.Getenv(envName(f.Name)) != "" {
+			c.setSource(f.Name, SourceEnv)
+		}
+	})
+
+	names := make([]string, 0, len(ignoredEnv))
+	for name := range ignoredEnv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if os.Getenv(name) != "" {
+			c.warnf("%s is not read by the proxy; set %s instead", name, ignoredEnv[name])
+		}
+	}
+}
+
+// recordFlagSources marks the settings given as flags and warns when a flag
+// overrides a different value from the environment or config file. A flag's
+// DefValue is the value it was registered with, i.e. after file and env.
+func (c *Config) recordFlagSources() {
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		if previous := c.sources[f.Name]; previous != "" && f.Value.String() != f.DefValue {
+			from := "config file"
+			if previous == SourceEnv {
+				from = envName(f.Name)
+			}
+			c.warnf("-%s overrides the value from %s", f.Name, from)
+		}
+		c.setSource(f.Name, SourceFlag)
+	})
+}
+
+// Warnings returns settings that were ignored or overridden while loading
+func (c *Config) Warnings() []string {
+	return c.warnings
+}
+
+// Effective lists the settings that don't come from defaults, with their
+// source. Secrets are masked.
+func (c *Config) Effective() []Setting {
+	var settings []Setting
+	flag.VisitAll(func(f *flag.Flag) {
+		source, ok := c.sources[f.Name]
+		if !ok {
+			return
+		}
+		value := f.Value.String()
+		if secretSettings[f.Name] {
+			value = "********"
+		}
+		settings = append(settings, Setting{Name: f.Name, Value: value, Source: source})
+	})
+	return settings
+}
@@ -0,0 +1,94 @@
+package ratelog
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLog sends the standard logger's output to a buffer for the rest of
+// the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	flags := log.Flags()
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+func logLines(buf *bytes.Buffer) []string {
+	return strings.Split(strings.TrimSpace(buf.String()), "\n")
+}
+
+func TestReportSuppressesRepeatsWithinInterval(t *testing.T) {
+	buf := captureLog(t)
+	l := New(time.Hour)
+	err := errors.New("iostat: exit status 1")
+
+	for i := 0; i < 5; i++ {
+		l.Report("collecting disk I/O", err)
+	}
+
+	lines := logLines(buf)
+	if len(lines) != 1 || lines[0] != "Error collecting disk I/O: iostat: exit status 1" {
+		t.Errorf("logged %q, want only the first failure", lines)
+	}
+}
+
+func TestReportSummarizesSuppressedRepeatsAfterInterval(t *testing.T) {
+	buf := captureLog(t)
+	interval := 50 * time.Millisecond
+	l := New(interval)
+	err := errors.New("timeout")
+
+	l.Report("collecting GPU metrics", err)
+	for i := 0; i < 3; i++ {
+		l.Report("collecting GPU metrics", err)
+	}
+	time.Sleep(interval + 10*time.Millisecond)
+	l.Report("collecting GPU metrics", err)
+
+	lines := logLines(buf)
+	want := []string{
+		"Error collecting GPU metrics: timeout",
+		"Error collecting GPU metrics: timeout (still failing, 3 similar errors suppressed)",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("logged %q, want %q", lines, want)
+	}
+}
+
+func TestReportLogsRecoveryOnce(t *testing.T) {
+	buf := captureLog(t)
+	l := New(time.Hour)
+
+	l.Report("collecting disk I/O", errors.New("boom"))
+	l.Report("collecting disk I/O", errors.New("boom"))
+	l.Report("collecting disk I/O", nil)
+	l.Report("collecting disk I/O", nil)
+
+	lines := logLines(buf)
+	if len(lines) != 2 || lines[1] != "Recovered collecting disk I/O after 2 failures" {
+		t.Errorf("logged %q, want the failure and one recovery line", lines)
+	}
+}
+
+func TestReportTracksKeysSeparately(t *testing.T) {
+	buf := captureLog(t)
+	l := New(time.Hour)
+
+	l.Report("collecting disk I/O", errors.New("a"))
+	l.Report("collecting GPU metrics", errors.New("b"))
+
+	if lines := logLines(buf); len(lines) != 2 {
+		t.Errorf("logged %q, want the first failure of each key", lines)
+	}
+}
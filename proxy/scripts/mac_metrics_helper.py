@@ -18,7 +18,7 @@ logger = logging.getLogger(__name__)
 
 app = Flask(__name__)
 
-# Global metrics storage
+# Global metrics storage; power is in milliwatts, as powermetrics reports it
 metrics = {
     'gpu_utilization': 0.0,
     'gpu_power': 0.0,